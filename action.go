@@ -16,7 +16,7 @@ import (
 	"github.com/shurcooL/users"
 )
 
-func initAction(code *code.Service, users users.Service) {
+func initAction(code *code.Service, external *code.ExternalRegistry, users users.Service) {
 	// "Create a New Repo" action.
 	http.Handle("/action/new-repo", cookieAuth{httputil.ErrorHandler(users, func(w http.ResponseWriter, req *http.Request) error {
 		if err := httputil.AllowMethods(req, http.MethodGet, http.MethodPost); err != nil {
@@ -55,6 +55,105 @@ func initAction(code *code.Service, users users.Service) {
 			panic("unreachable")
 		}
 	})})
+
+	// "Create a New Mirror" action.
+	http.Handle("/action/new-mirror", cookieAuth{httputil.ErrorHandler(users, func(w http.ResponseWriter, req *http.Request) error {
+		if err := httputil.AllowMethods(req, http.MethodGet, http.MethodPost); err != nil {
+			return err
+		}
+		switch req.Method {
+		case http.MethodGet:
+			if user, err := users.GetAuthenticated(req.Context()); err != nil {
+				return err
+			} else if !user.SiteAdmin {
+				return os.ErrPermission
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			httpgzip.ServeContent(w, req, "", time.Time{}, strings.NewReader(newMirrorHTML))
+			return nil
+		case http.MethodPost:
+			if err := req.ParseForm(); err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			repoSpec, err := getSingleValue(req.Form, "spec")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			upstreamURL, err := getSingleValue(req.Form, "upstream")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+
+			createMirrorError := code.CreateMirror(req.Context(), repoSpec, upstreamURL)
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintf(io.MultiWriter(os.Stdout, w), "creating new mirror: spec=%q upstream=%q: err=%v\n", repoSpec, upstreamURL, createMirrorError)
+
+			return nil
+		default:
+			panic("unreachable")
+		}
+	})})
+
+	// "Add an External Repo" action.
+	http.Handle("/action/new-external-repo", cookieAuth{httputil.ErrorHandler(users, func(w http.ResponseWriter, req *http.Request) error {
+		if err := httputil.AllowMethods(req, http.MethodGet, http.MethodPost); err != nil {
+			return err
+		}
+		switch req.Method {
+		case http.MethodGet:
+			if user, err := users.GetAuthenticated(req.Context()); err != nil {
+				return err
+			} else if !user.SiteAdmin {
+				return os.ErrPermission
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			httpgzip.ServeContent(w, req, "", time.Time{}, strings.NewReader(newExternalRepoHTML))
+			return nil
+		case http.MethodPost:
+			if err := req.ParseForm(); err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			repoRoot, err := getSingleValue(req.Form, "root")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+
+			addRepoError := external.AddRepo(req.Context(), repoRoot)
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintf(io.MultiWriter(os.Stdout, w), "adding external repo: root=%q: err=%v\n", repoRoot, addRepoError)
+
+			return nil
+		default:
+			panic("unreachable")
+		}
+	})})
+
+	// "Fetch Mirror" action.
+	http.Handle("/action/fetch-mirror", cookieAuth{httputil.ErrorHandler(users, func(w http.ResponseWriter, req *http.Request) error {
+		if err := httputil.AllowMethods(req, http.MethodPost); err != nil {
+			return err
+		}
+		if user, err := users.GetAuthenticated(req.Context()); err != nil {
+			return err
+		} else if !user.SiteAdmin {
+			return os.ErrPermission
+		}
+		if err := req.ParseForm(); err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		repoSpec, err := getSingleValue(req.PostForm, "spec")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		added, removed, err := code.FetchMirror(req.Context(), repoSpec)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("fetched mirror: spec=%q: %d packages added, %d removed\n", repoSpec, len(added), len(removed))
+		return httperror.Redirect{URL: sanitizeReturn(req.PostFormValue(returnParameterName)).String()}
+	})})
 }
 
 const newRepoHTML = `<!DOCTYPE html>
@@ -89,6 +188,67 @@ body, input {
 </html>
 `
 
+const newMirrorHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<title>Dmitri Shuralyov</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+body, input {
+	font-family: Go;
+}
+.wide {
+	width: 100%;
+	box-sizing: border-box;
+}
+		</style>
+	</head>
+	<body>
+		<form method="post" action="/action/new-mirror">
+			<h1>Create a New Mirror</h1>
+			Repo Spec<br>
+			<input class="wide" name="spec" type="text" value="dmitri.shuralyov.com/"><br>
+			<br>
+			Upstream URL<br>
+			<input class="wide" name="upstream" type="text" placeholder="https://github.com/user/repo"><br>
+			<br>
+			<input type="submit" value="Create">
+		</form>
+	</body>
+</html>
+`
+
+const newExternalRepoHTML = `<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<title>Dmitri Shuralyov</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+body, input {
+	font-family: Go;
+}
+.wide {
+	width: 100%;
+	box-sizing: border-box;
+}
+		</style>
+	</head>
+	<body>
+		<form method="post" action="/action/new-external-repo">
+			<h1>Add an External Repo</h1>
+			Repo Root<br>
+			<input class="wide" name="root" type="text" value="github.com/"><br>
+			<br>
+			<input type="submit" value="Add">
+		</form>
+	</body>
+</html>
+`
+
 // getSingleValue returns the single value for key in form,
 // or an error if there isn't exactly a single value.
 func getSingleValue(form url.Values, key string) (string, error) {
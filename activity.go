@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	statepkg "dmitri.shuralyov.com/state"
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// activityOptions returns options for listing a page of activity
+// as specified by the "before", "beforeid" and "type" query parameters.
+func activityOptions(query url.Values) (activitypkg.ListOptions, error) {
+	var opt activitypkg.ListOptions
+	if before := query.Get("before"); before != "" {
+		t, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			return activitypkg.ListOptions{}, fmt.Errorf("bad before query parameter: %v", err)
+		}
+		opt.Before = t
+		opt.BeforeID = query.Get("beforeid")
+	}
+	opt.PayloadType = query.Get("type")
+	return opt, nil
+}
+
+// activityTypes are payload types that activity can be filtered by.
+var activityTypes = []struct {
+	Type string // Payload type, as returned by activity.PayloadType.
+	Text string
+}{
+	{"", "All"},
+	{"push", "Pushes"},
+	{"issue", "Issues"},
+	{"change", "Changes"},
+	{"create", "Created"},
+}
+
+// activityFilter displays links for filtering activity by payload type.
+type activityFilter struct {
+	URL *url.URL // URL of current activity page.
+}
+
+func (f activityFilter) Render() []*html.Node {
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "font-size: 14px; margin-bottom: 20px;"}},
+	}
+	selected := f.URL.Query().Get("type")
+	for i, t := range activityTypes {
+		if i > 0 {
+			div.AppendChild(htmlg.Text(" · "))
+		}
+		if t.Type == selected {
+			div.AppendChild(htmlg.Strong(t.Text))
+			continue
+		}
+		q := f.URL.Query()
+		q.Del("before")
+		q.Del("beforeid")
+		if t.Type == "" {
+			q.Del("type")
+		} else {
+			q.Set("type", t.Type)
+		}
+		div.AppendChild(htmlg.A(t.Text, (&url.URL{Path: f.URL.Path, RawQuery: q.Encode()}).String()))
+	}
+	return []*html.Node{div}
+}
+
+// olderActivity displays a link to older activity. If the current page
+// is the last one, it displays a note if older activity wasn't retained,
+// or nothing otherwise.
+type olderActivity struct {
+	URL    *url.URL      // URL of current activity page.
+	Events []event.Event // Events on current page.
+
+	// RetainedSince is the time of the oldest retained event,
+	// or the zero time if no events have been dropped.
+	// See activitypkg.Retainer.
+	RetainedSince time.Time
+}
+
+func (o olderActivity) Render() []*html.Node {
+	// A partial page means there's no more activity, and there's
+	// no point in linking past the oldest retained event.
+	last := len(o.Events) < activitypkg.DefaultLimit ||
+		(!o.RetainedSince.IsZero() && !o.Events[len(o.Events)-1].Time.After(o.RetainedSince))
+	switch {
+	case last && o.RetainedSince.IsZero():
+		return nil
+	case last:
+		note := htmlg.Text(fmt.Sprintf("Older activity, from before %s, isn't retained.", o.RetainedSince.Local().Format("Jan 2, 2006")))
+		return []*html.Node{htmlg.DivClass("older", note)}
+	}
+	q := o.URL.Query()
+	oldest := o.Events[len(o.Events)-1]
+	q.Set("before", oldest.Time.Format(time.RFC3339Nano))
+	q.Set("beforeid", activitypkg.EventID(oldest))
+	a := htmlg.A("Older", (&url.URL{Path: o.URL.Path, RawQuery: q.Encode()}).String())
+	return []*html.Node{htmlg.DivClass("older", a)}
+}
+
+// retainedSince returns the time since which events listed by l are
+// retained, or the zero time if l doesn't drop old events.
+func retainedSince(ctx context.Context, l activitypkg.Lister) time.Time {
+	r, ok := l.(activitypkg.Retainer)
+	if !ok {
+		return time.Time{}
+	}
+	t, err := r.RetainedSince(ctx)
+	if err != nil {
+		log.Println("RetainedSince:", err)
+	}
+	return t
+}
+
+// repositoryActivityHandler is a handler for displaying activity in a repository.
+type repositoryActivityHandler struct {
+	Repo repoInfo
+
+	events       activitypkg.Lister
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+}
+
+var repositoryActivityHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>Repository {{.Name}} - Activity</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/index/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+func (h *repositoryActivityHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+	opt, err := activityOptions(req.URL.Query())
+	if err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	opt.ImportPath = h.Repo.Spec
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	openIssues, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	openChanges, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+
+	events, eventsError := h.events.ListEvents(req.Context(), opt)
+	var error string
+	if eventsError != nil {
+		error = "There was a problem getting activity."
+		if authenticatedUser.SiteAdmin {
+			error += "\n\n" + eventsError.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = repositoryActivityHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		Name          string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		Name:          path.Base(h.Repo.Spec),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := component.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, component.RepositoryTabNav(component.ActivityTab, h.Repo.Path, h.Repo.Packages, openIssues, openChanges))
+	if err != nil {
+		return err
+	}
+
+	activity := activity{
+		Events:  events,
+		Error:   error,
+		ShowWIP: authenticatedUser.UserSpec == dmitshur,
+	}
+	activity.ShowRaw, _ = strconv.ParseBool(req.URL.Query().Get("raw"))
+	err = htmlg.RenderComponents(w,
+		activityFilter{URL: req.URL},
+		activity,
+		olderActivity{URL: req.URL, Events: events, RetainedSince: retainedSince(req.Context(), h.events)},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>`)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</body></html>`)
+	return err
+}
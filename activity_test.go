@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/events/event"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
+	"github.com/shurcooL/htmlg"
+)
+
+// Test that the link to older activity isn't displayed
+// past the oldest retained event.
+func TestOlderActivity(t *testing.T) {
+	page := func(oldest time.Time) []event.Event {
+		events := make([]event.Event, activitypkg.DefaultLimit)
+		for i := range events {
+			events[i] = event.Event{Time: oldest.Add(time.Duration(len(events)-1-i) * time.Minute), Payload: event.Star{}}
+		}
+		return events
+	}
+	oldest := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	for _, tt := range [...]struct {
+		name          string
+		events        []event.Event
+		retainedSince time.Time
+		want          string // Substring of rendered HTML, or empty if nothing is rendered.
+	}{
+		{name: "partial page", events: page(oldest)[:3], want: ""},
+		{name: "full page", events: page(oldest), want: `<a href="/?before=`},
+		{name: "full page retained", events: page(oldest), retainedSince: oldest.Add(-time.Hour), want: `<a href="/?before=`},
+		{name: "oldest retained", events: page(oldest), retainedSince: oldest, want: "isn&#39;t retained"},
+		{name: "partial page retained", events: page(oldest)[:3], retainedSince: oldest, want: "isn&#39;t retained"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			o := olderActivity{URL: &url.URL{Path: "/"}, Events: tt.events, RetainedSince: tt.retainedSince}
+			got := htmlg.RenderComponentsString(o)
+			if tt.want == "" && got != "" {
+				t.Errorf("got %q, want nothing rendered", got)
+			} else if !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+// packageDocHTML renders full API documentation of a package.
+var packageDocHTML = template.Must(template.New("").Funcs(template.FuncMap{
+	"html":      func(s string) template.HTML { return template.HTML(s) },
+	"sourceURL": sourceURL,
+	"fn": func(importPath string, f code.Func) interface{} {
+		return struct {
+			ImportPath string
+			Func       code.Func
+		}{importPath, f}
+	},
+}).Parse(`
+{{- define "Index" -}}
+<h3 id="pkg-index">Index</h3>
+<ul class="doc-index">
+{{- if .Doc.Consts}}<li><a href="#pkg-constants">Constants</a></li>{{end -}}
+{{- if .Doc.Vars}}<li><a href="#pkg-variables">Variables</a></li>{{end -}}
+{{- range .Doc.Funcs}}<li><a href="#{{.ID}}">func {{.Name}}</a></li>{{end -}}
+{{- range .Doc.Types}}<li><a href="#{{.Name}}">type {{.Name}}</a>
+	{{- if or .Funcs .Methods}}<ul>
+	{{- range .Funcs}}<li><a href="#{{.ID}}">func {{.Name}}</a></li>{{end -}}
+	{{- range .Methods}}<li><a href="#{{.ID}}">func ({{.Recv}}) {{.Name}}</a></li>{{end -}}
+	</ul>{{end -}}
+</li>{{end -}}
+</ul>
+{{- end -}}
+
+{{- define "Values" -}}
+{{- range .}}<pre>{{html .DeclHTML}}</pre>{{html .DocHTML}}{{end -}}
+{{- end -}}
+
+{{- define "Func" -}}
+<h4 id="{{.Func.ID}}">func {{if .Func.Recv}}({{.Func.Recv}}) {{end}}<a href="{{sourceURL .ImportPath .Func.Pos}}">{{.Func.Name}}</a></h4>
+<pre>{{html .Func.DeclHTML}}</pre>{{html .Func.DocHTML -}}
+{{- range .Func.Examples}}{{template "Example" .}}{{end -}}
+{{- end -}}
+
+{{- define "Example" -}}
+<details class="doc-example"><summary>Example{{with .Suffix}} ({{.}}){{end}}</summary>
+{{- html .DocHTML -}}
+<p>Code:</p><pre>{{.Code}}</pre>
+{{- with .Output}}<p>Output:</p><pre>{{.}}</pre>{{end -}}
+{{- with .Play}}<details><summary>Runnable program</summary><pre>{{.}}</pre></details>{{end -}}
+</details>
+{{- end -}}
+
+{{- template "Index" . -}}
+{{- range .Doc.Examples}}{{template "Example" .}}{{end -}}
+{{- if .Doc.Consts}}<h3 id="pkg-constants">Constants</h3>{{template "Values" .Doc.Consts}}{{end -}}
+{{- if .Doc.Vars}}<h3 id="pkg-variables">Variables</h3>{{template "Values" .Doc.Vars}}{{end -}}
+{{- range .Doc.Funcs}}{{template "Func" (fn $.ImportPath .)}}{{end -}}
+{{- range .Doc.Types -}}
+<h3 id="{{.Name}}">type <a href="{{sourceURL $.ImportPath .Pos}}">{{.Name}}</a></h3>
+<pre>{{html .DeclHTML}}</pre>{{html .DocHTML -}}
+{{- range .Examples}}{{template "Example" .}}{{end -}}
+{{- template "Values" .Consts -}}
+{{- template "Values" .Vars -}}
+{{- range .Funcs}}{{template "Func" (fn $.ImportPath .)}}{{end -}}
+{{- range .Methods}}{{template "Func" (fn $.ImportPath .)}}{{end -}}
+{{- end -}}
+`))
+
+// renderPackageDoc renders full API documentation doc
+// of the package with the specified import path to w.
+func renderPackageDoc(w io.Writer, importPath string, doc *code.PackageDoc) error {
+	return packageDocHTML.Execute(w, struct {
+		ImportPath string
+		Doc        *code.PackageDoc
+	}{importPath, doc})
+}
+
+// sourceURL returns the URL of the source code at pos
+// in the package with the specified import path.
+func sourceURL(importPath string, pos code.Pos) string {
+	return fmt.Sprintf("https://gotools.org/%s#%s-L%d", importPath, pos.File, pos.Line)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// archiveFormats are the supported source archive formats,
+// keyed by file extension, with their content types.
+var archiveFormats = map[string]string{
+	"tar.gz": "application/gzip",
+	"zip":    "application/zip",
+}
+
+// archiveHandler is a handler for downloading source archives
+// of any revision of a git repository at "/{rev}.{format}".
+//
+// Generated archives are cached in CacheDir by commit and top-level
+// directory name, since the latter depends on the requested revision.
+// The cache is kept under maxArchiveCacheSize bytes by removing
+// the least recently served archives.
+type archiveHandler struct {
+	Repo     repoInfo
+	CacheDir string
+}
+
+func (h *archiveHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet, http.MethodHead); err != nil {
+		return err
+	}
+	rev, format, ok := parseArchivePath(req.URL.Path[1:])
+	if !ok {
+		return os.ErrNotExist
+	}
+	commit, err := resolveCommit(req.Context(), h.Repo.Dir, rev)
+	if err != nil {
+		return err
+	}
+
+	name := path.Base(h.Repo.Spec) + "-" + strings.Replace(rev, "/", "-", -1)
+	w.Header().Set("Content-Type", archiveFormats[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"."+format))
+	w.Header().Set("ETag", fmt.Sprintf(`"%s/%s.%s"`, commit, name, format))
+
+	cachePath := filepath.Join(h.CacheDir, filepath.FromSlash(h.Repo.Spec), commit, name+"."+format)
+	if f, err := os.Open(cachePath); err == nil {
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		// Mark the archive as recently served, so it's pruned last.
+		now := time.Now()
+		if err := os.Chtimes(cachePath, now, now); err != nil {
+			log.Println("archiveHandler: touching cached archive:", err)
+		}
+		http.ServeContent(w, req, "", fi.ModTime(), f)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if req.Method == http.MethodHead {
+		return nil
+	}
+
+	// Not in cache. Stream the output of git archive
+	// to the response while saving it to the cache.
+	err = os.MkdirAll(filepath.Dir(cachePath), 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(cachePath), filepath.Base(cachePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Not needed after successful rename, harmless then.
+	cmd := exec.CommandContext(req.Context(), "git", "archive",
+		"--format="+format,
+		"--prefix="+name+"/",
+		commit)
+	cmd.Dir = h.Repo.Dir
+	cmd.Stdout = io.MultiWriter(tmp, w)
+	err = cmd.Run()
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		// The response has likely been partially written,
+		// so there's no way to report the error to the client.
+		log.Printf("archiveHandler: %v: %v\n", cmd.Args, err)
+		return nil
+	}
+	err = os.Rename(tmp.Name(), cachePath)
+	if err != nil {
+		log.Println("archiveHandler: caching archive:", err)
+		return nil
+	}
+	err = pruneArchiveCache(h.CacheDir, maxArchiveCacheSize)
+	if err != nil {
+		log.Println("archiveHandler: pruning archive cache:", err)
+	}
+	return nil
+}
+
+// maxArchiveCacheSize is the maximum total size of cached archives, in bytes.
+const maxArchiveCacheSize = 1 << 30 // 1 GiB.
+
+// pruneArchiveMu serializes pruning of archive caches.
+var pruneArchiveMu sync.Mutex
+
+// pruneArchiveCache removes archives cached in dir, least recently
+// served first, until their total size is at most maxSize bytes.
+// Archives that are still being generated are left alone.
+func pruneArchiveCache(dir string, maxSize int64) error {
+	pruneArchiveMu.Lock()
+	defer pruneArchiveMu.Unlock()
+
+	type archive struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		archives []archive
+		total    int64
+	)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if _, _, ok := parseArchivePath(fi.Name()); !ok {
+			// Skip temporary files of archives being generated.
+			return nil
+		}
+		archives = append(archives, archive{path: path, size: fi.Size(), modTime: fi.ModTime()})
+		total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].modTime.Before(archives[j].modTime) })
+	for _, a := range archives {
+		if total <= maxSize {
+			break
+		}
+		err := os.Remove(a.path)
+		if err != nil {
+			return err
+		}
+		total -= a.size
+		os.Remove(filepath.Dir(a.path)) // Remove commit directory if it's now empty.
+	}
+	return nil
+}
+
+// parseArchivePath parses a "{rev}.{format}" archive path,
+// where format is one of archiveFormats.
+func parseArchivePath(p string) (rev, format string, ok bool) {
+	for ext := range archiveFormats {
+		if strings.HasSuffix(p, "."+ext) {
+			rev = p[:len(p)-len("."+ext)]
+			if rev == "" {
+				return "", "", false
+			}
+			return rev, ext, true
+		}
+	}
+	return "", "", false
+}
+
+// archiveLinks displays links for downloading source archives of a revision.
+type archiveLinks struct {
+	RepoPath string
+	Rev      string
+}
+
+func (a archiveLinks) Render() []*html.Node {
+	span := &html.Node{
+		Type: html.ElementNode, Data: atom.Span.String(),
+		Attr: []html.Attribute{{Key: atom.Class.String(), Val: "gray tiny"}},
+	}
+	span.AppendChild(htmlg.Text("Download "))
+	span.AppendChild(htmlg.A("tar.gz", route.RepoArchive(a.RepoPath)+"/"+a.Rev+".tar.gz"))
+	span.AppendChild(htmlg.Text(" · "))
+	span.AppendChild(htmlg.A("zip", route.RepoArchive(a.RepoPath)+"/"+a.Rev+".zip"))
+	return []*html.Node{span}
+}
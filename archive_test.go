@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseArchivePath(t *testing.T) {
+	for _, tt := range []struct {
+		path       string
+		wantRev    string
+		wantFormat string
+		wantOK     bool
+	}{
+		{"master.tar.gz", "master", "tar.gz", true},
+		{"v1.0.0.zip", "v1.0.0", "zip", true},
+		{"feature/sub.zip", "feature/sub", "zip", true},
+		{".zip", "", "", false},
+		{"master.tar", "", "", false},
+		{"master", "", "", false},
+	} {
+		rev, format, ok := parseArchivePath(tt.path)
+		if rev != tt.wantRev || format != tt.wantFormat || ok != tt.wantOK {
+			t.Errorf("parseArchivePath(%q): got (%q, %q, %v), want (%q, %q, %v)", tt.path, rev, format, ok, tt.wantRev, tt.wantFormat, tt.wantOK)
+		}
+	}
+}
+
+func TestPruneArchiveCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create archives of 10 bytes each, served at increasing times,
+	// and a temporary file of an archive being generated.
+	now := time.Now()
+	for i, name := range []string{
+		"repo/aaa/repo-master.zip",
+		"repo/bbb/repo-v1.0.0.zip",
+		"repo/bbb/repo-master.tar.gz",
+		"repo/ccc/repo-master.tar.gz.tmp123",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, make([]byte, 10), 0600); err != nil {
+			t.Fatal(err)
+		}
+		mt := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = pruneArchiveCache(dir, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, wantExist := range map[string]bool{
+		"repo/aaa":                           false,
+		"repo/bbb/repo-v1.0.0.zip":           false,
+		"repo/bbb/repo-master.tar.gz":        true,
+		"repo/ccc/repo-master.tar.gz.tmp123": true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if exist := err == nil; exist != wantExist {
+			t.Errorf("%s: exists = %v, want %v", name, exist, wantExist)
+		}
+	}
+}
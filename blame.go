@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	statepkg "dmitri.shuralyov.com/state"
+	homecomponent "github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	issuescomponent "github.com/shurcooL/issuesapp/component"
+	"github.com/shurcooL/octicon"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// blameHandler is a handler for displaying which commit last modified
+// each line of a file in a git repository, at "/{rev}/{path}".
+type blameHandler struct {
+	Repo repoInfo
+
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+	gitUsers     code.GitUsers
+}
+
+var blameHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>{{.FullName}} - Blame {{.Path}} at {{.Rev}}</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/commit/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+func (h *blameHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+	rev, file, ok := parseBlamePath(req.URL.Path[1:])
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	openIssues, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	openChanges, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+
+	commit, err := resolveCommit(req.Context(), h.Repo.Dir, rev)
+	if err != nil {
+		return err
+	}
+	hunks, err := blame(req.Context(), h.Repo.Dir, commit, file, h.gitUsers)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = blameHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		FullName      string
+		Path          string
+		Rev           string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		FullName:      "Repository " + path.Base(h.Repo.Spec),
+		Path:          file,
+		Rev:           rev,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, homecomponent.RepositoryTabNav(homecomponent.HistoryTab, h.Repo.Path, h.Repo.Packages, openIssues, openChanges))
+	if err != nil {
+		return err
+	}
+
+	err = htmlg.RenderComponents(w, blameFile{
+		RepoPath: h.Repo.Path,
+		Path:     file,
+		Commit:   commit,
+		Hunks:    hunks,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// parseBlamePath parses a "{rev}/{path}" blame path.
+// The revision is the first path element, so it can't contain slashes.
+// The file path must be clean and within the repository.
+func parseBlamePath(p string) (rev, file string, ok bool) {
+	i := strings.IndexByte(p, '/')
+	if i == -1 {
+		return "", "", false
+	}
+	rev, file = p[:i], p[i+1:]
+	if rev == "" || file == "" || path.Clean("/" + file)[1:] != file {
+		return "", "", false
+	}
+	return rev, file, true
+}
+
+// blameCommit is a commit that last modified some lines of a file.
+type blameCommit struct {
+	SHA        string
+	Subject    string
+	Author     users.User
+	AuthorTime time.Time
+
+	// PreviousSHA and PreviousPath identify the file
+	// in the parent commit, before it was modified.
+	// They're empty if the commit added the file.
+	PreviousSHA  string
+	PreviousPath string
+}
+
+// blameHunk is a run of consecutive lines of a file
+// that were last modified by the same commit.
+type blameHunk struct {
+	Commit    *blameCommit
+	StartLine int // Line number of the first line, 1-based.
+	Lines     []string
+}
+
+// blame returns the lines of file at commit in git repo at gitDir,
+// grouped by the commit that last modified them.
+// It returns os.ErrNotExist if there's no such file at commit.
+func blame(ctx context.Context, gitDir, commit, file string, gitUsers code.GitUsers) ([]blameHunk, error) {
+	cmd := exec.CommandContext(ctx, "git", "blame", "--porcelain", commit, "--", file)
+	cmd.Dir = gitDir
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	err := cmd.Run()
+	if ee, _ := err.(*exec.ExitError); ee != nil && ee.Sys().(syscall.WaitStatus).ExitStatus() == 128 {
+		return nil, os.ErrNotExist // File doesn't exist, or isn't a file.
+	} else if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return parseBlame(buf.Bytes(), gitUsers)
+}
+
+// parseBlame parses the output of git blame --porcelain.
+// Commit authors are mapped to users via gitUsers.
+func parseBlame(out []byte, gitUsers code.GitUsers) ([]blameHunk, error) {
+	if len(out) == 0 {
+		return nil, nil // Empty file.
+	}
+	var (
+		commits = make(map[string]*blameCommit)
+		hunks   []blameHunk
+		c       *blameCommit // Commit of the current line.
+		line    int          // Line number of the current line.
+	)
+	for _, l := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if strings.HasPrefix(l, "\t") {
+			// Line contents.
+			if c == nil {
+				return nil, fmt.Errorf("line contents %q without preceding header", l)
+			}
+			if n := len(hunks); n > 0 && hunks[n-1].Commit == c && hunks[n-1].StartLine+len(hunks[n-1].Lines) == line {
+				hunks[n-1].Lines = append(hunks[n-1].Lines, l[1:])
+			} else {
+				hunks = append(hunks, blameHunk{Commit: c, StartLine: line, Lines: []string{l[1:]}})
+			}
+			continue
+		}
+		key, value := l, ""
+		if i := strings.IndexByte(l, ' '); i != -1 {
+			key, value = l[:i], l[i+1:]
+		}
+		if _, err := verifyCommitHash(key); err == nil {
+			// Header of a line, "{sha} {orig line} {final line} [{lines in group}]".
+			f := strings.Fields(value)
+			if len(f) < 2 {
+				return nil, fmt.Errorf("unexpected line header %q", l)
+			}
+			var err error
+			line, err = strconv.Atoi(f[1])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected line header %q: %v", l, err)
+			}
+			c = commits[key]
+			if c == nil {
+				c = &blameCommit{SHA: key}
+				commits[key] = c
+			}
+			continue
+		} else if c == nil {
+			return nil, fmt.Errorf("unexpected line %q without preceding header", l)
+		}
+		switch key {
+		case "author":
+			c.Author.Name = value
+		case "author-mail":
+			c.Author.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected author time %q: %v", value, err)
+			}
+			c.AuthorTime = time.Unix(t, 0).UTC()
+		case "summary":
+			c.Subject = value
+		case "previous":
+			if i := strings.IndexByte(value, ' '); i != -1 {
+				c.PreviousSHA, c.PreviousPath = value[:i], value[i+1:]
+			}
+		}
+	}
+	for _, c := range commits {
+		if u, ok := gitUsers.GitUser(c.Author.Email); ok {
+			c.Author = u
+			continue
+		}
+		c.Author.AvatarURL = "https://secure.gravatar.com/avatar?d=mm&f=y&s=96" // TODO: Use email.
+	}
+	return hunks, nil
+}
+
+// blameURL returns the URL of the blame page of the file
+// at the slash-separated path file at revision rev.
+func blameURL(repoPath, rev, file string) string {
+	return route.RepoBlame(repoPath) + "/" + rev + "/" + (&url.URL{Path: file}).EscapedPath()
+}
+
+// blameFile displays the lines of a file at a commit,
+// grouped by the commit that last modified them.
+type blameFile struct {
+	RepoPath string
+	Path     string // Path of the file within the repository.
+	Commit   string // Commit hash of the blamed revision.
+	Hunks    []blameHunk
+}
+
+func (f blameFile) Render() []*html.Node {
+	header := htmlg.DivClass("list-entry-header",
+		htmlg.Text(f.Path+" at "),
+		htmlg.A(shortSHA(f.Commit), route.RepoCommit(f.RepoPath)+"/"+f.Commit),
+	)
+
+	if len(f.Hunks) == 0 {
+		body := htmlg.DivClass("list-entry-body", htmlg.Text("This file is empty."))
+		return []*html.Node{htmlg.DivClass("list-entry list-entry-border", header, body)}
+	}
+
+	table := &html.Node{
+		Type: html.ElementNode, Data: atom.Table.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "width: 100%; table-layout: fixed; border-collapse: collapse;"}},
+	}
+	for i, h := range f.Hunks {
+		tr := &html.Node{Type: html.ElementNode, Data: atom.Tr.String()}
+		if i > 0 {
+			tr.Attr = append(tr.Attr, html.Attribute{Key: atom.Style.String(), Val: "border-top: 1px solid #eee;"})
+		}
+		tr.AppendChild(f.commitCell(h.Commit))
+
+		var lineNumbers, lines string
+		for j, l := range h.Lines {
+			lineNumbers += strconv.Itoa(h.StartLine+j) + "\n"
+			lines += l + "\n"
+		}
+		tr.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.Td.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Class.String(), Val: "gray"},
+				{Key: atom.Style.String(), Val: "width: 40px; vertical-align: top; text-align: right; padding-right: 10px; white-space: pre;"},
+			},
+			FirstChild: htmlg.Text(lineNumbers),
+		})
+		tr.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.Td.String(),
+			Attr:       []html.Attribute{{Key: atom.Style.String(), Val: "vertical-align: top; white-space: pre-wrap; word-break: break-all;"}},
+			FirstChild: htmlg.Text(lines),
+		})
+		table.AppendChild(tr)
+	}
+	pre := &html.Node{
+		Type: html.ElementNode, Data: atom.Pre.String(),
+		Attr: []html.Attribute{{Key: atom.Class.String(), Val: "highlight"}},
+	}
+	pre.AppendChild(table)
+	body := htmlg.DivClass("list-entry-body", pre)
+
+	return []*html.Node{htmlg.DivClass("list-entry list-entry-border", header, body)}
+}
+
+// commitCell renders the table cell describing commit c,
+// with a link to blame the file prior to c, if it existed.
+func (f blameFile) commitCell(c *blameCommit) *html.Node {
+	td := &html.Node{
+		Type: html.ElementNode, Data: atom.Td.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "width: 220px; vertical-align: top; padding-right: 10px; font-family: Go, sans-serif; white-space: normal;"}},
+	}
+
+	title := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "display: flex;"}},
+	}
+	title.AppendChild(&html.Node{
+		Type: html.ElementNode, Data: atom.A.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Class.String(), Val: "black"},
+			{Key: atom.Href.String(), Val: route.RepoCommit(f.RepoPath) + "/" + c.SHA},
+			{Key: atom.Title.String(), Val: c.Subject},
+			{Key: atom.Style.String(), Val: "flex-grow: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap;"},
+		},
+		FirstChild: htmlg.Text(c.Subject),
+	})
+	if c.PreviousSHA != "" {
+		title.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.A.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Class.String(), Val: "gray"},
+				{Key: atom.Href.String(), Val: blameURL(f.RepoPath, c.PreviousSHA, c.PreviousPath)},
+				{Key: atom.Title.String(), Val: "Blame prior to this commit."},
+				{Key: atom.Style.String(), Val: "margin-left: 6px;"},
+			},
+			FirstChild: octicon.Versions(),
+		})
+	}
+	td.AppendChild(title)
+
+	byline := htmlg.DivClass("gray tiny")
+	htmlg.AppendChildren(byline, issuescomponent.Avatar{User: c.Author, Size: 16}.Render()...)
+	byline.AppendChild(htmlg.Text(" "))
+	htmlg.AppendChildren(byline, issuescomponent.User{User: c.Author}.Render()...)
+	byline.AppendChild(htmlg.Text(" committed "))
+	htmlg.AppendChildren(byline, issuescomponent.Time{Time: c.AuthorTime}.Render()...)
+	td.AppendChild(byline)
+
+	return td
+}
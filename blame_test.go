@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/users"
+)
+
+func TestParseBlamePath(t *testing.T) {
+	for _, tt := range []struct {
+		path     string
+		wantRev  string
+		wantFile string
+		wantOK   bool
+	}{
+		{"master/README.md", "master", "README.md", true},
+		{"v1.0.0/cmd/foo/main.go", "v1.0.0", "cmd/foo/main.go", true},
+		{"master", "", "", false},
+		{"master/", "", "", false},
+		{"/README.md", "", "", false},
+		{"master/../README.md", "", "", false},
+		{"master/cmd//main.go", "", "", false},
+		{"master/cmd/", "", "", false},
+	} {
+		rev, file, ok := parseBlamePath(tt.path)
+		if rev != tt.wantRev || file != tt.wantFile || ok != tt.wantOK {
+			t.Errorf("parseBlamePath(%q): got (%q, %q, %v), want (%q, %q, %v)", tt.path, rev, file, ok, tt.wantRev, tt.wantFile, tt.wantOK)
+		}
+	}
+}
+
+func TestBlameURL(t *testing.T) {
+	for _, tt := range []struct {
+		file string
+		want string
+	}{
+		{"cmd/foo/main.go", "/repo/...$blame/abc/cmd/foo/main.go"},
+		{"dir with space/a#b?c%d.txt", "/repo/...$blame/abc/dir%20with%20space/a%23b%3Fc%25d.txt"},
+	} {
+		if got := blameURL("/repo", "abc", tt.file); got != tt.want {
+			t.Errorf("blameURL(%q): got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestParseBlame(t *testing.T) {
+	const out = `9efc6bdfe24734489e94ab16bd7514a84943ec9c 1 1 1
+author Gopher
+author-mail <gopher@example.com>
+author-time 1577934245
+author-tz +0000
+committer Gopher
+committer-mail <gopher@example.com>
+committer-time 1577934245
+committer-tz +0000
+summary first
+boundary
+filename f.txt
+	a
+4f0c34fb97dc3a3f86c8ea365ab566e1cd6327a6 2 2 2
+author Other
+author-mail <other@example.com>
+author-time 1577934246
+author-tz +0000
+committer Other
+committer-mail <other@example.com>
+committer-time 1577934246
+committer-tz +0000
+summary second
+previous 9efc6bdfe24734489e94ab16bd7514a84943ec9c f.txt
+filename g.txt
+	B
+4f0c34fb97dc3a3f86c8ea365ab566e1cd6327a6 3 3
+	
+9efc6bdfe24734489e94ab16bd7514a84943ec9c 3 4 1
+	c
+`
+	gopher := users.User{UserSpec: users.UserSpec{ID: 1, Domain: "example.com"}, Login: "gopher"}
+	hunks, err := parseBlame([]byte(out), mockGitUsers{"gopher@example.com": gopher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &blameCommit{
+		SHA:        "9efc6bdfe24734489e94ab16bd7514a84943ec9c",
+		Subject:    "first",
+		Author:     gopher,
+		AuthorTime: time.Unix(1577934245, 0).UTC(),
+	}
+	second := &blameCommit{
+		SHA:     "4f0c34fb97dc3a3f86c8ea365ab566e1cd6327a6",
+		Subject: "second",
+		Author: users.User{
+			Name:      "Other",
+			Email:     "other@example.com",
+			AvatarURL: "https://secure.gravatar.com/avatar?d=mm&f=y&s=96",
+		},
+		AuthorTime:   time.Unix(1577934246, 0).UTC(),
+		PreviousSHA:  "9efc6bdfe24734489e94ab16bd7514a84943ec9c",
+		PreviousPath: "f.txt",
+	}
+	want := []blameHunk{
+		{Commit: first, StartLine: 1, Lines: []string{"a"}},
+		{Commit: second, StartLine: 2, Lines: []string{"B", ""}},
+		{Commit: first, StartLine: 4, Lines: []string{"c"}},
+	}
+	if !reflect.DeepEqual(hunks, want) {
+		t.Errorf("got %+v\nwant %+v", hunks, want)
+	}
+
+	hunks, err = parseBlame(nil, mockGitUsers{})
+	if err != nil || hunks != nil {
+		t.Errorf("parseBlame(nil): got (%v, %v), want (nil, nil)", hunks, err)
+	}
+}
+
+// mockGitUsers implements code.GitUsers.
+type mockGitUsers map[string]users.User
+
+func (m mockGitUsers) GitUser(email string) (users.User, bool) {
+	u, ok := m[email]
+	return u, ok
+}
@@ -24,7 +24,7 @@ import (
 )
 
 func newChangeService(reactions reactions.Service, users users.Service, router github.Router) change.Service {
-	local := &fs.Service{Reactions: reactions}
+	local := &fs.Service{Reactions: reactions, Users: users}
 	dmitshurGitHubChange := githubapi.NewService(
 		dmitshurPublicRepoGHV3,
 		dmitshurPublicRepoGHV4,
@@ -4,6 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os/exec"
+	"path"
+	"sort"
 	"strings"
 
 	"sourcegraph.com/sourcegraph/go-vcs/vcs"
@@ -59,6 +62,85 @@ func foreachCommit(shaOld, shaNew string, f func(r vcs.Repository, c *vcs.Commit
 	return nil
 }
 
+// withCommit calls f on the commit that sha refers to
+// in git repo in current directory. sha may refer to
+// a commit or an annotated tag.
+func withCommit(sha string, f func(r vcs.Repository, c *vcs.Commit) error) error {
+	r, err := gitcmd.Open(".")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	id, err := r.ResolveRevision(sha)
+	if err != nil {
+		return err
+	}
+	c, err := getCommit(r, id)
+	if err != nil {
+		return err
+	}
+	return f(r, c)
+}
+
+// commitModules returns directories of modules in commit c
+// in git repo in current directory. The module at the repository
+// root is always included first, as the empty string. Nested modules
+// are subdirectories with a go.mod file.
+//
+// Every commit on master branch is served as a pseudo-version of every
+// module it contains, so all of them are returned, not only the ones
+// that c changes.
+func commitModules(c *vcs.Commit) ([]string, error) {
+	files, err := gitFiles("ls-tree", "-r", "-z", "--name-only", string(c.ID))
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{""} // The root module is always included.
+	for _, f := range files {
+		if path.Base(f) != "go.mod" || f == "go.mod" {
+			continue
+		}
+		dir := path.Dir(f)
+		if skipDir(dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs[1:])
+	return dirs, nil
+}
+
+// skipDir reports whether the slash-separated directory dir
+// is ignored by home's code discovery: it or one of its parents
+// begins with "." or "_", or is named "testdata".
+func skipDir(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") || elem == "testdata" {
+			return true
+		}
+	}
+	return false
+}
+
+// gitFiles runs git with args in current directory, and returns
+// the file names it outputs. args must include the -z flag,
+// so that file names are terminated by a zero byte.
+func gitFiles(args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	var files []string
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f == "" {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
 // getCommit returns a commit with id from r
 // and checks it has a non-nil Committer field.
 func getCommit(r vcs.Repository, id vcs.CommitID) (*vcs.Commit, error) {
@@ -1,38 +1,55 @@
 // pre-receive is a pre-receive git hook
 // for use with home's git server.
 //
-// It verifies commits pushed to master branch
-// to ensure they produce good module versions.
+// It verifies commits pushed to master branch and
+// release version tags to ensure they produce good
+// module versions. Each commit is verified as a version
+// of the module at the repository root, and of each
+// nested module (a subdirectory with its own go.mod file)
+// that the commit contains. Tags like "v1.2.3" and
+// "subdir/v1.2.3" are verified as release versions of the
+// module at the repository root and in subdir, respectively.
+// Existing release version tags can't be moved.
 //
 // An environment variable HOME_MODULE_PATH must be set to
 // the module path corresponding to the git repository root.
+//
+// If an environment variable HOME_SIGNING_KEYS_DIR is set to
+// a keys directory of home's signature verifier, commits pushed
+// to master branch must also be signed with a signing key of
+// the user that owns their committer email.
 package main
 
 import (
 	"archive/tar"
 	archivezip "archive/zip"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/shurcooL/home/internal/code"
 	"github.com/shurcooL/home/internal/mod"
+	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
 	"golang.org/x/mod/sumdb/dirhash"
 	modzip "golang.org/x/mod/zip"
+	"golang.org/x/tools/godoc/vfs"
 	"sourcegraph.com/sourcegraph/go-vcs/vcs"
 )
 
 func main() {
 	ctx := Context{
-		ModulePath: os.Getenv("HOME_MODULE_PATH"),
+		ModulePath:     os.Getenv("HOME_MODULE_PATH"),
+		SigningKeysDir: os.Getenv("HOME_SIGNING_KEYS_DIR"),
 	}
 	err := ctx.Verify(os.Stdin)
 	if err != nil {
@@ -48,7 +65,8 @@ func main() {
 // Context holds the working context for a pre-receive hook run.
 type Context struct {
 	// Input.
-	ModulePath string
+	ModulePath     string
+	SigningKeysDir string // If not empty, commits to master must have verified signatures.
 
 	// Output.
 	Commits []Commit
@@ -56,6 +74,7 @@ type Context struct {
 }
 
 // Commit represents a commit that corresponds to a module version.
+// A commit may correspond to versions of multiple modules.
 type Commit struct {
 	ID      string
 	Subject string
@@ -66,30 +85,67 @@ type Commit struct {
 // Verify runs all the checks for the given pre-receive hook input.
 func (ctx *Context) Verify(stdin io.Reader) error {
 	err := foreachRef(stdin, func(shaOld, shaNew, refName string) error {
-		if refName != "refs/heads/master" {
-			// We are only verifying commits
-			// to master branch at this time.
+		switch {
+		case refName == "refs/heads/master":
+			err := foreachCommit(shaOld, shaNew, func(r vcs.Repository, commit *vcs.Commit) error {
+				cs, err := VerifyCommit(ctx.ModulePath, r, commit)
+				if err != nil {
+					return err
+				}
+				if ctx.SigningKeysDir != "" {
+					err := verifySignature(ctx.SigningKeysDir, commit, cs)
+					if err != nil {
+						return err
+					}
+				}
+				ctx.add(cs...)
+				return nil
+			})
+			return err
+		case strings.HasPrefix(refName, "refs/tags/") && shaNew != zeroSHA:
+			err := withCommit(shaNew, func(r vcs.Repository, commit *vcs.Commit) error {
+				tag := strings.TrimPrefix(refName, "refs/tags/")
+				c, ok, err := VerifyTag(ctx.ModulePath, r, commit, tag)
+				if err != nil {
+					return err
+				} else if !ok {
+					// Not a release version tag.
+					return nil
+				}
+				if shaOld != zeroSHA {
+					// Release versions must not change once published.
+					c.Errors = append([]string{fmt.Sprintf("tag %q already exists; release version tags can't be moved", tag)}, c.Errors...)
+				}
+				ctx.add(c)
+				return nil
+			})
+			return err
+		default:
+			// We are only verifying commits to master
+			// branch and release version tags at this time.
 			return nil
 		}
-		err := foreachCommit(shaOld, shaNew, func(r vcs.Repository, commit *vcs.Commit) error {
-			c, err := VerifyCommit(ctx.ModulePath, r, commit)
-			if err != nil {
-				return err
-			}
-			ctx.Commits = append(ctx.Commits, c)
-			if len(c.Errors) > 0 {
-				ctx.Bad++
-			}
-			return nil
-		})
-		return err
 	})
 	return err
 }
 
+// zeroSHA is the object name git uses for a ref that doesn't exist,
+// such as the new value of a ref that is being deleted.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// add adds verified commits cs to ctx.
+func (ctx *Context) add(cs ...Commit) {
+	for _, c := range cs {
+		ctx.Commits = append(ctx.Commits, c)
+		if len(c.Errors) > 0 {
+			ctx.Bad++
+		}
+	}
+}
+
 // Report reports the results of verify.
 func (ctx *Context) Report(w io.Writer) (ok bool) {
-	fmt.Fprintf(w, "publishing %d pseudo-versions\n", len(ctx.Commits))
+	fmt.Fprintf(w, "publishing %d module versions\n", len(ctx.Commits))
 	if ctx.Bad > 0 {
 		fmt.Fprintf(w, "error: rejecting push due to %d bad module versions\n", ctx.Bad)
 	}
@@ -111,20 +167,87 @@ func (ctx *Context) Report(w io.Writer) (ok bool) {
 	return true
 }
 
-// VerifyCommit verifies the given commit.
-func VerifyCommit(modulePath string, r vcs.Repository, c *vcs.Commit) (Commit, error) {
-	// Get commit and module version information.
+// VerifyCommit verifies the given commit. It returns a Commit for
+// each module version that the commit corresponds to: one for the
+// module at the repository root, and one for each nested module
+// that the commit contains.
+func VerifyCommit(modulePath string, r vcs.Repository, c *vcs.Commit) ([]Commit, error) {
+	version := mod.PseudoVersion("", "", time.Unix(c.Committer.Date.Seconds, 0).UTC(), string(c.ID[:12]))
+
+	// Verify pseudo-version time.
+	var timeError string
+	err := verifyPseudoVersionTime(r, c)
+	if e := (BadVersionError{}); errors.As(err, &e) {
+		timeError = e.Text
+	} else if err != nil {
+		return nil, err
+	}
+
+	dirs, err := commitModules(c)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, dir := range dirs {
+		commit, err := verifyModuleVersion(r, c, dir, module.Version{
+			Path:    path.Join(modulePath, dir),
+			Version: version,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if timeError != "" {
+			commit.Errors = append([]string{timeError}, commit.Errors...)
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// VerifyTag verifies the given tag pointing to commit c.
+// If tag is not a release version tag for the module at the
+// repository root or a nested module, it returns ok false.
+func VerifyTag(modulePath string, r vcs.Repository, c *vcs.Commit, tag string) (_ Commit, ok bool, _ error) {
+	// Split "<dir>/<version>" into dir and version.
+	var dir, version string
+	if i := strings.LastIndexByte(tag, '/'); i != -1 {
+		dir, version = tag[:i], tag[i+1:]
+	} else {
+		version = tag
+	}
+	if !code.IsReleaseVersion(version) {
+		return Commit{}, false, nil
+	}
+	if dir != "" {
+		// Check there's a nested module in dir.
+		fs, err := r.FileSystem(c.ID)
+		if err != nil {
+			return Commit{}, false, err
+		}
+		if _, err := fs.Stat(path.Join("/", dir, "go.mod")); os.IsNotExist(err) {
+			return Commit{}, false, nil
+		} else if err != nil {
+			return Commit{}, false, err
+		}
+	}
+	commit, err := verifyModuleVersion(r, c, dir, module.Version{
+		Path:    path.Join(modulePath, dir),
+		Version: version,
+	})
+	return commit, err == nil, err
+}
+
+// verifyModuleVersion verifies module version m,
+// whose module is in directory dir of commit c.
+func verifyModuleVersion(r vcs.Repository, c *vcs.Commit, dir string, m module.Version) (Commit, error) {
 	commit := Commit{
 		ID:      string(c.ID),
 		Subject: subject(c.Message),
-		Version: module.Version{
-			Path:    modulePath,
-			Version: mod.PseudoVersion("", "", time.Unix(c.Committer.Date.Seconds, 0).UTC(), string(c.ID[:12])),
-		},
+		Version: m,
 	}
 
-	// Verify pseudo-version time.
-	err := verifyPseudoVersionTime(r, c)
+	// Verify module path in go.mod file.
+	err := verifyModulePath(m, r, c.ID, dir)
 	if e := (BadVersionError{}); errors.As(err, &e) {
 		commit.Errors = append(commit.Errors, e.Text)
 	} else if err != nil {
@@ -132,15 +255,15 @@ func VerifyCommit(modulePath string, r vcs.Repository, c *vcs.Commit) (Commit, e
 	}
 
 	// Verify module zip contents.
-	err = verifyModuleZip(commit.Version, r, c.ID)
+	err = verifyModuleZip(m, r, c.ID, dir)
 	if e := (BadVersionError{}); errors.As(err, &e) {
 		commit.Errors = append(commit.Errors, e.Text)
 	} else if err != nil {
 		return Commit{}, err
 	}
 
-	// Verify there is a LICENSE file.
-	err = verifyHasLICENSE(r, c.ID)
+	// Verify there is a license file with a redistributable license.
+	err = verifyLicense(r, c.ID, dir)
 	if e := (BadVersionError{}); errors.As(err, &e) {
 		commit.Errors = append(commit.Errors, e.Text)
 	} else if err != nil {
@@ -150,6 +273,30 @@ func VerifyCommit(modulePath string, r vcs.Repository, c *vcs.Commit) (Commit, e
 	return commit, nil
 }
 
+// verifySignature verifies that commit c has a verified signature,
+// using signing keys in keysDir. If it doesn't, an error is added
+// to each of the module versions cs that the commit corresponds to.
+func verifySignature(keysDir string, c *vcs.Commit, cs []Commit) error {
+	// The hook runs in the git directory of the repository.
+	signatures, err := code.VerifyCommitSignatures(context.Background(), keysDir, ".", []string{string(c.ID)})
+	if err != nil {
+		return err
+	}
+	var text string
+	switch signatures[string(c.ID)] {
+	case code.Verified:
+		return nil
+	case code.Unverified:
+		text = fmt.Sprintf("commit %q signature can't be verified as made with a signing key of its committer %q", c.ID, c.Committer.Email)
+	default:
+		text = fmt.Sprintf("commit %q is not signed", c.ID)
+	}
+	for i := range cs {
+		cs[i].Errors = append([]string{text}, cs[i].Errors...)
+	}
+	return nil
+}
+
 // BadVersionError represents an error where a module version is bad.
 type BadVersionError struct {
 	Text string
@@ -179,12 +326,38 @@ func verifyPseudoVersionTime(r vcs.Repository, c *vcs.Commit) error {
 	return nil
 }
 
+// verifyModulePath verifies that the go.mod file of module m
+// in directory dir of the given commit, if any, declares the
+// module path m.Path.
+func verifyModulePath(m module.Version, r vcs.Repository, commitID vcs.CommitID, dir string) error {
+	fs, err := r.FileSystem(commitID)
+	if err != nil {
+		return err
+	}
+	f, err := fs.Open(path.Join("/", dir, "go.mod"))
+	if os.IsNotExist(err) {
+		// No go.mod file. The module path will be synthesized.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if got := modfile.ModulePath(b); got != m.Path {
+		return BadVersionError{fmt.Sprintf("%s declares module path %q, want %q", path.Join(dir, "go.mod"), got, m.Path)}
+	}
+	return nil
+}
+
 // verifyModuleZip verifies that the module zip created for
 // the given commit using the simplified code.WriteModuleZip
 // algorithm would have an identical hash as that of a module
 // zip created by the official "golang.org/x/mod/zip".Create
-// algorithm.
-func verifyModuleZip(m module.Version, r vcs.Repository, commitID vcs.CommitID) error {
+// algorithm. The module is in directory dir of the commit.
+func verifyModuleZip(m module.Version, r vcs.Repository, commitID vcs.CommitID, dir string) error {
 	var got, want struct {
 		Zip []byte
 		Sum string
@@ -195,8 +368,12 @@ func verifyModuleZip(m module.Version, r vcs.Repository, commitID vcs.CommitID)
 	{
 		var files []modzip.File
 
-		// Get a git archive.
-		cmd := exec.Command("git", "-c", "core.autocrlf=input", "archive", "--format=tar", string(commitID))
+		// Get a git archive of the module directory.
+		treeish := string(commitID)
+		if dir != "" {
+			treeish += ":" + dir
+		}
+		cmd := exec.Command("git", "-c", "core.autocrlf=input", "archive", "--format=tar", treeish)
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
 			return err
@@ -238,7 +415,7 @@ func verifyModuleZip(m module.Version, r vcs.Repository, commitID vcs.CommitID)
 	// Compute our own module zip.
 	{
 		var buf bytes.Buffer
-		err := code.WriteModuleZip(&buf, m, r, commitID)
+		err := code.WriteModuleZip(&buf, m, r, commitID, dir)
 		if err != nil {
 			return err
 		}
@@ -298,20 +475,29 @@ func (f tarFile) Path() string                 { return f.path }
 func (f tarFile) Lstat() (os.FileInfo, error)  { return f.fi, nil }
 func (f tarFile) Open() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(f.b)), nil }
 
-// verifyHasLICENSE verifies that the commit has a LICENSE file.
-func verifyHasLICENSE(r vcs.Repository, commitID vcs.CommitID) error {
+// verifyLicense verifies that the commit has a license file
+// in directory dir, and that its license is recognized and
+// permits redistribution.
+func verifyLicense(r vcs.Repository, commitID vcs.CommitID, dir string) error {
 	fs, err := r.FileSystem(commitID)
 	if err != nil {
 		return err
 	}
-	fi, err := fs.Stat("/LICENSE")
-	if os.IsNotExist(err) {
-		return BadVersionError{"commit does not have a LICENSE file"}
-	} else if err != nil {
+	name, err := code.FindLicenseFile(fs, path.Join("/", dir))
+	if err != nil {
+		return err
+	} else if name == "" {
+		return BadVersionError{fmt.Sprintf("commit does not have a license file (such as %s)", path.Join(dir, "LICENSE"))}
+	}
+	text, err := vfs.ReadFile(fs, path.Join("/", dir, name))
+	if err != nil {
 		return err
 	}
-	if !fi.Mode().IsRegular() {
-		return BadVersionError{"commit has a LICENSE but it's not a regular file"}
+	switch license := code.ClassifyLicense(text); {
+	case license == "":
+		return BadVersionError{fmt.Sprintf("commit has a %s file with an unrecognized license", path.Join(dir, name))}
+	case !code.LicenseRedistributable(license):
+		return BadVersionError{fmt.Sprintf("commit has a %s file with license %s, which doesn't permit redistribution", path.Join(dir, name), license)}
 	}
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/shurcooL/home/httputil"
 	"github.com/shurcooL/home/internal/code"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
 	"github.com/shurcooL/home/internal/exp/service/notification"
 	"github.com/shurcooL/home/internal/route"
 	"github.com/shurcooL/httperror"
@@ -24,13 +26,18 @@ import (
 type codeHandler struct {
 	code         *code.Service
 	reposDir     string
+	archivesDir  string // Directory where generated source archives are cached.
+	docs         *code.DocCache
+	vulns        *code.VulnScanner // May be nil.
 	issuesApp    httperror.Handler
 	changesApp   httperror.Handler
 	issues       issueCounter
 	change       changeCounter
+	events       activitypkg.Lister
 	notification notification.Service
 	users        users.Service
-	gitUsers     map[string]users.User // Key is lower git author email.
+	gitUsers     code.GitUsers
+	signatures   *code.SignatureVerifier // May be nil.
 }
 
 func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (ok bool) {
@@ -50,9 +57,39 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 		importPath = importPathPattern
 	}
 
-	// Look up code directory by import path.
-	d, err := h.code.GetDirectory(req.Context(), importPath)
-	if err != nil || !d.WithinRepo() || (wantRepoRoot && !d.IsRepoRoot()) {
+	// Split off the module version from a "{ImportPath}@{Version}" URL, if any.
+	var version string
+	if i := strings.IndexByte(importPath, '@'); i != -1 && !wantRepoRoot {
+		importPath, version = importPath[:i], importPath[i+1:]
+	}
+
+	// Look up code directory by import path. A directory may have had
+	// a package at an older version, so look it up at that version.
+	var d *code.Directory
+	var err error
+	if version != "" {
+		d, err = h.docs.GetDirectory(req.Context(), importPath, version)
+	} else {
+		d, err = h.code.GetDirectory(req.Context(), importPath)
+	}
+	if os.IsNotExist(err) {
+		// Redirect to the new location of a renamed repository, if any.
+		newImportPath, ok := h.code.LookUpRedirect(importPath)
+		if !ok {
+			return false
+		}
+		u := *req.URL
+		u.Path = newImportPath[len("dmitri.shuralyov.com"):]
+		if wantRepoRoot {
+			u.Path += "/..."
+		}
+		if version != "" {
+			u.Path += "@" + version
+		}
+		u.Path += req.URL.Path[len(route.BeforeImportPathSeparator(req.URL.Path)):]
+		http.Redirect(w, req, u.String(), http.StatusMovedPermanently)
+		return true
+	} else if err != nil || !d.WithinRepo() || (wantRepoRoot && !d.IsRepoRoot()) {
 		return false
 	}
 
@@ -67,10 +104,13 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 	if d.LicenseRoot != "" {
 		licensePkgPath = d.LicenseRoot[len("dmitri.shuralyov.com"):]
 	}
+	licenseName := licenseName(d)
 	switch {
-	case req.URL.Path == route.PkgIndex(pkgPath):
+	case req.URL.Path == route.PkgIndex(pkgPath) ||
+		version != "" && req.URL.Path == route.PkgVersion(pkgPath, version):
+
 		// Handle ?go-get=1 requests, serve a go-import meta tag page.
-		if req.URL.Query().Get("go-get") == "1" {
+		if version == "" && req.URL.Query().Get("go-get") == "1" {
 			if err := httputil.AllowMethods(req, http.MethodGet, http.MethodHead); err != nil {
 				httperror.HandleMethod(w, err.(httperror.Method))
 				return true
@@ -87,7 +127,8 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 		}
 
 		// If there's no Go package in this directory, redirect to "{ImportPath}/..." package listing.
-		if d.Package == nil {
+		// The directory may have had a package at an older version, so that's checked later.
+		if d.Package == nil && version == "" {
 			u := *req.URL
 			u.Path += "/..."
 			http.Redirect(w, req, u.String(), http.StatusSeeOther)
@@ -98,16 +139,25 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 		licenseURL := "/LICENSE" // Default license URL.
 		if licensePkgPath != "" {
 			// A more specific license override.
-			licenseURL = route.PkgLicense(licensePkgPath)
+			licenseURL = route.PkgLicense(licensePkgPath, d.LicenseFile)
+		}
+		pkg := pkgInfo{
+			Spec:        d.ImportPath,
+			LicenseURL:  licenseURL,
+			LicenseName: licenseName,
+		}
+		if d.Package != nil {
+			pkg.Name = d.Package.Name
+			pkg.DocHTML = d.Package.DocHTML
+			pkg.Doc = d.Package.Doc
 		}
 		h := cookieAuth{httputil.ErrorHandler(h.users, (&packageHandler{
-			Repo: repo,
-			Pkg: pkgInfo{
-				Spec:       d.ImportPath,
-				Name:       d.Package.Name,
-				DocHTML:    d.Package.DocHTML,
-				LicenseURL: licenseURL,
-			},
+			Repo:         repo,
+			Pkg:          pkg,
+			Dir:          d,
+			Version:      version,
+			docs:         h.docs,
+			vulns:        h.vulns,
 			issues:       h.issues,
 			change:       h.change,
 			notification: h.notification,
@@ -115,11 +165,7 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 		}).ServeHTTP)}
 		h.ServeHTTP(w, req)
 		return true
-	case req.URL.Path == route.PkgLicense(pkgPath):
-		if !d.HasLicenseFile() {
-			http.Error(w, "404 Not Found", http.StatusNotFound)
-			return true
-		}
+	case d.HasLicenseFile() && req.URL.Path == route.PkgLicense(pkgPath, d.LicenseFile):
 		license, err := readLicenseFile(repo.Dir, d)
 		if err != nil {
 			log.Println("readLicenseFile:", err)
@@ -137,6 +183,30 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 			notification: h.notification,
 			users:        h.users,
 			gitUsers:     h.gitUsers,
+			signatures:   h.signatures,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.PkgInsights(pkgPath):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&directoryInsightsHandler{
+			Repo:         repo,
+			PkgPath:      pkgPath,
+			Dir:          d,
+			notification: h.notification,
+			users:        h.users,
+			gitUsers:     h.gitUsers,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.PkgImports(pkgPath) || req.URL.Path == route.PkgImportedBy(pkgPath):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&importsHandler{
+			Repo:         repo,
+			PkgPath:      pkgPath,
+			Dir:          d,
+			ImportedBy:   req.URL.Path == route.PkgImportedBy(pkgPath),
+			code:         h.code,
+			notification: h.notification,
+			users:        h.users,
 		}).ServeHTTP)}
 		h.ServeHTTP(w, req)
 		return true
@@ -149,6 +219,7 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 			notification: h.notification,
 			users:        h.users,
 			gitUsers:     h.gitUsers,
+			signatures:   h.signatures,
 		}).ServeHTTP)}
 		h.ServeHTTP(w, req)
 		return true
@@ -156,6 +227,7 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 		h := cookieAuth{httputil.ErrorHandler(h.users, (&repositoryHandler{
 			Repo:         repo,
 			code:         h.code,
+			vulns:        h.vulns,
 			issues:       h.issues,
 			change:       h.change,
 			notification: h.notification,
@@ -171,6 +243,86 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 			notification: h.notification,
 			users:        h.users,
 			gitUsers:     h.gitUsers,
+			signatures:   h.signatures,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.RepoBranches(repo.Path) || req.URL.Path == route.RepoTags(repo.Path):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&refsHandler{
+			Repo:         repo,
+			Tags:         req.URL.Path == route.RepoTags(repo.Path),
+			code:         h.code,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+			signatures:   h.signatures,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case strings.HasPrefix(req.URL.Path, route.RepoCompare(repo.Path)+"/"):
+		req = stripPrefix(req, len(route.RepoCompare(repo.Path)))
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&compareHandler{
+			Repo:         repo,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+			gitUsers:     h.gitUsers,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case strings.HasPrefix(req.URL.Path, route.RepoBlame(repo.Path)+"/"):
+		req = stripPrefix(req, len(route.RepoBlame(repo.Path)))
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&blameHandler{
+			Repo:         repo,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+			gitUsers:     h.gitUsers,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case strings.HasPrefix(req.URL.Path, route.RepoArchive(repo.Path)+"/"):
+		req = stripPrefix(req, len(route.RepoArchive(repo.Path)))
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&archiveHandler{
+			Repo:     repo,
+			CacheDir: h.archivesDir,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.RepoSettings(repo.Path):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&repositorySettingsHandler{
+			Repo:         repo,
+			code:         h.code,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.RepoActivity(repo.Path):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&repositoryActivityHandler{
+			Repo:         repo,
+			events:       h.events,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+		}).ServeHTTP)}
+		h.ServeHTTP(w, req)
+		return true
+	case req.URL.Path == route.RepoInsights(repo.Path):
+		h := cookieAuth{httputil.ErrorHandler(h.users, (&repositoryInsightsHandler{
+			Repo:         repo,
+			code:         h.code,
+			issues:       h.issues,
+			change:       h.change,
+			notification: h.notification,
+			users:        h.users,
+			gitUsers:     h.gitUsers,
 		}).ServeHTTP)}
 		h.ServeHTTP(w, req)
 		return true
@@ -183,6 +335,7 @@ func (h *codeHandler) ServeCodeMaybe(w http.ResponseWriter, req *http.Request) (
 			notification: h.notification,
 			users:        h.users,
 			gitUsers:     h.gitUsers,
+			signatures:   h.signatures,
 		}).ServeHTTP)}
 		h.ServeHTTP(w, req)
 		return true
@@ -212,10 +365,15 @@ type repoInfo struct {
 }
 
 type pkgInfo struct {
-	Spec       string // Package import path. E.g., "example.com/repo/package".
-	Name       string // Package name. E.g., "pkg".
-	DocHTML    string // Package documentation HTML. E.g., "<p>Package pkg provides some functionality.</p><p>More information about pkg.</p>".
-	LicenseURL string // URL of license. E.g., "/repo/package$file/LICENSE".
+	Spec       string           // Package import path. E.g., "example.com/repo/package".
+	Name       string           // Package name. E.g., "pkg".
+	DocHTML    string           // Package documentation HTML. E.g., "<p>Package pkg provides some functionality.</p><p>More information about pkg.</p>".
+	Doc        *code.PackageDoc // Full API documentation, or nil if not available.
+	LicenseURL string           // URL of license. E.g., "/repo/package$file/LICENSE".
+
+	// LicenseName is the name of the license, or empty string
+	// if the package uses the default license. E.g., "MIT".
+	LicenseName string
 }
 
 // IsCommand reports whether the package is a command.
@@ -240,6 +398,19 @@ func readLicenseFile(gitDir string, d *code.Directory) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	license, err := vfs.ReadFile(fs, path.Join("/", strings.TrimPrefix(d.ImportPath, d.RepoRoot), "LICENSE"))
+	license, err := vfs.ReadFile(fs, path.Join("/", strings.TrimPrefix(d.ImportPath, d.RepoRoot), d.LicenseFile))
 	return license, err
 }
+
+// licenseName returns the name of the license of directory d,
+// or empty string if it's not covered by a license file.
+func licenseName(d *code.Directory) string {
+	switch {
+	case d.LicenseRoot == "":
+		return ""
+	case d.License == "":
+		return "Unknown license"
+	default:
+		return d.License
+	}
+}
@@ -43,7 +43,8 @@ type commitHandler struct {
 	change       changeCounter
 	notification notification.Service
 	users        users.Service
-	gitUsers     map[string]users.User // Key is lower git author email.
+	gitUsers     code.GitUsers
+	signatures   *code.SignatureVerifier // May be nil.
 }
 
 var commitHTML = template.Must(template.New("").Parse(`<html>
@@ -70,7 +71,7 @@ var commitHTML = template.Must(template.New("").Parse(`<html>
 		<span style="display: inline-block; vertical-align: bottom; margin-right: 5px;">{{.Avatar}}</span>{{/*
 		*/}}<span style="display: inline-block;">{{.User}} committed {{.Time}}</span>
 		<span style="float: right;">
-			<span>commit <code>{{.CommitHash}}</code></span>
+			{{.SignatureBadge}}<span>commit <code>{{.CommitHash}}</code></span>
 		</span>
 	</div>
 </div>
@@ -78,7 +79,7 @@ var commitHTML = template.Must(template.New("").Parse(`<html>
 
 {{define "FileDiff"}}
 <div class="list-entry list-entry-border">
-	<div class="list-entry-header">{{.Title}}</div>
+	<div class="list-entry-header">{{.Title}}{{with .BlameURL}}<a class="gray tiny" style="float: right;" href="{{.}}" title="Blame file at this commit.">Blame</a>{{end}}</div>
 	<div class="list-entry-body">
 		<pre class="highlight">{{.Diff}}</pre>
 	</div>
@@ -126,6 +127,7 @@ func (h *commitHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) erro
 	if commitHash != c.CommitHash {
 		return os.ErrNotExist
 	}
+	signature := verifyCommit(req.Context(), h.signatures, h.Repo.Dir, c.CommitHash)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err = commitHTML.Execute(w, struct {
@@ -175,11 +177,17 @@ func (h *commitHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) erro
 		Body:       c.Body,
 		Author:     c.Author,
 		AuthorTime: c.AuthorTime,
+		Signature:  signature,
 	})
 	if err != nil {
 		return err
 	}
 
+	err = html.Render(w, htmlg.Div(archiveLinks{RepoPath: h.Repo.Path, Rev: c.CommitHash}.Render()...))
+	if err != nil {
+		return err
+	}
+
 	if len(c.Patch) == 0 {
 		// Empty commit. Let the user know via a blank slate.
 		err := htmlg.RenderComponents(w, homecomponent.BlankSlate{
@@ -194,7 +202,11 @@ func (h *commitHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) erro
 			return err
 		}
 		for _, f := range fileDiffs {
-			err := commitHTML.ExecuteTemplate(w, "FileDiff", fileDiff{FileDiff: f})
+			var blame string
+			if f.NewName != "/dev/null" {
+				blame = blameURL(h.Repo.Path, c.CommitHash, f.NewName)
+			}
+			err := commitHTML.ExecuteTemplate(w, "FileDiff", fileDiff{FileDiff: f, BlameURL: blame})
 			if err != nil {
 				return err
 			}
@@ -215,7 +227,8 @@ type commitHandlerPkg struct {
 
 	notification notification.Service
 	users        users.Service
-	gitUsers     map[string]users.User // Key is lower git author email.
+	gitUsers     code.GitUsers
+	signatures   *code.SignatureVerifier // May be nil.
 }
 
 func (h *commitHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
@@ -247,6 +260,7 @@ func (h *commitHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request) e
 	if commitHash != c.CommitHash {
 		return os.ErrNotExist
 	}
+	signature := verifyCommit(req.Context(), h.signatures, h.Repo.Dir, c.CommitHash)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	var fullName string
@@ -304,6 +318,7 @@ func (h *commitHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request) e
 		Body:       c.Body,
 		Author:     c.Author,
 		AuthorTime: c.AuthorTime,
+		Signature:  signature,
 	})
 	if err != nil {
 		return err
@@ -363,11 +378,23 @@ func verifyCommitHash(commitHash string) (string, error) {
 	return commitHash, nil
 }
 
+// verifyCommit returns the signature verification state of
+// commit in git repo at gitDir, using signatures, which may be nil.
+// Errors are logged, and reported as Unsigned.
+func verifyCommit(ctx context.Context, signatures *code.SignatureVerifier, gitDir, commit string) code.Signature {
+	states, err := signatures.VerifyCommits(ctx, gitDir, []string{commit})
+	if err != nil {
+		log.Println("verifyCommit:", err)
+		return code.Unsigned
+	}
+	return states[commit]
+}
+
 func shortSHA(sha string) string {
 	return sha[:8]
 }
 
-func diffTree(ctx context.Context, gitDir, treeish, pathspec string, gitUsers map[string]users.User) (diffTreeResponse, error) {
+func diffTree(ctx context.Context, gitDir, treeish, pathspec string, gitUsers code.GitUsers) (diffTreeResponse, error) {
 	cmd := exec.CommandContext(ctx, "git", "diff-tree",
 		"--unified=5",
 		"--format=tformat:%H%x00%s%x00%b%x00%an%x00%ae%x00%aI",
@@ -406,7 +433,7 @@ func diffTree(ctx context.Context, gitDir, treeish, pathspec string, gitUsers ma
 		authorDate  = readLine(&b)
 		patch       = b // There may be a leading '\n', but diff.ParseMultiFileDiff ignores it anyway, so leave it. It's not there when commit is empty.
 	)
-	author, ok := gitUsers[strings.ToLower(authorEmail)]
+	author, ok := gitUsers.GitUser(authorEmail)
 	if !ok {
 		author = users.User{
 			Name:      authorName,
@@ -453,6 +480,7 @@ type commitMessage struct {
 	Body       string
 	Author     users.User
 	AuthorTime time.Time
+	Signature  code.Signature
 }
 
 func (c commitMessage) ViewCode() template.HTML {
@@ -480,8 +508,13 @@ func (c commitMessage) Time() template.HTML {
 	return template.HTML(htmlg.RenderComponentsString(issuescomponent.Time{Time: c.AuthorTime}))
 }
 
+func (c commitMessage) SignatureBadge() template.HTML {
+	return template.HTML(htmlg.RenderComponentsString(signatureBadge{Signature: c.Signature}))
+}
+
 type fileDiff struct {
 	*diff.FileDiff
+	BlameURL string // URL of the blame view of the new file. Optional.
 }
 
 func (f fileDiff) Title() (template.HTML, error) {
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
 	"path"
 	"strings"
@@ -39,7 +40,8 @@ type commitsHandler struct {
 	change       changeCounter
 	notification notification.Service
 	users        users.Service
-	gitUsers     map[string]users.User // Key is lower git author email.
+	gitUsers     code.GitUsers
+	signatures   *code.SignatureVerifier // May be nil.
 }
 
 var commitsHTML = template.Must(template.New("").Parse(`<html>
@@ -82,11 +84,14 @@ func (h *commitsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) err
 	}
 	fmt.Println("counting open issues & changes took:", time.Since(t0).Nanoseconds(), "for:", h.Repo.Spec)
 
+	ref := historyRef(req)
+
 	// TODO: Pagination support.
-	commits, err := listMasterCommits(req.Context(), h.Repo.Dir, ":", h.gitUsers)
+	commits, err := listCommits(req.Context(), h.Repo.Dir, ref, ":", h.gitUsers)
 	if err != nil {
 		return err
 	}
+	verifyCommits(req.Context(), h.signatures, h.Repo.Dir, commits)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err = commitsHTML.Execute(w, struct {
@@ -127,7 +132,7 @@ func (h *commitsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) err
 		return err
 	}
 
-	err = htmlg.RenderComponents(w, Commits{
+	err = htmlg.RenderComponents(w, refBar{Ref: ref, RepoPath: h.Repo.Path}, Commits{
 		Commits:    commits,
 		ImportPath: h.Repo.Spec,
 		CommitURL:  func(sha string) string { return route.RepoCommit(h.Repo.Path) + "/" + sha },
@@ -150,7 +155,8 @@ type commitsHandlerPkg struct {
 
 	notification notification.Service
 	users        users.Service
-	gitUsers     map[string]users.User // Key is lower git author email.
+	gitUsers     code.GitUsers
+	signatures   *code.SignatureVerifier // May be nil.
 }
 
 func (h *commitsHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
@@ -171,11 +177,14 @@ func (h *commitsHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request)
 		}
 	}
 
+	ref := historyRef(req)
+
 	// TODO: Pagination support.
-	commits, err := listMasterCommits(req.Context(), h.Repo.Dir, directoryGitPathspec(h.Dir), h.gitUsers)
+	commits, err := listCommits(req.Context(), h.Repo.Dir, ref, directoryGitPathspec(h.Dir), h.gitUsers)
 	if err != nil {
 		return err
 	}
+	verifyCommits(req.Context(), h.signatures, h.Repo.Dir, commits)
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	var fullName string
@@ -228,7 +237,7 @@ func (h *commitsHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request)
 		c.Subject = strings.TrimPrefix(c.Subject, pathWithinRepo(h.Dir)+": ") // THINK: Trim package prefix from subject better?
 		commits[i] = c
 	}
-	err = htmlg.RenderComponents(w, Commits{
+	err = htmlg.RenderComponents(w, refBar{Ref: ref, RepoPath: h.Repo.Path}, Commits{
 		Commits:    commits,
 		ImportPath: h.Dir.ImportPath,
 		CommitURL:  func(sha string) string { return route.PkgCommit(h.PkgPath) + "/" + sha },
@@ -243,14 +252,28 @@ func (h *commitsHandlerPkg) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	return err
 }
 
-// listMasterCommits returns a list of commits in git repo on master branch,
+// historyRef returns the ref whose history is requested
+// via the "ref" query parameter, or "master" if it's not set.
+func historyRef(req *http.Request) string {
+	if ref := req.URL.Query().Get("ref"); ref != "" {
+		return ref
+	}
+	return "master"
+}
+
+// listCommits returns a list of commits in git repo reachable from rev,
 // with an optionally specified pathspec.
-// If master branch doesn't exist, an empty list is returned.
-func listMasterCommits(ctx context.Context, gitDir, pathspec string, gitUsers map[string]users.User) ([]Commit, error) {
+// If rev is master and master branch doesn't exist, an empty list is returned.
+// If rev is another revision that doesn't exist, os.ErrNotExist is returned.
+func listCommits(ctx context.Context, gitDir, rev, pathspec string, gitUsers code.GitUsers) ([]Commit, error) {
+	if strings.HasPrefix(rev, "-") {
+		// Not a valid revision, and must not be interpreted as an option.
+		return nil, os.ErrNotExist
+	}
 	cmd := exec.CommandContext(ctx, "git", "log",
 		"--format=tformat:%H%x00%s%x00%b%x00%an%x00%ae%x00%aI",
 		"-z",
-		"master", "--", pathspec)
+		rev, "--", pathspec)
 	cmd.Dir = gitDir
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
@@ -260,7 +283,10 @@ func listMasterCommits(ctx context.Context, gitDir, pathspec string, gitUsers ma
 	}
 	err = cmd.Wait()
 	if ee, _ := err.(*exec.ExitError); ee != nil && ee.Sys().(syscall.WaitStatus).ExitStatus() == 128 {
-		return nil, nil // Master branch doesn't exist.
+		if rev == "master" {
+			return nil, nil // Master branch doesn't exist.
+		}
+		return nil, os.ErrNotExist
 	} else if err != nil {
 		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
 	}
@@ -276,7 +302,7 @@ func listMasterCommits(ctx context.Context, gitDir, pathspec string, gitUsers ma
 			authorEmail = readLine(&b)
 			authorDate  = readLine(&b)
 		)
-		author, ok := gitUsers[strings.ToLower(authorEmail)]
+		author, ok := gitUsers.GitUser(authorEmail)
 		if !ok {
 			author = users.User{
 				Name:      authorName,
@@ -299,6 +325,24 @@ func listMasterCommits(ctx context.Context, gitDir, pathspec string, gitUsers ma
 	return commits, nil
 }
 
+// verifyCommits sets the signature verification state of commits
+// in git repo at gitDir, using signatures, which may be nil.
+// Errors are logged, leaving commits without a signature state.
+func verifyCommits(ctx context.Context, signatures *code.SignatureVerifier, gitDir string, commits []Commit) {
+	hashes := make([]string, len(commits))
+	for i, c := range commits {
+		hashes[i] = c.SHA
+	}
+	states, err := signatures.VerifyCommits(ctx, gitDir, hashes)
+	if err != nil {
+		log.Println("verifyCommits:", err)
+		return
+	}
+	for i, c := range commits {
+		commits[i].Signature = states[c.SHA]
+	}
+}
+
 type Commits struct {
 	Commits    []Commit
 	ImportPath string
@@ -326,6 +370,7 @@ type Commit struct {
 	Body       string
 	Author     users.User
 	AuthorTime time.Time
+	Signature  code.Signature
 }
 
 func (c Commit) Render(importPath string, commitURL func(sha string) string) []*html.Node {
@@ -386,6 +431,8 @@ display: none;`}},
 	}
 	div.AppendChild(titleAndByline)
 
+	htmlg.AppendChildren(div, signatureBadge{Signature: c.Signature}.Render()...)
+
 	commitID := belt.CommitID{SHA: c.SHA}
 	htmlg.AppendChildren(div, commitID.Render()...)
 
@@ -404,3 +451,27 @@ display: none;`}},
 	listEntryDiv := htmlg.DivClass("list-entry-body multilist-entry commit-container", div)
 	return []*html.Node{listEntryDiv}
 }
+
+// signatureBadge displays whether the signature of
+// a commit or tag is verified. Unsigned ones have no badge.
+type signatureBadge struct {
+	Signature code.Signature
+}
+
+func (b signatureBadge) Render() []*html.Node {
+	var text, title, color string
+	switch b.Signature {
+	case code.Verified:
+		text, title, color = "Verified", "Signed with a signing key of the committer or tagger.", "#22863a"
+	case code.Unverified:
+		text, title, color = "Unverified", "Signed, but not with a signing key of the committer or tagger, or the signature is bad.", "#6a737d"
+	default:
+		return nil
+	}
+	badge := htmlg.Span(htmlg.Text(text))
+	badge.Attr = append(badge.Attr,
+		html.Attribute{Key: atom.Title.String(), Val: title},
+		html.Attribute{Key: atom.Style.String(), Val: "display: inline-block; height: 16px; line-height: 16px; margin-right: 12px; padding: 0 5px; border: 1px solid " + color + "; border-radius: 3px; color: " + color + "; font-size: 11px; font-weight: bold;"},
+	)
+	return []*html.Node{badge}
+}
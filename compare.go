@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"syscall"
+
+	statepkg "dmitri.shuralyov.com/state"
+	homecomponent "github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/users"
+	"github.com/sourcegraph/go-diff/diff"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// compareHandler is a handler for displaying a comparison
+// between two revisions of a git repository.
+type compareHandler struct {
+	Repo repoInfo
+
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+	gitUsers     code.GitUsers
+}
+
+var compareHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>{{.FullName}} - Compare {{.Base}}...{{.Head}}</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/commit/style.css" rel="stylesheet" type="text/css">
+		<link href="/assets/commits/style.css" rel="stylesheet" type="text/css">
+		<script async src="/assets/commits/commits.js"></script>
+	</head>
+	<body>`))
+
+func (h *compareHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+	base, head, ok := parseCompareSpec(req.URL.Path[1:])
+	if !ok {
+		return os.ErrNotExist
+	}
+	split := req.URL.Query().Get("view") == "split"
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	openIssues, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	openChanges, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+
+	baseCommit, err := resolveCommit(req.Context(), h.Repo.Dir, base)
+	if err != nil {
+		return err
+	}
+	headCommit, err := resolveCommit(req.Context(), h.Repo.Dir, head)
+	if err != nil {
+		return err
+	}
+	commits, err := listCommits(req.Context(), h.Repo.Dir, baseCommit+".."+headCommit, ":", h.gitUsers)
+	if err != nil {
+		return err
+	}
+	patch, err := diffRevisions(req.Context(), h.Repo.Dir, baseCommit, headCommit)
+	if err != nil {
+		return err
+	}
+	fileDiffs, err := diff.ParseMultiFileDiff(patch)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = compareHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		FullName      string
+		Base, Head    string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		FullName:      "Repository " + path.Base(h.Repo.Spec),
+		Base:          base,
+		Head:          head,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, homecomponent.RepositoryTabNav(homecomponent.HistoryTab, h.Repo.Path, h.Repo.Packages, openIssues, openChanges))
+	if err != nil {
+		return err
+	}
+
+	err = htmlg.RenderComponents(w,
+		compareBar{Base: base, Head: head, URL: req.URL, Split: split},
+		Commits{
+			Commits:    commits,
+			ImportPath: h.Repo.Spec,
+			CommitURL:  func(sha string) string { return route.RepoCommit(h.Repo.Path) + "/" + sha },
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(fileDiffs) == 0 {
+		err := htmlg.RenderComponents(w, homecomponent.BlankSlate{
+			Content: htmlg.Nodes{htmlg.Text("There are no affected files.")},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range fileDiffs {
+		if split {
+			err = htmlg.RenderComponents(w, splitFileDiff{fileDiff{FileDiff: f}})
+		} else {
+			err = commitHTML.ExecuteTemplate(w, "FileDiff", fileDiff{FileDiff: f})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// parseCompareSpec parses a "{base}...{head}" comparison spec.
+// If the "{base}..." part is omitted, base is master.
+func parseCompareSpec(spec string) (base, head string, ok bool) {
+	if i := strings.Index(spec, "..."); i != -1 {
+		base, head = spec[:i], spec[i+len("..."):]
+	} else {
+		base, head = "master", spec
+	}
+	if base == "" || head == "" {
+		return "", "", false
+	}
+	return base, head, true
+}
+
+// resolveCommit resolves revision rev in git repo to a commit hash.
+// It returns os.ErrNotExist if there's no such commit.
+func resolveCommit(ctx context.Context, gitDir, rev string) (string, error) {
+	if strings.HasPrefix(rev, "-") {
+		// Not a valid revision, and must not be interpreted as an option.
+		return "", os.ErrNotExist
+	}
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	cmd.Dir = gitDir
+	out, err := cmd.Output()
+	if ee, _ := err.(*exec.ExitError); ee != nil && ee.Sys().(syscall.WaitStatus).ExitStatus() == 1 {
+		return "", os.ErrNotExist
+	} else if err != nil {
+		return "", fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// diffRevisions returns the diff between the merge base
+// of commits base and head, and commit head.
+func diffRevisions(ctx context.Context, gitDir, base, head string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", "diff",
+		"--unified=5",
+		"--no-prefix",
+		"--find-renames",
+		base+"..."+head)
+	cmd.Dir = gitDir
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// compareBar displays the revisions being compared,
+// links for switching between unified and split views,
+// and a button for opening a change.
+type compareBar struct {
+	Base, Head string
+	URL        *url.URL // URL of current compare page.
+	Split      bool     // Whether split view is selected.
+}
+
+func (c compareBar) Render() []*html.Node {
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "display: flex; align-items: center; font-size: 14px; margin-bottom: 20px;"}},
+	}
+
+	revs := htmlg.Span(
+		htmlg.Text("Comparing "),
+		htmlg.Strong(c.Base),
+		htmlg.Text(" ... "),
+		htmlg.Strong(c.Head),
+	)
+	revs.Attr = append(revs.Attr, html.Attribute{Key: atom.Style.String(), Val: "flex-grow: 1;"})
+	div.AppendChild(revs)
+
+	viewURL := func(view string) string {
+		q := c.URL.Query()
+		if view == "" {
+			q.Del("view")
+		} else {
+			q.Set("view", view)
+		}
+		return (&url.URL{Path: c.URL.Path, RawQuery: q.Encode()}).String()
+	}
+	if c.Split {
+		div.AppendChild(htmlg.A("Unified", viewURL("")))
+		div.AppendChild(htmlg.Text(" · "))
+		div.AppendChild(htmlg.Strong("Split"))
+	} else {
+		div.AppendChild(htmlg.Strong("Unified"))
+		div.AppendChild(htmlg.Text(" · "))
+		div.AppendChild(htmlg.A("Split", viewURL("split")))
+	}
+
+	// TODO: Enable once change.Service supports creating changes.
+	button := &html.Node{
+		Type: html.ElementNode, Data: atom.Button.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Disabled.String()},
+			{Key: atom.Title.String(), Val: "Creating changes is not supported yet."},
+			{Key: atom.Style.String(), Val: "margin-left: 12px;"},
+		},
+		FirstChild: htmlg.Text("Open a change"),
+	}
+	div.AppendChild(button)
+
+	return []*html.Node{div}
+}
+
+// splitFileDiff displays a file diff with removed and added
+// lines side by side.
+type splitFileDiff struct {
+	fileDiff
+}
+
+func (f splitFileDiff) Render() []*html.Node {
+	title, err := f.Title()
+	if err != nil {
+		log.Println("splitFileDiff.Render:", err)
+	}
+	header := htmlg.DivClass("list-entry-header")
+	header.AppendChild(&html.Node{Type: html.RawNode, Data: string(title)})
+
+	table := &html.Node{
+		Type: html.ElementNode, Data: atom.Table.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "width: 100%; table-layout: fixed; border-collapse: collapse;"}},
+	}
+	for _, h := range f.Hunks {
+		table.AppendChild(splitDiffRow(
+			splitDiffCell{Text: fmt.Sprintf("@@ -%d,%d +%d,%d @@ %s", h.OrigStartLine, h.OrigLines, h.NewStartLine, h.NewLines, h.Section), Class: "gu"},
+			splitDiffCell{},
+		))
+		for _, row := range splitHunk(h.Body) {
+			table.AppendChild(splitDiffRow(row[0], row[1]))
+		}
+	}
+	pre := &html.Node{
+		Type: html.ElementNode, Data: atom.Pre.String(),
+		Attr: []html.Attribute{{Key: atom.Class.String(), Val: "highlight"}},
+	}
+	pre.AppendChild(table)
+	body := htmlg.DivClass("list-entry-body", pre)
+
+	return []*html.Node{htmlg.DivClass("list-entry list-entry-border", header, body)}
+}
+
+// splitDiffCell is one side of a row in a split diff.
+type splitDiffCell struct {
+	Text  string
+	Class string // "gd" for removed, "gi" for added, "gu" for hunk header, empty otherwise.
+}
+
+func splitDiffRow(left, right splitDiffCell) *html.Node {
+	tr := &html.Node{Type: html.ElementNode, Data: atom.Tr.String()}
+	for _, c := range [...]splitDiffCell{left, right} {
+		td := &html.Node{
+			Type: html.ElementNode, Data: atom.Td.String(),
+			Attr: []html.Attribute{{Key: atom.Style.String(), Val: "width: 50%; vertical-align: top; white-space: pre-wrap; word-break: break-all;"}},
+		}
+		if c.Class != "" {
+			td.Attr = append(td.Attr, html.Attribute{Key: atom.Class.String(), Val: c.Class})
+		}
+		td.AppendChild(htmlg.Text(c.Text))
+		tr.AppendChild(td)
+	}
+	return tr
+}
+
+// splitHunk splits the body of a unified diff hunk into rows
+// of left (original) and right (new) cells. Consecutive removed
+// and added lines are paired up, the rest are shown on both sides.
+func splitHunk(body []byte) [][2]splitDiffCell {
+	var (
+		rows     [][2]splitDiffCell
+		del, ins []string // Pending removed and added lines.
+	)
+	flush := func() {
+		for i := 0; i < len(del) || i < len(ins); i++ {
+			var row [2]splitDiffCell
+			if i < len(del) {
+				row[0] = splitDiffCell{Text: del[i], Class: "gd"}
+			}
+			if i < len(ins) {
+				row[1] = splitDiffCell{Text: ins[i], Class: "gi"}
+			}
+			rows = append(rows, row)
+		}
+		del, ins = nil, nil
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(string(body), "\n"), "\n") {
+		if line == "" {
+			// An empty context line, if diff was stripped of trailing whitespace.
+			line = " "
+		}
+		switch line[0] {
+		case '-':
+			if len(ins) > 0 {
+				flush()
+			}
+			del = append(del, line[1:])
+		case '+':
+			ins = append(ins, line[1:])
+		case '\\':
+			// "\ No newline at end of file".
+			continue
+		default:
+			flush()
+			rows = append(rows, [2]splitDiffCell{{Text: line[1:]}, {Text: line[1:]}})
+		}
+	}
+	flush()
+	return rows
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCompareSpec(t *testing.T) {
+	for _, tt := range []struct {
+		spec     string
+		wantBase string
+		wantHead string
+		wantOK   bool
+	}{
+		{"master...feature", "master", "feature", true},
+		{"v1.0.0...feature/sub", "v1.0.0", "feature/sub", true},
+		{"feature", "master", "feature", true},
+		{"...feature", "", "", false},
+		{"master...", "", "", false},
+		{"", "", "", false},
+	} {
+		base, head, ok := parseCompareSpec(tt.spec)
+		if base != tt.wantBase || head != tt.wantHead || ok != tt.wantOK {
+			t.Errorf("parseCompareSpec(%q): got (%q, %q, %v), want (%q, %q, %v)", tt.spec, base, head, ok, tt.wantBase, tt.wantHead, tt.wantOK)
+		}
+	}
+}
+
+func TestSplitHunk(t *testing.T) {
+	body := []byte(` context
+-old 1
+-old 2
++new 1
+ more context
++added
+\ No newline at end of file
+`)
+	got := splitHunk(body)
+	want := [][2]splitDiffCell{
+		{{Text: "context"}, {Text: "context"}},
+		{{Text: "old 1", Class: "gd"}, {Text: "new 1", Class: "gi"}},
+		{{Text: "old 2", Class: "gd"}, {}},
+		{{Text: "more context"}, {Text: "more context"}},
+		{{}, {Text: "added", Class: "gi"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
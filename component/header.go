@@ -143,7 +143,7 @@ header.header a.Logo:hover {
 			a := &html.Node{
 				Type: html.ElementNode, Data: atom.A.String(),
 				Attr: []html.Attribute{
-					{Key: atom.Href.String(), Val: h.CurrentUser.HTMLURL},
+					{Key: atom.Href.String(), Val: fmt.Sprintf("/users/%s/%d", h.CurrentUser.Domain, h.CurrentUser.ID)},
 					{Key: atom.Style.String(), Val: `margin-right: 6px;`},
 				},
 			}
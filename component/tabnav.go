@@ -65,6 +65,10 @@ const (
 	HistoryTab
 	IssuesTab
 	ChangesTab
+	ActivityTab
+	InsightsTab
+	ImportsTab
+	ImportedByTab
 )
 
 func RepositoryTabNav(selected RepositoryTab, repoPath string, packages int, openIssues, openChanges uint64) htmlg.Component {
@@ -83,6 +87,16 @@ func RepositoryTabNav(selected RepositoryTab, repoPath string, packages int, ope
 				URL:      route.RepoHistory(repoPath),
 				Selected: selected == HistoryTab,
 			},
+			{
+				Content:  iconText{Icon: octicon.Pulse, Text: "Activity"},
+				URL:      route.RepoActivity(repoPath),
+				Selected: selected == ActivityTab,
+			},
+			{
+				Content:  iconText{Icon: octicon.Graph, Text: "Insights"},
+				URL:      route.RepoInsights(repoPath),
+				Selected: selected == InsightsTab,
+			},
 			{
 				Content: contentCounter{
 					Content: iconText{Icon: octicon.IssueOpened, Text: "Issues"},
@@ -34,6 +34,21 @@ func directoryTabnav(selected component.RepositoryTab, pkgPath string) htmlg.Com
 				URL:      route.PkgHistory(pkgPath),
 				Selected: selected == component.HistoryTab,
 			},
+			{
+				Content:  iconText{Icon: octicon.Graph, Text: "Insights"},
+				URL:      route.PkgInsights(pkgPath),
+				Selected: selected == component.InsightsTab,
+			},
+			{
+				Content:  iconText{Icon: octicon.Package, Text: "Imports"},
+				URL:      route.PkgImports(pkgPath),
+				Selected: selected == component.ImportsTab,
+			},
+			{
+				Content:  iconText{Icon: octicon.Package, Text: "Imported By"},
+				URL:      route.PkgImportedBy(pkgPath),
+				Selected: selected == component.ImportedByTab,
+			},
 		},
 	}
 }
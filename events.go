@@ -2,11 +2,12 @@ package main
 
 import (
 	"context"
-	"sort"
+	"time"
 
 	"github.com/shurcooL/events"
 	"github.com/shurcooL/events/event"
 	"github.com/shurcooL/events/fs"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/webdav"
 )
@@ -15,7 +16,7 @@ func newEventsService(
 	root webdav.FileSystem,
 	githubEvents, gerritEvents events.Service,
 	users users.Service,
-) (events.Service, error) {
+) (multiEvents, error) {
 	dmitshur, err := users.Get(context.Background(), dmitshur)
 	if err != nil {
 		return nil, err
@@ -25,40 +26,104 @@ func newEventsService(
 		return nil, err
 	}
 	return multiEvents{
-		githubEvents, // Events from GitHub.
-		local,        // Events from local store.
-		gerritEvents, // Events from Gerrit instance at go.googlesource.com.
+		githubEvents,       // Events from GitHub.
+		localEvents{local}, // Events from local store.
+		gerritEvents,       // Events from Gerrit instance at go.googlesource.com.
 	}, nil
 }
 
+// localEvents wraps the local events store to implement
+// activitypkg.Lister and activitypkg.Retainer.
+type localEvents struct {
+	events.Service
+}
+
+// localEventsRetained is the number of newest events
+// the local events store keeps. Older events are dropped.
+const localEventsRetained = 100
+
+// ListEvents implements activitypkg.Lister.
+func (l localEvents) ListEvents(ctx context.Context, opt activitypkg.ListOptions) ([]event.Event, error) {
+	events, err := l.List(ctx)
+	return activitypkg.Filter(events, opt), err
+}
+
+// RetainedSince implements activitypkg.Retainer.
+func (l localEvents) RetainedSince(ctx context.Context) (time.Time, error) {
+	events, err := l.List(ctx)
+	if err != nil || len(events) < localEventsRetained {
+		// No events have been dropped yet.
+		return time.Time{}, err
+	}
+	return events[len(events)-1].Time, nil
+}
+
 // multiEvents is a union of multiple events.Services.
 type multiEvents []events.Service
 
-// List lists newest 100 events from all services.
+// List lists newest activitypkg.DefaultLimit events from all services.
 //
 // It keeps going even if there are errors encountered, but reports them at the end.
 func (m multiEvents) List(ctx context.Context) ([]event.Event, error) {
+	return m.ListEvents(ctx, activitypkg.ListOptions{})
+}
+
+// ListEvents lists events that match opt from all services.
+// Services that don't implement activitypkg.Lister have their
+// events filtered by opt after listing.
+//
+// It keeps going even if there are errors encountered, but reports them at the end.
+func (m multiEvents) ListEvents(ctx context.Context, opt activitypkg.ListOptions) ([]event.Event, error) {
 	var events []event.Event
 	var errors []error
 	for _, s := range m {
-		e, err := s.List(ctx)
+		var e []event.Event
+		var err error
+		if l, ok := s.(activitypkg.Lister); ok {
+			e, err = l.ListEvents(ctx, opt)
+		} else {
+			e, err = s.List(ctx)
+			e = activitypkg.Filter(e, opt)
+		}
 		if err != nil {
 			errors = append(errors, err)
 		}
 		events = append(events, e...)
 	}
-	sort.SliceStable(events, func(i, j int) bool {
-		return events[i].Time.After(events[j].Time)
-	})
-	if len(events) > 100 {
-		events = events[:100]
-	}
+	events = activitypkg.Filter(events, activitypkg.ListOptions{Limit: opt.Limit})
 	if len(errors) > 0 {
 		return events, errors[0]
 	}
 	return events, nil
 }
 
+// RetainedSince returns the latest time since which each service
+// implementing activitypkg.Retainer retains events. Events listed
+// from before it may be incomplete.
+//
+// It keeps going even if there are errors encountered, but reports them at the end.
+func (m multiEvents) RetainedSince(ctx context.Context) (time.Time, error) {
+	var since time.Time
+	var errors []error
+	for _, s := range m {
+		r, ok := s.(activitypkg.Retainer)
+		if !ok {
+			continue
+		}
+		t, err := r.RetainedSince(ctx)
+		if err != nil {
+			errors = append(errors, err)
+		}
+		if t.After(since) {
+			since = t
+		}
+	}
+	if len(errors) > 0 {
+		return since, errors[0]
+	}
+	return since, nil
+}
+
 // Log logs the event to all services.
 //
 // It keeps going even if there are errors encountered, but reports them at the end.
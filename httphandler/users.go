@@ -1,6 +1,8 @@
 package httphandler
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,6 +15,21 @@ import (
 // Users is an API handler for users.Service.
 type Users struct {
 	Users users.Service
+
+	// EditProfile, if not nil, edits the profile of the authenticated user.
+	// It's used to handle PATCH requests to the authenticated user endpoint.
+	// It's responsible for validating the request, and reporting an invalid
+	// request with an error of type httperror.BadRequest.
+	EditProfile func(context.Context, EditProfileRequest) (users.User, error)
+}
+
+// EditProfileRequest is a request to edit the authenticated user's profile.
+// Fields that are nil are left unchanged.
+type EditProfileRequest struct {
+	Name      *string // Display name.
+	Email     *string // Public email.
+	AvatarURL *string
+	HTMLURL   *string // Website.
 }
 
 func (h Users) GetAuthenticatedSpec(w http.ResponseWriter, req *http.Request) error {
@@ -37,6 +54,39 @@ func (h Users) GetAuthenticated(w http.ResponseWriter, req *http.Request) error
 	return httperror.JSONResponse{V: u}
 }
 
+// Authenticated handles GET requests to get the authenticated user,
+// and PATCH requests with a JSON-encoded EditProfileRequest body to edit
+// the authenticated user's profile.
+func (h Users) Authenticated(w http.ResponseWriter, req *http.Request) error {
+	switch req.Method {
+	case "GET":
+		return h.GetAuthenticated(w, req)
+	case "PATCH":
+		return h.EditAuthenticated(w, req)
+	default:
+		return httperror.Method{Allowed: []string{"GET", "PATCH"}}
+	}
+}
+
+func (h Users) EditAuthenticated(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "PATCH" {
+		return httperror.Method{Allowed: []string{"PATCH"}}
+	}
+	if h.EditProfile == nil {
+		return httperror.Method{Allowed: []string{"GET"}}
+	}
+	var er EditProfileRequest
+	err := json.NewDecoder(req.Body).Decode(&er)
+	if err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	u, err := h.EditProfile(req.Context(), er)
+	if err != nil {
+		return err
+	}
+	return httperror.JSONResponse{V: u}
+}
+
 func (h Users) Get(w http.ResponseWriter, req *http.Request) error {
 	if req.Method != "GET" {
 		return httperror.Method{Allowed: []string{"GET"}}
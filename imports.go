@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	homecomponent "github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var importsHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>{{.FullName}} - {{.Title}}</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/index/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+// importsHandler is a handler for displaying the imports of a package,
+// or the packages in the repository store that import it.
+type importsHandler struct {
+	Repo       repoInfo
+	PkgPath    string
+	Dir        *code.Directory
+	ImportedBy bool // Display packages that import this package, rather than its imports.
+
+	code         *code.Service
+	notification notification.Service
+	users        users.Service
+}
+
+func (h *importsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		title       = "Imports"
+		tab         = homecomponent.ImportsTab
+		importPaths []string
+		blank       = "This package doesn't import any packages."
+	)
+	if h.ImportedBy {
+		title, tab, blank = "Imported By", homecomponent.ImportedByTab, "No packages in this repository store import this package."
+		importPaths, err = h.code.ImportedBy(req.Context(), h.Dir.ImportPath)
+		if err != nil {
+			return err
+		}
+	} else if h.Dir.Package != nil {
+		importPaths = h.Dir.Package.Imports
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var fullName string
+	if h.Dir.Package == nil {
+		fullName = "Directory " + path.Base(h.Dir.ImportPath)
+	} else if h.Dir.Package.IsCommand() {
+		fullName = "Command " + path.Base(h.Dir.ImportPath)
+	} else {
+		fullName = "Package " + h.Dir.Package.Name
+	}
+	err = importsHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		FullName      string
+		Title         string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		FullName:      fullName,
+		Title:         title,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Dir.ImportPath)))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, directoryTabnav(tab, h.PkgPath))
+	if err != nil {
+		return err
+	}
+
+	if len(importPaths) == 0 {
+		err = htmlg.RenderComponents(w, homecomponent.BlankSlate{
+			Content: htmlg.Nodes{htmlg.Text(blank)},
+		})
+	} else {
+		err = htmlg.RenderComponents(w, importList(importPaths))
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// importList displays a list of import paths, linked to their documentation.
+type importList []string
+
+func (l importList) Render() []*html.Node {
+	var items []*html.Node
+	for _, importPath := range l {
+		items = append(items, htmlg.LI(htmlg.A(importPath, importPathURL(importPath))))
+	}
+	return []*html.Node{htmlg.UL(items...)}
+}
+
+// importPathURL returns the URL of the package with the specified import path.
+// Packages in the repository store are linked to directly, others on pkg.go.dev.
+func importPathURL(importPath string) string {
+	if strings.HasPrefix(importPath, "dmitri.shuralyov.com/") {
+		return route.PkgIndex(importPath[len("dmitri.shuralyov.com"):])
+	}
+	return "https://pkg.go.dev/" + importPath
+}
+
+// moduleGraph displays a module dependency graph,
+// highlighting outdated requirements.
+type moduleGraph []code.Module
+
+func (g moduleGraph) Render() []*html.Node {
+	ns := []*html.Node{htmlg.H3(htmlg.Text("Module dependencies"))}
+	if len(g) == 0 {
+		return append(ns, homecomponent.BlankSlate{
+			Content: htmlg.Nodes{htmlg.Text("There are no modules.")},
+		}.Render()...)
+	}
+	for _, m := range g {
+		ns = append(ns, htmlg.P(htmlg.Strong(m.Path)))
+		if len(m.Requires) == 0 {
+			ns = append(ns, htmlg.UL(htmlg.LI(htmlg.Text("No requirements."))))
+			continue
+		}
+		var items []*html.Node
+		for _, r := range m.Requires {
+			li := htmlg.LI(
+				htmlg.A(r.Path, importPathURL(r.Path)),
+				htmlg.Text(" "+r.Version),
+			)
+			if r.Indirect {
+				li.AppendChild(htmlg.Text(" (indirect)"))
+			}
+			if r.Outdated() {
+				outdated := htmlg.Span(htmlg.Text(fmt.Sprintf("outdated, latest is %s", r.Latest)))
+				outdated.Attr = append(outdated.Attr, html.Attribute{Key: atom.Style.String(), Val: "margin-left: 8px; color: #bd2c00;"})
+				li.AppendChild(outdated)
+			}
+			items = append(items, li)
+		}
+		ns = append(ns, htmlg.UL(items...))
+	}
+	return ns
+}
@@ -16,13 +16,14 @@ import (
 	statepkg "dmitri.shuralyov.com/state"
 	"github.com/dustin/go-humanize"
 	"github.com/shurcooL/component"
-	"github.com/shurcooL/events"
 	"github.com/shurcooL/events/event"
 	"github.com/shurcooL/go/timeutil"
 	homecomponent "github.com/shurcooL/home/component"
 	"github.com/shurcooL/home/httputil"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
 	"github.com/shurcooL/home/internal/exp/service/notification"
 	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
 	"github.com/shurcooL/octicon"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/html"
@@ -42,7 +43,7 @@ var indexHTML = template.Must(template.New("").Parse(`<!DOCTYPE html>
 	<body>
 		<div style="max-width: 800px; margin: 0 auto 100px auto;">`))
 
-func initIndex(events events.Service, notification notification.Service, users users.Service) http.Handler {
+func initIndex(events activitypkg.Lister, notification notification.Service, users users.Service) http.Handler {
 	h := &indexHandler{
 		AuthzEndpoint: indieauthMeFlag.Me != nil,
 		events:        events,
@@ -54,7 +55,7 @@ func initIndex(events events.Service, notification notification.Service, users u
 
 type indexHandler struct {
 	AuthzEndpoint bool // Whether to advertise the IndieAuth authorization endpoint.
-	events        events.Service
+	events        activitypkg.Lister
 	notification  notification.Service
 	users         users.Service
 }
@@ -63,6 +64,10 @@ func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error
 	if err := httputil.AllowMethods(req, http.MethodGet, http.MethodHead); err != nil {
 		return err
 	}
+	opt, err := activityOptions(req.URL.Query())
+	if err != nil {
+		return httperror.BadRequest{Err: err}
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if h.AuthzEndpoint {
@@ -77,7 +82,7 @@ func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error
 		AnalyticsHTML template.HTML
 		GitHubRelMe   string // GitHub username to advertise in a rel='me' link.
 	}{analyticsHTML, *githubRelMeFlag}
-	err := indexHTML.Execute(w, data)
+	err = indexHTML.Execute(w, data)
 	if err != nil {
 		return err
 	}
@@ -111,7 +116,7 @@ func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error
 		return err
 	}
 
-	events, eventsError := h.events.List(req.Context())
+	events, eventsError := h.events.ListEvents(req.Context(), opt)
 	var error string
 	if eventsError != nil {
 		error = "There was a problem getting latest activity."
@@ -125,7 +130,11 @@ func (h *indexHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error
 		ShowWIP: req.URL.Query().Get("events") == "all" || authenticatedUser.UserSpec == dmitshur,
 	}
 	activity.ShowRaw, _ = strconv.ParseBool(req.URL.Query().Get("raw"))
-	err = htmlg.RenderComponents(w, activity)
+	err = htmlg.RenderComponents(w,
+		activityFilter{URL: req.URL},
+		activity,
+		olderActivity{URL: req.URL, Events: events, RetainedSince: retainedSince(req.Context(), h.events)},
+	)
 	if err != nil {
 		return err
 	}
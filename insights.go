@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	statepkg "dmitri.shuralyov.com/state"
+	homecomponent "github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/htmlg"
+	issuescomponent "github.com/shurcooL/issuesapp/component"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var insightsHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>{{.FullName}} - Insights</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/index/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+// insightsWeeks is the number of weeks of commit frequency shown on insights pages.
+const insightsWeeks = 52
+
+// repositoryInsightsHandler is a handler for displaying insights of a repository.
+type repositoryInsightsHandler struct {
+	Repo repoInfo
+
+	code         *code.Service
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+	gitUsers     code.GitUsers
+}
+
+func (h *repositoryInsightsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	var counts issueChangeCounts
+	repo := issues.RepoSpec{URI: h.Repo.Spec}
+	counts.OpenIssues, err = h.issues.Count(req.Context(), repo, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	counts.ClosedIssues, err = h.issues.Count(req.Context(), repo, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueClosed)})
+	if err != nil {
+		return err
+	}
+	counts.OpenChanges, err = h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+	counts.ClosedChanges, err = h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterClosedMerged})
+	if err != nil {
+		return err
+	}
+
+	commits, err := listCommits(req.Context(), h.Repo.Dir, "master", ":", h.gitUsers)
+	if err != nil {
+		return err
+	}
+	graph, err := h.code.ModuleGraph(req.Context(), h.Repo.Spec)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = insightsHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		FullName      string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		FullName:      "Repository " + path.Base(h.Repo.Spec),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, homecomponent.RepositoryTabNav(homecomponent.InsightsTab, h.Repo.Path, h.Repo.Packages, counts.OpenIssues, counts.OpenChanges))
+	if err != nil {
+		return err
+	}
+
+	err = htmlg.RenderComponents(w, insights{
+		Commits:       commits,
+		Now:           time.Now(),
+		Counts:        &counts,
+		GoGetRequests: metrics.GoGetRequestsWithin(h.Repo.Spec),
+	}, moduleGraph(graph))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// directoryInsightsHandler is a handler for displaying insights of a single directory.
+type directoryInsightsHandler struct {
+	Repo    repoInfo
+	PkgPath string
+	Dir     *code.Directory
+
+	notification notification.Service
+	users        users.Service
+	gitUsers     code.GitUsers
+}
+
+func (h *directoryInsightsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	commits, err := listCommits(req.Context(), h.Repo.Dir, "master", directoryGitPathspec(h.Dir), h.gitUsers)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var fullName string
+	if h.Dir.Package == nil {
+		fullName = "Directory " + path.Base(h.Dir.ImportPath)
+	} else if h.Dir.Package.IsCommand() {
+		fullName = "Command " + path.Base(h.Dir.ImportPath)
+	} else {
+		fullName = "Package " + h.Dir.Package.Name
+	}
+	err = insightsHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		FullName      string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		FullName:      fullName,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Dir.ImportPath)))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, directoryTabnav(homecomponent.InsightsTab, h.PkgPath))
+	if err != nil {
+		return err
+	}
+
+	err = htmlg.RenderComponents(w, insights{
+		Commits:       commits,
+		Now:           time.Now(),
+		GoGetRequests: metrics.GoGetRequestsWithin(h.Dir.ImportPath),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// issueChangeCounts are counts of issues and changes in a repository.
+type issueChangeCounts struct {
+	OpenIssues, ClosedIssues   uint64
+	OpenChanges, ClosedChanges uint64
+}
+
+// insights displays an overview of a repository or directory.
+type insights struct {
+	Commits       []Commit           // Commits, newest first.
+	Now           time.Time          // Current time, used as the end of commit frequency.
+	Counts        *issueChangeCounts // Counts of issues and changes, or nil if not applicable.
+	GoGetRequests uint64             // Number of ?go-get=1 requests since process start.
+}
+
+func (i insights) Render() []*html.Node {
+	var ns []*html.Node
+
+	ns = append(ns, htmlg.H3(htmlg.Text("Commit frequency")))
+	ns = append(ns, commitFrequencyChart{Weeks: commitFrequency(i.Commits, i.Now, insightsWeeks)}.Render()...)
+
+	ns = append(ns, htmlg.H3(htmlg.Text("Top contributors")))
+	if contributors := topContributors(i.Commits, 10); len(contributors) > 0 {
+		var items []*html.Node
+		for _, c := range contributors {
+			items = append(items, c.Render()...)
+		}
+		ns = append(ns, htmlg.DivClass("list-entry-border", items...))
+	} else {
+		ns = append(ns, homecomponent.BlankSlate{
+			Content: htmlg.Nodes{htmlg.Text("There are no commits.")},
+		}.Render()...)
+	}
+
+	ns = append(ns, htmlg.H3(htmlg.Text("Numbers")))
+	var stats []*html.Node
+	if i.Counts != nil {
+		stats = append(stats,
+			insightsStat("Open issues", i.Counts.OpenIssues),
+			insightsStat("Closed issues", i.Counts.ClosedIssues),
+			insightsStat("Open changes", i.Counts.OpenChanges),
+			insightsStat("Closed or merged changes", i.Counts.ClosedChanges),
+		)
+	}
+	stats = append(stats, insightsStat("Total commits", uint64(len(i.Commits))))
+	stats = append(stats, insightsStat("go get requests since last restart", i.GoGetRequests))
+	ns = append(ns, htmlg.UL(stats...))
+
+	return ns
+}
+
+// insightsStat returns a list item displaying a named count.
+func insightsStat(name string, count uint64) *html.Node {
+	return htmlg.LI(
+		htmlg.Text(name+": "),
+		htmlg.Strong(fmt.Sprint(count)),
+	)
+}
+
+// commitFrequency returns the number of commits authored
+// in each of the last weeks weeks before now, oldest first.
+// Commits authored outside of that range are not counted.
+func commitFrequency(commits []Commit, now time.Time, weeks int) []int {
+	const week = 7 * 24 * time.Hour
+	counts := make([]int, weeks)
+	for _, c := range commits {
+		ago := now.Sub(c.AuthorTime)
+		if ago < 0 {
+			continue
+		}
+		w := int(ago / week)
+		if w >= weeks {
+			continue
+		}
+		counts[weeks-1-w]++
+	}
+	return counts
+}
+
+// commitFrequencyChart displays a bar chart of weekly commit counts.
+type commitFrequencyChart struct {
+	Weeks []int // Commit counts per week, oldest first.
+}
+
+func (c commitFrequencyChart) Render() []*html.Node {
+	const height = 60 // Height of the chart in pixels.
+	max := 0
+	for _, n := range c.Weeks {
+		if n > max {
+			max = n
+		}
+	}
+	chart := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: fmt.Sprintf("display: flex; align-items: flex-end; height: %dpx; border-bottom: 1px solid #ddd;", height)}},
+	}
+	for i, n := range c.Weeks {
+		barHeight := 0
+		if max > 0 {
+			barHeight = n * height / max
+		}
+		bar := &html.Node{
+			Type: html.ElementNode, Data: atom.Div.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Style.String(), Val: fmt.Sprintf("flex-grow: 1; margin-right: 1px; height: %dpx; background-color: #6cc644;", barHeight)},
+				{Key: atom.Title.String(), Val: fmt.Sprintf("%d commits %d weeks ago", n, len(c.Weeks)-1-i)},
+			},
+		}
+		chart.AppendChild(bar)
+	}
+	return []*html.Node{chart}
+}
+
+// contributor is a commit author along with their number of commits.
+type contributor struct {
+	Author  users.User
+	Commits int
+}
+
+func (c contributor) Render() []*html.Node {
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "display: flex; align-items: center;"}},
+	}
+	avatar := issuescomponent.Avatar{User: c.Author, Size: 24}.Render()
+	name := htmlg.Span(htmlg.Text(c.Author.Name))
+	name.Attr = append(name.Attr, html.Attribute{Key: atom.Style.String(), Val: "flex-grow: 1; margin-left: 8px;"})
+	htmlg.AppendChildren(div, avatar...)
+	div.AppendChild(name)
+	div.AppendChild(htmlg.Text(fmt.Sprintf("%d commits", c.Commits)))
+	return []*html.Node{div}
+}
+
+// topContributors returns up to n authors of commits with the most commits,
+// sorted by number of commits in descending order.
+// Authors known via the git user mapping are identified by their user spec,
+// others by their email address.
+func topContributors(commits []Commit, n int) []contributor {
+	type key struct {
+		User  users.UserSpec
+		Email string
+	}
+	var (
+		byKey = make(map[key]*contributor)
+		cs    []*contributor
+	)
+	for _, c := range commits {
+		k := key{User: c.Author.UserSpec}
+		if k.User == (users.UserSpec{}) {
+			k.Email = c.Author.Email
+		}
+		if cont, ok := byKey[k]; ok {
+			cont.Commits++
+			continue
+		}
+		cont := &contributor{Author: c.Author, Commits: 1}
+		byKey[k] = cont
+		cs = append(cs, cont)
+	}
+	// Stable sort keeps authors with equal counts in order of most recent commit.
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].Commits > cs[j].Commits })
+	if len(cs) > n {
+		cs = cs[:n]
+	}
+	contributors := make([]contributor, len(cs))
+	for i, c := range cs {
+		contributors[i] = *c
+	}
+	return contributors
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/users"
+)
+
+func TestCommitFrequency(t *testing.T) {
+	now := time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+	commits := []Commit{
+		{AuthorTime: now.Add(time.Hour)},        // In the future, not counted.
+		{AuthorTime: now.Add(-time.Hour)},       // This week.
+		{AuthorTime: now.Add(-2 * time.Hour)},   // This week.
+		{AuthorTime: now.AddDate(0, 0, -8)},     // Last week.
+		{AuthorTime: now.AddDate(0, 0, -7*3-1)}, // Too old, not counted.
+	}
+	got := commitFrequency(commits, now, 3)
+	want := []int{0, 1, 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTopContributors(t *testing.T) {
+	alice := users.User{UserSpec: users.UserSpec{ID: 1, Domain: "example.com"}, Name: "Alice"}
+	bob := users.User{Name: "Bob", Email: "bob@example.com"}
+	carol := users.User{Name: "Carol", Email: "carol@example.com"}
+	commits := []Commit{
+		{Author: carol},
+		{Author: bob},
+		{Author: alice},
+		{Author: bob},
+		{Author: alice},
+		{Author: alice},
+	}
+	got := topContributors(commits, 2)
+	want := []contributor{
+		{Author: alice, Commits: 3},
+		{Author: bob, Commits: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,324 @@
+package code
+
+import (
+	"bytes"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"html/template"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PackageDoc is the full API documentation of a Go package.
+type PackageDoc struct {
+	Consts   []Value
+	Vars     []Value
+	Funcs    []Func
+	Types    []Type
+	Examples []Example // Package examples.
+}
+
+// Value is a documented const or var declaration.
+type Value struct {
+	Names    []string
+	DeclHTML string // Declaration source as HTML, with references linked.
+	DocHTML  string
+	Pos      Pos
+}
+
+// Func is a documented function or method.
+type Func struct {
+	Name     string
+	Recv     string // Receiver type of a method, e.g., "*T". Empty string for functions.
+	DeclHTML string // Declaration source as HTML, with references linked.
+	DocHTML  string
+	Pos      Pos
+	Examples []Example
+}
+
+// ID returns the anchor ID of f, e.g., "F" or "T.M".
+func (f Func) ID() string {
+	if f.Recv == "" {
+		return f.Name
+	}
+	return strings.TrimPrefix(f.Recv, "*") + "." + f.Name
+}
+
+// Type is a documented type, along with its associated declarations.
+type Type struct {
+	Name     string
+	DeclHTML string // Declaration source as HTML, with references linked.
+	DocHTML  string
+	Pos      Pos
+	Consts   []Value
+	Vars     []Value
+	Funcs    []Func // Functions returning this type.
+	Methods  []Func
+	Examples []Example
+}
+
+// Example is an example function found in package tests.
+type Example struct {
+	Suffix  string // Example suffix, e.g., "multiple". Empty string if none.
+	DocHTML string
+	Code    string // Formatted body of the example function.
+	Play    string // Formatted complete program that runs the example, if available.
+	Output  string // Expected output, if any.
+}
+
+// Pos is a position of a declaration within a package directory.
+type Pos struct {
+	File string // Name of file, e.g., "foo.go".
+	Line int
+}
+
+// newPackageDoc creates full API documentation for the documented
+// package dpkg, whose files are files parsed using fset.
+func newPackageDoc(fset *token.FileSet, files []*ast.File, dpkg *doc.Package) *PackageDoc {
+	r := docRenderer{
+		fset:     fset,
+		comments: make(map[string][]*ast.CommentGroup),
+		imports:  make(map[string]map[string]string),
+		types:    make(map[string]bool),
+	}
+	for _, f := range files {
+		filename := fset.Position(f.Package).Filename
+		r.comments[filename] = f.Comments
+		r.imports[filename] = fileImports(f)
+	}
+	for _, t := range dpkg.Types {
+		r.types[t.Name] = true
+	}
+
+	pd := &PackageDoc{
+		Consts:   r.values(dpkg.Consts),
+		Vars:     r.values(dpkg.Vars),
+		Funcs:    r.funcs(dpkg.Funcs),
+		Examples: r.examples(dpkg.Examples),
+	}
+	for _, t := range dpkg.Types {
+		pd.Types = append(pd.Types, Type{
+			Name:     t.Name,
+			DeclHTML: r.declHTML(t.Decl),
+			DocHTML:  docHTML(t.Doc),
+			Pos:      r.pos(t.Decl),
+			Consts:   r.values(t.Consts),
+			Vars:     r.values(t.Vars),
+			Funcs:    r.funcs(t.Funcs),
+			Methods:  r.funcs(t.Methods),
+			Examples: r.examples(t.Examples),
+		})
+	}
+	return pd
+}
+
+// docRenderer renders declarations of a single package.
+type docRenderer struct {
+	fset     *token.FileSet
+	comments map[string][]*ast.CommentGroup // File name -> comments.
+	imports  map[string]map[string]string   // File name -> package name -> import path.
+	types    map[string]bool                // Set of exported type names in the package.
+}
+
+func (r docRenderer) values(vs []*doc.Value) []Value {
+	var values []Value
+	for _, v := range vs {
+		values = append(values, Value{
+			Names:    v.Names,
+			DeclHTML: r.declHTML(v.Decl),
+			DocHTML:  docHTML(v.Doc),
+			Pos:      r.pos(v.Decl),
+		})
+	}
+	return values
+}
+
+func (r docRenderer) funcs(fs []*doc.Func) []Func {
+	var funcs []Func
+	for _, f := range fs {
+		funcs = append(funcs, Func{
+			Name:     f.Name,
+			Recv:     f.Recv,
+			DeclHTML: r.declHTML(f.Decl),
+			DocHTML:  docHTML(f.Doc),
+			Pos:      r.pos(f.Decl),
+			Examples: r.examples(f.Examples),
+		})
+	}
+	return funcs
+}
+
+func (r docRenderer) examples(es []*doc.Example) []Example {
+	var examples []Example
+	for _, e := range es {
+		ex := Example{
+			Suffix:  e.Suffix,
+			DocHTML: docHTML(e.Doc),
+			Code:    exampleCode(r.fset, e),
+			Output:  e.Output,
+		}
+		if e.Play != nil {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, r.fset, e.Play); err == nil {
+				ex.Play = buf.String()
+			}
+		}
+		examples = append(examples, ex)
+	}
+	return examples
+}
+
+// exampleCode returns the formatted body of example e.
+func exampleCode(fset *token.FileSet, e *doc.Example) string {
+	var buf bytes.Buffer
+	err := (&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&buf, fset, &printer.CommentedNode{Node: e.Code, Comments: e.Comments})
+	if err != nil {
+		return ""
+	}
+	code := buf.String()
+	if _, ok := e.Code.(*ast.BlockStmt); !ok {
+		return code
+	}
+	// Strip the surrounding braces, and unindent the body by one level.
+	code = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(code, "{"), "}"))
+	return strings.ReplaceAll(code, "\n\t", "\n")
+}
+
+func (r docRenderer) pos(decl ast.Decl) Pos {
+	p := r.fset.Position(decl.Pos())
+	return Pos{File: filepath.Base(p.Filename), Line: p.Line}
+}
+
+// declHTML renders the source of declaration decl as HTML,
+// linking references to exported types of this package and
+// to identifiers of imported packages.
+func (r docRenderer) declHTML(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		dd := *d
+		dd.Doc, dd.Body = nil, nil
+		decl = &dd
+	case *ast.GenDecl:
+		dd := *d
+		dd.Doc = nil
+		decl = &dd
+	}
+	filename := r.fset.Position(decl.Pos()).Filename
+	var buf bytes.Buffer
+	err := (&printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}).Fprint(&buf, r.fset, &printer.CommentedNode{Node: decl, Comments: r.comments[filename]})
+	if err != nil {
+		return template.HTMLEscapeString(err.Error())
+	}
+	return linkIdents(buf.Bytes(), r.imports[filename], r.types)
+}
+
+// linkIdents converts Go source src to HTML, linking qualified identifiers
+// of packages in imports, and identifiers of exported types in types.
+func linkIdents(src []byte, imports map[string]string, types map[string]bool) string {
+	type tok struct {
+		off int
+		tok token.Token
+		lit string
+	}
+	var toks []tok
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", -1, len(src)), src, nil, scanner.ScanComments)
+	for {
+		pos, t, lit := s.Scan()
+		if t == token.EOF {
+			break
+		}
+		toks = append(toks, tok{off: fset.Position(pos).Offset, tok: t, lit: lit})
+	}
+
+	var buf bytes.Buffer
+	last := 0 // Offset in src up to which output has been written.
+	link := func(start, end int, href string) {
+		template.HTMLEscape(&buf, src[last:start])
+		buf.WriteString(`<a href="` + template.HTMLEscapeString(href) + `">`)
+		template.HTMLEscape(&buf, src[start:end])
+		buf.WriteString(`</a>`)
+		last = end
+	}
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.tok != token.IDENT || (i > 0 && (toks[i-1].tok == token.PERIOD || toks[i-1].tok == token.TYPE)) {
+			// Skip selectors and names of types being declared.
+			continue
+		}
+		if importPath, ok := imports[t.lit]; ok && i+2 < len(toks) && toks[i+1].tok == token.PERIOD && toks[i+2].tok == token.IDENT {
+			sel := toks[i+2]
+			link(t.off, sel.off+len(sel.lit), packageURL(importPath)+"#"+sel.lit)
+			i += 2
+		} else if types[t.lit] {
+			link(t.off, t.off+len(t.lit), "#"+t.lit)
+		}
+	}
+	template.HTMLEscape(&buf, src[last:])
+	return buf.String()
+}
+
+// packageURL returns the URL of documentation of the package with
+// the specified import path. Packages served by home are linked to
+// directly, others are linked to on pkg.go.dev.
+func packageURL(importPath string) string {
+	if strings.HasPrefix(importPath, "dmitri.shuralyov.com/") {
+		return importPath[len("dmitri.shuralyov.com"):]
+	}
+	return "https://pkg.go.dev/" + importPath
+}
+
+// fileImports returns the imports of file f, keyed by package name.
+// The package name of imports without an explicit name is guessed
+// from the import path.
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, imp := range f.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		var name string
+		if imp.Name != nil {
+			name = imp.Name.Name
+		} else {
+			name = guessPackageName(importPath)
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		imports[name] = importPath
+	}
+	return imports
+}
+
+// guessPackageName guesses the package name of the package with
+// the specified import path, taking into account major version
+// suffixes like "/v2" and ".v2", and "go-" prefixes.
+func guessPackageName(importPath string) string {
+	elem := path.Base(importPath)
+	if len(elem) >= 2 && elem[0] == 'v' && isDigits(elem[1:]) && path.Dir(importPath) != "." {
+		elem = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(elem, ".v"); i > 0 && isDigits(elem[i+len(".v"):]) {
+		elem = elem[:i]
+	}
+	elem = strings.TrimPrefix(elem, "go-")
+	return strings.NewReplacer("-", "_", ".", "_").Replace(elem)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
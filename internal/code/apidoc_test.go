@@ -0,0 +1,135 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestPackageDoc(t *testing.T) {
+	fs := mapfs.New(map[string]string{
+		"greet/greet.go": `// Package greet greets.
+package greet
+
+import (
+	"io"
+
+	"dmitri.shuralyov.com/other"
+)
+
+// Greeting is the default greeting.
+const Greeting = "Hello"
+
+// Greeter greets.
+type Greeter struct {
+	W io.Writer // Destination.
+	O other.Option
+
+	unexported int
+}
+
+// New returns a Greeter that writes to w.
+func New(w io.Writer) *Greeter { return &Greeter{W: w} }
+
+// Greet greets name.
+func (g *Greeter) Greet(name string) {}
+`,
+		"greet/example_test.go": `package greet_test
+
+import "dmitri.shuralyov.com/greet"
+
+func Example() {
+	println(greet.Greeting)
+}
+
+func ExampleGreeter_Greet_twice() {
+	g := greet.New(nil)
+	g.Greet("a")
+	g.Greet("b")
+	// Output: ab
+}
+`,
+	})
+	pkg, err := loadPackage(fs, "/greet", "dmitri.shuralyov.com/greet")
+	if err != nil {
+		t.Fatal("loadPackage:", err)
+	}
+	if pkg == nil || pkg.Doc == nil {
+		t.Fatal("loadPackage: got no package documentation")
+	}
+	got := pkg.Doc
+	for i := range got.Examples {
+		got.Examples[i].Play = "" // Not worth checking exactly.
+	}
+	for i := range got.Types {
+		for j := range got.Types[i].Methods {
+			for k := range got.Types[i].Methods[j].Examples {
+				got.Types[i].Methods[j].Examples[k].Play = ""
+			}
+		}
+	}
+	want := &PackageDoc{
+		Consts: []Value{{
+			Names:    []string{"Greeting"},
+			DeclHTML: `const Greeting = &#34;Hello&#34;`,
+			DocHTML:  docHTML("Greeting is the default greeting.\n"),
+			Pos:      Pos{File: "greet.go", Line: 11},
+		}},
+		Types: []Type{{
+			Name: "Greeter",
+			DeclHTML: `type Greeter struct {
+	W <a href="https://pkg.go.dev/io#Writer">io.Writer</a> // Destination.
+	O <a href="/other#Option">other.Option</a>
+	// contains filtered or unexported fields
+}`,
+			DocHTML: docHTML("Greeter greets.\n"),
+			Pos:     Pos{File: "greet.go", Line: 14},
+			Funcs: []Func{{
+				Name:     "New",
+				DeclHTML: `func New(w <a href="https://pkg.go.dev/io#Writer">io.Writer</a>) *<a href="#Greeter">Greeter</a>`,
+				DocHTML:  docHTML("New returns a Greeter that writes to w.\n"),
+				Pos:      Pos{File: "greet.go", Line: 22},
+			}},
+			Methods: []Func{{
+				Name:     "Greet",
+				Recv:     "*Greeter",
+				DeclHTML: `func (g *<a href="#Greeter">Greeter</a>) Greet(name string)`,
+				DocHTML:  docHTML("Greet greets name.\n"),
+				Pos:      Pos{File: "greet.go", Line: 25},
+				Examples: []Example{{
+					Suffix: "twice",
+					Code:   "g := greet.New(nil)\ng.Greet(\"a\")\ng.Greet(\"b\")\n// Output: ab",
+					Output: "ab\n",
+				}},
+			}},
+		}},
+		Examples: []Example{{
+			Code: "println(greet.Greeting)",
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+	if id := got.Types[0].Methods[0].ID(); id != "Greeter.Greet" {
+		t.Errorf("method ID: got %q, want %q", id, "Greeter.Greet")
+	}
+}
+
+func TestGuessPackageName(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{"io", "io"},
+		{"net/http", "http"},
+		{"github.com/google/go-github/v32/github", "github"},
+		{"example.com/mod/v2", "mod"},
+		{"gopkg.in/yaml.v2", "yaml"},
+		{"github.com/user/go-thing", "thing"},
+	} {
+		if got := guessPackageName(tt.in); got != tt.want {
+			t.Errorf("guessPackageName(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
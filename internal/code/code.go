@@ -23,8 +23,12 @@ type Service struct {
 	reposDir string
 
 	mu           sync.RWMutex
-	dirs         []*Directory          // Sorted.
-	byImportPath map[string]*Directory // Key is import path.
+	dirs         []*Directory              // Sorted.
+	byImportPath map[string]*Directory     // Key is import path.
+	redirects    map[string]string         // Renamed repositories. Key is old repo root, value is new repo root.
+	owners       map[string]users.UserSpec // Repository owners. Key is repo root.
+	modules      map[string]moduleInfo     // Cached module information. Key is module path.
+	hooks        []func(repoRoot string)   // Called after code in a repository is rediscovered.
 
 	notification notification.Service
 	events       events.ExternalService
@@ -38,11 +42,22 @@ func NewService(reposDir string, notification notification.Service, events event
 	if err != nil {
 		return nil, err
 	}
+	redirects, err := loadRedirects(reposDir, dirs)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := loadOwners(reposDir, dirs)
+	if err != nil {
+		return nil, err
+	}
 	return &Service{
 		reposDir: reposDir,
 
 		dirs:         dirs,
 		byImportPath: byImportPath,
+		redirects:    redirects,
+		owners:       owners,
+		modules:      make(map[string]moduleInfo),
 
 		notification: notification,
 		events:       events,
@@ -94,12 +109,22 @@ func (s *Service) CreateRepo(ctx context.Context, repoSpec, description string)
 		return os.ErrExist
 	}
 
-	// Create bare git repo.
-	cmd := exec.Command("git", "init", "--bare", filepath.Join(s.reposDir, filepath.FromSlash(repoSpec)))
+	// Create bare git repo, and record its owner.
+	gitDir := filepath.Join(s.reposDir, filepath.FromSlash(repoSpec))
+	cmd := exec.Command("git", "init", "--bare", gitDir)
 	err = cmd.Run()
 	if err != nil {
 		return err
 	}
+	cmd = exec.Command("git", "--git-dir", gitDir, "config", ownerConfigKey, fmt.Sprintf("%d@%s", currentUser.ID, currentUser.Domain))
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+	err = setConfig(ctx, gitDir, descriptionConfigKey, description)
+	if err != nil {
+		return err
+	}
 
 	// Empty repository.
 	dir := &Directory{
@@ -109,6 +134,8 @@ func (s *Service) CreateRepo(ctx context.Context, repoSpec, description string)
 	s.mu.Lock()
 	insertDir(&s.dirs, dir)
 	s.byImportPath[repoSpec] = dir
+	delete(s.redirects, repoSpec)
+	s.owners[repoSpec] = currentUser.UserSpec
 	s.mu.Unlock()
 
 	// Watch the newly created repository.
@@ -130,6 +157,75 @@ func (s *Service) CreateRepo(ctx context.Context, repoSpec, description string)
 	return err
 }
 
+// ownerConfigKey is the git config key where the owner
+// of a repository is recorded, as a "{ID}@{Domain}" user spec.
+const ownerConfigKey = "home.owner"
+
+// RepoOwner returns the owner of the repository with the specified
+// repo root, as recorded when the repository was created.
+// It returns a zero user spec if the repository doesn't record
+// an owner, which is the case for repositories created before
+// owners started being recorded.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) RepoOwner(_ context.Context, repoRoot string) (users.UserSpec, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	owner, ok := s.owners[repoRoot]
+	if !ok {
+		return users.UserSpec{}, os.ErrNotExist
+	}
+	return owner, nil
+}
+
+// ListOwnedRepos lists repo roots of repositories owned by owner,
+// in sorted order. A zero owner lists repositories that don't
+// record an owner.
+func (s *Service) ListOwnedRepos(_ context.Context, owner users.UserSpec) ([]string, error) {
+	s.mu.RLock()
+	var repoRoots []string
+	for repoRoot, o := range s.owners {
+		if o == owner {
+			repoRoots = append(repoRoots, repoRoot)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(repoRoots)
+	return repoRoots, nil
+}
+
+// loadOwners loads owners of repositories among dirs
+// in the repository store at reposDir.
+// The returned map is keyed by repo root.
+func loadOwners(reposDir string, dirs []*Directory) (map[string]users.UserSpec, error) {
+	owners := make(map[string]users.UserSpec)
+	for _, d := range dirs {
+		if !d.IsRepoRoot() {
+			continue
+		}
+		owner, err := readOwner(context.Background(), filepath.Join(reposDir, filepath.FromSlash(d.RepoRoot)))
+		if err != nil {
+			return nil, err
+		}
+		owners[d.RepoRoot] = owner
+	}
+	return owners, nil
+}
+
+// readOwner reads the owner recorded in the repository at gitDir.
+// It returns a zero user spec if no owner is recorded.
+func readOwner(ctx context.Context, gitDir string) (users.UserSpec, error) {
+	v, ok, err := getConfig(ctx, gitDir, ownerConfigKey)
+	if err != nil || !ok {
+		return users.UserSpec{}, err
+	}
+	var owner users.UserSpec
+	_, err = fmt.Sscanf(v, "%d@%s", &owner.ID, &owner.Domain)
+	if err != nil {
+		return users.UserSpec{}, fmt.Errorf("bad %s value %q: %v", ownerConfigKey, v, err)
+	}
+	return owner, nil
+}
+
 // insertDir inserts directory dir into the sorted slice s,
 // keeping the slice sorted. s must not already contain dir.
 func insertDir(s *[]*Directory, dir *Directory) {
@@ -154,8 +250,14 @@ func (s *Service) Rediscover(repoRoot string) (added, removed []*Directory, err
 	oldDirs := replaceDirs(&s.dirs, repoRoot, newDirs)
 	replaceDirsMap(s.byImportPath, oldDirs, newDirs)
 	populateLicenseRoot(newDirs, s.byImportPath)
+	s.forgetModules(repoRoot)
+	hooks := s.hooks
 	s.mu.Unlock()
 
+	for _, f := range hooks {
+		f(repoRoot)
+	}
+
 	// Compute added, removed packages.
 	for _, d := range newDirs {
 		if d.Package == nil || containsPackage(oldDirs, d.ImportPath) {
@@ -173,6 +275,14 @@ func (s *Service) Rediscover(repoRoot string) (added, removed []*Directory, err
 	return added, removed, nil
 }
 
+// OnRediscover registers f to be called after code in a repository
+// is rediscovered, such as after a push. f must not block.
+func (s *Service) OnRediscover(f func(repoRoot string)) {
+	s.mu.Lock()
+	s.hooks = append(s.hooks, f)
+	s.mu.Unlock()
+}
+
 // replaceDirs replaces directories with repoRoot in the sorted slice s
 // with newDirs, keeping the slice sorted. It returns old directories that got replaced.
 func replaceDirs(s *[]*Directory, repoRoot string, newDirs []*Directory) (oldDirs []*Directory) {
@@ -234,8 +344,17 @@ type Directory struct {
 	RepoPackages int    // Number of packages contained by repository (if any, otherwise 0).
 
 	// LicenseRoot is the import path corresponding to this or nearest parent directory
-	// that contains a LICENSE file, or empty string if there isn't such a directory.
+	// that contains a license file, or empty string if there isn't such a directory.
 	LicenseRoot string
+	LicenseFile string // Name of license file in LicenseRoot directory, like "LICENSE" or "COPYING.md".
+	License     string // SPDX identifier of license in LicenseFile, or empty string if it isn't recognized.
+
+	// ModuleRoot is the import path corresponding to this or nearest parent directory
+	// that is the root of a nested module (i.e., it contains a go.mod file and
+	// is not the repository root), or empty string if there isn't such a directory.
+	// Directories that aren't inside a nested module belong to the module
+	// corresponding to the repository root.
+	ModuleRoot string
 
 	Package *Package
 }
@@ -246,14 +365,32 @@ func (d Directory) WithinRepo() bool { return d.RepoRoot != "" }
 // IsRepoRoot reports whether directory d corresponds to a repository root.
 func (d Directory) IsRepoRoot() bool { return d.RepoRoot == d.ImportPath }
 
-// HasLicenseFile reports whether directory d contains a LICENSE file.
+// Module returns the module path of the module that contains directory d.
+// It returns the empty string if directory d is not in a repository.
+func (d Directory) Module() string {
+	if d.ModuleRoot != "" {
+		return d.ModuleRoot
+	}
+	return d.RepoRoot
+}
+
+// IsModuleRoot reports whether directory d corresponds to a module root.
+// Each repository root is a module root, and so is each nested module.
+func (d Directory) IsModuleRoot() bool { return d.WithinRepo() && d.Module() == d.ImportPath }
+
+// HasLicenseFile reports whether directory d contains a license file.
 func (d Directory) HasLicenseFile() bool { return d.LicenseRoot == d.ImportPath }
 
 // Package represents a Go package inside a repository store.
 type Package struct {
 	Name     string
-	Synopsis string // Package documentation synopsis.
-	DocHTML  string // Package documentation HTML.
+	Synopsis string   // Package documentation synopsis.
+	DocHTML  string   // Package documentation HTML.
+	Imports  []string // Import paths of packages imported by non-test Go files, sorted.
+
+	// Doc is the full API documentation of the package.
+	// It's not included in API responses due to its size.
+	Doc *PackageDoc `json:"-"`
 }
 
 // IsCommand reports whether the package is a command.
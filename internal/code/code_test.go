@@ -10,8 +10,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/shurcooL/events/event"
 	"github.com/shurcooL/home/internal/code"
@@ -43,7 +45,7 @@ func TestCode(t *testing.T) {
 	}
 
 	// Create a real HTTP server so we can git push to it.
-	gitHandler, err := code.NewGitHandler(service, filepath.Join(tempDir, "repositories"), "", events, users, nil, func(req *http.Request) *http.Request { return req })
+	gitHandler, err := code.NewGitHandler(service, filepath.Join(tempDir, "repositories"), "", events, users, nil, nil, func(req *http.Request) *http.Request { return req })
 	if err != nil {
 		t.Fatal("code.NewGitHandler:", err)
 	}
@@ -79,6 +81,7 @@ using kebab-case naming convention.
 Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers">https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers</a>.
 </p>
 `,
+					Imports: []string{"github.com/shurcooL/graphql/ident", "strings"},
 				},
 			},
 			{
@@ -86,6 +89,7 @@ Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "scratch",
 					Synopsis: "Package scratch is used for testing.",
@@ -100,8 +104,10 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
-					Name: "main",
+					Name:    "main",
+					Imports: []string{"fmt"},
 				},
 			},
 			{
@@ -109,12 +115,14 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 			},
 			{
 				ImportPath:   "dmitri.shuralyov.com/scratch/image/jpeg",
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "jpeg",
 					Synopsis: "Package jpeg implements a tiny subset of a JPEG image decoder and encoder.",
@@ -132,6 +140,7 @@ JPEG is defined in ITU-T T.81: <a href="http://www.w3.org/Graphics/JPEG/itu-t81.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "png",
 					Synopsis: "Package png implements a tiny subset of a PNG image decoder and encoder.",
@@ -151,7 +160,7 @@ The PNG specification is at <a href="http://www.w3.org/TR/PNG/">http://www.w3.or
 		if err != nil {
 			t.Fatalf("service.ListDirectories: %v", err)
 		}
-		if !reflect.DeepEqual(got, want) {
+		if got := withoutDocs(got); !reflect.DeepEqual(got, want) {
 			t.Error("initial state: not equal")
 		}
 		if got, want := events.listAndReset(), wantEvents; !reflect.DeepEqual(got, want) {
@@ -190,6 +199,7 @@ using kebab-case naming convention.
 Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers">https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers</a>.
 </p>
 `,
+					Imports: []string{"github.com/shurcooL/graphql/ident", "strings"},
 				},
 			},
 			{
@@ -202,6 +212,7 @@ Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "scratch",
 					Synopsis: "Package scratch is used for testing.",
@@ -216,8 +227,10 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
-					Name: "main",
+					Name:    "main",
+					Imports: []string{"fmt"},
 				},
 			},
 			{
@@ -225,12 +238,14 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 			},
 			{
 				ImportPath:   "dmitri.shuralyov.com/scratch/image/jpeg",
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "jpeg",
 					Synopsis: "Package jpeg implements a tiny subset of a JPEG image decoder and encoder.",
@@ -248,6 +263,7 @@ JPEG is defined in ITU-T T.81: <a href="http://www.w3.org/Graphics/JPEG/itu-t81.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "png",
 					Synopsis: "Package png implements a tiny subset of a PNG image decoder and encoder.",
@@ -275,7 +291,7 @@ The PNG specification is at <a href="http://www.w3.org/TR/PNG/">http://www.w3.or
 		if err != nil {
 			t.Fatalf("service.ListDirectories: %v", err)
 		}
-		if !reflect.DeepEqual(got, want) {
+		if got := withoutDocs(got); !reflect.DeepEqual(got, want) {
 			t.Error("after empty repository created: not equal")
 		}
 		if got, want := events.listAndReset(), wantEvents; !reflect.DeepEqual(got, want) {
@@ -316,6 +332,7 @@ using kebab-case naming convention.
 Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers">https://en.wikipedia.org/wiki/Naming_convention_(programming)#Multiple-word_identifiers</a>.
 </p>
 `,
+					Imports: []string{"github.com/shurcooL/graphql/ident", "strings"},
 				},
 			},
 			{
@@ -323,6 +340,7 @@ Reference: <a href="https://en.wikipedia.org/wiki/Naming_convention_(programming
 				RepoRoot:     "dmitri.shuralyov.com/new/repo",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/new/repo",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "scratch",
 					Synopsis: "Package scratch is used for testing.",
@@ -337,8 +355,10 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/new/repo",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/new/repo",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
-					Name: "main",
+					Name:    "main",
+					Imports: []string{"fmt"},
 				},
 			},
 			{
@@ -346,12 +366,14 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/new/repo",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/new/repo/image",
+				LicenseFile:  "LICENSE",
 			},
 			{
 				ImportPath:   "dmitri.shuralyov.com/new/repo/image/jpeg",
 				RepoRoot:     "dmitri.shuralyov.com/new/repo",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/new/repo/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "jpeg",
 					Synopsis: "Package jpeg implements a tiny subset of a JPEG image decoder and encoder.",
@@ -369,6 +391,7 @@ JPEG is defined in ITU-T T.81: <a href="http://www.w3.org/Graphics/JPEG/itu-t81.
 				RepoRoot:     "dmitri.shuralyov.com/new/repo",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/new/repo/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "png",
 					Synopsis: "Package png implements a tiny subset of a PNG image decoder and encoder.",
@@ -386,6 +409,7 @@ The PNG specification is at <a href="http://www.w3.org/TR/PNG/">http://www.w3.or
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "scratch",
 					Synopsis: "Package scratch is used for testing.",
@@ -400,8 +424,10 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
-					Name: "main",
+					Name:    "main",
+					Imports: []string{"fmt"},
 				},
 			},
 			{
@@ -409,12 +435,14 @@ Package scratch is used for testing.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 			},
 			{
 				ImportPath:   "dmitri.shuralyov.com/scratch/image/jpeg",
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "jpeg",
 					Synopsis: "Package jpeg implements a tiny subset of a JPEG image decoder and encoder.",
@@ -432,6 +460,7 @@ JPEG is defined in ITU-T T.81: <a href="http://www.w3.org/Graphics/JPEG/itu-t81.
 				RepoRoot:     "dmitri.shuralyov.com/scratch",
 				RepoPackages: 4,
 				LicenseRoot:  "dmitri.shuralyov.com/scratch/image",
+				LicenseFile:  "LICENSE",
 				Package: &code.Package{
 					Name:     "png",
 					Synopsis: "Package png implements a tiny subset of a PNG image decoder and encoder.",
@@ -486,7 +515,7 @@ The PNG specification is at <a href="http://www.w3.org/TR/PNG/">http://www.w3.or
 		if err != nil {
 			t.Fatalf("service.ListDirectories: %v", err)
 		}
-		if !reflect.DeepEqual(got, want) {
+		if got := withoutDocs(got); !reflect.DeepEqual(got, want) {
 			t.Error("after new repository pushed to: not equal")
 		}
 		if got, want := events.listAndReset(), wantEvents; !reflect.DeepEqual(got, want) {
@@ -495,6 +524,70 @@ The PNG specification is at <a href="http://www.w3.org/TR/PNG/">http://www.w3.or
 	}
 }
 
+// withoutDocs returns a copy of dirs with full package
+// documentation left out. It's tested separately.
+func withoutDocs(dirs []*code.Directory) []*code.Directory {
+	var ds []*code.Directory
+	for _, d := range dirs {
+		d := *d
+		if d.Package != nil {
+			p := *d.Package
+			p.Doc = nil
+			d.Package = &p
+		}
+		ds = append(ds, &d)
+	}
+	return ds
+}
+
+// gitEnv returns the environment for running git in tests, with a fixed
+// author and committer. Commit dates are set to date if it's non-zero.
+func gitEnv(date time.Time) []string {
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=Gopher", "GIT_AUTHOR_EMAIL=gopher@example.com",
+		"GIT_COMMITTER_NAME=Gopher", "GIT_COMMITTER_EMAIL=gopher@example.com",
+	)
+	if !date.IsZero() {
+		env = append(env,
+			"GIT_AUTHOR_DATE="+date.Format(time.RFC3339),
+			"GIT_COMMITTER_DATE="+date.Format(time.RFC3339),
+		)
+	}
+	return env
+}
+
+// runGit runs git with args in dir and environment gitEnv(date),
+// and returns its output with leading and trailing space removed.
+func runGit(t *testing.T, dir string, date time.Time, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv(date)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v failed: %v\n%s", cmd.Args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeFiles writes files with the specified contents to dir.
+// Files are keyed by slash-separated names relative to dir.
+// Parent directories are created as needed.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 type mockNotification struct{ notification.Service }
 
 func (mockNotification) SubscribeThread(context.Context, string, string, uint64, []users.UserSpec) error {
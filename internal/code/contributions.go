@@ -0,0 +1,80 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// CountCommits returns the number of commits on master branch of all
+// repositories that were authored at or after since by an author email
+// for which isAuthor reports true. Merge commits are not counted.
+// The counts are keyed by author date in loc, in "2006-01-02" format.
+func (s *Service) CountCommits(ctx context.Context, since time.Time, loc *time.Location, isAuthor func(email string) bool) (map[string]int, error) {
+	s.mu.RLock()
+	dirs := s.dirs
+	s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	authors := make(map[string]bool) // Email -> isAuthor(email).
+	for _, d := range dirs {
+		if !d.IsRepoRoot() {
+			continue
+		}
+		gitDir := filepath.Join(s.reposDir, filepath.FromSlash(d.RepoRoot))
+		err := foreachMasterCommitSince(ctx, gitDir, since, func(email string, t time.Time) {
+			author, ok := authors[email]
+			if !ok {
+				author = isAuthor(email)
+				authors[email] = author
+			}
+			if !author || t.Before(since) {
+				return
+			}
+			counts[t.In(loc).Format("2006-01-02")]++
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// foreachMasterCommitSince calls f with the author email and time of each
+// non-merge commit on master branch of git repo at gitDir that was committed
+// at or after since. If master branch doesn't exist, f is not called.
+func foreachMasterCommitSince(ctx context.Context, gitDir string, since time.Time, f func(email string, t time.Time)) error {
+	cmd := exec.CommandContext(ctx, "git", "log",
+		"--format=tformat:%ae%x00%at",
+		"-z",
+		"--no-merges",
+		"--since="+since.UTC().Format(time.RFC3339),
+		"master")
+	cmd.Dir = gitDir
+	var buf bytes.Buffer
+	cmd.Stdout = &buf
+	err := cmd.Run()
+	if ee, _ := err.(*exec.ExitError); ee != nil && ee.Sys().(syscall.WaitStatus).ExitStatus() == 128 {
+		return nil // Master branch doesn't exist.
+	} else if err != nil {
+		return fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	for b := buf.Bytes(); len(b) != 0; {
+		var (
+			// Calls to readLine match exactly what is specified in --format.
+			authorEmail = readLine(&b)
+			authorDate  = readLine(&b)
+		)
+		timestamp, err := strconv.ParseInt(authorDate, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid time from git log: %v", err)
+		}
+		f(authorEmail, time.Unix(timestamp, 0))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestCountCommits(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "contributions_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	workDir := filepath.Join(tempDir, "work")
+	gitDir := filepath.Join(tempDir, "repositories", "dmitri.shuralyov.com", "counts")
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 12, 0, 0, 0, time.UTC) }
+	commit := func(date time.Time, args ...string) {
+		t.Helper()
+		runGit(t, workDir, date, append([]string{"commit", "-q", "--allow-empty", "-m", "commit"}, args...)...)
+	}
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workDir, day(1), "init", "-q")
+	commit(day(1)) // Before since, not counted.
+	commit(day(2))
+	commit(day(3), "--author=Other <other@example.com>") // Different author, not counted.
+	commit(day(3))
+	commit(day(3))
+	runGit(t, tempDir, day(3), "clone", "-q", "--bare", workDir, gitDir)
+
+	notification := mockNotification{}
+	events := &mockEvents{}
+	users := mockUsers{}
+	service, err := code.NewService(filepath.Join(tempDir, "repositories"), notification, events, users)
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	got, err := service.CountCommits(context.Background(), day(2).Add(-time.Hour), time.UTC, func(email string) bool {
+		return email == "gopher@example.com"
+	})
+	if err != nil {
+		t.Fatal("CountCommits:", err)
+	}
+	want := map[string]int{"2020-01-02": 1, "2020-01-03": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -36,8 +36,8 @@ func discover(reposDir string) ([]*Directory, map[string]*Directory, error) {
 	return dirs, byImportPath, nil
 }
 
-// populateLicenseRoot populates LicenseRoot values for
-// directories that don't directly contain a LICENSE file.
+// populateLicenseRoot populates LicenseRoot, LicenseFile and License values
+// for directories that don't directly contain a license file.
 func populateLicenseRoot(dirs []*Directory, byImportPath map[string]*Directory) {
 	for _, dir := range dirs {
 		if dir.HasLicenseFile() {
@@ -48,6 +48,8 @@ func populateLicenseRoot(dirs []*Directory, byImportPath map[string]*Directory)
 			p, ok := byImportPath[path.Join(elems[:i]...)]
 			if ok && p.HasLicenseFile() {
 				dir.LicenseRoot = p.ImportPath
+				dir.LicenseFile = p.LicenseFile
+				dir.License = p.License
 				break
 			}
 		}
@@ -126,6 +128,7 @@ func walkRepository(gitDir, repoRoot string) ([]*Directory, error) {
 	var (
 		dirs         []*Directory
 		repoPackages int
+		moduleRoots  = make(map[string]bool) // Set of nested module roots, keyed by import path.
 	)
 	err = vfsutil.Walk(fs, "/", func(dir string, fi os.FileInfo, err error) error {
 		if err != nil {
@@ -139,9 +142,20 @@ func walkRepository(gitDir, repoRoot string) ([]*Directory, error) {
 			return filepath.SkipDir
 		}
 		importPath := path.Join(repoRoot, dir)
-		var licenseRoot string
-		if ok, err := hasLicenseFile(fs, dir); err == nil && ok {
-			licenseRoot = importPath
+		var licenseRoot, license string
+		licenseFile, err := FindLicenseFile(fs, dir)
+		if err != nil {
+			return err
+		}
+		if licenseFile != "" {
+			text, err := vfs.ReadFile(fs, path.Join(dir, licenseFile))
+			if err != nil {
+				return err
+			}
+			licenseRoot, license = importPath, ClassifyLicense(text)
+		}
+		if ok, err := hasGoModFile(fs, dir); err == nil && ok && dir != "/" {
+			moduleRoots[importPath] = true
 		} else if err != nil {
 			return err
 		}
@@ -156,6 +170,9 @@ func walkRepository(gitDir, repoRoot string) ([]*Directory, error) {
 			ImportPath:  importPath,
 			RepoRoot:    repoRoot,
 			LicenseRoot: licenseRoot,
+			LicenseFile: licenseFile,
+			License:     license,
+			ModuleRoot:  nearestModuleRoot(moduleRoots, importPath, repoRoot),
 			Package:     pkg,
 		})
 		return nil
@@ -206,14 +223,20 @@ func loadPackage(fs vfs.FileSystem, dir, importPath string) (*Package, error) {
 		} else if err != nil {
 			return nil, err
 		}
-		dpkg, err := computeDoc(bctx, p)
+		dpkg, fset, files, err := computeDoc(bctx, p)
 		if err != nil {
 			return nil, fmt.Errorf("can't get godoc of package %q: %v", importPath, err)
 		}
+		var imports []string
+		if len(p.Imports) > 0 {
+			imports = p.Imports
+		}
 		return &Package{
 			Name:     p.Name,
 			Synopsis: p.Doc,
 			DocHTML:  docHTML(dpkg.Doc),
+			Imports:  imports,
+			Doc:      newPackageDoc(fset, files, dpkg),
 		}, nil
 	}
 	// This directory doesn't contain a package.
@@ -248,22 +271,34 @@ func hasSubdir(root, dir string) (rel string, ok bool) {
 }
 
 // computeDoc computes the package documentation for the given package,
-// using the specified build context.
-func computeDoc(bctx *build.Context, p *build.Package) (*doc.Package, error) {
+// using the specified build context. Examples are taken from test files.
+// It also returns the parsed package files, excluding test files,
+// along with the file set used to parse them.
+func computeDoc(bctx *build.Context, p *build.Package) (*doc.Package, *token.FileSet, []*ast.File, error) {
 	fset := token.NewFileSet()
-	files := make(map[string]*ast.File)
+	var files []*ast.File
 	for _, file := range append(p.GoFiles, p.CgoFiles...) {
 		f, err := buildutil.ParseFile(fset, bctx, nil, p.Dir, file, parser.ParseComments)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
-		files[file] = f
+		files = append(files, f)
 	}
-	apkg := &ast.Package{
-		Name:  p.Name,
-		Files: files,
+	testFiles := files[:len(files):len(files)]
+	for _, file := range append(p.TestGoFiles, p.XTestGoFiles...) {
+		f, err := buildutil.ParseFile(fset, bctx, nil, p.Dir, file, parser.ParseComments)
+		if err != nil {
+			// Test files are only used for examples, so skip ones that don't parse.
+			log.Printf("computeDoc: skipping test file %s in package %q: %v\n", file, p.ImportPath, err)
+			continue
+		}
+		testFiles = append(testFiles, f)
+	}
+	dpkg, err := doc.NewFromFiles(fset, testFiles, p.ImportPath)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	return doc.New(apkg, p.ImportPath, 0), nil
+	return dpkg, fset, files, nil
 }
 
 // docHTML returns documentation comment text converted to formatted HTML.
@@ -273,8 +308,8 @@ func docHTML(text string) string {
 	return buf.String()
 }
 
-func hasLicenseFile(fs vfs.FileSystem, dir string) (bool, error) {
-	fi, err := fs.Stat(path.Join(dir, "LICENSE"))
+func hasGoModFile(fs vfs.FileSystem, dir string) (bool, error) {
+	fi, err := fs.Stat(path.Join(dir, "go.mod"))
 	if os.IsNotExist(err) {
 		return false, nil
 	} else if err != nil {
@@ -282,3 +317,15 @@ func hasLicenseFile(fs vfs.FileSystem, dir string) (bool, error) {
 	}
 	return !fi.IsDir(), nil
 }
+
+// nearestModuleRoot returns the import path of this or nearest parent
+// directory of importPath that is in the moduleRoots set, stopping at
+// repoRoot. It returns the empty string if there isn't such a directory.
+func nearestModuleRoot(moduleRoots map[string]bool, importPath, repoRoot string) string {
+	for p := importPath; p != repoRoot && strings.HasPrefix(p, repoRoot+"/"); p = path.Dir(p) {
+		if moduleRoots[p] {
+			return p
+		}
+	}
+	return ""
+}
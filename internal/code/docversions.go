@@ -0,0 +1,220 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/git"
+)
+
+// DocCache computes documentation of Go packages at past module versions,
+// and caches it on disk, so that old versions aren't parsed on every request.
+//
+// Versions are resolved to commits the same way ModuleHandler does,
+// so the documentation matches the code that users of that version get.
+type DocCache struct {
+	// Code is the underlying source of Go code.
+	Code *Service
+
+	// Dir is the directory where computed documentation is cached.
+	Dir string
+
+	mu       sync.Mutex
+	versions map[string]cachedVersions // Keyed by module path.
+}
+
+// cachedVersions are the latest pseudo-versions of a module
+// as of the commit that master branch pointed to.
+type cachedVersions struct {
+	Master string // Commit hash of master branch.
+	Pseudo []string
+}
+
+// maxPseudoVersions is the maximum number of pseudo-versions listed by ListVersions.
+const maxPseudoVersions = 10
+
+// ListVersions lists versions of the module that contains directory d.
+// Release versions are listed first, followed by up to maxPseudoVersions
+// pseudo-versions of the latest commits on master branch, each ordered
+// from newest to oldest.
+func (c *DocCache) ListVersions(ctx context.Context, d *Directory) ([]string, error) {
+	if !d.WithinRepo() {
+		return nil, os.ErrNotExist
+	}
+	gitDir := filepath.Join(c.Code.reposDir, filepath.FromSlash(d.RepoRoot))
+	moduleDir := strings.TrimPrefix(d.Module()[len(d.RepoRoot):], "/")
+	tags, err := listModuleTags(ctx, gitDir, moduleDir)
+	if err != nil {
+		return nil, err
+	}
+	pseudo, err := c.listPseudoVersions(ctx, gitDir, moduleDir, d.Module())
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for i := len(tags) - 1; i >= 0; i-- {
+		versions = append(versions, tags[i])
+	}
+	versions = append(versions, pseudo...)
+	return versions, nil
+}
+
+// listPseudoVersions returns up to maxPseudoVersions pseudo-versions
+// of the latest commits on master branch of module modulePath in dir
+// of git repo at gitDir. They're cached until master branch changes,
+// so that its history isn't walked on every request.
+func (c *DocCache) listPseudoVersions(ctx context.Context, gitDir, dir, modulePath string) ([]string, error) {
+	master, err := masterCommit(ctx, gitDir)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	cv, ok := c.versions[modulePath]
+	c.mu.Unlock()
+	if ok && cv.Master == master {
+		return cv.Pseudo, nil
+	}
+
+	revs, err := listMasterCommits(ctx, gitDir, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) > maxPseudoVersions {
+		revs = revs[:maxPseudoVersions]
+	}
+	var pseudo []string
+	for _, r := range revs {
+		pseudo = append(pseudo, r.Version)
+	}
+	c.mu.Lock()
+	if c.versions == nil {
+		c.versions = make(map[string]cachedVersions)
+	}
+	c.versions[modulePath] = cachedVersions{Master: master, Pseudo: pseudo}
+	c.mu.Unlock()
+	return pseudo, nil
+}
+
+// GetDirectory looks up a directory by specified import path as of
+// the specified version of the module that contains it. Directories
+// that no longer exist on master branch are found if they have a Go
+// package at that version. They're assumed to belong to the same module
+// as their nearest existing parent directory.
+// If the directory doesn't exist, os.ErrNotExist is returned.
+func (c *DocCache) GetDirectory(ctx context.Context, importPath, version string) (*Directory, error) {
+	d, err := c.Code.GetDirectory(ctx, importPath)
+	if !os.IsNotExist(err) {
+		return d, err
+	}
+	for parentPath := path.Dir(importPath); parentPath != "." && parentPath != "/"; parentPath = path.Dir(parentPath) {
+		parent, err := c.Code.GetDirectory(ctx, parentPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if !parent.WithinRepo() {
+			return nil, os.ErrNotExist
+		}
+		d := &Directory{
+			ImportPath:   importPath,
+			RepoRoot:     parent.RepoRoot,
+			RepoPackages: parent.RepoPackages,
+			LicenseRoot:  parent.LicenseRoot,
+			LicenseFile:  parent.LicenseFile,
+			License:      parent.License,
+			ModuleRoot:   parent.ModuleRoot,
+		}
+		if _, err := c.GetPackage(ctx, d, version); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// GetPackage returns the Go package in directory d as of the specified
+// version of the module that contains it. It returns os.ErrNotExist if
+// the version doesn't exist, or there's no package in d at that version.
+func (c *DocCache) GetPackage(ctx context.Context, d *Directory, version string) (*Package, error) {
+	if !d.WithinRepo() {
+		return nil, os.ErrNotExist
+	}
+	gitDir := filepath.Join(c.Code.reposDir, filepath.FromSlash(d.RepoRoot))
+	moduleDir := strings.TrimPrefix(d.Module()[len(d.RepoRoot):], "/")
+
+	repo, err := git.Open(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := repo.Close(); err != nil {
+			log.Println("DocCache.GetPackage: repo.Close:", err)
+		}
+	}()
+	commit, err := resolveModuleVersion(ctx, gitDir, repo, moduleDir, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documentation is cached by commit rather than version,
+	// so that it stays correct even if a tag is moved.
+	cachePath := filepath.Join(c.Dir, filepath.FromSlash(d.ImportPath), "@c", string(commit.ID)+".json")
+	var cp cachedPackage
+	if b, err := ioutil.ReadFile(cachePath); err == nil && json.Unmarshal(b, &cp) == nil {
+		return cp.unpack()
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	fs, err := repo.FileSystem(commit.ID)
+	if err != nil {
+		return nil, err
+	}
+	dir := path.Join("/", d.ImportPath[len(d.RepoRoot):])
+	var pkg *Package
+	if fi, err := fs.Stat(dir); err == nil && fi.IsDir() {
+		pkg, err = loadPackage(fs, dir, d.ImportPath)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	cp = cachedPackage{Package: pkg}
+	if pkg != nil {
+		cp.Doc = pkg.Doc
+	}
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(cachePath, b)
+	if err != nil {
+		return nil, err
+	}
+	return cp.unpack()
+}
+
+// cachedPackage is the on-disk representation of a Package,
+// including its full API documentation.
+type cachedPackage struct {
+	Package *Package    // Nil if there's no package.
+	Doc     *PackageDoc // Package.Doc, which is otherwise omitted from JSON.
+}
+
+// unpack returns the cached package,
+// or os.ErrNotExist if there's no package.
+func (cp cachedPackage) unpack() (*Package, error) {
+	if cp.Package == nil {
+		return nil, os.ErrNotExist
+	}
+	cp.Package.Doc = cp.Doc
+	return cp.Package, nil
+}
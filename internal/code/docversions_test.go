@@ -0,0 +1,134 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/mod"
+)
+
+func TestDocCache(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "docversions_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a repository with a tagged release, followed by
+	// a commit that changes the API and removes a package.
+	workDir := filepath.Join(tempDir, "work")
+	gitDir := filepath.Join(tempDir, "repositories", "dmitri.shuralyov.com", "hello")
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workDir, date, "init", "-q")
+	runGit(t, workDir, date, "checkout", "-q", "-b", "master")
+	writeFiles(t, workDir, map[string]string{
+		"go.mod":     "module dmitri.shuralyov.com/hello\n",
+		"hello.go":   "// Package hello says hello.\npackage hello\n\n// Old is old.\nfunc Old() {}\n",
+		"old/old.go": "// Package old is removed later.\npackage old\n",
+	})
+	runGit(t, workDir, date, "add", ".")
+	runGit(t, workDir, date, "commit", "-q", "-m", "first")
+	first := runGit(t, workDir, date, "rev-parse", "HEAD")
+	runGit(t, workDir, date, "tag", "v1.0.0")
+	date = date.Add(time.Hour)
+	writeFiles(t, workDir, map[string]string{
+		"hello.go": "// Package hello says hello.\npackage hello\n\n// New is new.\nfunc New() {}\n",
+	})
+	runGit(t, workDir, date, "rm", "-q", "-r", "old")
+	runGit(t, workDir, date, "commit", "-q", "-am", "second")
+	second := runGit(t, workDir, date, "rev-parse", "HEAD")
+	runGit(t, tempDir, date, "clone", "-q", "--bare", workDir, gitDir)
+
+	service, err := code.NewService(filepath.Join(tempDir, "repositories"), mockNotification{}, &mockEvents{}, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	cacheDir := filepath.Join(tempDir, "doccache")
+	docs := &code.DocCache{Code: service, Dir: cacheDir}
+	ctx := context.Background()
+	d, err := service.GetDirectory(ctx, "dmitri.shuralyov.com/hello")
+	if err != nil {
+		t.Fatal("GetDirectory:", err)
+	}
+
+	versions, err := docs.ListVersions(ctx, d)
+	if err != nil {
+		t.Fatal("ListVersions:", err)
+	}
+	secondVersion := mod.PseudoVersion("", "", date, second[:12])
+	wantVersions := []string{
+		"v1.0.0",
+		secondVersion,
+		mod.PseudoVersion("", "", date.Add(-time.Hour), first[:12]),
+	}
+	if !reflect.DeepEqual(versions, wantVersions) {
+		t.Errorf("ListVersions:\ngot  %q\nwant %q", versions, wantVersions)
+	}
+
+	for _, tt := range []struct {
+		version  string
+		wantFunc string
+	}{
+		{"v1.0.0", "Old"},
+		{secondVersion, "New"},
+		{"v1.0.0", "Old"}, // Served from cache.
+	} {
+		pkg, err := docs.GetPackage(ctx, d, tt.version)
+		if err != nil {
+			t.Fatalf("GetPackage(%q): %v", tt.version, err)
+		}
+		if pkg.Name != "hello" || pkg.Doc == nil || len(pkg.Doc.Funcs) != 1 || pkg.Doc.Funcs[0].Name != tt.wantFunc {
+			t.Errorf("GetPackage(%q): got %+v, want package hello with func %s", tt.version, pkg, tt.wantFunc)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "dmitri.shuralyov.com", "hello", "@c", first+".json")); err != nil {
+		t.Errorf("documentation of v1.0.0 is not cached: %v", err)
+	}
+
+	if _, err := docs.GetPackage(ctx, d, "v1.2.3"); !os.IsNotExist(err) {
+		t.Errorf("GetPackage(v1.2.3): got %v, want os.ErrNotExist", err)
+	}
+
+	// A package removed from master is found at versions that have it.
+	const oldPath = "dmitri.shuralyov.com/hello/old"
+	if _, err := service.GetDirectory(ctx, oldPath); !os.IsNotExist(err) {
+		t.Fatalf("GetDirectory(%q): got %v, want os.ErrNotExist", oldPath, err)
+	}
+	oldDir, err := docs.GetDirectory(ctx, oldPath, "v1.0.0")
+	if err != nil {
+		t.Fatalf("DocCache.GetDirectory(%q, v1.0.0): %v", oldPath, err)
+	}
+	if oldDir.ImportPath != oldPath || oldDir.RepoRoot != "dmitri.shuralyov.com/hello" {
+		t.Errorf("DocCache.GetDirectory(%q, v1.0.0): got %+v", oldPath, oldDir)
+	}
+	if pkg, err := docs.GetPackage(ctx, oldDir, "v1.0.0"); err != nil || pkg.Name != "old" {
+		t.Errorf("GetPackage(%q, v1.0.0): got (%+v, %v), want package old", oldPath, pkg, err)
+	}
+	if _, err := docs.GetDirectory(ctx, oldPath, secondVersion); !os.IsNotExist(err) {
+		t.Errorf("DocCache.GetDirectory(%q, %s): got %v, want os.ErrNotExist", oldPath, secondVersion, err)
+	}
+
+	// Versions are listed anew after master branch changes.
+	date = date.Add(time.Hour)
+	runGit(t, workDir, date, "commit", "-q", "--allow-empty", "-m", "third")
+	third := runGit(t, workDir, date, "rev-parse", "HEAD")
+	runGit(t, workDir, date, "push", "-q", gitDir, "master")
+	versions, err = docs.ListVersions(ctx, d)
+	if err != nil {
+		t.Fatal("ListVersions:", err)
+	}
+	wantVersions = append([]string{"v1.0.0", mod.PseudoVersion("", "", date, third[:12])}, wantVersions[1:]...)
+	if !reflect.DeepEqual(versions, wantVersions) {
+		t.Errorf("ListVersions after push:\ngot  %q\nwant %q", versions, wantVersions)
+	}
+}
@@ -0,0 +1,311 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shurcooL/users"
+)
+
+// ExternalRegistry is a registry of Go packages in repositories
+// hosted externally on GitHub. It's persisted in a directory of
+// the store. Packages are discovered by cloning each repository,
+// and are refreshed periodically.
+type ExternalRegistry struct {
+	dir   string
+	users users.Service
+
+	// CloneURL returns the git URL to clone the repository with
+	// the specified repo root from. It's "https://" + repoRoot
+	// by default, and can be overridden in tests.
+	CloneURL func(repoRoot string) string
+
+	mu    sync.RWMutex
+	repos map[string]externalRepo // Keyed by repo root.
+	dirs  []*Directory            // Packages of all repos, sorted by import path.
+}
+
+// externalRepo is an external repository as persisted in the registry.
+type externalRepo struct {
+	Root      string
+	Refreshed time.Time // Zero if the repository hasn't been discovered yet.
+	Packages  []externalPackage
+	Excluded  []string `json:",omitempty"` // Import paths of packages that aren't listed.
+}
+
+// externalPackage is a Go package in an external repository.
+type externalPackage struct {
+	ImportPath string
+	Name       string
+	Synopsis   string
+}
+
+// NewExternalRegistry creates an external package registry
+// persisted in directory dir. If the registry doesn't exist yet,
+// it's created with the seed packages, which are listed right away
+// and get rediscovered with the rest of their repositories on the
+// next refresh. Packages with import paths in excluded are
+// discovered, but not listed.
+func NewExternalRegistry(dir string, seed []*Directory, excluded []string, users users.Service) (*ExternalRegistry, error) {
+	r := &ExternalRegistry{
+		dir:      dir,
+		users:    users,
+		CloneURL: func(repoRoot string) string { return "https://" + repoRoot },
+		repos:    make(map[string]externalRepo),
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "repos.json"))
+	if os.IsNotExist(err) {
+		for _, d := range seed {
+			repo, ok := r.repos[d.RepoRoot]
+			if !ok {
+				repo = externalRepo{Root: d.RepoRoot}
+				for _, importPath := range excluded {
+					if importPath == d.RepoRoot || strings.HasPrefix(importPath, d.RepoRoot+"/") {
+						repo.Excluded = append(repo.Excluded, importPath)
+					}
+				}
+			}
+			if d.Package != nil {
+				repo.Packages = append(repo.Packages, externalPackage{
+					ImportPath: d.ImportPath,
+					Name:       d.Package.Name,
+					Synopsis:   d.Package.Synopsis,
+				})
+			}
+			r.repos[d.RepoRoot] = repo
+		}
+		r.dirs = r.directories()
+		return r, r.save()
+	} else if err != nil {
+		return nil, err
+	}
+	var repos []externalRepo
+	err = json.Unmarshal(b, &repos)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		r.repos[repo.Root] = repo
+	}
+	r.dirs = r.directories()
+	return r, nil
+}
+
+// List lists Go packages in the registry, sorted by import path.
+func (r *ExternalRegistry) List() []*Directory {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.dirs
+}
+
+// ListRepos lists repo roots of repositories in the registry, sorted.
+func (r *ExternalRegistry) ListRepos() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var roots []string
+	for root := range r.repos {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// AddRepo adds the GitHub repository with the specified repo root,
+// like "github.com/user/repo", to the registry, and discovers its packages.
+// If the repository is already in the registry, os.ErrExist is returned.
+func (r *ExternalRegistry) AddRepo(ctx context.Context, repoRoot string) error {
+	currentUser, err := r.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	if elems := strings.Split(repoRoot, "/"); len(elems) != 3 || elems[0] != "github.com" || repoRoot != path.Clean(repoRoot) {
+		return fmt.Errorf("repo root %q is not of the form github.com/user/repo", repoRoot)
+	}
+	r.mu.RLock()
+	_, ok := r.repos[repoRoot]
+	r.mu.RUnlock()
+	if ok {
+		return os.ErrExist
+	}
+
+	pkgs, err := r.discover(ctx, repoRoot)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.repos[repoRoot]; ok {
+		// Added concurrently while it was being discovered.
+		return os.ErrExist
+	}
+	r.repos[repoRoot] = externalRepo{
+		Root:      repoRoot,
+		Refreshed: time.Now().UTC(),
+		Packages:  pkgs,
+	}
+	r.dirs = r.directories()
+	return r.save()
+}
+
+// Refresh rediscovers packages in the repository
+// with the specified repo root, and persists them.
+// If the repository isn't in the registry, os.ErrNotExist is returned.
+func (r *ExternalRegistry) Refresh(ctx context.Context, repoRoot string) error {
+	r.mu.RLock()
+	_, ok := r.repos[repoRoot]
+	r.mu.RUnlock()
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	pkgs, err := r.discover(ctx, repoRoot)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, ok := r.repos[repoRoot]
+	if !ok {
+		return os.ErrNotExist
+	}
+	repo.Refreshed = time.Now().UTC()
+	repo.Packages = pkgs
+	r.repos[repoRoot] = repo
+	r.dirs = r.directories()
+	return r.save()
+}
+
+// Run refreshes repositories that haven't been discovered yet,
+// and then all repositories every interval, until ctx is canceled.
+func (r *ExternalRegistry) Run(ctx context.Context, interval time.Duration) {
+	r.mu.RLock()
+	var pending []string
+	for root, repo := range r.repos {
+		if repo.Refreshed.IsZero() {
+			pending = append(pending, root)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Strings(pending)
+	r.refresh(ctx, pending)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		r.refresh(ctx, r.ListRepos())
+	}
+}
+
+func (r *ExternalRegistry) refresh(ctx context.Context, repoRoots []string) {
+	for _, root := range repoRoots {
+		if ctx.Err() != nil {
+			return
+		}
+		err := r.Refresh(ctx, root)
+		if err != nil {
+			log.Printf("ExternalRegistry.Refresh(%q): %v\n", root, err)
+		}
+	}
+}
+
+// discover clones the repository with the specified repo root
+// and returns Go packages it contains, sorted by import path.
+func (r *ExternalRegistry) discover(ctx context.Context, repoRoot string) ([]externalPackage, error) {
+	tempDir, err := ioutil.TempDir("", "external_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+	gitDir := filepath.Join(tempDir, "repo.git")
+	cmd := exec.CommandContext(ctx, "git", "clone", "--bare", "--depth=1", "--quiet", "--", r.CloneURL(repoRoot), gitDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	// Packages are discovered on master, so point it to
+	// the default branch, which may be named differently.
+	cmd = exec.Command("git", "--git-dir", gitDir, "update-ref", "refs/heads/master", "HEAD")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	dirs, err := walkRepository(gitDir, repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []externalPackage
+	for _, d := range dirs {
+		if d.Package == nil {
+			continue
+		}
+		pkgs = append(pkgs, externalPackage{
+			ImportPath: d.ImportPath,
+			Name:       d.Package.Name,
+			Synopsis:   d.Package.Synopsis,
+		})
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ImportPath < pkgs[j].ImportPath })
+	return pkgs, nil
+}
+
+// directories returns packages of all repos in the registry,
+// except excluded ones, sorted by import path. r.mu must be held.
+func (r *ExternalRegistry) directories() []*Directory {
+	var dirs []*Directory
+	for _, repo := range r.repos {
+		var repoDirs []*Directory
+		for _, p := range repo.Packages {
+			if containsString(repo.Excluded, p.ImportPath) {
+				continue
+			}
+			repoDirs = append(repoDirs, &Directory{
+				ImportPath: p.ImportPath,
+				RepoRoot:   repo.Root,
+				Package: &Package{
+					Name:     p.Name,
+					Synopsis: p.Synopsis,
+				},
+			})
+		}
+		for _, d := range repoDirs {
+			d.RepoPackages = len(repoDirs)
+		}
+		dirs = append(dirs, repoDirs...)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].ImportPath < dirs[j].ImportPath })
+	return dirs
+}
+
+// save persists the registry. r.mu must be held.
+func (r *ExternalRegistry) save() error {
+	repos := make([]externalRepo, 0, len(r.repos))
+	for _, repo := range r.repos {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Root < repos[j].Root })
+	b, err := json.MarshalIndent(repos, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(r.dir, "repos.json"), b)
+}
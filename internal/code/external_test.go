@@ -0,0 +1,157 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestExternalRegistry(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "external_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a local stand-in for a GitHub repository,
+	// with a default branch that isn't named master.
+	upstreamDir := filepath.Join(tempDir, "upstream")
+	err = os.MkdirAll(upstreamDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, upstreamDir, time.Time{}, "init", "-q")
+	runGit(t, upstreamDir, time.Time{}, "checkout", "-q", "-b", "main")
+	writeFiles(t, upstreamDir, map[string]string{
+		"lib.go":           "// Package lib is a library.\npackage lib\n",
+		"cmd/tool/main.go": "// Tool is a command.\npackage main\n\nfunc main() {}\n",
+	})
+	runGit(t, upstreamDir, time.Time{}, "add", ".")
+	runGit(t, upstreamDir, time.Time{}, "commit", "-q", "-m", "initial")
+
+	const repoRoot = "github.com/gopher/lib"
+	seedDir := &code.Directory{
+		ImportPath: "github.com/gopher/seed",
+		RepoRoot:   "github.com/gopher/seed",
+		Package:    &code.Package{Name: "seed", Synopsis: "Package seed is seeded."},
+	}
+	newRegistry := func() *code.ExternalRegistry {
+		t.Helper()
+		r, err := code.NewExternalRegistry(filepath.Join(tempDir, "external"), []*code.Directory{seedDir}, nil, mockUsers{})
+		if err != nil {
+			t.Fatal("code.NewExternalRegistry:", err)
+		}
+		r.CloneURL = func(root string) string {
+			if root != repoRoot {
+				t.Errorf("CloneURL: unexpected repo root %q", root)
+			}
+			return upstreamDir
+		}
+		return r
+	}
+	registry := newRegistry()
+	ctx := context.Background()
+
+	// Seed packages are listed before their repositories are discovered.
+	if got, want := registry.ListRepos(), []string{"github.com/gopher/seed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRepos: got %q, want %q", got, want)
+	}
+	wantSeed := &code.Directory{
+		ImportPath:   "github.com/gopher/seed",
+		RepoRoot:     "github.com/gopher/seed",
+		RepoPackages: 1,
+		Package:      &code.Package{Name: "seed", Synopsis: "Package seed is seeded."},
+	}
+	if got, want := registry.List(), []*code.Directory{wantSeed}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	// Repositories that aren't in the registry can't be refreshed.
+	if err := registry.Refresh(ctx, repoRoot); !os.IsNotExist(err) {
+		t.Errorf("Refresh of unknown repo: got %v, want os.ErrNotExist", err)
+	}
+
+	// Add a repository, and check its packages are discovered.
+	if err := registry.AddRepo(ctx, "github.com/gopher"); err == nil {
+		t.Error("AddRepo with invalid repo root: got nil error")
+	}
+	err = registry.AddRepo(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("AddRepo:", err)
+	}
+	if err := registry.AddRepo(ctx, repoRoot); !os.IsExist(err) {
+		t.Errorf("AddRepo again: got %v, want os.ErrExist", err)
+	}
+	want := []*code.Directory{
+		{
+			ImportPath:   "github.com/gopher/lib",
+			RepoRoot:     repoRoot,
+			RepoPackages: 2,
+			Package:      &code.Package{Name: "lib", Synopsis: "Package lib is a library."},
+		},
+		{
+			ImportPath:   "github.com/gopher/lib/cmd/tool",
+			RepoRoot:     repoRoot,
+			RepoPackages: 2,
+			Package:      &code.Package{Name: "main", Synopsis: "Tool is a command."},
+		},
+		wantSeed,
+	}
+	if got := registry.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	// Excluded packages of seed repositories aren't listed.
+	seeded, err := code.NewExternalRegistry(filepath.Join(tempDir, "seeded"), []*code.Directory{{
+		ImportPath: repoRoot,
+		RepoRoot:   repoRoot,
+		Package:    &code.Package{Name: "lib", Synopsis: "Package lib is a library."},
+	}}, []string{"github.com/gopher/lib/cmd/tool", "github.com/gopher/other"}, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewExternalRegistry:", err)
+	}
+	seeded.CloneURL = func(string) string { return upstreamDir }
+	err = seeded.Refresh(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("Refresh:", err)
+	}
+	wantSeeded := []*code.Directory{
+		{
+			ImportPath:   "github.com/gopher/lib",
+			RepoRoot:     repoRoot,
+			RepoPackages: 1,
+			Package:      &code.Package{Name: "lib", Synopsis: "Package lib is a library."},
+		},
+	}
+	if got := seeded.List(); !reflect.DeepEqual(got, wantSeeded) {
+		t.Errorf("List of seeded registry:\ngot  %+v\nwant %+v", got, wantSeeded)
+	}
+
+	// Refresh after a package is removed upstream.
+	runGit(t, upstreamDir, time.Time{}, "rm", "-q", "-r", "cmd")
+	runGit(t, upstreamDir, time.Time{}, "commit", "-q", "-m", "remove tool")
+	err = registry.Refresh(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("Refresh:", err)
+	}
+	want = []*code.Directory{want[0], wantSeed}
+	want[0].RepoPackages = 1
+	if got := registry.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List after refresh:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	// The registry is persisted.
+	registry = newRegistry()
+	if got, want := registry.ListRepos(), []string{"github.com/gopher/lib", "github.com/gopher/seed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRepos after reopening: got %q, want %q", got, want)
+	}
+	if got := registry.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List after reopening:\ngot  %+v\nwant %+v", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package code
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
@@ -26,27 +27,57 @@ import (
 )
 
 const (
+	// gitTimeout is the timeout for git commands that advertise refs.
 	gitTimeout = 45 * time.Second
+
+	// gitPackTimeout is the timeout for git commands that serve packs.
+	// It's longer than gitTimeout, since cloning or pushing a large
+	// repository can take a long time.
+	gitPackTimeout = 30 * time.Minute
+
+	// gitMaxRequestSize is the maximum size of a git request body,
+	// after it's decompressed.
+	gitMaxRequestSize = 1 << 30
 )
 
+// uploadPackConfig is git configuration used when serving fetches.
+// It enables partial clone filters (e.g., "--filter=blob:none"),
+// and lets partial clones fetch missing objects that are reachable
+// from refs later.
+var uploadPackConfig = []string{
+	"-c", "uploadpack.allowFilter=true",
+	"-c", "uploadpack.allowReachableSHA1InWant=true",
+}
+
+// GitUsers maps git commit author emails to users.
+type GitUsers interface {
+	// GitUser returns the user that owns the git commit author email,
+	// compared case-insensitively, and reports whether there is one.
+	GitUser(email string) (users.User, bool)
+}
+
 // TODO: Consider moving NewGitHandler into Service.
 
 // NewGitHandler creates a gitHandler.
 // gitHooksDir specifies the directory where to look for git hooks.
-func NewGitHandler(code *Service, reposDir, gitHooksDir string, events events.ExternalService, users users.Service, gitUsers map[string]users.User, authenticate func(*http.Request) *http.Request) (*gitHandler, error) {
+// gitUsers, if not nil, is used to attribute pushed commits to users.
+// requireSigned, if not nil, is used by the pre-receive hook to require
+// commits pushed to master to have verified signatures.
+func NewGitHandler(code *Service, reposDir, gitHooksDir string, events events.ExternalService, users users.Service, gitUsers GitUsers, requireSigned *SignatureVerifier, authenticate func(*http.Request) *http.Request) (*gitHandler, error) {
 	gitBin, err := exec.LookPath("git")
 	if err != nil {
 		return nil, err
 	}
 	return &gitHandler{
-		code:         code,
-		reposDir:     reposDir,
-		events:       events,
-		users:        users,
-		gitUsers:     gitUsers,
-		authenticate: authenticate,
-		gitBin:       gitBin,
-		gitHooksDir:  gitHooksDir,
+		code:          code,
+		reposDir:      reposDir,
+		events:        events,
+		users:         users,
+		gitUsers:      gitUsers,
+		requireSigned: requireSigned,
+		authenticate:  authenticate,
+		gitBin:        gitBin,
+		gitHooksDir:   gitHooksDir,
 	}, nil
 }
 
@@ -55,7 +86,9 @@ type gitHandler struct {
 	reposDir string
 	events   events.ExternalService
 	users    users.Service
-	gitUsers map[string]users.User // Key is lower git author email.
+	gitUsers GitUsers // May be nil.
+
+	requireSigned *SignatureVerifier // May be nil.
 
 	authenticate func(*http.Request) *http.Request
 
@@ -69,7 +102,9 @@ func (h *gitHandler) ServeGitMaybe(w http.ResponseWriter, req *http.Request) (ok
 	switch url := req.URL.String(); {
 	case strings.HasSuffix(url, "/info/refs?service=git-upload-pack"):
 		repoRoot := "dmitri.shuralyov.com" + url[:len(url)-len("/info/refs?service=git-upload-pack")]
-		if dir, err := h.code.GetDirectory(req.Context(), repoRoot); err != nil || !dir.IsRepoRoot() {
+		if dir, err := h.code.GetDirectory(req.Context(), repoRoot); os.IsNotExist(err) {
+			return h.redirectMaybe(w, req, repoRoot, "/info/refs?service=git-upload-pack")
+		} else if err != nil || !dir.IsRepoRoot() {
 			return false
 		}
 		h.serveGitInfoRefsUploadPack(w, req, repoInfo{
@@ -91,7 +126,9 @@ func (h *gitHandler) ServeGitMaybe(w http.ResponseWriter, req *http.Request) (ok
 		return true
 	case strings.HasSuffix(url, "/info/refs?service=git-receive-pack"):
 		repoRoot := "dmitri.shuralyov.com" + url[:len(url)-len("/info/refs?service=git-receive-pack")]
-		if dir, err := h.code.GetDirectory(req.Context(), repoRoot); err != nil || !dir.IsRepoRoot() {
+		if dir, err := h.code.GetDirectory(req.Context(), repoRoot); os.IsNotExist(err) {
+			return h.redirectMaybe(w, req, repoRoot, "/info/refs?service=git-receive-pack")
+		} else if err != nil || !dir.IsRepoRoot() {
 			return false
 		}
 		h.serveGitInfoRefsReceivePack(w, req, repoInfo{
@@ -116,6 +153,20 @@ func (h *gitHandler) ServeGitMaybe(w http.ResponseWriter, req *http.Request) (ok
 	}
 }
 
+// redirectMaybe redirects a git protocol request for repoRoot to the
+// new location of the repository, if it has been renamed.
+// Git follows redirects for the initial request only, so
+// later requests of the same operation use the new location.
+// It reports whether the HTTP request was handled or not.
+func (h *gitHandler) redirectMaybe(w http.ResponseWriter, req *http.Request, repoRoot, suffix string) (ok bool) {
+	newRepoRoot, ok := h.code.LookUpRedirect(repoRoot)
+	if !ok || newRepoRoot == repoRoot {
+		return false
+	}
+	http.Redirect(w, req, newRepoRoot[len("dmitri.shuralyov.com"):]+suffix, http.StatusMovedPermanently)
+	return true
+}
+
 func (h *gitHandler) serveGitInfoRefsUploadPack(w http.ResponseWriter, req *http.Request, repo repoInfo) {
 	if req.Method != http.MethodGet {
 		httperror.HandleMethod(w, httperror.Method{Allowed: []string{http.MethodGet}})
@@ -123,8 +174,8 @@ func (h *gitHandler) serveGitInfoRefsUploadPack(w http.ResponseWriter, req *http
 	}
 	ctx, cancel := context.WithTimeout(req.Context(), gitTimeout)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, h.gitBin, "-c", "core.hooksPath="+h.gitHooksDir,
-		"upload-pack", "--strict", "--advertise-refs", ".")
+	args := append([]string{"-c", "core.hooksPath=" + h.gitHooksDir}, uploadPackConfig...)
+	cmd := exec.CommandContext(ctx, h.gitBin, append(args, "upload-pack", "--strict", "--advertise-refs", ".")...)
 	cmd.Dir = repo.Dir
 	env := osutil.Environ(os.Environ())
 	env.Set("HOME_MODULE_PATH", repo.Spec)
@@ -149,10 +200,15 @@ func (h *gitHandler) serveGitInfoRefsUploadPack(w http.ResponseWriter, req *http
 		return
 	}
 	w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
-	_, err = io.WriteString(w, "001e# service=git-upload-pack\n0000")
-	if err != nil {
-		log.Println(err)
-		return
+	w.Header().Set("Cache-Control", "no-cache")
+	if !isProtocolV2(req) {
+		// Protocol v2 capability advertisement
+		// isn't preceded by a service line.
+		_, err = io.WriteString(w, "001e# service=git-upload-pack\n0000")
+		if err != nil {
+			log.Println(err)
+			return
+		}
 	}
 	_, err = io.Copy(w, &buf)
 	if err != nil {
@@ -169,10 +225,16 @@ func (h *gitHandler) serveGitUploadPack(w http.ResponseWriter, req *http.Request
 		httperror.HandleBadRequest(w, httperror.BadRequest{Err: err})
 		return
 	}
-	ctx, cancel := context.WithTimeout(req.Context(), gitTimeout)
+	body, err := requestBody(w, req)
+	if err != nil {
+		httperror.HandleBadRequest(w, httperror.BadRequest{Err: err})
+		return
+	}
+	defer body.Close()
+	ctx, cancel := context.WithTimeout(req.Context(), gitPackTimeout)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, h.gitBin, "-c", "core.hooksPath="+h.gitHooksDir,
-		"upload-pack", "--strict", "--stateless-rpc", ".")
+	args := append([]string{"-c", "core.hooksPath=" + h.gitHooksDir}, uploadPackConfig...)
+	cmd := exec.CommandContext(ctx, h.gitBin, append(args, "upload-pack", "--strict", "--stateless-rpc", ".")...)
 	cmd.Dir = repo.Dir
 	env := osutil.Environ(os.Environ())
 	env.Set("HOME_MODULE_PATH", repo.Spec)
@@ -180,10 +242,14 @@ func (h *gitHandler) serveGitUploadPack(w http.ResponseWriter, req *http.Request
 		env.Set("GIT_PROTOCOL", v)
 	}
 	cmd.Env = env
-	cmd.Stdin = req.Body
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
-	err := cmd.Start()
+	cmd.Stdin = body
+	// Stream the result rather than buffering it, so that large
+	// packs aren't held in memory. Once it has started, errors
+	// can no longer be reported to the client via HTTP status.
+	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	cmd.Stdout = w
+	err = cmd.Start()
 	if os.IsNotExist(err) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
@@ -197,13 +263,6 @@ func (h *gitHandler) serveGitUploadPack(w http.ResponseWriter, req *http.Request
 		// due to git clone --depth=1 or so. Ignore this error.
 	} else if err != nil {
 		log.Printf("git-upload-pack command failed: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
-	_, err = io.Copy(w, &buf)
-	if err != nil {
-		log.Println(err)
 	}
 }
 
@@ -231,6 +290,16 @@ func (h *gitHandler) serveGitInfoRefsReceivePack(w http.ResponseWriter, req *htt
 		return
 	}
 
+	// Mirrors and archived repositories are read-only.
+	if reason, err := readOnly(req.Context(), repo.Dir); err != nil {
+		log.Println("readOnly:", err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if reason != "" {
+		http.Error(w, "403 Forbidden: "+reason, http.StatusForbidden)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(req.Context(), gitTimeout)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, h.gitBin, "-c", "core.hooksPath="+h.gitHooksDir,
@@ -298,24 +367,54 @@ func (h *gitHandler) serveGitReceivePack(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(req.Context(), gitTimeout)
+	// Mirrors and archived repositories are read-only.
+	if reason, err := readOnly(req.Context(), repo.Dir); err != nil {
+		log.Println("readOnly:", err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	} else if reason != "" {
+		http.Error(w, "403 Forbidden: "+reason, http.StatusForbidden)
+		return
+	}
+
+	body, err := requestBody(w, req)
+	if err != nil {
+		httperror.HandleBadRequest(w, httperror.BadRequest{Err: err})
+		return
+	}
+	defer body.Close()
+	ctx, cancel := context.WithTimeout(req.Context(), gitPackTimeout)
 	defer cancel()
 	cmd := exec.CommandContext(ctx, h.gitBin, "-c", "core.hooksPath="+h.gitHooksDir,
 		"receive-pack", "--stateless-rpc", ".")
 	cmd.Dir = repo.Dir
 	env := osutil.Environ(os.Environ())
 	env.Set("HOME_MODULE_PATH", repo.Spec)
+	if h.requireSigned != nil {
+		keysDir, err := h.requireSigned.KeysDir()
+		if err != nil {
+			log.Println("requireSigned.KeysDir:", err)
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		env.Set("HOME_SIGNING_KEYS_DIR", keysDir)
+	}
 	if v := req.Header.Get("Git-Protocol"); v != "" {
 		env.Set("GIT_PROTOCOL", v)
 	}
 	cmd.Env = env
 	rpc := &githttp.RpcReader{
-		Reader: req.Body,
+		Reader: body,
 		Rpc:    "receive-pack",
 	}
 	cmd.Stdin = rpc
-	var buf bytes.Buffer
-	cmd.Stdout = &buf
+	// Stream the result rather than buffering it, keeping
+	// only its end to check whether the push was declined.
+	const declined = " pre-receive hook declined\n00000000"
+	tail := &suffixWriter{N: len(declined)}
+	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	cmd.Stdout = io.MultiWriter(w, tail)
 	err = cmd.Start()
 	if os.IsNotExist(err) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
@@ -327,17 +426,10 @@ func (h *gitHandler) serveGitReceivePack(w http.ResponseWriter, req *http.Reques
 	err = cmd.Wait()
 	if err != nil {
 		log.Printf("git-receive-pack command failed: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	hookDeclined := bytes.HasSuffix(buf.Bytes(), []byte(" pre-receive hook declined\n00000000"))
-	w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
-	_, err = io.Copy(w, &buf)
-	if err != nil {
-		log.Println(err)
-	}
 
-	if hookDeclined {
+	if hookDeclined := string(tail.B) == declined; hookDeclined {
 		return
 	}
 
@@ -410,7 +502,8 @@ func (h *gitHandler) serveGitReceivePack(w http.ResponseWriter, req *http.Reques
 }
 
 // listCommitsBetween returns a list of commits in git repo from base to head.
-func listCommitsBetween(repo repoInfo, base, head vcs.CommitID, gitUsers map[string]users.User) ([]event.Commit, error) {
+// gitUsers may be nil.
+func listCommitsBetween(repo repoInfo, base, head vcs.CommitID, gitUsers GitUsers) ([]event.Commit, error) {
 	r := &gitcmd.Repository{Dir: repo.Dir}
 	defer r.Close()
 	cs, _, err := r.Commits(vcs.CommitsOptions{
@@ -425,7 +518,11 @@ func listCommitsBetween(repo repoInfo, base, head vcs.CommitID, gitUsers map[str
 	for i := len(cs) - 1; i >= 0; i-- {
 		c := cs[i]
 
-		user, ok := gitUsers[strings.ToLower(c.Author.Email)]
+		var user users.User
+		var ok bool
+		if gitUsers != nil {
+			user, ok = gitUsers.GitUser(c.Author.Email)
+		}
 		if !ok {
 			user = users.User{
 				Name:      c.Author.Name,
@@ -444,6 +541,50 @@ func listCommitsBetween(repo repoInfo, base, head vcs.CommitID, gitUsers map[str
 	return commits, nil
 }
 
+// isProtocolV2 reports whether the git smart HTTP request
+// asks for git wire protocol version 2.
+func isProtocolV2(req *http.Request) bool {
+	for _, v := range strings.Split(req.Header.Get("Git-Protocol"), ":") {
+		if v == "version=2" {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBody returns the body of a git smart HTTP request,
+// decompressing it if the client sent it gzip-encoded.
+// Reading more than gitMaxRequestSize bytes from it fails.
+func requestBody(w http.ResponseWriter, req *http.Request) (io.ReadCloser, error) {
+	switch req.Header.Get("Content-Encoding") {
+	case "":
+		return http.MaxBytesReader(w, req.Body, gitMaxRequestSize), nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		return http.MaxBytesReader(w, zr, gitMaxRequestSize), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %v", req.Header.Get("Content-Encoding"))
+	}
+}
+
+// suffixWriter is an io.Writer that keeps
+// the last N bytes written to it in B.
+type suffixWriter struct {
+	N int
+	B []byte
+}
+
+func (s *suffixWriter) Write(p []byte) (int, error) {
+	s.B = append(s.B, p...)
+	if len(s.B) > s.N {
+		s.B = append([]byte(nil), s.B[len(s.B)-s.N:]...)
+	}
+	return len(p), nil
+}
+
 type repoInfo struct {
 	Spec string // Repository spec. E.g., "example.com/repo".
 	Path string // Path corresponding to repository root, without domain. E.g., "/repo".
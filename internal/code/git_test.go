@@ -0,0 +1,139 @@
+package code_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestGitHandler(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "git_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	err = exec.Command("cp", "-R", filepath.Join("testdata", "repositories"), tempDir).Run()
+	if err != nil {
+		t.Fatal("cp -R failed:", err)
+	}
+	reposDir := filepath.Join(tempDir, "repositories")
+	service, err := code.NewService(reposDir, mockNotification{}, &mockEvents{}, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	gitHandler, err := code.NewGitHandler(service, reposDir, "", &mockEvents{}, mockUsers{}, nil, nil, func(req *http.Request) *http.Request { return req })
+	if err != nil {
+		t.Fatal("code.NewGitHandler:", err)
+	}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if ok := gitHandler.ServeGitMaybe(w, req); ok {
+			return
+		}
+		t.Error("HTTP server got a non-git request")
+		http.NotFound(w, req)
+	}))
+	defer httpServer.Close()
+	repoURL := httpServer.URL + "/kebabcase"
+
+	t.Run("capability advertisement", func(t *testing.T) {
+		for _, tt := range []struct {
+			protocol   string
+			wantPrefix string
+			wantLines  []string
+		}{
+			{"", "001e# service=git-upload-pack\n0000", []string{"refs/heads/master"}},
+			{"version=2", "000eversion 2\n", []string{"ls-refs", "fetch=", "filter"}},
+		} {
+			req, err := http.NewRequest(http.MethodGet, repoURL+"/info/refs?service=git-upload-pack", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.protocol != "" {
+				req.Header.Set("Git-Protocol", tt.protocol)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(body), tt.wantPrefix) {
+				t.Errorf("protocol %q: advertisement %q doesn't begin with %q", tt.protocol, body, tt.wantPrefix)
+			}
+			for _, l := range tt.wantLines {
+				if !strings.Contains(string(body), l) {
+					t.Errorf("protocol %q: advertisement %q doesn't contain %q", tt.protocol, body, l)
+				}
+			}
+		}
+	})
+
+	t.Run("gzip-encoded request", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte("0014command=ls-refs\n00010009peel\n0000"))
+		zw.Close()
+		req, err := http.NewRequest(http.MethodPost, repoURL+"/git-upload-pack", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Git-Protocol", "version=2")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), " refs/heads/master\n") {
+			t.Errorf("got status %v and body %q, want refs/heads/master to be listed", resp.Status, body)
+		}
+	})
+
+	for _, protocol := range []string{"0", "2"} {
+		t.Run("protocol version "+protocol, func(t *testing.T) {
+			// A shallow clone has a single commit.
+			shallowDir := filepath.Join(tempDir, "shallow-v"+protocol)
+			runGit(t, tempDir, time.Time{}, "-c", "protocol.version="+protocol, "clone", "--quiet", "--depth=1", repoURL, shallowDir)
+			if got := runGit(t, shallowDir, time.Time{}, "rev-list", "--count", "HEAD"); got != "1" {
+				t.Errorf("shallow clone has %s commits, want 1", got)
+			}
+			if _, err := os.Stat(filepath.Join(shallowDir, ".git", "shallow")); err != nil {
+				t.Error("shallow clone isn't shallow:", err)
+			}
+			// Deepen it to get the full history.
+			runGit(t, shallowDir, time.Time{}, "-c", "protocol.version="+protocol, "fetch", "--quiet", "--unshallow")
+			if got := runGit(t, shallowDir, time.Time{}, "rev-list", "--count", "HEAD"); got == "1" {
+				t.Error("unshallowed clone still has 1 commit")
+			}
+
+			// A partial clone omits blobs until they're needed.
+			partialDir := filepath.Join(tempDir, "partial-v"+protocol)
+			runGit(t, tempDir, time.Time{}, "-c", "protocol.version="+protocol, "clone", "--quiet", "--no-checkout", "--filter=blob:none", repoURL, partialDir)
+			if missing := runGit(t, partialDir, time.Time{}, "rev-list", "--objects", "--missing=print", "--all"); !strings.Contains(missing, "\n?") {
+				t.Errorf("partial clone isn't missing any objects:\n%s", missing)
+			}
+			runGit(t, partialDir, time.Time{}, "-c", "protocol.version="+protocol, "checkout", "--quiet", "master")
+			if _, err := os.Stat(filepath.Join(partialDir, "kebabcase.go")); err != nil {
+				t.Error("checking out partial clone didn't fetch missing blobs:", err)
+			}
+		})
+	}
+}
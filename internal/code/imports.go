@@ -0,0 +1,221 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// ImportedBy returns import paths of packages in the repository store
+// that import the package with the specified import path, in sorted order.
+// If the directory doesn't exist, os.ErrNotExist is returned.
+func (s *Service) ImportedBy(_ context.Context, importPath string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.byImportPath[importPath]; !ok {
+		return nil, os.ErrNotExist
+	}
+	var importers []string
+	for _, d := range s.dirs {
+		if d.Package == nil || !containsString(d.Package.Imports, importPath) {
+			continue
+		}
+		importers = append(importers, d.ImportPath)
+	}
+	return importers, nil
+}
+
+// Module is a node in a module dependency graph.
+type Module struct {
+	Path     string
+	Requires []Requirement // Requirements as specified in the go.mod file.
+}
+
+// Requirement is a module requirement.
+type Requirement struct {
+	Path     string
+	Version  string
+	Indirect bool
+
+	// Latest is the latest version of a required module
+	// that is in the repository store, or empty string
+	// if the module is not in the repository store.
+	Latest string
+}
+
+// Outdated reports whether the required module is in the repository store,
+// and a newer version of it than the one required is available.
+func (r Requirement) Outdated() bool {
+	return r.Latest != "" && semver.Compare(r.Version, r.Latest) < 0
+}
+
+// ModuleGraph returns the dependency graph of modules in the repository
+// with the specified root, as specified by their go.mod files on master branch.
+// Requirements on modules in the repository store are followed transitively,
+// so that the graph includes their dependencies too. Modules of the repository
+// are listed first, followed by their dependencies in the order they're visited.
+// Information about each module is cached, see moduleInfo.
+// If the repository doesn't exist, os.ErrNotExist is returned.
+func (s *Service) ModuleGraph(ctx context.Context, repoRoot string) ([]Module, error) {
+	if _, err := s.gitDir(repoRoot); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	var queue []*Directory // Module roots to visit.
+	for _, d := range s.dirs {
+		if d.RepoRoot == repoRoot && d.IsModuleRoot() {
+			queue = append(queue, d)
+		}
+	}
+	s.mu.RUnlock()
+
+	var (
+		graph   []Module
+		visited = make(map[string]bool) // Set of visited module paths.
+	)
+	for _, d := range queue {
+		visited[d.ImportPath] = true
+	}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+
+		info, err := s.moduleInfo(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		m := Module{Path: d.ImportPath}
+		for _, req := range info.Requires {
+			s.mu.RLock()
+			rd, ok := s.byImportPath[req.Path]
+			s.mu.RUnlock()
+			if ok && rd.IsModuleRoot() {
+				rinfo, err := s.moduleInfo(ctx, rd)
+				if err != nil {
+					return nil, err
+				}
+				req.Latest = rinfo.Latest
+				if !visited[rd.ImportPath] {
+					visited[rd.ImportPath] = true
+					queue = append(queue, rd)
+				}
+			}
+			m.Requires = append(m.Requires, req)
+		}
+		graph = append(graph, m)
+	}
+	return graph, nil
+}
+
+// moduleInfo is information about a module on master branch
+// of its repository, as needed to compute module graphs.
+type moduleInfo struct {
+	Requires []Requirement // Requirements without Latest set. Nil if there's no go.mod file.
+	Latest   string        // Latest version of the module.
+}
+
+// moduleInfo returns information about the module whose root is directory d.
+// It's cached until code in the repository is rediscovered, so that module
+// graphs don't need to read it from git on every request.
+func (s *Service) moduleInfo(ctx context.Context, d *Directory) (moduleInfo, error) {
+	s.mu.RLock()
+	info, ok := s.modules[d.ImportPath]
+	s.mu.RUnlock()
+	if ok {
+		return info, nil
+	}
+
+	gitDir := filepath.Join(s.reposDir, filepath.FromSlash(d.RepoRoot))
+	moduleDir := strings.TrimPrefix(d.ImportPath[len(d.RepoRoot):], "/")
+	f, err := readGoMod(ctx, gitDir, moduleDir)
+	if err != nil {
+		return moduleInfo{}, err
+	}
+	if f != nil {
+		for _, r := range f.Require {
+			info.Requires = append(info.Requires, Requirement{
+				Path:     r.Mod.Path,
+				Version:  r.Mod.Version,
+				Indirect: r.Indirect,
+			})
+		}
+	}
+	info.Latest, err = latestModuleVersion(ctx, gitDir, moduleDir)
+	if err != nil {
+		return moduleInfo{}, err
+	}
+
+	s.mu.Lock()
+	if s.byImportPath[d.ImportPath] == d {
+		// Cache only if the repository hasn't been rediscovered meanwhile.
+		s.modules[d.ImportPath] = info
+	}
+	s.mu.Unlock()
+	return info, nil
+}
+
+// forgetModules removes cached information about modules
+// in the repository with the specified root.
+// s.mu must be held for writing.
+func (s *Service) forgetModules(repoRoot string) {
+	for modulePath := range s.modules {
+		if modulePath == repoRoot || strings.HasPrefix(modulePath, repoRoot+"/") {
+			delete(s.modules, modulePath)
+		}
+	}
+}
+
+// readGoMod reads and parses the go.mod file of the module in moduleDir
+// of git repo at gitDir on master branch. It returns a nil file if
+// there isn't a go.mod file, or master branch doesn't exist.
+func readGoMod(ctx context.Context, gitDir, moduleDir string) (*modfile.File, error) {
+	name := path.Join(moduleDir, "go.mod")
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "blob", "master:"+name)
+	cmd.Dir = gitDir
+	b, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 128 {
+		// No such file, or master branch doesn't exist.
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return modfile.ParseLax(name, b, nil)
+}
+
+// latestModuleVersion returns the latest version of the module in moduleDir
+// of git repo at gitDir. It's the latest release version, if there are any,
+// otherwise the pseudo-version of the latest commit on master branch.
+// It returns the empty string if there are no versions.
+func latestModuleVersion(ctx context.Context, gitDir, moduleDir string) (string, error) {
+	tags, err := listModuleTags(ctx, gitDir, moduleDir)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) > 0 {
+		return tags[len(tags)-1], nil
+	}
+	revs, err := listMasterCommits(ctx, gitDir, moduleDir)
+	if err != nil {
+		return "", err
+	}
+	if len(revs) == 0 {
+		return "", nil
+	}
+	return revs[0].Version, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
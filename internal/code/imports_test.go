@@ -0,0 +1,121 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestImportsAndModuleGraph(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "imports_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create repository a with two releases, and repository b
+	// that imports a and requires the older release of it.
+	reposDir := filepath.Join(tempDir, "repositories")
+	createRepo := func(name string, files map[string]string, tags ...string) {
+		t.Helper()
+		workDir := filepath.Join(tempDir, "work", name)
+		err := os.MkdirAll(workDir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, workDir, time.Time{}, "init", "-q")
+		runGit(t, workDir, time.Time{}, "checkout", "-q", "-b", "master")
+		writeFiles(t, workDir, files)
+		runGit(t, workDir, time.Time{}, "add", ".")
+		runGit(t, workDir, time.Time{}, "commit", "-q", "-m", "initial")
+		for _, tag := range tags {
+			runGit(t, workDir, time.Time{}, "tag", tag)
+		}
+		runGit(t, tempDir, time.Time{}, "clone", "-q", "--bare", workDir, filepath.Join(reposDir, "dmitri.shuralyov.com", name))
+	}
+	createRepo("a", map[string]string{
+		"go.mod": "module dmitri.shuralyov.com/a\n",
+		"a.go":   "package a\n",
+	}, "v1.0.0", "v1.1.0")
+	createRepo("b", map[string]string{
+		"go.mod": `module dmitri.shuralyov.com/b
+
+require (
+	dmitri.shuralyov.com/a v1.0.0
+	golang.org/x/text v0.3.0 // indirect
+)
+`,
+		"b.go": "package b\n\nimport (\n\t\"fmt\"\n\n\t\"dmitri.shuralyov.com/a\"\n)\n",
+	})
+
+	service, err := code.NewService(reposDir, mockNotification{}, &mockEvents{}, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	ctx := context.Background()
+
+	b, err := service.GetDirectory(ctx, "dmitri.shuralyov.com/b")
+	if err != nil {
+		t.Fatal("GetDirectory:", err)
+	}
+	if got, want := b.Package.Imports, []string{"dmitri.shuralyov.com/a", "fmt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imports: got %q, want %q", got, want)
+	}
+	importers, err := service.ImportedBy(ctx, "dmitri.shuralyov.com/a")
+	if err != nil {
+		t.Fatal("ImportedBy:", err)
+	}
+	if want := []string{"dmitri.shuralyov.com/b"}; !reflect.DeepEqual(importers, want) {
+		t.Errorf("ImportedBy: got %q, want %q", importers, want)
+	}
+	if _, err := service.ImportedBy(ctx, "dmitri.shuralyov.com/c"); !os.IsNotExist(err) {
+		t.Errorf("ImportedBy(c): got %v, want os.ErrNotExist", err)
+	}
+
+	graph, err := service.ModuleGraph(ctx, "dmitri.shuralyov.com/b")
+	if err != nil {
+		t.Fatal("ModuleGraph:", err)
+	}
+	wantGraph := []code.Module{
+		{Path: "dmitri.shuralyov.com/b", Requires: []code.Requirement{
+			{Path: "dmitri.shuralyov.com/a", Version: "v1.0.0", Latest: "v1.1.0"},
+			{Path: "golang.org/x/text", Version: "v0.3.0", Indirect: true},
+		}},
+		{Path: "dmitri.shuralyov.com/a"},
+	}
+	if !reflect.DeepEqual(graph, wantGraph) {
+		t.Errorf("ModuleGraph:\ngot  %+v\nwant %+v", graph, wantGraph)
+	}
+	if !graph[0].Requires[0].Outdated() || graph[0].Requires[1].Outdated() {
+		t.Error("Outdated: want only the dmitri.shuralyov.com/a requirement to be outdated")
+	}
+
+	// Module information is cached until the repository is rediscovered.
+	runGit(t, filepath.Join(reposDir, "dmitri.shuralyov.com", "a"), time.Time{}, "tag", "v1.2.0", "master")
+	for _, tt := range []struct {
+		rediscover bool
+		wantLatest string
+	}{
+		{false, "v1.1.0"},
+		{true, "v1.2.0"},
+	} {
+		if tt.rediscover {
+			if _, _, err := service.Rediscover("dmitri.shuralyov.com/a"); err != nil {
+				t.Fatal("Rediscover:", err)
+			}
+		}
+		graph, err := service.ModuleGraph(ctx, "dmitri.shuralyov.com/b")
+		if err != nil {
+			t.Fatal("ModuleGraph:", err)
+		}
+		if got := graph[0].Requires[0].Latest; got != tt.wantLatest {
+			t.Errorf("ModuleGraph (rediscover=%v): got latest version %q of a, want %q", tt.rediscover, got, tt.wantLatest)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package code
+
+import (
+	"os"
+	"path"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/godoc/vfs"
+)
+
+// licenseFileNames are the names of files that are recognized
+// as license files, in order of preference.
+var licenseFileNames = []string{
+	"LICENSE",
+	"LICENSE.md",
+	"LICENSE.txt",
+	"LICENCE",
+	"LICENCE.md",
+	"LICENCE.txt",
+	"COPYING",
+	"COPYING.md",
+	"COPYING.txt",
+}
+
+// FindLicenseFile finds a license file in directory dir of filesystem fs.
+// It returns the name of the license file, or empty string if there isn't one.
+func FindLicenseFile(fs vfs.FileSystem, dir string) (string, error) {
+	for _, name := range licenseFileNames {
+		fi, err := fs.Stat(path.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// licenseTypes are the license types that can be recognized,
+// in the order they're tried. Licenses whose text contains
+// the phrases of another license (e.g., the 3-clause BSD license
+// contains the phrases of the 2-clause one) must come first.
+var licenseTypes = []struct {
+	SPDX    string   // SPDX license identifier.
+	Phrases []string // Normalized phrases that must all be present in license text.
+
+	Redistributable bool
+}{
+	{SPDX: "AGPL-3.0", Phrases: []string{"gnu affero general public license version 3"}, Redistributable: true},
+	{SPDX: "LGPL-3.0", Phrases: []string{"gnu lesser general public license version 3"}, Redistributable: true},
+	{SPDX: "LGPL-2.1", Phrases: []string{"gnu lesser general public license version 2 1"}, Redistributable: true},
+	{SPDX: "GPL-3.0", Phrases: []string{"gnu general public license version 3"}, Redistributable: true},
+	{SPDX: "GPL-2.0", Phrases: []string{"gnu general public license version 2"}, Redistributable: true},
+	{SPDX: "MPL-2.0", Phrases: []string{"mozilla public license version 2 0"}, Redistributable: true},
+	{SPDX: "Apache-2.0", Phrases: []string{"apache license version 2 0"}, Redistributable: true},
+	{SPDX: "BSL-1.0", Phrases: []string{"boost software license version 1 0"}, Redistributable: true},
+	{SPDX: "BUSL-1.1", Phrases: []string{"business source license 1 1"}},
+	{SPDX: "CC-BY-NC-4.0", Phrases: []string{"attribution noncommercial 4 0 international"}},
+	{SPDX: "CC0-1.0", Phrases: []string{"cc0 1 0 universal"}, Redistributable: true},
+	{SPDX: "Unlicense", Phrases: []string{"this is free and unencumbered software released into the public domain"}, Redistributable: true},
+	{SPDX: "BSD-3-Clause", Phrases: []string{"redistribution and use in source and binary forms", "may be used to endorse or promote products derived from this software"}, Redistributable: true},
+	{SPDX: "BSD-2-Clause", Phrases: []string{"redistribution and use in source and binary forms", "redistributions in binary form must reproduce"}, Redistributable: true},
+	{SPDX: "MIT", Phrases: []string{"permission is hereby granted free of charge to any person obtaining a copy of this software"}, Redistributable: true},
+	{SPDX: "ISC", Phrases: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted", "provided that the above copyright notice and this permission notice appear in all copies"}, Redistributable: true},
+	{SPDX: "0BSD", Phrases: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}, Redistributable: true},
+	{SPDX: "Zlib", Phrases: []string{"altered source versions must be plainly marked as such", "this notice may not be removed or altered from any source distribution"}, Redistributable: true},
+}
+
+// ClassifyLicense classifies license text, and returns
+// the SPDX identifier of the license it contains,
+// or empty string if the license isn't recognized.
+func ClassifyLicense(text []byte) string {
+	normalized := " " + normalizeLicenseText(string(text)) + " "
+	for _, l := range licenseTypes {
+		if containsAllPhrases(normalized, l.Phrases) {
+			return l.SPDX
+		}
+	}
+	return ""
+}
+
+// LicenseRedistributable reports whether the license with
+// the given SPDX identifier permits redistribution.
+// Unrecognized licenses are not considered redistributable.
+func LicenseRedistributable(spdx string) bool {
+	for _, l := range licenseTypes {
+		if l.SPDX == spdx {
+			return l.Redistributable
+		}
+	}
+	return false
+}
+
+// normalizeLicenseText normalizes license text so that it can be
+// matched against phrases. Text is converted to lower case, and
+// all sequences of non-alphanumeric characters are replaced by a
+// single space, so that differences in formatting and punctuation
+// don't matter.
+func normalizeLicenseText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// containsAllPhrases reports whether normalized text s,
+// padded with spaces, contains all of the phrases as whole words.
+func containsAllPhrases(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if !strings.Contains(s, " "+p+" ") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package code_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/shurcooL/home/internal/code"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestClassifyLicense(t *testing.T) {
+	mit, err := ioutil.ReadFile("../../LICENSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"MIT", string(mit), "MIT"},
+		{"BSD-3-Clause", `Copyright (c) 2009 The Go Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+   * Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+   * Redistributions in binary form must reproduce the above
+copyright notice, this list of conditions and the following disclaimer
+in the documentation and/or other materials provided with the
+distribution.
+   * Neither the name of Google Inc. nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+`, "BSD-3-Clause"},
+		{"BSD-2-Clause", `Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+`, "BSD-2-Clause"},
+		{"Apache-2.0", "\n                                 Apache License\n                           Version 2.0, January 2004\n", "Apache-2.0"},
+		{"GPL-3.0", `                    GNU GENERAL PUBLIC LICENSE
+                       Version 3, 29 June 2007
+
+But first, please read <https://www.gnu.org/licenses/why-not-lgpl.html>
+and consider whether to use the GNU Lesser General Public License instead.
+`, "GPL-3.0"},
+		{"LGPL-2.1", "GNU LESSER GENERAL PUBLIC LICENSE\nVersion 2.1, February 1999\n", "LGPL-2.1"},
+		{"ISC", `Permission to use, copy, modify, and/or distribute this software for any
+purpose with or without fee is hereby granted, provided that the above
+copyright notice and this permission notice appear in all copies.
+`, "ISC"},
+		{"unknown", "SCRATCH LICENSE TEXT\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := code.ClassifyLicense([]byte(tt.text)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLicenseRedistributable(t *testing.T) {
+	for _, tt := range []struct {
+		spdx string
+		want bool
+	}{
+		{"MIT", true},
+		{"BSD-3-Clause", true},
+		{"GPL-3.0", true},
+		{"CC-BY-NC-4.0", false},
+		{"BUSL-1.1", false},
+		{"", false},
+	} {
+		if got := code.LicenseRedistributable(tt.spdx); got != tt.want {
+			t.Errorf("LicenseRedistributable(%q): got %v, want %v", tt.spdx, got, tt.want)
+		}
+	}
+}
+
+func TestFindLicenseFile(t *testing.T) {
+	fs := mapfs.New(map[string]string{
+		"LICENSE":           "root license",
+		"a/COPYING.md":      "a license",
+		"b/LICENSE.md":      "b license",
+		"b/COPYING":         "b license",
+		"c/README.md":       "no license",
+		"d/LICENSE/foo.txt": "not a license file",
+	})
+	for _, tt := range []struct {
+		dir  string
+		want string
+	}{
+		{"/", "LICENSE"},
+		{"/a", "COPYING.md"},
+		{"/b", "LICENSE.md"},
+		{"/c", ""},
+		{"/d", ""},
+	} {
+		got, err := code.FindLicenseFile(fs, tt.dir)
+		if err != nil {
+			t.Fatalf("FindLicenseFile(%q): %v", tt.dir, err)
+		}
+		if got != tt.want {
+			t.Errorf("FindLicenseFile(%q): got %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
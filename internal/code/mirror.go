@@ -0,0 +1,203 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/users"
+)
+
+// mirrorConfigKey is the git config key where the upstream URL
+// of a mirror repository is recorded. Repositories that are mirrors
+// are read-only; they're updated by fetching from upstream only.
+const mirrorConfigKey = "home.mirror"
+
+// CreateMirror creates a repository with the specified repoSpec
+// that mirrors the upstream git repository at upstreamURL.
+// If the directory already exists, os.ErrExist is returned.
+func (s *Service) CreateMirror(ctx context.Context, repoSpec, upstreamURL string) error {
+	currentUser, err := s.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	if repoSpec != path.Clean(repoSpec) {
+		return fmt.Errorf("repo spec %q is not in its canonical form %q", repoSpec, path.Clean(repoSpec))
+	}
+	if upstreamURL == "" || strings.HasPrefix(upstreamURL, "-") {
+		return fmt.Errorf("upstream URL %q is not valid", upstreamURL)
+	}
+
+	s.mu.RLock()
+	_, ok := s.byImportPath[repoSpec]
+	s.mu.RUnlock()
+	if ok {
+		return os.ErrExist
+	}
+
+	// Clone a bare mirror of upstream, and record its owner and upstream URL.
+	gitDir := filepath.Join(s.reposDir, filepath.FromSlash(repoSpec))
+	cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", "--quiet", "--", upstreamURL, gitDir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(gitDir)
+		return fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	cmd = exec.Command("git", "--git-dir", gitDir, "config", ownerConfigKey, fmt.Sprintf("%d@%s", currentUser.ID, currentUser.Domain))
+	err = cmd.Run()
+	if err != nil {
+		os.RemoveAll(gitDir)
+		return err
+	}
+	cmd = exec.Command("git", "--git-dir", gitDir, "config", mirrorConfigKey, upstreamURL)
+	err = cmd.Run()
+	if err != nil {
+		os.RemoveAll(gitDir)
+		return err
+	}
+	s.mu.Lock()
+	s.owners[repoSpec] = currentUser.UserSpec
+	s.mu.Unlock()
+
+	// Discover packages in the newly mirrored repository.
+	_, _, err = s.Rediscover(repoSpec)
+	if err != nil {
+		return err
+	}
+
+	// Watch the newly created repository.
+	err = s.notification.SubscribeThread(ctx, repoSpec, "", 0, []users.UserSpec{currentUser.UserSpec})
+	if err != nil {
+		return err
+	}
+
+	// Log a "created repository" event.
+	err = s.events.Log(ctx, event.Event{
+		Time:      time.Now().UTC(),
+		Actor:     currentUser,
+		Container: repoSpec,
+		Payload: event.Create{
+			Type:        "repository",
+			Description: "Mirror of " + RedactURL(upstreamURL),
+		},
+	})
+	return err
+}
+
+// MirrorUpstream returns the upstream URL of the repository with
+// the specified repo root, if it's a mirror. It returns the empty
+// string if the repository isn't a mirror.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) MirrorUpstream(ctx context.Context, repoRoot string) (string, error) {
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return mirrorUpstream(ctx, gitDir)
+}
+
+// RedactURL returns upstream URL rawURL with any user information,
+// such as credentials, removed, so that it's safe to display.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		// Not a URL with user information, such as an scp-like
+		// address "git@host:path", whose user isn't a secret.
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// mirrorUpstream returns the upstream URL of the repository at gitDir,
+// or the empty string if it isn't a mirror.
+func mirrorUpstream(ctx context.Context, gitDir string) (string, error) {
+	upstream, _, err := getConfig(ctx, gitDir, mirrorConfigKey)
+	return upstream, err
+}
+
+// ListMirrors lists repo roots of repositories that are mirrors, in sorted order.
+func (s *Service) ListMirrors(ctx context.Context) ([]string, error) {
+	var repoRoots []string
+	s.mu.RLock()
+	for _, d := range s.dirs {
+		if d.IsRepoRoot() {
+			repoRoots = append(repoRoots, d.RepoRoot)
+		}
+	}
+	s.mu.RUnlock()
+
+	var mirrors []string
+	for _, repoRoot := range repoRoots {
+		upstream, err := mirrorUpstream(ctx, filepath.Join(s.reposDir, filepath.FromSlash(repoRoot)))
+		if err != nil {
+			return nil, err
+		} else if upstream == "" {
+			continue
+		}
+		mirrors = append(mirrors, repoRoot)
+	}
+	return mirrors, nil
+}
+
+// FetchMirror fetches the latest changes from upstream into the
+// mirror repository with the specified repo root, and rediscovers
+// code in it. It returns packages that have been added and removed.
+// It returns os.ErrNotExist if there's no such mirror repository.
+func (s *Service) FetchMirror(ctx context.Context, repoRoot string) (added, removed []*Directory, err error) {
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if upstream, err := mirrorUpstream(ctx, gitDir); err != nil {
+		return nil, nil, err
+	} else if upstream == "" {
+		return nil, nil, os.ErrNotExist
+	}
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "fetch", "--prune", "--quiet", "origin")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	return s.Rediscover(repoRoot)
+}
+
+// RunMirrorFetcher fetches all mirror repositories from upstream
+// every interval, until ctx is canceled.
+func (s *Service) RunMirrorFetcher(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		mirrors, err := s.ListMirrors(ctx)
+		if err != nil {
+			log.Println("code.ListMirrors:", err)
+			continue
+		}
+		for _, repoRoot := range mirrors {
+			added, removed, err := s.FetchMirror(ctx, repoRoot)
+			if err != nil {
+				log.Printf("code.FetchMirror(%q): %v\n", repoRoot, err)
+				continue
+			}
+			if len(added) > 0 || len(removed) > 0 {
+				log.Printf("code.FetchMirror(%q): %d packages added, %d removed\n", repoRoot, len(added), len(removed))
+			}
+		}
+	}
+}
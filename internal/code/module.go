@@ -11,7 +11,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -22,6 +24,7 @@ import (
 	"github.com/shurcooL/httperror"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 	"sourcegraph.com/sourcegraph/go-vcs/vcs"
 	"sourcegraph.com/sourcegraph/go-vcs/vcs/git"
 )
@@ -34,22 +37,27 @@ import (
 // general go mod download functionality that extracts module
 // versions from a VCS repository:
 //
-// • It serves only pseudo-versions derived from commits
-// on master branch. No other versions or module queries
-// are supported at this time.
-//
-// • It serves a single module corresponding to the root
-// of each repository. Multi-module repositories are not
+// • It serves pseudo-versions derived from commits on
+// master branch, and release versions derived from tags
+// like "v1.2.3" or "subdir/v1.2.3" (for a nested module
+// in subdir). No other versions or module queries are
 // supported at this time.
 //
-// • It serves only the v0 major version. Major versions
-// other than v0 are not supported at this time.
+// • It serves a module corresponding to the root of each
+// repository, and a module for each nested module, i.e.,
+// a subdirectory that contains its own go.mod file.
+//
+// • It serves only the v0 and v1 major versions. Major versions
+// v2 and higher are not supported at this time.
 //
 // This may change over time as my needs evolve.
 type ModuleHandler struct {
 	// Code is the underlying source of Go code.
-	// Each repository root available in it is served as a Go module.
+	// Each module root available in it is served as a Go module.
 	Code *Service
+
+	// Cache, if not nil, is used to serve modules that are not in Code.
+	Cache *ModuleCache
 }
 
 // ServeModule serves a module proxy protocol HTTP request.
@@ -74,23 +82,21 @@ func (h ModuleHandler) ServeModule(w http.ResponseWriter, req *http.Request) err
 
 	// Look up code directory by module path.
 	d, err := h.Code.GetDirectory(req.Context(), modulePath)
-	if err != nil || !d.IsRepoRoot() {
+	if err != nil && h.Cache != nil {
+		// Not a local module, serve it via the module cache.
+		return h.Cache.serveModule(req.Context(), w, unesc)
+	} else if err != nil || !d.IsModuleRoot() {
 		return os.ErrNotExist
 	}
 	gitDir := filepath.Join(h.Code.reposDir, filepath.FromSlash(d.RepoRoot))
+	moduleDir := strings.TrimPrefix(d.ImportPath[len(d.RepoRoot):], "/") // Module directory relative to repository root.
 
 	// Handle "/@v/list" request.
 	if typ == "list" {
-		return h.serveList(req.Context(), w, gitDir)
+		return h.serveList(req.Context(), w, gitDir, moduleDir)
 	}
 
-	// Parse the time and revision from the v0.0.0 pseudo-version.
-	versionTime, versionRevision, err := mod.ParseV000PseudoVersion(version)
-	if err != nil {
-		return os.ErrNotExist
-	}
-
-	// Open the git repository and get the commit that corresponds to the pseudo-version.
+	// Open the git repository and get the commit that corresponds to the version.
 	repo, err := git.Open(gitDir)
 	if err != nil {
 		return err
@@ -100,36 +106,93 @@ func (h ModuleHandler) ServeModule(w http.ResponseWriter, req *http.Request) err
 			log.Println("ModuleHandler.ServeModule: repo.Close:", err)
 		}
 	}()
-	commitID, err := repo.ResolveRevision(versionRevision)
+	commit, err := resolveModuleVersion(req.Context(), gitDir, repo, moduleDir, version)
 	if err != nil {
-		return os.ErrNotExist
-	}
-	commit, err := repo.GetCommit(commitID)
-	if err != nil || commit.Committer == nil || !versionTime.Equal(time.Unix(commit.Committer.Date.Seconds, 0).UTC()) {
-		return os.ErrNotExist
-	} else if !isCommitOnMaster(req.Context(), gitDir, commit) {
-		return os.ErrNotExist
+		return err
 	}
 
 	// Handle one of "/@v/<version>.<ext>" requests.
 	switch typ {
 	case "info":
-		return h.serveInfo(w, version, versionTime)
+		return h.serveInfo(w, version, time.Unix(commit.Committer.Date.Seconds, 0).UTC())
 	case "mod":
-		return h.serveMod(w, modulePath, repo, commitID)
+		return h.serveMod(w, modulePath, moduleDir, repo, commit.ID)
 	case "zip":
-		return h.serveZip(w, modulePath, version, repo, commitID)
+		return h.serveZip(w, modulePath, moduleDir, version, repo, commit.ID)
 	default:
 		panic("unreachable")
 	}
 }
 
-func (ModuleHandler) serveList(ctx context.Context, w http.ResponseWriter, gitDir string) error {
-	revs, err := listMasterCommits(ctx, gitDir)
+// resolveModuleVersion returns the commit that corresponds to version
+// of the module in moduleDir of git repo at gitDir. The version must
+// be a v0.0.0 pseudo-version of a commit on master branch, or a release
+// version with a corresponding tag. It returns os.ErrNotExist if there
+// isn't such a commit, or the module doesn't exist in that commit.
+//
+// Tags are mutable, but module versions must not change once served.
+// The commit of a release version is recorded the first time it's
+// resolved, and the release version is refused if its tag is later
+// moved to a different commit. See pinReleaseVersion.
+func resolveModuleVersion(ctx context.Context, gitDir string, repo *git.Repository, moduleDir, version string) (*vcs.Commit, error) {
+	var commitID vcs.CommitID
+	if versionTime, versionRevision, err := mod.ParseV000PseudoVersion(version); err == nil {
+		// Get the commit that corresponds to the pseudo-version.
+		commitID, err = repo.ResolveRevision(versionRevision)
+		if err != nil {
+			return nil, os.ErrNotExist
+		}
+		commit, err := repo.GetCommit(commitID)
+		if err != nil || commit.Committer == nil || !versionTime.Equal(time.Unix(commit.Committer.Date.Seconds, 0).UTC()) {
+			return nil, os.ErrNotExist
+		} else if !isCommitOnMaster(ctx, gitDir, commit) {
+			return nil, os.ErrNotExist
+		}
+	} else if IsReleaseVersion(version) {
+		// Get the commit that corresponds to the tag.
+		tag := moduleTagPrefix(moduleDir) + version
+		commitID, err = repo.ResolveTag(tag)
+		if err != nil {
+			return nil, os.ErrNotExist
+		}
+		err = pinReleaseVersion(ctx, gitDir, tag, commitID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, os.ErrNotExist
+	}
+	commit, err := repo.GetCommit(commitID)
+	if err != nil || commit.Committer == nil {
+		return nil, os.ErrNotExist
+	}
+	if moduleDir != "" {
+		// Check that the nested module exists in this commit.
+		ok, err := hasModule(repo, commitID, moduleDir)
+		if err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, os.ErrNotExist
+		}
+	}
+	return commit, nil
+}
+
+// serveList serves a list of versions of the module in moduleDir,
+// release versions first, followed by pseudo-versions.
+func (ModuleHandler) serveList(ctx context.Context, w http.ResponseWriter, gitDir, moduleDir string) error {
+	tags, err := listModuleTags(ctx, gitDir, moduleDir)
+	if err != nil {
+		return err
+	}
+	revs, err := listMasterCommits(ctx, gitDir, moduleDir)
 	if err != nil {
 		return err
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, v := range tags {
+		fmt.Fprintln(w, v)
+	}
 	for i := len(revs) - 1; i >= 0; i-- {
 		fmt.Fprintln(w, revs[i].Version)
 	}
@@ -147,12 +210,12 @@ func (ModuleHandler) serveInfo(w http.ResponseWriter, version string, time time.
 	return err
 }
 
-func (ModuleHandler) serveMod(w http.ResponseWriter, modulePath string, repo *git.Repository, commitID vcs.CommitID) error {
+func (ModuleHandler) serveMod(w http.ResponseWriter, modulePath, moduleDir string, repo *git.Repository, commitID vcs.CommitID) error {
 	fs, err := repo.FileSystem(commitID)
 	if err != nil {
 		return err
 	}
-	f, err := fs.Open("/go.mod")
+	f, err := fs.Open(path.Join("/", moduleDir, "go.mod"))
 	if os.IsNotExist(err) {
 		// go.mod file doesn't exist in this commit.
 		f = nil
@@ -174,17 +237,19 @@ func (ModuleHandler) serveMod(w http.ResponseWriter, modulePath string, repo *gi
 	}
 }
 
-func (ModuleHandler) serveZip(w http.ResponseWriter, modulePath, version string, repo *git.Repository, commitID vcs.CommitID) error {
+func (ModuleHandler) serveZip(w http.ResponseWriter, modulePath, moduleDir, version string, repo *git.Repository, commitID vcs.CommitID) error {
 	w.Header().Set("Content-Type", "application/zip")
-	return WriteModuleZip(w, module.Version{Path: modulePath, Version: version}, repo, commitID)
+	return WriteModuleZip(w, module.Version{Path: modulePath, Version: version}, repo, commitID, moduleDir)
 }
 
 // WriteModuleZip builds a zip archive for module version m
-// by including all files from repository r at commit id,
-// and writes the result to w.
+// by including all files from directory dir of repository r
+// at commit id, and writes the result to w. dir is a slash-separated
+// path relative to the repository root, or the empty string for the
+// repository root itself.
 //
-// WriteModuleZip does not support multi-module repositories.
-// A go.mod file may be in root, but not in any other directory.
+// Subdirectories of dir that contain a go.mod file are
+// nested modules, and their files are not included.
 //
 // Unlike "golang.org/x/mod/zip".Create, it does not verify
 // any module zip restrictions. It will produce an invalid
@@ -192,21 +257,28 @@ func (ModuleHandler) serveZip(w http.ResponseWriter, modulePath, version string,
 // It should be used on commits that are known to have files
 // that are all acceptable to include in a module zip.
 //
-func WriteModuleZip(w io.Writer, m module.Version, r vcs.Repository, id vcs.CommitID) error {
+func WriteModuleZip(w io.Writer, m module.Version, r vcs.Repository, id vcs.CommitID, dir string) error {
 	fs, err := r.FileSystem(id)
 	if err != nil {
 		return err
 	}
+	root := path.Join("/", dir)
 	z := zip.NewWriter(w)
-	err = vfsutil.Walk(fs, "/", func(name string, fi os.FileInfo, err error) error {
+	err = vfsutil.Walk(fs, root, func(name string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if fi.IsDir() {
+			// Skip nested modules.
+			if name != root {
+				if _, err := fs.Stat(path.Join(name, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
 			// We need to include only files, not directories.
 			return nil
 		}
-		dst, err := z.Create(m.Path + "@" + m.Version + name)
+		dst, err := z.Create(m.Path + "@" + m.Version + strings.TrimPrefix(name, strings.TrimSuffix(root, "/")))
 		if err != nil {
 			return err
 		}
@@ -234,13 +306,33 @@ func isCommitOnMaster(ctx context.Context, gitDir string, c *vcs.Commit) bool {
 	return err == nil
 }
 
+// masterCommit returns the commit hash that master branch of git repo
+// at gitDir points to, or the empty string if it doesn't exist.
+func masterCommit(ctx context.Context, gitDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", "refs/heads/master^{commit}")
+	cmd.Dir = gitDir
+	out, err := cmd.Output()
+	if ee, _ := err.(*exec.ExitError); ee != nil && ee.Sys().(syscall.WaitStatus).ExitStatus() == 1 {
+		return "", nil // Master branch doesn't exist.
+	} else if err != nil {
+		return "", fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
 // listMasterCommits returns a list of commits in git repo on master branch.
+// If dir is not empty, only commits that modify the nested module in dir
+// and have a dir/go.mod file are included.
 // If master branch doesn't exist, an empty list is returned.
-func listMasterCommits(ctx context.Context, gitDir string) ([]mod.RevInfo, error) {
-	cmd := exec.CommandContext(ctx, "git", "log",
+func listMasterCommits(ctx context.Context, gitDir, dir string) ([]mod.RevInfo, error) {
+	args := []string{"log",
 		"--format=tformat:%H%x00%ct",
 		"-z",
-		"master")
+		"master"}
+	if dir != "" {
+		args = append(args, "--", dir)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = gitDir
 	var buf bytes.Buffer
 	cmd.Stdout = &buf
@@ -255,7 +347,10 @@ func listMasterCommits(ctx context.Context, gitDir string) ([]mod.RevInfo, error
 		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
 	}
 
-	var revs []mod.RevInfo
+	var (
+		revs   []mod.RevInfo
+		hashes []string // Commit hashes of revs.
+	)
 	for b := buf.Bytes(); len(b) != 0; {
 		var (
 			// Calls to readLine match exactly what is specified in --format.
@@ -271,10 +366,133 @@ func listMasterCommits(ctx context.Context, gitDir string) ([]mod.RevInfo, error
 			Version: mod.PseudoVersion("", "", t, commitHash[:12]),
 			Time:    t,
 		})
+		hashes = append(hashes, commitHash)
+	}
+	if dir != "" && len(revs) > 0 {
+		// Drop commits from before the nested module was created.
+		// Revisions are ordered newest first, so the module exists
+		// in a prefix of them.
+		n, err := countCommitsWithFile(ctx, gitDir, hashes, path.Join(dir, "go.mod"))
+		if err != nil {
+			return nil, err
+		}
+		revs = revs[:n]
 	}
 	return revs, nil
 }
 
+// countCommitsWithFile returns the number of leading commits in
+// commitHashes that have a file at the slash-separated path name.
+func countCommitsWithFile(ctx context.Context, gitDir string, commitHashes []string, name string) (int, error) {
+	var stdin bytes.Buffer
+	for _, hash := range commitHashes {
+		fmt.Fprintf(&stdin, "%s:%s\n", hash, name)
+	}
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "--batch-check")
+	cmd.Dir = gitDir
+	cmd.Stdin = &stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	n := 0
+	for _, line := range strings.Split(string(out), "\n") {
+		// Each line is "<object> blob <size>" if the file exists,
+		// or "<input> missing" if it doesn't.
+		if f := strings.Fields(line); len(f) != 3 || f[1] != "blob" {
+			break
+		}
+		n++
+	}
+	return n, nil
+}
+
+// listModuleTags returns a list of release versions of the nested module
+// in dir of git repo at gitDir, or of the repository root module if dir
+// is empty, sorted in semantic version order. Release versions are derived
+// from tags like "v1.2.3" or "dir/v1.2.3".
+func listModuleTags(ctx context.Context, gitDir, dir string) ([]string, error) {
+	prefix := moduleTagPrefix(dir)
+	cmd := exec.CommandContext(ctx, "git", "tag", "--list", prefix+"v*")
+	cmd.Dir = gitDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	var versions []string
+	for _, tag := range strings.Fields(string(out)) {
+		v := strings.TrimPrefix(tag, prefix)
+		if !IsReleaseVersion(v) {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return semver.Compare(versions[i], versions[j]) < 0 })
+	return versions, nil
+}
+
+// moduleTagPrefix returns the prefix of tags for release versions
+// of the nested module in dir, or the repository root module if dir is empty.
+func moduleTagPrefix(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return dir + "/"
+}
+
+// IsReleaseVersion reports whether v is a canonical semantic version
+// with major version v0 or v1 that can be served from a tag.
+// The pre-receive hook uses it to decide which tags to verify.
+func IsReleaseVersion(v string) bool {
+	if !semver.IsValid(v) || semver.Canonical(v) != v {
+		return false
+	}
+	if major := semver.Major(v); major != "v0" && major != "v1" {
+		return false
+	}
+	return !module.IsPseudoVersion(v)
+}
+
+// pinReleaseVersion checks that release version tag of git repo
+// at gitDir resolves to the same commit as the first time it was
+// resolved, and records commitID as that commit if it's the first time.
+// It returns an error if the tag has been moved to a different commit.
+func pinReleaseVersion(ctx context.Context, gitDir, tag string, commitID vcs.CommitID) error {
+	key := releaseConfigKey(tag)
+	pinned, ok, err := getConfig(ctx, gitDir, key)
+	if err != nil {
+		return err
+	} else if !ok {
+		return setConfig(ctx, gitDir, key, string(commitID))
+	}
+	if pinned != string(commitID) {
+		return fmt.Errorf("tag %q was moved from commit %s to %s after its release version was served; refusing to serve it", tag, pinned, commitID)
+	}
+	return nil
+}
+
+// releaseConfigKey returns the git config key that records
+// the commit of release version tag, see pinReleaseVersion.
+func releaseConfigKey(tag string) string {
+	return "home-release." + tag + ".commit"
+}
+
+// hasModule reports whether repository r at commit id
+// has a nested module in dir, i.e., a dir/go.mod file.
+func hasModule(r vcs.Repository, id vcs.CommitID, dir string) (bool, error) {
+	fs, err := r.FileSystem(id)
+	if err != nil {
+		return false, err
+	}
+	fi, err := fs.Stat(path.Join("/", dir, "go.mod"))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !fi.IsDir(), nil
+}
+
 // readLine reads a line until zero byte, then updates b to the byte that immediately follows.
 // A zero byte must exist in b, otherwise readLine panics.
 func readLine(b *[]byte) string {
@@ -0,0 +1,287 @@
+package code
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shurcooL/home/internal/mod"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// ModuleCache is a caching module proxy for modules that are not
+// in the local code store. It forwards requests that it can't serve
+// from its cache to an upstream module proxy, and caches the results,
+// so that the modules remain available when upstream is unavailable.
+//
+// Only canonical versions are cached. Queries for other versions,
+// like branch names, are always passed through to upstream.
+//
+// Module .zip and go.mod files are verified against a go.sum-style record
+// kept in Dir. Checksums of module versions that are not yet in the record
+// are added to it on first download.
+type ModuleCache struct {
+	// Upstream is the base URL of the upstream module proxy,
+	// like "https://proxy.golang.org". It must not end with a slash.
+	Upstream string
+
+	// Dir is the directory where module files are cached.
+	Dir string
+
+	// Client is the HTTP client used to make requests to Upstream.
+	// If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	sumMu sync.Mutex // Guards the go.sum file in Dir.
+}
+
+// maxModuleZipSize is the maximum size of a module zip file.
+// It matches the limit enforced by the go command.
+const maxModuleZipSize = 500 << 20
+
+// serveModule serves the module proxy request r, where r is unescaped.
+func (c *ModuleCache) serveModule(ctx context.Context, w http.ResponseWriter, r moduleProxyRequest) error {
+	esc, ok := r.Escape()
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	if r.Type == "list" {
+		return c.serveList(ctx, w, r, esc)
+	}
+
+	if module.CanonicalVersion(r.Version) != r.Version {
+		// Queries like "master" or "v1.2" resolve to different
+		// versions over time, so they're passed through to upstream.
+		b, err := c.fetch(ctx, esc)
+		if err != nil {
+			return err
+		}
+		return writeModuleFile(w, r.Type, b)
+	}
+
+	cachePath := filepath.Join(c.Dir, filepath.FromSlash(esc.URL()))
+	b, err := ioutil.ReadFile(cachePath)
+	if os.IsNotExist(err) {
+		// Not in cache, fetch it from upstream.
+		b, err = c.fetch(ctx, esc)
+		if err != nil {
+			return err
+		}
+		err = c.verify(r, b)
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomic(cachePath, b)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return writeModuleFile(w, r.Type, b)
+}
+
+// writeModuleFile writes the module file b of type typ
+// ("info", "mod" or "zip") to w.
+func writeModuleFile(w http.ResponseWriter, typ string, b []byte) error {
+	switch typ {
+	case "info":
+		w.Header().Set("Content-Type", "application/json")
+	case "mod":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	case "zip":
+		w.Header().Set("Content-Type", "application/zip")
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// serveList serves a "/@v/list" request. The list is fetched
+// from upstream, since it may change over time. If upstream
+// is unavailable, the versions available in cache are served.
+func (c *ModuleCache) serveList(ctx context.Context, w http.ResponseWriter, r, esc moduleProxyRequest) error {
+	b, err := c.fetch(ctx, esc)
+	if err != nil && !os.IsNotExist(err) {
+		// Fall back to the versions in cache.
+		b, err = c.cachedVersions(esc)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = w.Write(b)
+	return err
+}
+
+// cachedVersions returns a list of versions of module esc,
+// one per line, for which a .info file is cached.
+func (c *ModuleCache) cachedVersions(esc moduleProxyRequest) ([]byte, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(c.Dir, filepath.FromSlash(esc.Module), "@v"))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), ".info") {
+			continue
+		}
+		v, err := module.UnescapeVersion(strings.TrimSuffix(fi.Name(), ".info"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	var buf bytes.Buffer
+	for _, v := range versions {
+		fmt.Fprintln(&buf, v)
+	}
+	return buf.Bytes(), nil
+}
+
+// fetch fetches the escaped module proxy request esc from upstream.
+// It returns an error satisfying os.IsNotExist if upstream
+// doesn't have the requested module or version.
+func (c *ModuleCache) fetch(ctx context.Context, esc moduleProxyRequest) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.Upstream+"/"+esc.URL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, os.ErrNotExist
+	default:
+		return nil, fmt.Errorf("upstream module proxy: %s %s: %s", req.Method, req.URL, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxModuleZipSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxModuleZipSize {
+		return nil, fmt.Errorf("upstream module proxy: %s %s: response exceeds %d bytes", req.Method, req.URL, maxModuleZipSize)
+	}
+	return b, nil
+}
+
+// verify verifies the checksum of the .zip or .mod file b
+// of module version r against the go.sum record.
+// If the record doesn't have the checksum, it's added.
+func (c *ModuleCache) verify(r moduleProxyRequest, b []byte) error {
+	var (
+		version = r.Version
+		sum     string
+		err     error
+	)
+	switch r.Type {
+	case "zip":
+		sum, err = mod.HashZip(b, dirhash.DefaultHash)
+	case "mod":
+		version += "/go.mod"
+		sum, err = dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		})
+	default:
+		// Only .zip and .mod files have checksums.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("computing checksum of %s@%s: %v", r.Module, version, err)
+	}
+
+	c.sumMu.Lock()
+	defer c.sumMu.Unlock()
+	sums, err := c.readSums()
+	if err != nil {
+		return err
+	}
+	key := r.Module + " " + version
+	if want, ok := sums[key]; ok {
+		if sum != want {
+			return fmt.Errorf("checksum mismatch for %s: downloaded %s, go.sum has %s", key, sum, want)
+		}
+		return nil
+	}
+	return c.appendSum(key + " " + sum + "\n")
+}
+
+// readSums reads the go.sum file in c.Dir. The returned map is keyed by
+// "<module> <version>" or "<module> <version>/go.mod", and its values are checksums.
+func (c *ModuleCache) readSums() (map[string]string, error) {
+	f, err := os.Open(filepath.Join(c.Dir, "go.sum"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sums := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 3 {
+			continue
+		}
+		sums[f[0]+" "+f[1]] = f[2]
+	}
+	return sums, s.Err()
+}
+
+// appendSum appends line to the go.sum file in c.Dir.
+func (c *ModuleCache) appendSum(line string) error {
+	err := os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(c.Dir, "go.sum"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, line)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// writeFileAtomic writes b to the file at path, creating parent
+// directories as needed. The file is either written in full, or not at all.
+func writeFileAtomic(path string, b []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
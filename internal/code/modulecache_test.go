@@ -0,0 +1,148 @@
+package code_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestModuleCache(t *testing.T) {
+	// Start a stand-in upstream module proxy that serves
+	// module example.com/hello at versions v1.0.0 and v1.1.0.
+	upstreamFiles := map[string][]byte{
+		"/example.com/hello/@v/list":        []byte("v1.0.0\nv1.1.0\n"),
+		"/example.com/hello/@v/v1.0.0.info": []byte(`{"Version":"v1.0.0","Time":"2020-01-01T00:00:00Z"}`),
+		"/example.com/hello/@v/v1.0.0.mod":  []byte("module example.com/hello\n"),
+		"/example.com/hello/@v/v1.0.0.zip":  moduleZip(t, "example.com/hello@v1.0.0", "package hello\n"),
+		"/example.com/hello/@v/v1.1.0.info": []byte(`{"Version":"v1.1.0","Time":"2020-02-01T00:00:00Z"}`),
+		"/example.com/hello/@v/v1.1.0.mod":  []byte("module example.com/hello\n"),
+		"/example.com/hello/@v/v1.1.0.zip":  moduleZip(t, "example.com/hello@v1.1.0", "package hello // Tampered.\n"),
+		"/example.com/hello/@v/master.info": []byte(`{"Version":"v1.1.0","Time":"2020-02-01T00:00:00Z"}`),
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, ok := upstreamFiles[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write(b)
+	}))
+	defer upstream.Close()
+
+	notification := mockNotification{}
+	events := &mockEvents{}
+	users := mockUsers{}
+	service, err := code.NewService(filepath.Join("testdata", "repositories"), notification, events, users)
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	cacheDir, err := ioutil.TempDir("", "modulecache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	// The go.sum record has a known checksum for v1.1.0
+	// that doesn't match what upstream serves.
+	err = ioutil.WriteFile(filepath.Join(cacheDir, "go.sum"), []byte("example.com/hello v1.1.0 h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moduleHandler := code.ModuleHandler{
+		Code: service,
+		Cache: &code.ModuleCache{
+			Upstream: upstream.URL,
+			Dir:      cacheDir,
+		},
+	}
+	handler := http.StripPrefix("/api/module/", httputil.ErrorHandler(nil, moduleHandler.ServeModule))
+	get := func(url string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Modules in the store are served from the store, not upstream.
+	if rr := get("/api/module/dmitri.shuralyov.com/kebabcase/@v/list"); rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "v0.0.0-20170912031248-a1d95f8919b5\n") {
+		t.Errorf("local module: got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// Modules not in the store are fetched from upstream.
+	for _, ext := range []string{"info", "mod", "zip"} {
+		rr := get("/api/module/example.com/hello/@v/v1.0.0." + ext)
+		if got, want := rr.Code, http.StatusOK; got != want {
+			t.Fatalf("%s: got status code %d, want %d", ext, got, want)
+		}
+		if got, want := rr.Body.Bytes(), upstreamFiles["/example.com/hello/@v/v1.0.0."+ext]; !bytes.Equal(got, want) {
+			t.Errorf("%s: got body %q, want %q", ext, got, want)
+		}
+	}
+	sum, err := ioutil.ReadFile(filepath.Join(cacheDir, "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"example.com/hello v1.0.0 h1:", "example.com/hello v1.0.0/go.mod h1:"} {
+		if !strings.Contains(string(sum), want) {
+			t.Errorf("go.sum doesn't contain %q:\n%s", want, sum)
+		}
+	}
+
+	// Queries for non-canonical versions are served, but not cached.
+	if rr := get("/api/module/example.com/hello/@v/master.info"); rr.Code != http.StatusOK || rr.Body.String() != string(upstreamFiles["/example.com/hello/@v/master.info"]) {
+		t.Errorf("master.info: got %d %q", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "example.com", "hello", "@v", "master.info")); !os.IsNotExist(err) {
+		t.Errorf("master.info was cached: %v", err)
+	}
+
+	// A zip that doesn't match the go.sum record is rejected and not cached.
+	if rr := get("/api/module/example.com/hello/@v/v1.1.0.zip"); rr.Code == http.StatusOK {
+		t.Error("got status OK for zip with checksum mismatch, want an error")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "example.com", "hello", "@v", "v1.1.0.zip")); !os.IsNotExist(err) {
+		t.Errorf("zip with checksum mismatch was cached: %v", err)
+	}
+
+	// Cached modules are served when upstream is down.
+	upstream.Close()
+	if rr := get("/api/module/example.com/hello/@v/v1.0.0.zip"); rr.Code != http.StatusOK {
+		t.Errorf("zip with upstream down: got status code %d, want %d", rr.Code, http.StatusOK)
+	}
+	if rr := get("/api/module/example.com/hello/@v/list"); rr.Code != http.StatusOK || rr.Body.String() != "v1.0.0\n" {
+		t.Errorf("list with upstream down: got %d %q, want %d %q", rr.Code, rr.Body.String(), http.StatusOK, "v1.0.0\n")
+	}
+}
+
+// moduleZip returns a module zip with prefix and a single hello.go file.
+func moduleZip(t *testing.T, prefix, helloGo string) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"go.mod":   "module example.com/hello\n",
+		"hello.go": helloGo,
+	} {
+		f, err := z.Create(prefix + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
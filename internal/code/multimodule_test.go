@@ -0,0 +1,214 @@
+package code_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/mod"
+)
+
+func TestModuleHandlerMultiModule(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "multimodule_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a repository with a nested module in sub directory.
+	// The sub directory exists in the first commit, but becomes
+	// a nested module only in the second commit.
+	workDir := filepath.Join(tempDir, "work")
+	gitDir := filepath.Join(tempDir, "repositories", "dmitri.shuralyov.com", "tools")
+	var commits []string // Commit hashes, oldest first.
+	commit := func(date time.Time, files map[string]string) {
+		t.Helper()
+		writeFiles(t, workDir, files)
+		runGit(t, workDir, date, "add", "-A")
+		runGit(t, workDir, date, "commit", "-q", "-m", "commit")
+		commits = append(commits, runGit(t, workDir, date, "rev-parse", "HEAD"))
+	}
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workDir, day(1), "init", "-q")
+	commit(day(1), map[string]string{
+		"go.mod":       "module dmitri.shuralyov.com/tools\n",
+		"tools.go":     "package tools\n",
+		"sub/hello.go": "package hello\n",
+	})
+	commit(day(2), map[string]string{
+		"sub/go.mod": "module dmitri.shuralyov.com/tools/sub\n",
+	})
+	commit(day(3), map[string]string{
+		"tools.go": "package tools // Modified.\n",
+	})
+	commit(day(4), map[string]string{
+		"sub/hello.go": "package hello // Modified.\n",
+	})
+	runGit(t, workDir, day(4), "tag", "v0.1.0", commits[2])
+	runGit(t, workDir, day(4), "tag", "sub/v1.0.0", commits[3])
+	runGit(t, workDir, day(4), "tag", "sub/v2.0.0", commits[3]) // Major version v2 is not served.
+	runGit(t, workDir, day(4), "tag", "sub/not-a-version", commits[3])
+	runGit(t, tempDir, day(4), "clone", "-q", "--bare", workDir, gitDir)
+
+	notification := mockNotification{}
+	events := &mockEvents{}
+	users := mockUsers{}
+	service, err := code.NewService(filepath.Join(tempDir, "repositories"), notification, events, users)
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+
+	// Nested modules are discovered.
+	for _, tt := range []struct {
+		importPath   string
+		wantModule   string
+		isModuleRoot bool
+	}{
+		{"dmitri.shuralyov.com/tools", "dmitri.shuralyov.com/tools", true},
+		{"dmitri.shuralyov.com/tools/sub", "dmitri.shuralyov.com/tools/sub", true},
+	} {
+		d, err := service.GetDirectory(context.Background(), tt.importPath)
+		if err != nil {
+			t.Fatalf("service.GetDirectory(%q): %v", tt.importPath, err)
+		}
+		if got, want := d.Module(), tt.wantModule; got != want {
+			t.Errorf("%s: got module %q, want %q", tt.importPath, got, want)
+		}
+		if got, want := d.IsModuleRoot(), tt.isModuleRoot; got != want {
+			t.Errorf("%s: got IsModuleRoot %v, want %v", tt.importPath, got, want)
+		}
+	}
+
+	moduleHandler := code.ModuleHandler{Code: service}
+	handler := http.StripPrefix("/api/module/", httputil.ErrorHandler(nil, moduleHandler.ServeModule))
+	get := func(url string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	pseudo := func(i int) string { return mod.PseudoVersion("", "", day(i+1), commits[i][:12]) }
+
+	for _, tt := range []struct {
+		name         string
+		url          string
+		wantNotExist bool
+		wantBody     string
+		wantFiles    []string // Expected files in module zip.
+	}{
+		{
+			name: "root version list",
+			url:  "/api/module/dmitri.shuralyov.com/tools/@v/list",
+			wantBody: "v0.1.0\n" +
+				pseudo(0) + "\n" + pseudo(1) + "\n" + pseudo(2) + "\n" + pseudo(3) + "\n",
+		},
+		{
+			name:     "sub version list",
+			url:      "/api/module/dmitri.shuralyov.com/tools/sub/@v/list",
+			wantBody: "v1.0.0\n" + pseudo(1) + "\n" + pseudo(3) + "\n",
+		},
+		{
+			name:     "root release version info",
+			url:      "/api/module/dmitri.shuralyov.com/tools/@v/v0.1.0.info",
+			wantBody: "{\n\t\"Version\": \"v0.1.0\",\n\t\"Time\": \"2020-01-03T00:00:00Z\"\n}\n",
+		},
+		{
+			name:      "root release version zip",
+			url:       "/api/module/dmitri.shuralyov.com/tools/@v/v0.1.0.zip",
+			wantFiles: []string{"dmitri.shuralyov.com/tools@v0.1.0/go.mod", "dmitri.shuralyov.com/tools@v0.1.0/tools.go"},
+		},
+		{
+			name:      "root pseudo-version zip before sub became a module",
+			url:       "/api/module/dmitri.shuralyov.com/tools/@v/" + pseudo(0) + ".zip",
+			wantFiles: []string{"dmitri.shuralyov.com/tools@" + pseudo(0) + "/go.mod", "dmitri.shuralyov.com/tools@" + pseudo(0) + "/sub/hello.go", "dmitri.shuralyov.com/tools@" + pseudo(0) + "/tools.go"},
+		},
+		{
+			name:     "sub release version mod",
+			url:      "/api/module/dmitri.shuralyov.com/tools/sub/@v/v1.0.0.mod",
+			wantBody: "module dmitri.shuralyov.com/tools/sub\n",
+		},
+		{
+			name:      "sub release version zip",
+			url:       "/api/module/dmitri.shuralyov.com/tools/sub/@v/v1.0.0.zip",
+			wantFiles: []string{"dmitri.shuralyov.com/tools/sub@v1.0.0/go.mod", "dmitri.shuralyov.com/tools/sub@v1.0.0/hello.go"},
+		},
+		{
+			name:      "sub pseudo-version zip",
+			url:       "/api/module/dmitri.shuralyov.com/tools/sub/@v/" + pseudo(1) + ".zip",
+			wantFiles: []string{"dmitri.shuralyov.com/tools/sub@" + pseudo(1) + "/go.mod", "dmitri.shuralyov.com/tools/sub@" + pseudo(1) + "/hello.go"},
+		},
+		{
+			name:         "sub pseudo-version before it became a module",
+			url:          "/api/module/dmitri.shuralyov.com/tools/sub/@v/" + pseudo(0) + ".info",
+			wantNotExist: true,
+		},
+		{
+			name:         "sub release version with root tag",
+			url:          "/api/module/dmitri.shuralyov.com/tools/sub/@v/v0.1.0.info",
+			wantNotExist: true,
+		},
+		{
+			name:         "root release version with sub tag",
+			url:          "/api/module/dmitri.shuralyov.com/tools/@v/v1.0.0.info",
+			wantNotExist: true,
+		},
+		{
+			name:         "sub major version v2",
+			url:          "/api/module/dmitri.shuralyov.com/tools/sub/@v/v2.0.0.info",
+			wantNotExist: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get(tt.url)
+			if tt.wantNotExist {
+				if got, want := rr.Code, http.StatusNotFound; got != want {
+					t.Errorf("got status code %d, want %d", got, want)
+				}
+				return
+			}
+			if got, want := rr.Code, http.StatusOK; got != want {
+				t.Fatalf("got status code %d, want %d:\n%s", got, want, rr.Body.String())
+			}
+			if tt.wantFiles == nil {
+				if got, want := rr.Body.String(), tt.wantBody; got != want {
+					t.Errorf("got body:\n%s\nwant:\n%s", got, want)
+				}
+				return
+			}
+			z, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range z.File {
+				got = append(got, f.Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("got zip files:\n%q\nwant:\n%q", got, tt.wantFiles)
+			}
+		})
+	}
+
+	// A release version whose tag is moved after it was served is refused.
+	runGit(t, gitDir, day(5), "tag", "-f", "v0.1.0", commits[3])
+	if rr := get("/api/module/dmitri.shuralyov.com/tools/@v/v0.1.0.info"); rr.Code == http.StatusOK {
+		t.Errorf("got status code %d for a release version whose tag was moved, want an error:\n%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,191 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/events/event"
+)
+
+// Ref is a branch or tag in a repository.
+type Ref struct {
+	Name string // Short name. E.g., "master" or "v1.0.0".
+
+	// Commit that the ref points to. For annotated tags,
+	// it's the commit that the tag object points to.
+	Commit      string
+	Subject     string
+	AuthorName  string
+	AuthorEmail string
+	AuthorTime  time.Time
+
+	// Ahead and Behind are the number of commits that
+	// the ref is ahead of and behind the master branch.
+	// They're zero if there's no master branch.
+	Ahead, Behind int
+}
+
+// ListBranches lists branches in the repository with the specified
+// repo root, sorted by name.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) ListBranches(ctx context.Context, repoRoot string) ([]Ref, error) {
+	return s.listRefs(ctx, repoRoot, "refs/heads/")
+}
+
+// ListTags lists tags in the repository with the specified
+// repo root, sorted by name.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) ListTags(ctx context.Context, repoRoot string) ([]Ref, error) {
+	return s.listRefs(ctx, repoRoot, "refs/tags/")
+}
+
+func (s *Service) listRefs(ctx context.Context, repoRoot, prefix string) ([]Ref, error) {
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	// Fields prefixed with '*' are of the object that an annotated tag points to,
+	// and are empty for refs that point to commits directly.
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(*objectname)%00"+
+			"%(subject)%00%(*subject)%00%(authorname)%00%(*authorname)%00"+
+			"%(authoremail)%00%(*authoremail)%00%(authordate:unix)%00%(*authordate:unix)",
+		prefix)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	var refs []Ref
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		f := strings.Split(line, "\x00")
+		if len(f) != 11 {
+			return nil, fmt.Errorf("unexpected git for-each-ref line: %q", line)
+		}
+		deref := func(direct, peeled string) string {
+			if peeled != "" {
+				return peeled
+			}
+			return direct
+		}
+		ref := Ref{
+			Name:        strings.TrimPrefix(f[0], prefix),
+			Commit:      deref(f[1], f[2]),
+			Subject:     deref(f[3], f[4]),
+			AuthorName:  deref(f[5], f[6]),
+			AuthorEmail: strings.Trim(deref(f[7], f[8]), "<>"),
+		}
+		if sec, err := strconv.ParseInt(deref(f[9], f[10]), 10, 64); err == nil {
+			ref.AuthorTime = time.Unix(sec, 0).UTC()
+		}
+		ref.Ahead, ref.Behind, err = aheadBehind(ctx, gitDir, ref.Commit)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// aheadBehind returns the number of commits that commit
+// is ahead of and behind the master branch in gitDir.
+// It returns zero counts if there's no master branch.
+func aheadBehind(ctx context.Context, gitDir, commit string) (ahead, behind int, _ error) {
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "rev-list", "--left-right", "--count", "master..."+commit)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 128 {
+		// Master branch doesn't exist.
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("%v: %v: %s", cmd.Args, err, stderr.Bytes())
+	}
+	_, err = fmt.Sscanf(string(out), "%d\t%d", &behind, &ahead)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git rev-list output %q: %v", out, err)
+	}
+	return ahead, behind, nil
+}
+
+// DeleteBranch deletes the branch with the specified name
+// from the repository with the specified repo root.
+// The master branch can't be deleted.
+// It returns os.ErrNotExist if there's no such repository or branch.
+func (s *Service) DeleteBranch(ctx context.Context, repoRoot, name string) error {
+	if name == "master" {
+		return fmt.Errorf("master branch can't be deleted")
+	}
+	return s.deleteRef(ctx, repoRoot, "branch", "refs/heads/", name)
+}
+
+// DeleteTag deletes the tag with the specified name
+// from the repository with the specified repo root.
+// It returns os.ErrNotExist if there's no such repository or tag.
+func (s *Service) DeleteTag(ctx context.Context, repoRoot, name string) error {
+	return s.deleteRef(ctx, repoRoot, "tag", "refs/tags/", name)
+}
+
+// deleteRef deletes the ref prefix+name, and logs a "deleted {typ}" event.
+func (s *Service) deleteRef(ctx context.Context, repoRoot, typ, prefix, name string) error {
+	currentUser, err := s.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return err
+	}
+	ref := prefix + name
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "show-ref", "--verify", "--quiet", ref)
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		return os.ErrNotExist
+	} else if err != nil {
+		return fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	cmd = exec.CommandContext(ctx, "git", "--git-dir", gitDir, "update-ref", "-d", ref)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+
+	// Log a "deleted {typ}" event.
+	err = s.events.Log(ctx, event.Event{
+		Time:      time.Now().UTC(),
+		Actor:     currentUser,
+		Container: repoRoot,
+		Payload: event.Delete{
+			Type: typ,
+			Name: name,
+		},
+	})
+	return err
+}
+
+// gitDir returns the git directory of the repository
+// with the specified repo root.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) gitDir(repoRoot string) (string, error) {
+	s.mu.RLock()
+	d, ok := s.byImportPath[repoRoot]
+	s.mu.RUnlock()
+	if !ok || !d.IsRepoRoot() {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(s.reposDir, filepath.FromSlash(repoRoot)), nil
+}
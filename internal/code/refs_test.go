@@ -0,0 +1,115 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestRefs(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "refs_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a repository with a feature branch that is
+	// 1 commit ahead of and 1 commit behind master.
+	workDir := filepath.Join(tempDir, "work")
+	gitDir := filepath.Join(tempDir, "repositories", "dmitri.shuralyov.com", "refs")
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workDir, date, "init", "-q")
+	runGit(t, workDir, date, "checkout", "-q", "-b", "master")
+	runGit(t, workDir, date, "commit", "-q", "--allow-empty", "-m", "first")
+	runGit(t, workDir, date, "tag", "-a", "-m", "annotated", "v1.0.0")
+	runGit(t, workDir, date, "checkout", "-q", "-b", "feature")
+	runGit(t, workDir, date, "commit", "-q", "--allow-empty", "-m", "feature work")
+	feature := runGit(t, workDir, date, "rev-parse", "HEAD")
+	runGit(t, workDir, date, "checkout", "-q", "master")
+	runGit(t, workDir, date, "commit", "-q", "--allow-empty", "-m", "second")
+	master := runGit(t, workDir, date, "rev-parse", "HEAD")
+	first := runGit(t, workDir, date, "rev-parse", "HEAD~1")
+	runGit(t, tempDir, date, "clone", "-q", "--bare", workDir, gitDir)
+
+	events := &mockEvents{}
+	service, err := code.NewService(filepath.Join(tempDir, "repositories"), mockNotification{}, events, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	ctx := context.Background()
+	const repoRoot = "dmitri.shuralyov.com/refs"
+
+	branches, err := service.ListBranches(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("ListBranches:", err)
+	}
+	wantBranches := []code.Ref{
+		{Name: "feature", Commit: feature, Subject: "feature work", AuthorName: "Gopher", AuthorEmail: "gopher@example.com", AuthorTime: date, Ahead: 1, Behind: 1},
+		{Name: "master", Commit: master, Subject: "second", AuthorName: "Gopher", AuthorEmail: "gopher@example.com", AuthorTime: date},
+	}
+	if !reflect.DeepEqual(branches, wantBranches) {
+		t.Errorf("ListBranches:\ngot  %+v\nwant %+v", branches, wantBranches)
+	}
+
+	tags, err := service.ListTags(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("ListTags:", err)
+	}
+	wantTags := []code.Ref{
+		{Name: "v1.0.0", Commit: first, Subject: "first", AuthorName: "Gopher", AuthorEmail: "gopher@example.com", AuthorTime: date, Behind: 1},
+	}
+	if !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("ListTags:\ngot  %+v\nwant %+v", tags, wantTags)
+	}
+
+	// Deleting.
+	if err := service.DeleteBranch(ctx, repoRoot, "master"); err == nil {
+		t.Error("DeleteBranch(master): got nil error, want non-nil")
+	}
+	if err := service.DeleteBranch(ctx, repoRoot, "no-such-branch"); !os.IsNotExist(err) {
+		t.Errorf("DeleteBranch(no-such-branch): got %v, want os.ErrNotExist", err)
+	}
+	if _, err := service.ListBranches(ctx, "dmitri.shuralyov.com/no-such-repo"); !os.IsNotExist(err) {
+		t.Errorf("ListBranches(no-such-repo): got %v, want os.ErrNotExist", err)
+	}
+	err = service.DeleteBranch(ctx, repoRoot, "feature")
+	if err != nil {
+		t.Fatal("DeleteBranch(feature):", err)
+	}
+	err = service.DeleteTag(ctx, repoRoot, "v1.0.0")
+	if err != nil {
+		t.Fatal("DeleteTag(v1.0.0):", err)
+	}
+	branches, err = service.ListBranches(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("ListBranches:", err)
+	}
+	if len(branches) != 1 || branches[0].Name != "master" {
+		t.Errorf("ListBranches after delete: got %+v, want only master", branches)
+	}
+	tags, err = service.ListTags(ctx, repoRoot)
+	if err != nil {
+		t.Fatal("ListTags:", err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("ListTags after delete: got %+v, want none", tags)
+	}
+	wantEvents := []event.Event{
+		{Container: repoRoot, Payload: event.Delete{Type: "branch", Name: "feature"}},
+		{Container: repoRoot, Payload: event.Delete{Type: "tag", Name: "v1.0.0"}},
+	}
+	if got := events.listAndReset(); !reflect.DeepEqual(got, wantEvents) {
+		t.Errorf("events:\ngot  %+v\nwant %+v", got, wantEvents)
+	}
+}
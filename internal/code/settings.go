@@ -0,0 +1,319 @@
+package code
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/events/event"
+)
+
+const (
+	// descriptionConfigKey is the git config key where
+	// the description of a repository is recorded.
+	descriptionConfigKey = "home.description"
+
+	// archivedConfigKey is the git config key that marks
+	// a repository as archived. Archived repositories are read-only.
+	archivedConfigKey = "home.archived"
+
+	// renamedFromConfigKey is a multi-valued git config key where
+	// previous repo roots of a renamed repository are recorded.
+	// Requests for previous repo roots are redirected to the current one.
+	renamedFromConfigKey = "home.renamedfrom"
+)
+
+// RepoSettings are the editable settings of a repository.
+type RepoSettings struct {
+	Description string
+	Archived    bool // Archived repositories are read-only.
+}
+
+// GetRepoSettings returns the settings of the repository with the specified repo root.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) GetRepoSettings(ctx context.Context, repoRoot string) (RepoSettings, error) {
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return RepoSettings{}, err
+	}
+	description, _, err := getConfig(ctx, gitDir, descriptionConfigKey)
+	if err != nil {
+		return RepoSettings{}, err
+	}
+	archived, err := isArchived(ctx, gitDir)
+	if err != nil {
+		return RepoSettings{}, err
+	}
+	return RepoSettings{
+		Description: description,
+		Archived:    archived,
+	}, nil
+}
+
+// EditRepoSettings sets the settings of the repository with the specified repo root.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) EditRepoSettings(ctx context.Context, repoRoot string, settings RepoSettings) error {
+	currentUser, err := s.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	gitDir, err := s.gitDir(repoRoot)
+	if err != nil {
+		return err
+	}
+	err = setConfig(ctx, gitDir, descriptionConfigKey, settings.Description)
+	if err != nil {
+		return err
+	}
+	return setConfig(ctx, gitDir, archivedConfigKey, strconv.FormatBool(settings.Archived))
+}
+
+// RenameRepo renames the repository with the specified repo root to newRepoRoot.
+// Requests for the old repo root are redirected to the new one afterwards,
+// see LookUpRedirect.
+// newRepoRoot must not be nested in or contain another repository.
+// It returns os.ErrNotExist if there's no such repository,
+// and os.ErrExist if newRepoRoot already exists.
+func (s *Service) RenameRepo(ctx context.Context, repoRoot, newRepoRoot string) error {
+	currentUser, err := s.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	if newRepoRoot != path.Clean(newRepoRoot) {
+		return fmt.Errorf("repo spec %q is not in its canonical form %q", newRepoRoot, path.Clean(newRepoRoot))
+	}
+	if newRepoRoot == repoRoot || strings.HasPrefix(newRepoRoot, repoRoot+"/") || strings.HasPrefix(repoRoot, newRepoRoot+"/") {
+		return fmt.Errorf("can't rename repository %q to %q", repoRoot, newRepoRoot)
+	}
+
+	gitDir := filepath.Join(s.reposDir, filepath.FromSlash(repoRoot))
+	newGitDir := filepath.Join(s.reposDir, filepath.FromSlash(newRepoRoot))
+
+	// Walk the repository ahead of the rename, outside the lock.
+	// Its content doesn't depend on where it's stored.
+	s.mu.RLock()
+	d, ok := s.byImportPath[repoRoot]
+	s.mu.RUnlock()
+	if !ok || !d.IsRepoRoot() {
+		return os.ErrNotExist
+	}
+	newDirs, err := walkRepository(gitDir, newRepoRoot)
+	if err != nil {
+		return err
+	}
+
+	// Hold the lock for the duration of the move,
+	// so that indexes are updated atomically with it.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := s.byImportPath[repoRoot]; !ok || !d.IsRepoRoot() {
+		return os.ErrNotExist
+	}
+	for _, d := range s.dirs {
+		if !d.IsRepoRoot() || d.RepoRoot == repoRoot {
+			continue
+		}
+		if d.RepoRoot == newRepoRoot {
+			return os.ErrExist
+		} else if strings.HasPrefix(newRepoRoot, d.RepoRoot+"/") || strings.HasPrefix(d.RepoRoot, newRepoRoot+"/") {
+			return fmt.Errorf("can't rename repository %q to %q: it overlaps repository %q", repoRoot, newRepoRoot, d.RepoRoot)
+		}
+	}
+	if _, ok := s.byImportPath[newRepoRoot]; ok {
+		return os.ErrExist
+	} else if _, err := os.Stat(newGitDir); err == nil {
+		return os.ErrExist
+	}
+	err = os.MkdirAll(filepath.Dir(newGitDir), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(gitDir, newGitDir)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", newGitDir, "config", "--add", renamedFromConfigKey, repoRoot)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	oldDirs := replaceDirs(&s.dirs, repoRoot, nil)
+	replaceDirsMap(s.byImportPath, oldDirs, nil)
+	replaceDirs(&s.dirs, newRepoRoot, newDirs)
+	replaceDirsMap(s.byImportPath, nil, newDirs)
+	populateLicenseRoot(newDirs, s.byImportPath)
+	for from, to := range s.redirects {
+		if to == repoRoot {
+			s.redirects[from] = newRepoRoot
+		}
+	}
+	s.redirects[repoRoot] = newRepoRoot
+	delete(s.redirects, newRepoRoot)
+	s.owners[newRepoRoot] = s.owners[repoRoot]
+	delete(s.owners, repoRoot)
+	s.forgetModules(repoRoot)
+	return nil
+}
+
+// DeleteRepo deletes the repository with the specified repo root,
+// and logs a "deleted repository" event.
+// It returns os.ErrNotExist if there's no such repository.
+func (s *Service) DeleteRepo(ctx context.Context, repoRoot string) error {
+	currentUser, err := s.users.GetAuthenticated(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Authorization check.
+	if !currentUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	gitDir := filepath.Join(s.reposDir, filepath.FromSlash(repoRoot))
+
+	// Hold the lock for the duration of the removal,
+	// so that indexes are updated atomically with it.
+	s.mu.Lock()
+	if d, ok := s.byImportPath[repoRoot]; !ok || !d.IsRepoRoot() {
+		err = os.ErrNotExist
+	} else {
+		err = os.RemoveAll(gitDir)
+	}
+	if err == nil {
+		oldDirs := replaceDirs(&s.dirs, repoRoot, nil)
+		replaceDirsMap(s.byImportPath, oldDirs, nil)
+		for from, to := range s.redirects {
+			if to == repoRoot {
+				delete(s.redirects, from)
+			}
+		}
+		delete(s.owners, repoRoot)
+		s.forgetModules(repoRoot)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Log a "deleted repository" event.
+	err = s.events.Log(ctx, event.Event{
+		Time:      time.Now().UTC(),
+		Actor:     currentUser,
+		Container: repoRoot,
+		Payload: event.Delete{
+			Type: "repository",
+			Name: repoRoot,
+		},
+	})
+	return err
+}
+
+// LookUpRedirect looks up where importPath has moved to,
+// if it's within a repository that has been renamed.
+// It reports whether there is such a redirect.
+func (s *Service) LookUpRedirect(importPath string) (newImportPath string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for from, to := range s.redirects {
+		if importPath == from {
+			return to, true
+		} else if strings.HasPrefix(importPath, from+"/") {
+			return to + importPath[len(from):], true
+		}
+	}
+	return "", false
+}
+
+// readOnly reports whether the repository at gitDir is read-only,
+// and if so, why. Mirrors and archived repositories are read-only.
+func readOnly(ctx context.Context, gitDir string) (reason string, err error) {
+	upstream, err := mirrorUpstream(ctx, gitDir)
+	if err != nil {
+		return "", err
+	} else if upstream != "" {
+		return "repository is a read-only mirror of " + RedactURL(upstream), nil
+	}
+	archived, err := isArchived(ctx, gitDir)
+	if err != nil {
+		return "", err
+	} else if archived {
+		return "repository is archived", nil
+	}
+	return "", nil
+}
+
+// loadRedirects loads redirects of renamed repositories
+// among dirs in the repository store at reposDir.
+// The returned map is keyed by old repo root.
+func loadRedirects(reposDir string, dirs []*Directory) (map[string]string, error) {
+	redirects := make(map[string]string)
+	for _, d := range dirs {
+		if !d.IsRepoRoot() {
+			continue
+		}
+		cmd := exec.Command("git", "--git-dir", filepath.Join(reposDir, filepath.FromSlash(d.RepoRoot)), "config", "--get-all", renamedFromConfigKey)
+		out, err := cmd.Output()
+		if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+			// The key is not set.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%v: %v", cmd.Args, err)
+		}
+		for _, from := range strings.Fields(string(out)) {
+			redirects[from] = d.RepoRoot
+		}
+	}
+	return redirects, nil
+}
+
+func isArchived(ctx context.Context, gitDir string) (bool, error) {
+	v, ok, err := getConfig(ctx, gitDir, archivedConfigKey)
+	if err != nil || !ok {
+		return false, err
+	}
+	archived, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("bad %s value %q: %v", archivedConfigKey, v, err)
+	}
+	return archived, nil
+}
+
+// getConfig gets the value of git config key in gitDir,
+// and reports whether it's set.
+func getConfig(ctx context.Context, gitDir, key string) (string, bool, error) {
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "config", "--get", key)
+	out, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+		// The key is not set.
+		return "", false, nil
+	} else if err != nil {
+		return "", false, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), true, nil
+}
+
+// setConfig sets git config key in gitDir to value.
+func setConfig(ctx context.Context, gitDir, key, value string) error {
+	cmd := exec.CommandContext(ctx, "git", "--git-dir", gitDir, "config", key, value)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/users"
+)
+
+func TestRepoSettings(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "settings_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	reposDir := filepath.Join(tempDir, "repositories")
+	err = os.MkdirAll(reposDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &mockEvents{}
+	service, err := code.NewService(reposDir, mockNotification{}, events, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	ctx := context.Background()
+	const (
+		oldRoot = "dmitri.shuralyov.com/old"
+		newRoot = "dmitri.shuralyov.com/new/name"
+	)
+
+	err = service.CreateRepo(ctx, oldRoot, "Some repository.")
+	if err != nil {
+		t.Fatal("CreateRepo:", err)
+	}
+	settings, err := service.GetRepoSettings(ctx, oldRoot)
+	if err != nil {
+		t.Fatal("GetRepoSettings:", err)
+	}
+	if want := (code.RepoSettings{Description: "Some repository."}); settings != want {
+		t.Errorf("GetRepoSettings: got %+v, want %+v", settings, want)
+	}
+	err = service.EditRepoSettings(ctx, oldRoot, code.RepoSettings{Description: "Edited.", Archived: true})
+	if err != nil {
+		t.Fatal("EditRepoSettings:", err)
+	}
+
+	// Rename, and check settings and redirects carry over.
+	err = service.RenameRepo(ctx, oldRoot, newRoot)
+	if err != nil {
+		t.Fatal("RenameRepo:", err)
+	}
+	if _, err := service.GetDirectory(ctx, oldRoot); !os.IsNotExist(err) {
+		t.Errorf("GetDirectory(old): got %v, want os.ErrNotExist", err)
+	}
+	if _, err := service.GetDirectory(ctx, newRoot); err != nil {
+		t.Errorf("GetDirectory(new): %v", err)
+	}
+	settings, err = service.GetRepoSettings(ctx, newRoot)
+	if err != nil {
+		t.Fatal("GetRepoSettings:", err)
+	}
+	if want := (code.RepoSettings{Description: "Edited.", Archived: true}); settings != want {
+		t.Errorf("GetRepoSettings after rename: got %+v, want %+v", settings, want)
+	}
+	for _, tt := range []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{oldRoot, newRoot, true},
+		{oldRoot + "/sub", newRoot + "/sub", true},
+		{oldRoot + "er", "", false},
+		{newRoot, "", false},
+	} {
+		got, ok := service.LookUpRedirect(tt.in)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("LookUpRedirect(%q): got (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// Redirects are persisted across service restarts.
+	service, err = code.NewService(reposDir, mockNotification{}, events, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	if got, ok := service.LookUpRedirect(oldRoot); got != newRoot || !ok {
+		t.Errorf("LookUpRedirect after restart: got (%q, %v), want (%q, true)", got, ok, newRoot)
+	}
+	owner := users.UserSpec{ID: 1, Domain: "example.org"}
+	if got, err := service.ListOwnedRepos(ctx, owner); err != nil || !reflect.DeepEqual(got, []string{newRoot}) {
+		t.Errorf("ListOwnedRepos after restart: got (%q, %v), want ([%q], nil)", got, err, newRoot)
+	}
+
+	// Renames into, over, or around other repositories are rejected.
+	const otherRoot = "dmitri.shuralyov.com/other"
+	err = service.CreateRepo(ctx, otherRoot, "")
+	if err != nil {
+		t.Fatal("CreateRepo:", err)
+	}
+	if err := service.RenameRepo(ctx, newRoot, otherRoot); !os.IsExist(err) {
+		t.Errorf("RenameRepo to existing repository: got %v, want os.ErrExist", err)
+	}
+	for _, to := range []string{otherRoot + "/nested", "dmitri.shuralyov.com"} {
+		if err := service.RenameRepo(ctx, newRoot, to); err == nil {
+			t.Errorf("RenameRepo to %q: got nil error, want non-nil", to)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(reposDir, "dmitri.shuralyov.com", "other", "nested")); !os.IsNotExist(err) {
+		t.Errorf("directory inside other repository: got %v, want os.ErrNotExist", err)
+	}
+	if _, err := service.GetDirectory(ctx, newRoot); err != nil {
+		t.Errorf("GetDirectory after rejected renames: %v", err)
+	}
+
+	// Delete.
+	err = service.DeleteRepo(ctx, newRoot)
+	if err != nil {
+		t.Fatal("DeleteRepo:", err)
+	}
+	if _, err := service.GetDirectory(ctx, newRoot); !os.IsNotExist(err) {
+		t.Errorf("GetDirectory after delete: got %v, want os.ErrNotExist", err)
+	}
+	if _, ok := service.LookUpRedirect(oldRoot); ok {
+		t.Error("LookUpRedirect after delete: got ok, want no redirect")
+	}
+	if _, err := os.Stat(filepath.Join(reposDir, "dmitri.shuralyov.com", "new", "name")); !os.IsNotExist(err) {
+		t.Errorf("repository directory after delete: got %v, want os.ErrNotExist", err)
+	}
+	if got, err := service.ListOwnedRepos(ctx, owner); err != nil || !reflect.DeepEqual(got, []string{otherRoot}) {
+		t.Errorf("ListOwnedRepos after delete: got (%q, %v), want ([%q], nil)", got, err, otherRoot)
+	}
+	if err := service.DeleteRepo(ctx, newRoot); !os.IsNotExist(err) {
+		t.Errorf("DeleteRepo again: got %v, want os.ErrNotExist", err)
+	}
+
+	wantEvents := []event.Event{
+		{Container: oldRoot, Payload: event.Create{Type: "repository", Description: "Some repository."}},
+		{Container: otherRoot, Payload: event.Create{Type: "repository"}},
+		{Container: newRoot, Payload: event.Delete{Type: "repository", Name: newRoot}},
+	}
+	if got := events.listAndReset(); !reflect.DeepEqual(got, wantEvents) {
+		t.Errorf("events:\ngot  %+v\nwant %+v", got, wantEvents)
+	}
+}
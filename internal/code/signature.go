@@ -0,0 +1,398 @@
+package code
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SigningKey is a public key that a user signs git commits and tags with.
+type SigningKey struct {
+	Type        string // Key type. Either "gpg" or "ssh".
+	Key         string // ASCII-armored GPG public key, or SSH public key in authorized_keys format.
+	Fingerprint string // Fingerprint of GPG primary key in upper case hex, or SHA256 fingerprint of SSH key.
+}
+
+// ParseSigningKey parses an ASCII-armored GPG public key
+// or an SSH public key in authorized_keys format. The gpg and
+// ssh-keygen tools are used to validate it and compute its fingerprint.
+func ParseSigningKey(ctx context.Context, key string) (SigningKey, error) {
+	key = strings.TrimSpace(key)
+	switch {
+	case strings.HasPrefix(key, "-----BEGIN PGP PUBLIC KEY BLOCK-----"):
+		homeDir, err := ioutil.TempDir("", "gnupg_")
+		if err != nil {
+			return SigningKey{}, err
+		}
+		defer os.RemoveAll(homeDir)
+		cmd := exec.CommandContext(ctx, "gpg", "--homedir", homeDir, "--batch", "--with-colons",
+			"--import-options", "show-only", "--import")
+		cmd.Stdin = strings.NewReader(key + "\n")
+		out, err := cmd.Output()
+		if err != nil {
+			return SigningKey{}, fmt.Errorf("not a valid GPG public key")
+		}
+		// A "pub" record is followed by the "fpr" record of its fingerprint.
+		var fingerprints []string
+		lines := strings.Split(string(out), "\n")
+		for i := 0; i+1 < len(lines); i++ {
+			if f := strings.Split(lines[i+1], ":"); strings.HasPrefix(lines[i], "pub:") && f[0] == "fpr" && len(f) > 9 {
+				fingerprints = append(fingerprints, f[9])
+			}
+		}
+		if len(fingerprints) != 1 {
+			return SigningKey{}, fmt.Errorf("GPG public key block has %d keys, want exactly 1", len(fingerprints))
+		}
+		return SigningKey{Type: "gpg", Key: key + "\n", Fingerprint: fingerprints[0]}, nil
+	case !strings.Contains(key, "\n") && isSSHKeyType(key):
+		cmd := exec.CommandContext(ctx, "ssh-keygen", "-l", "-E", "sha256", "-f", "-")
+		cmd.Stdin = strings.NewReader(key + "\n")
+		out, err := cmd.Output()
+		f := strings.Fields(string(out))
+		if err != nil || len(f) < 2 || !strings.HasPrefix(f[1], "SHA256:") {
+			return SigningKey{}, fmt.Errorf("not a valid SSH public key")
+		}
+		return SigningKey{Type: "ssh", Key: key, Fingerprint: f[1]}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("signing key must be an ASCII-armored GPG public key or an SSH public key")
+	}
+}
+
+// isSSHKeyType reports whether key begins with an SSH public key type,
+// like "ssh-ed25519" or "ecdsa-sha2-nistp256", rather than key options.
+func isSSHKeyType(key string) bool {
+	return strings.HasPrefix(key, "ssh-") ||
+		strings.HasPrefix(key, "ecdsa-") ||
+		strings.HasPrefix(key, "sk-")
+}
+
+// SigningKeys maps verified email addresses to signing keys.
+type SigningKeys interface {
+	// SigningKeys returns signing keys of all users, keyed by
+	// each verified email address of their owner in lower case.
+	SigningKeys() map[string][]SigningKey
+}
+
+// Signature is the verification state of a git commit or tag signature.
+type Signature uint8
+
+const (
+	Unsigned   Signature = iota // Not signed.
+	Unverified                  // Signed, but the signature is bad or not made with a signing key of the committer or tagger.
+	Verified                    // Signed with a signing key of the user that owns the committer or tagger email.
+)
+
+// SignatureVerifier verifies signatures of git commits and tags
+// against signing keys that users uploaded to their profiles.
+//
+// Signing keys are prepared for git to use in a keys directory
+// inside dir. It's rebuilt when signing keys change.
+type SignatureVerifier struct {
+	dir  string
+	keys SigningKeys
+
+	mu      sync.Mutex
+	keysDir string // Current keys directory, or empty if it hasn't been built yet.
+}
+
+// NewSignatureVerifier creates a signature verifier that
+// verifies signatures against keys, keeping keys directories in dir.
+func NewSignatureVerifier(dir string, keys SigningKeys) *SignatureVerifier {
+	return &SignatureVerifier{dir: dir, keys: keys}
+}
+
+// KeysDir returns the keys directory with current signing keys,
+// building it first if signing keys changed since it was last built.
+// It can be given to VerifyCommitSignatures and VerifyTagSignature.
+func (v *SignatureVerifier) KeysDir() (string, error) {
+	keys := v.keys.SigningKeys()
+	var emails []string
+	for email := range keys {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	h := sha256.New()
+	for _, email := range emails {
+		for _, k := range keys[email] {
+			fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", email, k.Type, k.Fingerprint, k.Key)
+		}
+	}
+	name := hex.EncodeToString(h.Sum(nil))[:16]
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.keysDir != "" && filepath.Base(v.keysDir) == name {
+		return v.keysDir, nil
+	}
+	keysDir, err := filepath.Abs(filepath.Join(v.dir, name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(keysDir); os.IsNotExist(err) {
+		err := buildKeysDir(keysDir, emails, keys)
+		if err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	// Remove stale keys directories. The previous one is kept,
+	// so that verifications that may still be using it don't fail.
+	fis, err := ioutil.ReadDir(v.dir)
+	if err != nil {
+		return "", err
+	}
+	for _, fi := range fis {
+		if fi.Name() == name || (v.keysDir != "" && fi.Name() == filepath.Base(v.keysDir)) {
+			continue
+		}
+		err := os.RemoveAll(filepath.Join(v.dir, fi.Name()))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	v.keysDir = keysDir
+	return keysDir, nil
+}
+
+// buildKeysDir builds a keys directory at keysDir with keys. It contains:
+//
+//	keysDir
+//	├── gnupg           (GnuPG home directory with imported GPG keys)
+//	├── allowed_signers (SSH keys, for the gpg.ssh.allowedSignersFile git config)
+//	└── fingerprints    (lines of "<email> <fingerprint>" of all keys)
+func buildKeysDir(keysDir string, emails []string, keys map[string][]SigningKey) error {
+	tempDir := keysDir + ".tmp"
+	err := os.RemoveAll(tempDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Join(tempDir, "gnupg"), 0700)
+	if err != nil {
+		return err
+	}
+	var allowedSigners, fingerprints, gpgKeys bytes.Buffer
+	for _, email := range emails {
+		if strings.ContainsAny(email, ",*?!\" \t") {
+			// Can't be used as an allowed signers principal.
+			continue
+		}
+		for _, k := range keys[email] {
+			switch k.Type {
+			case "gpg":
+				gpgKeys.WriteString(k.Key)
+			case "ssh":
+				f := strings.Fields(k.Key)
+				if len(f) < 2 {
+					continue
+				}
+				fmt.Fprintf(&allowedSigners, "%s namespaces=\"git\" %s %s\n", email, f[0], f[1])
+			default:
+				continue
+			}
+			fmt.Fprintf(&fingerprints, "%s %s\n", email, k.Fingerprint)
+		}
+	}
+	if gpgKeys.Len() > 0 {
+		cmd := exec.Command("gpg", "--homedir", filepath.Join(tempDir, "gnupg"), "--batch", "--quiet", "--import")
+		cmd.Stdin = &gpgKeys
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v: %v: %s", cmd.Args, err, out)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(tempDir, "allowed_signers"), allowedSigners.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(tempDir, "fingerprints"), fingerprints.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempDir, keysDir)
+}
+
+// VerifyCommits verifies signatures of commits in the git repository
+// at gitDir. See VerifyCommitSignatures for details.
+// If v is nil, signature verification is disabled and it returns nil.
+func (v *SignatureVerifier) VerifyCommits(ctx context.Context, gitDir string, commits []string) (map[string]Signature, error) {
+	if v == nil {
+		return nil, nil
+	}
+	keysDir, err := v.KeysDir()
+	if err != nil {
+		return nil, err
+	}
+	return VerifyCommitSignatures(ctx, keysDir, gitDir, commits)
+}
+
+// VerifyTag verifies the signature of a tag in the git repository
+// at gitDir. See VerifyTagSignature for details.
+// If v is nil, signature verification is disabled and it returns Unsigned.
+func (v *SignatureVerifier) VerifyTag(ctx context.Context, gitDir, tag string) (Signature, error) {
+	if v == nil {
+		return Unsigned, nil
+	}
+	keysDir, err := v.KeysDir()
+	if err != nil {
+		return Unsigned, err
+	}
+	return VerifyTagSignature(ctx, keysDir, gitDir, tag)
+}
+
+// VerifyCommitSignatures verifies signatures of commits, specified by
+// their full hashes, in the git repository at gitDir, using signing keys
+// in keysDir. A signature is verified if it's good, and it's made with
+// a signing key of the user that owns the commit's committer email.
+func VerifyCommitSignatures(ctx context.Context, keysDir, gitDir string, commits []string) (map[string]Signature, error) {
+	if len(commits) == 0 {
+		return nil, nil
+	}
+	fingerprints, err := readFingerprints(keysDir)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "git", "-c", "gpg.ssh.allowedSignersFile="+filepath.Join(keysDir, "allowed_signers"),
+		"log", "--no-walk=unsorted", "--stdin", "-z",
+		"--format=tformat:%H%x00%ce%x00%G?%x00%GF%x00%GP")
+	cmd.Dir = gitDir
+	cmd.Env = append(os.Environ(), "GNUPGHOME="+filepath.Join(keysDir, "gnupg"))
+	cmd.Stdin = strings.NewReader(strings.Join(commits, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v: %s", cmd.Args, err, stderr.Bytes())
+	}
+	f := strings.Split(string(out), "\x00")
+	signatures := make(map[string]Signature, len(commits))
+	for ; len(f) >= 5; f = f[5:] {
+		// Fields match exactly what is specified in --format.
+		// The last one is terminated by a zero byte too.
+		var (
+			commitHash     = f[0]
+			committerEmail = strings.ToLower(f[1])
+			status         = f[2]
+			keyFingerprint = f[3]
+			primaryKey     = f[4]
+		)
+		switch status {
+		case "N":
+			signatures[commitHash] = Unsigned
+		case "G", "U": // Good signature, with GPG key of any trust level.
+			if fingerprints[committerEmail][keyFingerprint] || fingerprints[committerEmail][primaryKey] {
+				signatures[commitHash] = Verified
+			} else {
+				signatures[commitHash] = Unverified
+			}
+		default:
+			signatures[commitHash] = Unverified
+		}
+	}
+	return signatures, nil
+}
+
+// VerifyTagSignature verifies the signature of tag in the git repository
+// at gitDir, using signing keys in keysDir. A signature is verified if it's
+// good, and it's made with a signing key of the user that owns the tagger email.
+// Lightweight tags are reported as Unsigned.
+func VerifyTagSignature(ctx context.Context, keysDir, gitDir, tag string) (Signature, error) {
+	if strings.HasPrefix(tag, "-") {
+		// Not a valid tag name, and must not be interpreted as an option.
+		return Unsigned, os.ErrNotExist
+	}
+	cmd := exec.CommandContext(ctx, "git", "cat-file", "tag", "refs/tags/"+tag)
+	cmd.Dir = gitDir
+	obj, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 128 {
+		// Not an annotated tag.
+		return Unsigned, nil
+	} else if err != nil {
+		return Unsigned, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	var taggerEmail string
+	for _, line := range strings.Split(string(obj), "\n") {
+		if line == "" {
+			break // End of header.
+		}
+		if strings.HasPrefix(line, "tagger ") {
+			if i, j := strings.IndexByte(line, '<'), strings.IndexByte(line, '>'); i != -1 && i < j {
+				taggerEmail = strings.ToLower(line[i+1 : j])
+			}
+		}
+	}
+	if !bytes.Contains(obj, []byte("\n-----BEGIN PGP SIGNATURE-----\n")) &&
+		!bytes.Contains(obj, []byte("\n-----BEGIN SSH SIGNATURE-----\n")) {
+		return Unsigned, nil
+	}
+
+	fingerprints, err := readFingerprints(keysDir)
+	if err != nil {
+		return Unsigned, err
+	}
+	cmd = exec.CommandContext(ctx, "git", "-c", "gpg.ssh.allowedSignersFile="+filepath.Join(keysDir, "allowed_signers"),
+		"verify-tag", "--raw", "refs/tags/"+tag)
+	cmd.Dir = gitDir
+	cmd.Env = append(os.Environ(), "GNUPGHOME="+filepath.Join(keysDir, "gnupg"))
+	var out bytes.Buffer
+	cmd.Stderr = &out
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		// Bad signature, or one that can't be checked.
+		return Unverified, nil
+	} else if err != nil {
+		return Unsigned, fmt.Errorf("%v: %v", cmd.Args, err)
+	}
+	for _, line := range strings.Split(out.String(), "\n") {
+		var keys []string
+		switch f := strings.Fields(line); {
+		case len(f) >= 3 && f[0] == "[GNUPG:]" && f[1] == "VALIDSIG":
+			// GPG status line with the signing key
+			// and primary key fingerprints.
+			keys = []string{f[2], f[len(f)-1]}
+		case strings.HasPrefix(line, `Good "git" signature`) && len(f) >= 2 && f[len(f)-2] == "key":
+			// ssh-keygen output ending with the key fingerprint.
+			keys = []string{f[len(f)-1]}
+		}
+		for _, k := range keys {
+			if fingerprints[taggerEmail][k] {
+				return Verified, nil
+			}
+		}
+	}
+	return Unverified, nil
+}
+
+// readFingerprints reads the fingerprints file in keysDir.
+// The returned map is keyed by email, then by key fingerprint.
+func readFingerprints(keysDir string) (map[string]map[string]bool, error) {
+	f, err := os.Open(filepath.Join(keysDir, "fingerprints"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fingerprints := make(map[string]map[string]bool)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		email, fingerprint, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			continue
+		}
+		if fingerprints[email] == nil {
+			fingerprints[email] = make(map[string]bool)
+		}
+		fingerprints[email][fingerprint] = true
+	}
+	return fingerprints, s.Err()
+}
@@ -0,0 +1,179 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestSignatureVerifier(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "signature_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	gnupgHome := filepath.Join(tempDir, "gnupg")
+	err = os.Mkdir(gnupgHome, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Command("gpgconf", "--homedir", gnupgHome, "--kill", "gpg-agent").Run()
+
+	run := func(dir, name string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(name, args...)
+		cmd.Dir = dir
+		cmd.Env = append(gitEnv(time.Time{}), "GNUPGHOME="+gnupgHome)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v failed: %v", cmd.Args, err)
+		}
+		return string(out)
+	}
+
+	// Generate signing keys.
+	run(tempDir, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "gopher", "-f", "ssh_key")
+	run(tempDir, "ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "other", "-f", "other_ssh_key")
+	run(tempDir, "gpg", "--batch", "--passphrase", "", "--quick-gen-key", "Gopher <gopher@example.com>", "ed25519", "sign", "never")
+	sshKey, err := ioutil.ReadFile(filepath.Join(tempDir, "ssh_key.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gpgKey := run(tempDir, "gpg", "--armor", "--export", "gopher@example.com")
+
+	ctx := context.Background()
+	sshSigningKey, err := code.ParseSigningKey(ctx, string(sshKey))
+	if err != nil {
+		t.Fatal("ParseSigningKey(ssh):", err)
+	}
+	if !strings.HasPrefix(sshSigningKey.Fingerprint, "SHA256:") || sshSigningKey.Type != "ssh" {
+		t.Errorf("ParseSigningKey(ssh): got %+v, want SHA256 fingerprint of an ssh key", sshSigningKey)
+	}
+	gpgSigningKey, err := code.ParseSigningKey(ctx, gpgKey)
+	if err != nil {
+		t.Fatal("ParseSigningKey(gpg):", err)
+	}
+	if len(gpgSigningKey.Fingerprint) != 40 || gpgSigningKey.Type != "gpg" {
+		t.Errorf("ParseSigningKey(gpg): got %+v, want 40 hex digit fingerprint of a gpg key", gpgSigningKey)
+	}
+	for _, key := range []string{
+		"",
+		"not a key",
+		"ssh-ed25519 AAAAnotbase64",
+		`restrict ` + string(sshKey),
+		"-----BEGIN PGP PUBLIC KEY BLOCK-----\n\ngarbage\n-----END PGP PUBLIC KEY BLOCK-----\n",
+	} {
+		if _, err := code.ParseSigningKey(ctx, key); err == nil {
+			t.Errorf("ParseSigningKey(%q): got nil error, want non-nil", key)
+		}
+	}
+
+	// Make a repository with unsigned and signed commits and tags.
+	repoDir := filepath.Join(tempDir, "repo")
+	err = os.Mkdir(repoDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	git := func(args ...string) string {
+		t.Helper()
+		return strings.TrimSpace(run(repoDir, "git", args...))
+	}
+	sshSign := []string{"-c", "gpg.format=ssh", "-c", "user.signingKey=" + filepath.Join(tempDir, "ssh_key")}
+	otherSign := []string{"-c", "gpg.format=ssh", "-c", "user.signingKey=" + filepath.Join(tempDir, "other_ssh_key")}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "unsigned")
+	unsigned := git("rev-parse", "HEAD")
+	git(append(sshSign, "commit", "-q", "--allow-empty", "-S", "-m", "signed with ssh key")...)
+	sshSigned := git("rev-parse", "HEAD")
+	git("commit", "-q", "--allow-empty", "-S", "-m", "signed with gpg key")
+	gpgSigned := git("rev-parse", "HEAD")
+	git(append(otherSign, "commit", "-q", "--allow-empty", "-S", "-m", "signed with someone else's key")...)
+	otherSigned := git("rev-parse", "HEAD")
+	git("tag", "lightweight")
+	git("tag", "-a", "-m", "annotated", "annotated")
+	git(append(sshSign, "tag", "-s", "-m", "signed", "ssh-signed")...)
+	git("tag", "-s", "-m", "signed", "gpg-signed")
+	git(append(otherSign, "tag", "-s", "-m", "signed", "other-signed")...)
+
+	keys := mockSigningKeys{}
+	verifier := code.NewSignatureVerifier(filepath.Join(tempDir, "keys"), keys)
+	commits := []string{unsigned, sshSigned, gpgSigned, otherSigned}
+
+	// Without signing keys, signed commits are unverified.
+	got, err := verifier.VerifyCommits(ctx, repoDir, commits)
+	if err != nil {
+		t.Fatal("VerifyCommits:", err)
+	}
+	want := map[string]code.Signature{
+		unsigned:    code.Unsigned,
+		sshSigned:   code.Unverified,
+		gpgSigned:   code.Unverified,
+		otherSigned: code.Unverified,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyCommits without keys:\ngot  %v\nwant %v", got, want)
+	}
+
+	// Add signing keys of the committer, and verify again.
+	keys["gopher@example.com"] = []code.SigningKey{sshSigningKey, gpgSigningKey}
+	got, err = verifier.VerifyCommits(ctx, repoDir, commits)
+	if err != nil {
+		t.Fatal("VerifyCommits:", err)
+	}
+	want[sshSigned] = code.Verified
+	want[gpgSigned] = code.Verified
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyCommits with keys:\ngot  %v\nwant %v", got, want)
+	}
+	for _, tt := range []struct {
+		tag  string
+		want code.Signature
+	}{
+		{"lightweight", code.Unsigned},
+		{"annotated", code.Unsigned},
+		{"ssh-signed", code.Verified},
+		{"gpg-signed", code.Verified},
+		{"other-signed", code.Unverified},
+	} {
+		got, err := verifier.VerifyTag(ctx, repoDir, tt.tag)
+		if err != nil {
+			t.Fatalf("VerifyTag(%q): %v", tt.tag, err)
+		}
+		if got != tt.want {
+			t.Errorf("VerifyTag(%q): got %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+
+	// Keys that belong to another user's email don't verify signatures.
+	keys["someone@example.com"] = keys["gopher@example.com"]
+	delete(keys, "gopher@example.com")
+	got, err = verifier.VerifyCommits(ctx, repoDir, commits)
+	if err != nil {
+		t.Fatal("VerifyCommits:", err)
+	}
+	want[sshSigned] = code.Unverified
+	want[gpgSigned] = code.Unverified
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyCommits with keys of another user:\ngot  %v\nwant %v", got, want)
+	}
+
+	// Stale keys directories are removed, apart from the previous one.
+	if fis, err := ioutil.ReadDir(filepath.Join(tempDir, "keys")); err != nil {
+		t.Fatal(err)
+	} else if len(fis) != 2 {
+		t.Errorf("got %d keys directories, want 2", len(fis))
+	}
+}
+
+// mockSigningKeys implements code.SigningKeys.
+type mockSigningKeys map[string][]code.SigningKey
+
+func (m mockSigningKeys) SigningKeys() map[string][]code.SigningKey { return m }
@@ -0,0 +1,349 @@
+package code
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/shurcooL/home/internal/mod"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/sumdb/note"
+	"golang.org/x/mod/sumdb/tlog"
+)
+
+// SumDB is a checksum database for locally hosted modules.
+// It keeps a transparent log of go.sum lines, and implements the
+// operations needed by "golang.org/x/mod/sumdb".Server to serve it
+// using the checksum database protocol, as specified at
+// https://go.googlesource.com/proposal/+/master/design/25530-sumdb.md.
+//
+// A module version is added to the log the first time it's looked up.
+// Once added, its checksums never change. If a module version is later
+// served with different content, clients of the checksum database
+// will detect the mismatch.
+type SumDB struct {
+	dir     string // Directory where the log and signing key are stored.
+	modules ModuleHandler
+	signer  note.Signer
+
+	// VerifierKey is the verifier key of the checksum database.
+	// Clients use it in their GOSUMDB environment variable.
+	VerifierKey string
+
+	mu      sync.Mutex
+	records [][]byte                 // Record texts, indexed by record ID.
+	hashes  []tlog.Hash              // Stored hashes of the log.
+	index   map[module.Version]int64 // Module version → record ID.
+	signed  []byte                   // Signed tree head, or nil if it needs to be recomputed.
+}
+
+// logRecord is the on-disk representation of a log record.
+type logRecord struct {
+	Path    string // Module path.
+	Version string // Module version.
+	Text    string // Record text, containing go.sum lines for module version.
+}
+
+// NewSumDB returns a checksum database with the given name for modules
+// served by modules. The log and signing key are stored in dir.
+// If dir doesn't have a signing key, a new one is generated.
+//
+// Only locally hosted modules, those in modules.Code, are added to the log.
+// modules.Cache is not used, since what an upstream module proxy serves
+// can't be vouched for.
+func NewSumDB(dir, name string, modules ModuleHandler) (*SumDB, error) {
+	modules.Cache = nil
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load or generate the signing key.
+	skey, err := ioutil.ReadFile(filepath.Join(dir, "key"))
+	if os.IsNotExist(err) {
+		s, _, err := note.GenerateKey(rand.Reader, name)
+		if err != nil {
+			return nil, err
+		}
+		skey = []byte(s)
+		err = ioutil.WriteFile(filepath.Join(dir, "key"), skey, 0600)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	signer, err := note.NewSigner(string(skey))
+	if err != nil {
+		return nil, fmt.Errorf("note.NewSigner: %v", err)
+	}
+	vkey, err := verifierKey(string(skey))
+	if err != nil {
+		return nil, err
+	}
+
+	db := &SumDB{
+		dir:         dir,
+		modules:     modules,
+		signer:      signer,
+		VerifierKey: vkey,
+		index:       make(map[module.Version]int64),
+	}
+
+	// Load the log, and recompute its hashes.
+	// Each record is a JSON object on its own line. A final line that
+	// isn't terminated by a newline is a record whose write didn't
+	// complete, so it's treated as not written and truncated away.
+	path := filepath.Join(dir, "records")
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var off int // Offset of the end of the last complete record.
+	for {
+		i := bytes.IndexByte(b[off:], '\n')
+		if i == -1 {
+			break
+		}
+		var r logRecord
+		err := json.Unmarshal(b[off:off+i], &r)
+		if err != nil {
+			return nil, fmt.Errorf("decoding record %d: %v", len(db.records), err)
+		}
+		err = db.add(module.Version{Path: r.Path, Version: r.Version}, []byte(r.Text))
+		if err != nil {
+			return nil, err
+		}
+		off += i + 1
+	}
+	if off < len(b) {
+		log.Printf("code.NewSumDB: truncating incomplete record %d (%d bytes) from %s\n", len(db.records), len(b)-off, path)
+		err := os.Truncate(path, int64(off))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// verifierKey returns the verifier key corresponding to signer key skey.
+// The format of skey is "PRIVATE+KEY+<name>+<hash>+<keydata>",
+// where keydata is the base64 encoding of the algorithm byte
+// followed by the Ed25519 seed.
+func verifierKey(skey string) (string, error) {
+	f := strings.SplitN(skey, "+", 5)
+	if len(f) != 5 || f[0] != "PRIVATE" || f[1] != "KEY" {
+		return "", fmt.Errorf("malformed signer key")
+	}
+	key, err := base64.StdEncoding.DecodeString(f[4])
+	if err != nil || len(key) != 1+ed25519.SeedSize || key[0] != 1 {
+		return "", fmt.Errorf("malformed signer key")
+	}
+	pub := ed25519.NewKeyFromSeed(key[1:]).Public().(ed25519.PublicKey)
+	return note.NewEd25519VerifierKey(f[2], pub)
+}
+
+// add adds a record with text for module version m to the log in memory.
+// db.mu must be held, or db must not be shared yet.
+func (db *SumDB) add(m module.Version, text []byte) error {
+	id := int64(len(db.records))
+	hashes, err := tlog.StoredHashes(id, text, db.hashReader())
+	if err != nil {
+		return err
+	}
+	db.records = append(db.records, text)
+	db.hashes = append(db.hashes, hashes...)
+	db.index[m] = id
+	db.signed = nil
+	return nil
+}
+
+// hashReader returns a tlog.HashReader for the log in memory.
+// db.mu must be held while it's used.
+func (db *SumDB) hashReader() tlog.HashReader {
+	return tlog.HashReaderFunc(func(indexes []int64) ([]tlog.Hash, error) {
+		hashes := make([]tlog.Hash, len(indexes))
+		for i, index := range indexes {
+			if index < 0 || index >= int64(len(db.hashes)) {
+				return nil, os.ErrNotExist
+			}
+			hashes[i] = db.hashes[index]
+		}
+		return hashes, nil
+	})
+}
+
+// Signed returns the signed hash of the latest tree.
+func (db *SumDB) Signed(context.Context) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.signed != nil {
+		return db.signed, nil
+	}
+	n := int64(len(db.records))
+	h, err := tlog.TreeHash(n, db.hashReader())
+	if err != nil {
+		return nil, err
+	}
+	signed, err := note.Sign(&note.Note{Text: string(tlog.FormatTree(tlog.Tree{N: n, Hash: h}))}, db.signer)
+	if err != nil {
+		return nil, err
+	}
+	db.signed = signed
+	return signed, nil
+}
+
+// ReadRecords returns the content for the n records id through id+n-1.
+func (db *SumDB) ReadRecords(_ context.Context, id, n int64) ([][]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if id < 0 || n < 0 || id+n > int64(len(db.records)) {
+		return nil, os.ErrNotExist
+	}
+	return db.records[id : id+n], nil
+}
+
+// Lookup looks up a record for the given module, returning the record ID.
+// If the module version isn't in the log yet, but it's served by the
+// module handler, its checksums are computed and added to the log.
+func (db *SumDB) Lookup(ctx context.Context, m module.Version) (int64, error) {
+	db.mu.Lock()
+	id, ok := db.index[m]
+	db.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	text, err := db.goSumLines(ctx, m)
+	if err != nil {
+		return 0, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if id, ok := db.index[m]; ok {
+		// Added concurrently.
+		return id, nil
+	}
+	b, err := json.Marshal(logRecord{Path: m.Path, Version: m.Version, Text: string(text)})
+	if err != nil {
+		return 0, err
+	}
+	err = db.appendRecord(append(b, '\n'))
+	if err != nil {
+		return 0, err
+	}
+	id = int64(len(db.records))
+	err = db.add(m, text)
+	return id, err
+}
+
+// appendRecord appends line to the records file, and syncs it to disk,
+// so that a record is durable before it becomes part of a signed tree.
+// If the write fails, the file is truncated back to its previous size.
+// db.mu must be held.
+func (db *SumDB) appendRecord(line []byte) error {
+	f, err := os.OpenFile(filepath.Join(db.dir, "records"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	_, err = f.Write(line)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Truncate(fi.Size())
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadTileData reads the content of tile t.
+// It is only invoked for hash tiles (t.L ≥ 0).
+func (db *SumDB) ReadTileData(_ context.Context, t tlog.Tile) ([]byte, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return tlog.ReadTileData(t, db.hashReader())
+}
+
+// goSumLines returns the go.sum lines for module version m,
+// computed from the .zip and .mod files served by the module handler.
+// It returns an error satisfying os.IsNotExist if m isn't served.
+func (db *SumDB) goSumLines(ctx context.Context, m module.Version) ([]byte, error) {
+	zip, err := db.modules.fetch(ctx, moduleProxyRequest{Module: m.Path, Type: "zip", Version: m.Version})
+	if err != nil {
+		return nil, err
+	}
+	zipHash, err := mod.HashZip(zip, dirhash.DefaultHash)
+	if err != nil {
+		return nil, err
+	}
+	goMod, err := db.modules.fetch(ctx, moduleProxyRequest{Module: m.Path, Type: "mod", Version: m.Version})
+	if err != nil {
+		return nil, err
+	}
+	modHash, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(goMod)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%s %s %s\n%s %s/go.mod %s\n", m.Path, m.Version, zipHash, m.Path, m.Version, modHash)), nil
+}
+
+// fetch returns the content of module proxy request r, where r is unescaped,
+// as it would be served by h. It returns an error satisfying os.IsNotExist
+// if h doesn't serve r.
+func (h ModuleHandler) fetch(ctx context.Context, r moduleProxyRequest) ([]byte, error) {
+	esc, ok := r.Escape()
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	req, err := http.NewRequest(http.MethodGet, esc.URL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var w bufferResponseWriter
+	err = h.ServeModule(&w, req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return w.body.Bytes(), nil
+}
+
+// bufferResponseWriter is an http.ResponseWriter that writes to a buffer.
+type bufferResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *bufferResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+func (w *bufferResponseWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *bufferResponseWriter) WriteHeader(int)             {}
@@ -0,0 +1,186 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shurcooL/home/internal/code"
+	"golang.org/x/mod/sumdb"
+)
+
+func TestSumDB(t *testing.T) {
+	notification := mockNotification{}
+	events := &mockEvents{}
+	users := mockUsers{}
+	service, err := code.NewService(filepath.Join("testdata", "repositories"), notification, events, users)
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	dir, err := ioutil.TempDir("", "sumdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := code.NewSumDB(dir, "sum.example.com", code.ModuleHandler{Code: service})
+	if err != nil {
+		t.Fatal("code.NewSumDB:", err)
+	}
+	srv := sumdb.NewServer(db)
+	mux := http.NewServeMux()
+	for _, path := range sumdb.ServerPaths {
+		mux.Handle(path, srv)
+	}
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Use the sumdb client, which verifies the signed tree head
+	// and the inclusion proof of each record it looks up.
+	client := sumdb.NewClient(&clientOps{url: ts.URL, key: db.VerifierKey, t: t})
+	for _, tc := range []struct {
+		version string
+		want    string
+	}{
+		{"v0.0.0-20170912031248-a1d95f8919b5", "dmitri.shuralyov.com/kebabcase v0.0.0-20170912031248-a1d95f8919b5 h1:xUU8cZj0tfJxDjfyJ6xLLh6G615T10e16A1mxCoygiI="},
+		{"v0.0.0-20170912031248-a1d95f8919b5/go.mod", "dmitri.shuralyov.com/kebabcase v0.0.0-20170912031248-a1d95f8919b5/go.mod h1:zlZLgG71KSMQ+9XWuKJgSRws1h0iMspYv2y69MUzNFo="},
+	} {
+		lines, err := client.Lookup("dmitri.shuralyov.com/kebabcase", tc.version)
+		if err != nil {
+			t.Fatal("client.Lookup:", err)
+		}
+		if got := strings.Join(lines, "\n"); got != tc.want {
+			t.Errorf("client.Lookup(%q):\ngot:  %s\nwant: %s", tc.version, got, tc.want)
+		}
+	}
+
+	// Module versions that aren't served are not found.
+	resp, err := http.Get(ts.URL + "/lookup/dmitri.shuralyov.com/kebabcase@v0.0.0-20170912031248-000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusNotFound; got != want {
+		t.Errorf("lookup of unknown version: got status code %d, want %d", got, want)
+	}
+
+	// The log and signing key persist across restarts.
+	db2, err := code.NewSumDB(dir, "sum.example.com", code.ModuleHandler{Code: service})
+	if err != nil {
+		t.Fatal("code.NewSumDB:", err)
+	}
+	if db2.VerifierKey != db.VerifierKey {
+		t.Errorf("verifier key changed after restart: got %q, want %q", db2.VerifierKey, db.VerifierKey)
+	}
+	signed1, err := db.Signed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed2, err := db2.Signed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signed1) != string(signed2) {
+		t.Errorf("signed tree head changed after restart:\ngot:\n%s\nwant:\n%s", signed2, signed1)
+	}
+
+	// A record whose write didn't complete is truncated away on restart.
+	records := filepath.Join(dir, "records")
+	complete, err := ioutil.ReadFile(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(records, append(complete, `{"Path":"dmitri.shuralyov.com/kebabcase","Vers`...), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db3, err := code.NewSumDB(dir, "sum.example.com", code.ModuleHandler{Code: service})
+	if err != nil {
+		t.Fatal("code.NewSumDB with an incomplete record:", err)
+	}
+	signed3, err := db3.Signed(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(signed3) != string(signed1) {
+		t.Errorf("signed tree head changed after restart with an incomplete record:\ngot:\n%s\nwant:\n%s", signed3, signed1)
+	}
+	if b, err := ioutil.ReadFile(records); err != nil {
+		t.Fatal(err)
+	} else if string(b) != string(complete) {
+		t.Errorf("records file was not truncated to its complete records:\ngot:  %q\nwant: %q", b, complete)
+	}
+}
+
+// clientOps implements sumdb.ClientOps for a checksum database at url,
+// keeping configuration and cache in memory.
+type clientOps struct {
+	url string
+	key string
+	t   *testing.T
+
+	mu     sync.Mutex
+	config map[string][]byte
+	cache  map[string][]byte
+}
+
+func (c *clientOps) ReadRemote(path string) ([]byte, error) {
+	resp, err := http.Get(c.url + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *clientOps) ReadConfig(file string) ([]byte, error) {
+	if file == "key" {
+		return []byte(c.key), nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config[file], nil
+}
+
+func (c *clientOps) WriteConfig(file string, old, new []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if string(c.config[file]) != string(old) {
+		return sumdb.ErrWriteConflict
+	}
+	if c.config == nil {
+		c.config = make(map[string][]byte)
+	}
+	c.config[file] = new
+	return nil
+}
+
+func (c *clientOps) ReadCache(file string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.cache[file]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+func (c *clientOps) WriteCache(file string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[string][]byte)
+	}
+	c.cache[file] = data
+}
+
+func (c *clientOps) Log(msg string)           { c.t.Log(msg) }
+func (c *clientOps) SecurityError(msg string) { c.t.Error(msg) }
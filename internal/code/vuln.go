@@ -0,0 +1,500 @@
+package code
+
+import (
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/go-vcs/vcs/git"
+)
+
+// VulnScanner checks modules in the repository store for dependencies
+// with known vulnerabilities. It uses a vulnerability database in OSV format
+// (https://ossf.github.io/osv-schema/) in a local directory, which is
+// expected to be synced separately.
+//
+// Repositories are scanned periodically, and after code in them is
+// rediscovered, such as after a push.
+type VulnScanner struct {
+	// Code is the underlying source of Go code.
+	Code *Service
+
+	// DBDir is the directory of the vulnerability database.
+	// Each .json file in it, at any depth, is an OSV entry.
+	DBDir string
+
+	// FileIssue, if not nil, is called for each finding in a repository
+	// after each scan, so that it may be filed as an issue. It's
+	// responsible for not filing the same finding more than once.
+	FileIssue func(ctx context.Context, repoRoot string, f Finding) error
+
+	mu       sync.Mutex
+	findings map[string][]Finding // Key is repo root.
+	queue    map[string]bool      // Set of repo roots to scan.
+	wake     chan struct{}
+}
+
+// Finding is a known vulnerability in a dependency of a module.
+type Finding struct {
+	ID       string   // ID of the OSV entry. E.g., "GO-2021-0113".
+	Aliases  []string // Other IDs of the vulnerability. E.g., "CVE-2021-38561".
+	Summary  string
+	Module   string // Path of the vulnerable module.
+	Version  string // Required version of the vulnerable module.
+	Fixed    string // Version in which the vulnerability is fixed, or empty string if none is known.
+	Requirer string // Path of the module in the repository store that requires the vulnerable module.
+
+	// Packages are import paths of packages of the requiring module
+	// that use vulnerable packages. If the database doesn't specify
+	// which packages are vulnerable, or no package was found to use
+	// them, it's empty, and the whole requiring module is considered
+	// affected.
+	Packages []string
+
+	// Unconfirmed reports that the database specifies vulnerable
+	// packages, but no package of the requiring module was found
+	// to use them directly. They may still be used through other
+	// dependencies, which aren't analyzed.
+	Unconfirmed bool
+}
+
+// Findings returns the findings of the last scan
+// of the repository with the specified root.
+// It's safe to call on a nil VulnScanner.
+func (v *VulnScanner) Findings(repoRoot string) []Finding {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.findings[repoRoot]
+}
+
+// Run scans all repositories every interval, and repositories whose code
+// is rediscovered as soon as possible, until ctx is canceled.
+func (v *VulnScanner) Run(ctx context.Context, interval time.Duration) {
+	v.mu.Lock()
+	v.queue = make(map[string]bool)
+	v.wake = make(chan struct{}, 1)
+	v.mu.Unlock()
+	v.Code.OnRediscover(func(repoRoot string) {
+		v.mu.Lock()
+		v.queue[repoRoot] = true
+		v.mu.Unlock()
+		select {
+		case v.wake <- struct{}{}:
+		default:
+		}
+	})
+
+	v.scanAll(ctx)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			v.scanAll(ctx)
+		case <-v.wake:
+			v.mu.Lock()
+			queue := v.queue
+			v.queue = make(map[string]bool)
+			v.mu.Unlock()
+			db, err := loadVulnDB(v.DBDir)
+			if err != nil {
+				log.Println("VulnScanner: loadVulnDB:", err)
+				continue
+			}
+			for repoRoot := range queue {
+				v.scanAndReport(ctx, db, repoRoot)
+			}
+		}
+	}
+}
+
+func (v *VulnScanner) scanAll(ctx context.Context) {
+	db, err := loadVulnDB(v.DBDir)
+	if err != nil {
+		log.Println("VulnScanner: loadVulnDB:", err)
+		return
+	}
+	dirs, err := v.Code.ListDirectories(ctx)
+	if err != nil {
+		log.Println("VulnScanner: ListDirectories:", err)
+		return
+	}
+	for _, d := range dirs {
+		if !d.IsRepoRoot() {
+			continue
+		}
+		v.scanAndReport(ctx, db, d.RepoRoot)
+	}
+}
+
+func (v *VulnScanner) scanAndReport(ctx context.Context, db vulnDB, repoRoot string) {
+	findings, err := v.scan(ctx, db, repoRoot)
+	if os.IsNotExist(err) {
+		// The repository was deleted.
+		return
+	} else if err != nil {
+		log.Printf("VulnScanner: Scan(%q): %v\n", repoRoot, err)
+		return
+	}
+	if v.FileIssue == nil {
+		return
+	}
+	for _, f := range findings {
+		err := v.FileIssue(ctx, repoRoot, f)
+		if err != nil {
+			log.Printf("VulnScanner: FileIssue(%q, %q): %v\n", repoRoot, f.ID, err)
+		}
+	}
+}
+
+// Scan checks modules of the repository with the specified root for
+// dependencies with known vulnerabilities, and records the findings.
+//
+// A vulnerable dependency is reported if the required version is affected.
+// When the database specifies the vulnerable packages and symbols, packages
+// of the requiring module that import a vulnerable package and use one of its
+// vulnerable symbols are reported. If there aren't any, the finding is marked
+// as unconfirmed, since vulnerable packages may be used through other dependencies.
+func (v *VulnScanner) Scan(ctx context.Context, repoRoot string) ([]Finding, error) {
+	db, err := loadVulnDB(v.DBDir)
+	if err != nil {
+		return nil, err
+	}
+	return v.scan(ctx, db, repoRoot)
+}
+
+// scan is like Scan, but uses the already loaded vulnerability database db,
+// so that it's loaded once per scan of all repositories.
+func (v *VulnScanner) scan(ctx context.Context, db vulnDB, repoRoot string) ([]Finding, error) {
+	graph, err := v.Code.ModuleGraph(ctx, repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := v.Code.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var repoDirs []*Directory // Directories with packages in this repository.
+	for _, d := range dirs {
+		if d.RepoRoot == repoRoot && d.Package != nil {
+			repoDirs = append(repoDirs, d)
+		}
+	}
+	sf := symbolFinder{gitDir: filepath.Join(v.Code.reposDir, filepath.FromSlash(repoRoot))}
+	defer sf.close()
+
+	var findings []Finding
+	for _, m := range graph {
+		if m.Path != repoRoot && !strings.HasPrefix(m.Path, repoRoot+"/") {
+			// A dependency in another repository, scanned separately.
+			continue
+		}
+		for _, r := range m.Requires {
+			for _, e := range db[r.Path] {
+				for _, a := range e.Affected {
+					if a.Package.Name != r.Path || !a.affects(r.Version) {
+						continue
+					}
+					f := Finding{
+						ID:       e.ID,
+						Aliases:  e.Aliases,
+						Summary:  e.Summary,
+						Module:   r.Path,
+						Version:  r.Version,
+						Fixed:    a.fixed(),
+						Requirer: m.Path,
+					}
+					if imports := a.EcosystemSpecific.Imports; len(imports) > 0 {
+						for _, d := range repoDirs {
+							if d.Module() != m.Path {
+								continue
+							}
+							used, err := sf.usesAny(d, imports)
+							if err != nil {
+								return nil, err
+							}
+							if used {
+								f.Packages = append(f.Packages, d.ImportPath)
+							}
+						}
+						if len(f.Packages) == 0 {
+							// Vulnerable code isn't used directly, but it may
+							// be used through another dependency.
+							f.Unconfirmed = true
+						}
+					}
+					findings = append(findings, f)
+				}
+			}
+		}
+	}
+
+	v.mu.Lock()
+	if v.findings == nil {
+		v.findings = make(map[string][]Finding)
+	}
+	v.findings[repoRoot] = findings
+	v.mu.Unlock()
+	return findings, nil
+}
+
+// osvEntry is an entry in an OSV-format vulnerability database.
+// Only the fields used by VulnScanner are included.
+type osvEntry struct {
+	ID       string
+	Aliases  []string
+	Summary  string
+	Affected []osvAffected
+}
+
+type osvAffected struct {
+	Package struct {
+		Name      string
+		Ecosystem string
+	}
+	Ranges []struct {
+		Type   string
+		Events []struct {
+			Introduced string
+			Fixed      string
+		}
+	}
+	EcosystemSpecific struct {
+		Imports []osvImport
+	} `json:"ecosystem_specific"`
+}
+
+type osvImport struct {
+	Path    string
+	Symbols []string // Vulnerable functions, and methods like "T.M". Empty means all.
+}
+
+// affects reports whether module version v is within an affected range.
+// Versions in the database are semantic versions without the "v" prefix.
+func (a osvAffected) affects(v string) bool {
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		// Events are ordered by version, so the last
+		// event that v is at or after determines if it's affected.
+		affected := false
+		for _, e := range r.Events {
+			switch {
+			case e.Introduced != "" && (e.Introduced == "0" || semver.Compare(v, "v"+e.Introduced) >= 0):
+				affected = true
+			case e.Fixed != "" && semver.Compare(v, "v"+e.Fixed) >= 0:
+				affected = false
+			}
+		}
+		if affected {
+			return true
+		}
+	}
+	return false
+}
+
+// fixed returns the highest version in which the vulnerability
+// is fixed, or empty string if none is known.
+func (a osvAffected) fixed() string {
+	var fixed string
+	for _, r := range a.Ranges {
+		for _, e := range r.Events {
+			if e.Fixed != "" && semver.Compare("v"+e.Fixed, fixed) > 0 {
+				fixed = "v" + e.Fixed
+			}
+		}
+	}
+	return fixed
+}
+
+// vulnDB is a vulnerability database.
+// It maps module paths to OSV entries that affect them.
+type vulnDB map[string][]osvEntry
+
+// loadVulnDB loads the OSV entries of Go modules in dir.
+// A missing dir is an empty database.
+func loadVulnDB(dir string) (vulnDB, error) {
+	db := make(vulnDB)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && p == dir {
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if fi.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var e osvEntry
+		if err := json.Unmarshal(b, &e); err != nil || e.ID == "" {
+			// Not an OSV entry, such as an index file.
+			return nil
+		}
+		seen := make(map[string]bool)
+		for _, a := range e.Affected {
+			if a.Package.Ecosystem != "Go" || seen[a.Package.Name] {
+				continue
+			}
+			seen[a.Package.Name] = true
+			db[a.Package.Name] = append(db[a.Package.Name], e)
+		}
+		return nil
+	})
+	for _, es := range db {
+		sort.Slice(es, func(i, j int) bool { return es[i].ID < es[j].ID })
+	}
+	return db, err
+}
+
+// symbolFinder finds uses of symbols of imported packages
+// by packages in a git repository on master branch.
+type symbolFinder struct {
+	gitDir string
+
+	repo *git.Repository
+	fs   vfs.FileSystem
+}
+
+// usesAny reports whether the package in directory d
+// uses any of the symbols in imports.
+//
+// Method symbols like "T.M" are considered used if a method or field
+// named M is selected anywhere in the package, since the types of
+// receivers aren't resolved.
+func (sf *symbolFinder) usesAny(d *Directory, imports []osvImport) (bool, error) {
+	var relevant []osvImport
+	for _, imp := range imports {
+		if containsString(d.Package.Imports, imp.Path) {
+			relevant = append(relevant, imp)
+		}
+	}
+	if len(relevant) == 0 {
+		return false, nil
+	}
+	for _, imp := range relevant {
+		if len(imp.Symbols) == 0 {
+			return true, nil
+		}
+	}
+
+	if sf.fs == nil {
+		repo, err := git.Open(sf.gitDir)
+		if err != nil {
+			return false, err
+		}
+		sf.repo = repo
+		master, err := repo.ResolveBranch("master")
+		if err != nil {
+			return false, err
+		}
+		sf.fs, err = repo.FileSystem(master)
+		if err != nil {
+			return false, err
+		}
+	}
+	dir := path.Join("/", d.ImportPath[len(d.RepoRoot):])
+	fis, err := sf.fs.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	fset := token.NewFileSet()
+	for _, fi := range fis {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".go") || strings.HasSuffix(fi.Name(), "_test.go") {
+			continue
+		}
+		src, err := vfs.ReadFile(sf.fs, path.Join(dir, fi.Name()))
+		if err != nil {
+			return false, err
+		}
+		f, err := parser.ParseFile(fset, fi.Name(), src, 0)
+		if err != nil {
+			// Can't tell, so assume it's used.
+			return true, nil
+		}
+		for _, imp := range relevant {
+			if usesSymbols(f, imp) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (sf *symbolFinder) close() {
+	if sf.repo == nil {
+		return
+	}
+	if err := sf.repo.Close(); err != nil {
+		log.Println("symbolFinder: repo.Close:", err)
+	}
+}
+
+// usesSymbols reports whether file f uses any of the symbols of imp.
+func usesSymbols(f *ast.File, imp osvImport) bool {
+	var name string // Name of the imported package in f.
+	for _, is := range f.Imports {
+		if p, err := strconv.Unquote(is.Path.Value); err != nil || p != imp.Path {
+			continue
+		}
+		if is.Name != nil {
+			name = is.Name.Name
+		} else {
+			name = guessPackageName(imp.Path)
+		}
+	}
+	switch name {
+	case "":
+		// Not imported by this file.
+		return false
+	case ".", "_":
+		// Can't tell which symbols are used.
+		return name == "."
+	}
+	used := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || used {
+			return !used
+		}
+		for _, sym := range imp.Symbols {
+			if i := strings.IndexByte(sym, '.'); i != -1 {
+				// Method symbol "T.M".
+				if sel.Sel.Name == sym[i+1:] {
+					used = true
+				}
+			} else if isIdent(sel.X, name) && sel.Sel.Name == sym {
+				used = true
+			}
+		}
+		return !used
+	})
+	return used
+}
+
+func isIdent(x ast.Expr, name string) bool {
+	id, ok := x.(*ast.Ident)
+	return ok && id.Name == name
+}
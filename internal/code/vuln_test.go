@@ -0,0 +1,112 @@
+package code_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/home/internal/code"
+)
+
+func TestVulnScanner(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "vuln_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a repository whose module requires two modules
+	// with known vulnerabilities, and uses one vulnerable symbol.
+	// Other vulnerable symbols may be used through dependencies.
+	workDir := filepath.Join(tempDir, "work")
+	reposDir := filepath.Join(tempDir, "repositories")
+	writeFiles(t, workDir, map[string]string{
+		"go.mod": `module dmitri.shuralyov.com/app
+
+require (
+	example.com/other v1.0.0
+	example.com/vulnerable v1.0.0
+)
+`,
+		"app.go": `package app
+
+import v "example.com/vulnerable/sub"
+
+func F() { v.Bad() }
+`,
+		"quiet/quiet.go": `package quiet
+
+import "example.com/vulnerable/sub"
+
+var _ = sub.Fine
+`,
+	})
+	runGit(t, workDir, time.Time{}, "init", "-q")
+	runGit(t, workDir, time.Time{}, "checkout", "-q", "-b", "master")
+	runGit(t, workDir, time.Time{}, "add", ".")
+	runGit(t, workDir, time.Time{}, "commit", "-q", "-m", "initial")
+	runGit(t, tempDir, time.Time{}, "clone", "-q", "--bare", workDir, filepath.Join(reposDir, "dmitri.shuralyov.com", "app"))
+
+	dbDir := filepath.Join(tempDir, "vulndb")
+	writeFiles(t, dbDir, map[string]string{
+		"index.json": `["not an entry"]`,
+		"ID/GO-0001.json": `{"id": "GO-0001", "aliases": ["CVE-0001"], "summary": "Bad is bad.", "affected": [{
+	"package": {"name": "example.com/vulnerable", "ecosystem": "Go"},
+	"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.1.0"}]}],
+	"ecosystem_specific": {"imports": [{"path": "example.com/vulnerable/sub", "symbols": ["Bad"]}]}
+}]}`,
+		"ID/GO-0002.json": `{"id": "GO-0002", "summary": "Method is unused.", "affected": [{
+	"package": {"name": "example.com/vulnerable", "ecosystem": "Go"},
+	"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}],
+	"ecosystem_specific": {"imports": [{"path": "example.com/vulnerable/sub", "symbols": ["T.Unused"]}]}
+}]}`,
+		"ID/GO-0003.json": `{"id": "GO-0003", "summary": "Already fixed.", "affected": [{
+	"package": {"name": "example.com/other", "ecosystem": "Go"},
+	"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.9.0"}]}]
+}]}`,
+		"ID/GO-0004.json": `{"id": "GO-0004", "summary": "Whole module.", "affected": [{
+	"package": {"name": "example.com/other", "ecosystem": "Go"},
+	"ranges": [{"type": "SEMVER", "events": [{"introduced": "0.5.0"}, {"fixed": "1.2.0"}]}]
+}]}`,
+		"ID/GO-0005.json": `{"id": "GO-0005", "summary": "Used through a dependency.", "affected": [{
+	"package": {"name": "example.com/other", "ecosystem": "Go"},
+	"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}],
+	"ecosystem_specific": {"imports": [{"path": "example.com/other/internal/deep"}]}
+}]}`,
+	})
+
+	service, err := code.NewService(reposDir, mockNotification{}, &mockEvents{}, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	scanner := &code.VulnScanner{Code: service, DBDir: dbDir}
+	const repoRoot = "dmitri.shuralyov.com/app"
+
+	if got := scanner.Findings(repoRoot); got != nil {
+		t.Errorf("Findings before scan: got %+v, want none", got)
+	}
+	findings, err := scanner.Scan(context.Background(), repoRoot)
+	if err != nil {
+		t.Fatal("Scan:", err)
+	}
+	want := []code.Finding{
+		{ID: "GO-0004", Summary: "Whole module.", Module: "example.com/other", Version: "v1.0.0", Fixed: "v1.2.0", Requirer: repoRoot},
+		{ID: "GO-0005", Summary: "Used through a dependency.", Module: "example.com/other", Version: "v1.0.0", Requirer: repoRoot, Unconfirmed: true},
+		{ID: "GO-0001", Aliases: []string{"CVE-0001"}, Summary: "Bad is bad.", Module: "example.com/vulnerable", Version: "v1.0.0", Fixed: "v1.1.0", Requirer: repoRoot, Packages: []string{repoRoot}},
+		{ID: "GO-0002", Summary: "Method is unused.", Module: "example.com/vulnerable", Version: "v1.0.0", Requirer: repoRoot, Unconfirmed: true},
+	}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("Scan:\ngot  %+v\nwant %+v", findings, want)
+	}
+	if got := scanner.Findings(repoRoot); !reflect.DeepEqual(got, want) {
+		t.Errorf("Findings:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	if got := (*code.VulnScanner)(nil).Findings(repoRoot); got != nil {
+		t.Errorf("Findings of nil scanner: got %+v, want none", got)
+	}
+}
@@ -37,6 +37,8 @@ func (a *app) SetupPage(ctx context.Context, state interface{}) {
 	js.Global().Set("MarkdownPreview", jsutil.Wrap(MarkdownPreview))
 	js.Global().Set("SwitchWriteTab", jsutil.Wrap(SwitchWriteTab))
 	js.Global().Set("PasteHandler", jsutil.Wrap(PasteHandler))
+	js.Global().Set("DragOverHandler", jsutil.Wrap(DragOverHandler))
+	js.Global().Set("DropHandler", jsutil.Wrap(DropHandler))
 	js.Global().Set("CreateNewIssue", funcOf(as.CreateNewIssue))
 	js.Global().Set("ToggleIssueState", js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
 		st := statepkg.Issue(args[0].String())
@@ -547,7 +547,7 @@ var t = template.Must(template.New("").Funcs(template.FuncMap{
 				<span class="gray"><span style="margin-right: 6px;">{{octicon "markdown"}}</span>Markdown</span>
 			</div>
 			<div class="list-entry-body">
-				<textarea class="comment-editor" placeholder="Leave a comment." onpaste="PasteHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);" tabindex=1></textarea>
+				<textarea class="comment-editor" placeholder="Leave a comment." onpaste="PasteHandler(event);" ondragover="DragOverHandler(event);" ondrop="DropHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);" tabindex=1></textarea>
 				<div class="comment-preview markdown-body" style="padding: 11px 11px 10px 11px; min-height: 120px; box-sizing: border-box; border-bottom: 1px solid #eee; display: none;"></div>
 				<div style="text-align: right; margin-top: 10px;">
 					<button class="btn btn-success btn-small" onclick="PostComment();" tabindex=1>Comment</button>
@@ -578,7 +578,7 @@ var t = template.Must(template.New("").Funcs(template.FuncMap{
 			</div>
 		</div>
 		<div class="list-entry-body">
-			<textarea class="comment-editor" style="min-height: 200px;" placeholder="Leave a comment." onpaste="PasteHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);"></textarea>
+			<textarea class="comment-editor" style="min-height: 200px;" placeholder="Leave a comment." onpaste="PasteHandler(event);" ondragover="DragOverHandler(event);" ondrop="DropHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);"></textarea>
 			<div class="comment-preview markdown-body" style="padding: 10px; min-height: 200px; display: none;"></div>
 			<div style="text-align: right; margin-top: 10px;">
 				<button id="create-issue-button" class="btn btn-success btn-small" disabled="disabled" onclick="CreateNewIssue();">Create Issue</button>
@@ -636,7 +636,7 @@ var t = template.Must(template.New("").Funcs(template.FuncMap{
 			<span class="gray"><span style="margin-right: 6px;">{{octicon "markdown"}}</span>Markdown</span>
 		</div>
 		<div class="list-entry-body">
-			<textarea class="comment-editor" placeholder="Leave a comment." onpaste="PasteHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);" data-id="{{.ID}}" data-raw="{{.Body}}" tabindex=1></textarea>
+			<textarea class="comment-editor" placeholder="Leave a comment." onpaste="PasteHandler(event);" ondragover="DragOverHandler(event);" ondrop="DropHandler(event);" onkeydown="TabSupportKeyDownHandler(this, event);" data-id="{{.ID}}" data-raw="{{.Body}}" tabindex=1></textarea>
 			<div class="comment-preview markdown-body" style="padding: 11px 11px 10px 11px; min-height: 120px; box-sizing: border-box; border-bottom: 1px solid #eee; display: none;"></div>
 			<div style="text-align: right; margin-top: 10px;">
 				<button class="btn btn-success btn-small" onclick="EditComment({{` + "`update`" + ` | json}}, this, event);" tabindex=1>Update comment</button>
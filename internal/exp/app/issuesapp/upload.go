@@ -10,18 +10,29 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"syscall/js"
 
 	"honnef.co/go/js/dom/v2"
 )
 
+// uploadTypes is the set of file types that can be uploaded.
+// It matches the allow-list of the /api/usercontent endpoint.
+var uploadTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
 func PasteHandler(e dom.Event) {
 	ce := e.(*dom.ClipboardEvent)
 
 	items := ce.Get("clipboardData").Get("items")
-	file, err := imagePNGFile(items)
+	file, err := uploadableFile(items)
 	if err != nil {
-		// No image to paste.
+		// No file to paste.
 		return
 	}
 
@@ -30,44 +41,113 @@ func PasteHandler(e dom.Event) {
 
 	nameFn, err := plainTextString(items)
 	if err != nil {
-		nameFn = func() string { return "Image" }
+		nameFn = func() string { return defaultName(file) }
 	}
 
+	t := ce.Target().(*dom.HTMLTextAreaElement)
 	go func() {
-		b, name := blobToBytes(file), nameFn()
+		upload(t, file, nameFn())
+	}()
+}
 
-		resp, err := http.Post("/api/usercontent", "image/png", bytes.NewReader(b))
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			body, _ := ioutil.ReadAll(resp.Body)
-			log.Println(fmt.Errorf("did not get acceptable status code: %v body: %q", resp.Status, body))
-			return
-		} else if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
-			log.Println(fmt.Errorf("got Content-Type %q, want %q", ct, "application/json"))
-			return
-		}
-		var uploadResponse struct {
-			URL   string
-			Error string
-		}
-		err = json.NewDecoder(resp.Body).Decode(&uploadResponse)
-		if err != nil {
-			log.Println(err)
-			return
+// DragOverHandler allows files to be dropped onto a comment editor.
+func DragOverHandler(e dom.Event) {
+	if !hasFiles(e.Underlying().Get("dataTransfer")) {
+		return
+	}
+	e.PreventDefault()
+	e.Underlying().Get("dataTransfer").Set("dropEffect", "copy")
+}
+
+// DropHandler uploads files dropped onto a comment editor,
+// and inserts Markdown referencing them.
+func DropHandler(e dom.Event) {
+	if !hasFiles(e.Underlying().Get("dataTransfer")) {
+		return
+	}
+	e.PreventDefault()
+
+	t := e.Target().(*dom.HTMLTextAreaElement)
+	files := e.Underlying().Get("dataTransfer").Get("files")
+	var uploads []js.Value
+	for i := 0; i < files.Length(); i++ {
+		if file := files.Index(i); uploadTypes[fileType(file)] {
+			uploads = append(uploads, file)
+		} else {
+			log.Printf("file %q of type %q is not supported\n", file.Get("name").String(), file.Get("type").String())
 		}
-		if uploadResponse.Error != "" {
-			log.Println(uploadResponse.Error)
-			return
+	}
+	go func() {
+		for _, file := range uploads {
+			upload(t, file, file.Get("name").String())
 		}
-
-		insertText(ce.Target().(*dom.HTMLTextAreaElement), fmt.Sprintf("![%s](%s)\n\n", name, uploadResponse.URL))
 	}()
 }
 
+// upload uploads file and inserts Markdown referencing it into t.
+func upload(t *dom.HTMLTextAreaElement, file js.Value, name string) {
+	b := blobToBytes(file)
+
+	resp, err := http.Post("/api/usercontent", fileType(file), bytes.NewReader(b))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Println(fmt.Errorf("did not get acceptable status code: %v body: %q", resp.Status, body))
+		return
+	} else if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		log.Println(fmt.Errorf("got Content-Type %q, want %q", ct, "application/json"))
+		return
+	}
+	var uploadResponse struct {
+		URL          string
+		ThumbnailURL string
+		Error        string
+	}
+	err = json.NewDecoder(resp.Body).Decode(&uploadResponse)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if uploadResponse.Error != "" {
+		log.Println(uploadResponse.Error)
+		return
+	}
+
+	insertText(t, uploadMarkdown(fileType(file), name, uploadResponse.URL, uploadResponse.ThumbnailURL))
+}
+
+// uploadMarkdown returns Markdown that references uploaded content.
+// Images are embedded, linking to the full size image if there's a thumbnail.
+// Other files are linked to. The name is escaped so it's always
+// treated as literal link text.
+func uploadMarkdown(mediaType, name, url, thumbnailURL string) string {
+	name = markdownEscaper.Replace(name)
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && thumbnailURL != "":
+		return fmt.Sprintf("[![%s](%s)](%s)\n\n", name, thumbnailURL, url)
+	case strings.HasPrefix(mediaType, "image/"):
+		return fmt.Sprintf("![%s](%s)\n\n", name, url)
+	default:
+		return fmt.Sprintf("[%s](%s)\n\n", name, url)
+	}
+}
+
+// markdownEscaper escapes Markdown metacharacters, and replaces
+// line breaks with spaces so text stays on a single line.
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"[", "\\[", "]", "\\]",
+	"(", "\\(", ")", "\\)",
+	"<", "\\<", ">", "\\>",
+	"*", "\\*", "_", "\\_", "`", "\\`",
+	"!", "\\!", "#", "\\#", "|", "\\|", "~", "\\~",
+	"\r\n", " ", "\n", " ", "\r", " ",
+)
+
 func insertText(t *dom.HTMLTextAreaElement, inserted string) {
 	value, start, end := t.Value(), t.SelectionStart(), t.SelectionEnd()
 	t.SetValue(value[:start] + inserted + value[end:])
@@ -75,11 +155,11 @@ func insertText(t *dom.HTMLTextAreaElement, inserted string) {
 	t.SetSelectionEnd(start + len(inserted))
 }
 
-// imagePNGFile tries to get an "image/png" file from items.
-func imagePNGFile(items js.Value) (file js.Value, _ error) {
+// uploadableFile tries to get a file of a type in uploadTypes from items.
+func uploadableFile(items js.Value) (file js.Value, _ error) {
 	for i := 0; i < items.Length(); i++ {
 		item := items.Index(i)
-		if item.Get("kind").String() != "file" || item.Get("type").String() != "image/png" {
+		if item.Get("kind").String() != "file" || !uploadTypes[item.Get("type").String()] {
 			continue
 		}
 		return item.Call("getAsFile"), nil
@@ -87,6 +167,38 @@ func imagePNGFile(items js.Value) (file js.Value, _ error) {
 	return js.Value{}, os.ErrNotExist
 }
 
+// hasFiles reports whether dataTransfer carries files.
+func hasFiles(dataTransfer js.Value) bool {
+	types := dataTransfer.Get("types")
+	for i := 0; i < types.Length(); i++ {
+		if types.Index(i).String() == "Files" {
+			return true
+		}
+	}
+	return false
+}
+
+// fileType returns the media type of file.
+// Files without a known type, such as logs, are treated as plain text.
+// The server verifies the type by sniffing the content.
+func fileType(file js.Value) string {
+	switch typ := file.Get("type").String(); typ {
+	case "", "text/x-log":
+		return "text/plain"
+	default:
+		return typ
+	}
+}
+
+// defaultName returns the name to use for a pasted file
+// when there's no accompanying text.
+func defaultName(file js.Value) string {
+	if strings.HasPrefix(fileType(file), "image/") {
+		return "Image"
+	}
+	return "File"
+}
+
 // plainTextString tries to get a "text/plain" string from items.
 // The returned func blocks until the string is available.
 func plainTextString(items js.Value) (func() string, error) {
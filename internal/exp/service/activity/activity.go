@@ -2,12 +2,32 @@
 package activity
 
 import (
+	"context"
+	"time"
+
 	"github.com/shurcooL/events"
+	"github.com/shurcooL/events/event"
 	notificationv2 "github.com/shurcooL/home/internal/exp/service/notification"
 )
 
 // Service defines methods of an activity service.
 type Service interface {
 	events.Service
+	Lister
 	notificationv2.Service
 }
+
+// Lister lists events with options.
+type Lister interface {
+	// ListEvents lists events that match opt, newest first.
+	ListEvents(ctx context.Context, opt ListOptions) ([]event.Event, error)
+}
+
+// Retainer is implemented by event sources
+// that keep only a window of newest events.
+type Retainer interface {
+	// RetainedSince returns the time of the oldest retained event.
+	// Events that happened before it may not be available.
+	// It returns the zero time if no events have been dropped.
+	RetainedSince(ctx context.Context) (time.Time, error)
+}
@@ -24,6 +24,7 @@ import (
 	"dmitri.shuralyov.com/service/change"
 	"dmitri.shuralyov.com/state"
 	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/home/internal/exp/service/activity"
 	"github.com/shurcooL/home/internal/exp/service/notification"
 	"github.com/shurcooL/httpfs/vfsutil"
 	"github.com/shurcooL/users"
@@ -128,15 +129,38 @@ func (t *thread) UnmarshalText(text []byte) error {
 	return nil
 }
 
-// List lists events.
+// maxEvents is the maximum number of events kept in memory.
+const maxEvents = 1000
+
+// List lists the newest activity.DefaultLimit events.
 func (s *Service) List(ctx context.Context) ([]event.Event, error) {
+	return s.ListEvents(ctx, activity.ListOptions{})
+}
+
+// ListEvents implements activity.Lister.
+func (s *Service) ListEvents(ctx context.Context, opt activity.ListOptions) ([]event.Event, error) {
 	s.mu.Lock()
 	events := make([]event.Event, len(s.events))
 	for i, event := range s.events {
 		events[i] = event.WithURL(ctx)
 	}
 	s.mu.Unlock()
-	return events, nil
+	return activity.Filter(events, opt), nil
+}
+
+// RetainedSince implements activity.Retainer.
+// Only recent changes are fetched, so events that happened
+// before the oldest one kept in memory aren't available.
+func (s *Service) RetainedSince(context.Context) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest time.Time
+	for _, e := range s.events {
+		if oldest.IsZero() || e.Time.Before(oldest) {
+			oldest = e.Time
+		}
+	}
+	return oldest, nil
 }
 
 // ListNotifications implements notification.Service.
@@ -379,8 +403,8 @@ func (s *Service) loadAndPoll(ctx context.Context) (err error) {
 				{
 					s.events = append(s.events, events...)
 					sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].Time.After(s.events[j].Time) })
-					if len(s.events) > 100 {
-						s.events = s.events[:100]
+					if len(s.events) > maxEvents {
+						s.events = s.events[:maxEvents]
 					}
 				}
 				{
@@ -16,6 +16,7 @@ import (
 	githubv3 "github.com/google/go-github/github"
 	"github.com/shurcooL/events/event"
 	"github.com/shurcooL/githubv4"
+	"github.com/shurcooL/home/internal/exp/service/activity"
 	"github.com/shurcooL/home/internal/exp/service/notification"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/webdav"
@@ -435,8 +436,17 @@ func (*Service) NotifyThread(_ context.Context, namespace, threadType string, th
 	return nil
 }
 
-// List lists events.
+// maxEvents is the maximum number of events derived
+// from notification mail messages kept in memory.
+const maxEvents = 1000
+
+// List lists the newest activity.DefaultLimit events.
 func (s *Service) List(ctx context.Context) ([]event.Event, error) {
+	return s.ListEvents(ctx, activity.ListOptions{})
+}
+
+// ListEvents implements activity.Lister.
+func (s *Service) ListEvents(ctx context.Context, opt activity.ListOptions) ([]event.Event, error) {
 	var seen = make(map[githubEventID]struct{}) // Used to deduplicate same event from multiple sources.
 
 	// Get events from mail.
@@ -464,11 +474,20 @@ func (s *Service) List(ctx context.Context) ([]event.Event, error) {
 		all = append(all, e)
 	}
 	sort.SliceStable(all, func(i, j int) bool { return all[i].Time.After(all[j].Time) })
-	if len(all) > 100 {
-		all = all[:100]
-	}
 
-	return all, fetchError
+	return activity.Filter(all, opt), fetchError
+}
+
+// RetainedSince implements activity.Retainer.
+// Only recent events are fetched and received via mail, so events
+// that happened before the oldest one kept in memory aren't available.
+func (s *Service) RetainedSince(ctx context.Context) (time.Time, error) {
+	// Fetch errors are reported by ListEvents, what's in memory is still retained.
+	events, _ := s.ListEvents(ctx, activity.ListOptions{Limit: 2 * maxEvents}) // Events from mail and list.
+	if len(events) == 0 {
+		return time.Time{}, nil
+	}
+	return events[len(events)-1].Time, nil
 }
 
 // Log logs the event.
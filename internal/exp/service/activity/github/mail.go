@@ -116,8 +116,8 @@ func (s *Service) loadAndPoll() (err error) {
 				{
 					s.mail.events = append(s.mail.events, events...)
 					sort.SliceStable(s.mail.events, func(i, j int) bool { return s.mail.events[i].Time.After(s.mail.events[j].Time) })
-					if len(s.mail.events) > 100 {
-						s.mail.events = s.mail.events[:100]
+					if len(s.mail.events) > maxEvents {
+						s.mail.events = s.mail.events[:maxEvents]
 					}
 				}
 				s.mail.mu.Unlock()
@@ -0,0 +1,150 @@
+package activity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/users"
+)
+
+// DefaultLimit is the maximum number of events listed
+// when ListOptions.Limit is zero.
+const DefaultLimit = 100
+
+// ListOptions are options for listing events.
+// The zero value lists the newest DefaultLimit events.
+type ListOptions struct {
+	// Before, if non-zero, lists only events that happened before it.
+	// Before and BeforeID can be set to the time and ID of the oldest
+	// listed event to list older ones.
+	Before time.Time
+	// BeforeID, if non-empty, additionally lists events that happened
+	// at Before and whose EventID is less than it. It's used to page
+	// through events that happened at the same time.
+	BeforeID string
+	// After, if non-zero, lists only events that happened after it.
+	After time.Time
+
+	// ImportPath, if non-empty, lists only events whose container is
+	// the import path or is within it. For example, "example.com/repo"
+	// includes containers "example.com/repo" and "example.com/repo/pkg",
+	// but not "example.com/repo2".
+	ImportPath string
+
+	// Actor, if non-zero, lists only events by this user.
+	Actor users.UserSpec
+
+	// PayloadType, if non-empty, lists only events
+	// whose payload is of this type, as returned by PayloadType.
+	PayloadType string
+
+	// Limit is the maximum number of events to list.
+	// Zero means DefaultLimit.
+	Limit int
+}
+
+// Match reports whether event e matches the filters in opt.
+// It doesn't take opt.Limit into account.
+func (opt ListOptions) Match(e event.Event) bool {
+	if !opt.Before.IsZero() && !e.Time.Before(opt.Before) &&
+		!(e.Time.Equal(opt.Before) && opt.BeforeID != "" && EventID(e) < opt.BeforeID) {
+		return false
+	}
+	if !opt.After.IsZero() && !e.Time.After(opt.After) {
+		return false
+	}
+	if opt.ImportPath != "" && e.Container != opt.ImportPath && !strings.HasPrefix(e.Container, opt.ImportPath+"/") {
+		return false
+	}
+	if opt.Actor != (users.UserSpec{}) && e.Actor.UserSpec != opt.Actor {
+		return false
+	}
+	if opt.PayloadType != "" && PayloadType(e.Payload) != opt.PayloadType {
+		return false
+	}
+	return true
+}
+
+// Filter returns events that match opt, up to opt's limit,
+// in the order of Sort. events must be sorted newest first.
+func Filter(events []event.Event, opt ListOptions) []event.Event {
+	limit := opt.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	events = append([]event.Event(nil), events...)
+	Sort(events)
+	var filtered []event.Event
+	for _, e := range events {
+		if len(filtered) == limit {
+			break
+		}
+		if !opt.Match(e) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered
+}
+
+// Sort sorts events newest first. Events that happened
+// at the same time are sorted by EventID, greatest first.
+func Sort(events []event.Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if ti, tj := events[i].Time, events[j].Time; !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return EventID(events[i]) > EventID(events[j])
+	})
+}
+
+// EventID returns an identifier of event e, derived from its contents.
+// Events don't have IDs of their own, so it's used to tell apart and
+// order events that happened at the same time.
+func EventID(e event.Event) string {
+	b, err := json.Marshal(e)
+	if err != nil {
+		b = []byte(fmt.Sprintf("%v %v %v", e.Time, e.Actor.UserSpec, e.Container))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// PayloadType returns the type of event payload p.
+// It's one of "issue", "change", "issuecomment", "changecomment",
+// "commitcomment", "push", "star", "create", "fork", "delete", "wiki",
+// or the empty string if p is of an unknown type.
+func PayloadType(p interface{}) string {
+	switch p.(type) {
+	case event.Issue:
+		return "issue"
+	case event.Change:
+		return "change"
+	case event.IssueComment:
+		return "issuecomment"
+	case event.ChangeComment:
+		return "changecomment"
+	case event.CommitComment:
+		return "commitcomment"
+	case event.Push:
+		return "push"
+	case event.Star:
+		return "star"
+	case event.Create:
+		return "create"
+	case event.Fork:
+		return "fork"
+	case event.Delete:
+		return "delete"
+	case event.Wiki:
+		return "wiki"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,91 @@
+package activity_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/events/event"
+	"github.com/shurcooL/home/internal/exp/service/activity"
+	"github.com/shurcooL/users"
+)
+
+func TestFilter(t *testing.T) {
+	var (
+		alice = users.User{UserSpec: users.UserSpec{ID: 1, Domain: "example.org"}}
+		bob   = users.User{UserSpec: users.UserSpec{ID: 2, Domain: "example.org"}}
+		day   = func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	)
+	// Events, newest first.
+	events := []event.Event{
+		{Time: day(5), Actor: alice, Container: "example.org/repo/pkg", Payload: event.Push{}},
+		{Time: day(4), Actor: bob, Container: "example.org/repo2", Payload: event.Star{}},
+		{Time: day(3), Actor: alice, Container: "example.org/repo", Payload: event.Issue{Action: "opened"}},
+		{Time: day(2), Actor: bob, Container: "example.org/repo", Payload: event.Push{}},
+		{Time: day(1), Actor: alice, Container: "example.org/other", Payload: event.Create{Type: "repository"}},
+	}
+	for _, tt := range []struct {
+		name string
+		opt  activity.ListOptions
+		want []int // Indices of wanted events.
+	}{
+		{"all", activity.ListOptions{}, []int{0, 1, 2, 3, 4}},
+		{"limit", activity.ListOptions{Limit: 2}, []int{0, 1}},
+		{"before", activity.ListOptions{Before: day(3)}, []int{3, 4}},
+		{"after", activity.ListOptions{After: day(3)}, []int{0, 1}},
+		{"before and limit", activity.ListOptions{Before: day(5), Limit: 2}, []int{1, 2}},
+		{"import path", activity.ListOptions{ImportPath: "example.org/repo"}, []int{0, 2, 3}},
+		{"actor", activity.ListOptions{Actor: bob.UserSpec}, []int{1, 3}},
+		{"payload type", activity.ListOptions{PayloadType: "push"}, []int{0, 3}},
+		{"combined", activity.ListOptions{ImportPath: "example.org/repo", Actor: alice.UserSpec, PayloadType: "issue"}, []int{2}},
+		{"none", activity.ListOptions{PayloadType: "fork"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := activity.Filter(events, tt.opt)
+			var want []event.Event
+			for _, i := range tt.want {
+				want = append(want, events[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got:\n%v\nwant:\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestFilterSameTime(t *testing.T) {
+	var (
+		alice = users.User{UserSpec: users.UserSpec{ID: 1, Domain: "example.org"}}
+		at    = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	// Events that happened at the same time, in no particular order.
+	events := []event.Event{
+		{Time: at, Actor: alice, Container: "example.org/repo1", Payload: event.Push{}},
+		{Time: at, Actor: alice, Container: "example.org/repo2", Payload: event.Push{}},
+		{Time: at, Actor: alice, Container: "example.org/repo3", Payload: event.Push{}},
+		{Time: at.Add(-time.Hour), Actor: alice, Container: "example.org/repo4", Payload: event.Push{}},
+	}
+
+	// Page through all events, one at a time, using the oldest listed
+	// event as the cursor, and check that each event is listed once.
+	seen := make(map[string]bool)
+	opt := activity.ListOptions{Limit: 1}
+	for i := 0; ; i++ {
+		if i > len(events) {
+			t.Fatal("paging didn't stop")
+		}
+		page := activity.Filter(events, opt)
+		if len(page) == 0 {
+			break
+		}
+		e := page[0]
+		if seen[e.Container] {
+			t.Fatalf("event %q listed more than once", e.Container)
+		}
+		seen[e.Container] = true
+		opt.Before, opt.BeforeID = e.Time, activity.EventID(e)
+	}
+	if len(seen) != len(events) {
+		t.Errorf("listed %d events, want %d", len(seen), len(events))
+	}
+}
@@ -18,6 +18,10 @@ import (
 type Service struct {
 	// Reactions, if not nil, is temporarily used as a place to store reactions.
 	Reactions reactions.Service
+
+	// Users, if not nil, is used to look up current profiles of change
+	// authors and timeline item actors, so that profile edits are reflected.
+	Users users.Service
 }
 
 var s = struct {
@@ -256,7 +260,7 @@ Also make minor tweaks to the documentation to make it more accurate.`,
 }
 
 // List changes.
-func (*Service) List(ctx context.Context, repo string, opt change.ListOptions) ([]change.Change, error) {
+func (svc *Service) List(ctx context.Context, repo string, opt change.ListOptions) ([]change.Change, error) {
 	var counts func(s state.Change) bool
 	switch opt.Filter {
 	case change.FilterOpen:
@@ -274,6 +278,7 @@ func (*Service) List(ctx context.Context, repo string, opt change.ListOptions) (
 		if !counts(c.State) {
 			continue
 		}
+		c.Author = svc.user(ctx, c.Author)
 		cs = append(cs, c.Change)
 	}
 	return cs, nil
@@ -304,11 +309,13 @@ func (*Service) Count(ctx context.Context, repo string, opt change.ListOptions)
 }
 
 // Get a change.
-func (*Service) Get(ctx context.Context, repo string, id uint64) (change.Change, error) {
+func (svc *Service) Get(ctx context.Context, repo string, id uint64) (change.Change, error) {
 	if !hasChange(repo, id) {
 		return change.Change{}, os.ErrNotExist
 	}
-	return s.changes[repo][id-1].Change, nil
+	c := s.changes[repo][id-1].Change
+	c.Author = svc.user(ctx, c.Author)
+	return c, nil
 }
 
 // ListTimeline lists timeline items (change.Comment, change.Review, change.TimelineItem) for specified change id.
@@ -316,15 +323,28 @@ func (svc *Service) ListTimeline(ctx context.Context, repo string, id uint64, op
 	if !hasChange(repo, id) {
 		return nil, os.ErrNotExist
 	}
+	timeline := make([]interface{}, len(s.changes[repo][id-1].Timeline))
+	copy(timeline, s.changes[repo][id-1].Timeline)
+	for i, item := range timeline {
+		switch t := item.(type) {
+		case change.Comment:
+			t.User = svc.user(ctx, t.User)
+			timeline[i] = t
+		case change.Review:
+			t.User = svc.user(ctx, t.User)
+			timeline[i] = t
+		case change.TimelineItem:
+			t.Actor = svc.user(ctx, t.Actor)
+			timeline[i] = t
+		}
+	}
 	if svc.Reactions == nil {
-		return s.changes[repo][id-1].Timeline, nil
+		return timeline, nil
 	}
 	reactions, err := svc.Reactions.List(ctx, repo)
 	if err != nil {
 		return nil, fmt.Errorf("ListTimeline: Reactions.List: %v", err)
 	}
-	timeline := make([]interface{}, len(s.changes[repo][id-1].Timeline))
-	copy(timeline, s.changes[repo][id-1].Timeline)
 	switch {
 	case repo == "dmitri.shuralyov.com/font/woff2" && id == 1:
 		{
@@ -391,6 +411,19 @@ func (s *Service) EditComment(ctx context.Context, repo string, id uint64, cr ch
 	return comment, nil
 }
 
+// user returns the current profile of user u, if svc.Users
+// is set and has it. Otherwise, it returns u unmodified.
+func (svc *Service) user(ctx context.Context, u users.User) users.User {
+	if svc.Users == nil {
+		return u
+	}
+	current, err := svc.Users.Get(ctx, u.UserSpec)
+	if err != nil {
+		return u
+	}
+	return current
+}
+
 func hasChange(repo string, id uint64) bool {
 	return 1 <= id && id <= uint64(len(s.changes[repo]))
 }
@@ -0,0 +1,157 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shurcooL/users"
+)
+
+// EditRequest is a request to edit a user's profile.
+// Fields that are nil are left unchanged.
+// Leading and trailing white space is trimmed from values.
+type EditRequest struct {
+	Name      *string // Display name. May be empty.
+	Email     *string // Public email. May be empty.
+	AvatarURL *string // Absolute http(s) URL, or a path of uploaded user content.
+	HTMLURL   *string // Website, as an absolute http(s) URL. May be empty.
+}
+
+const (
+	maxNameLength  = 100
+	maxEmailLength = 254
+	maxURLLength   = 2048
+)
+
+// InvalidEditError is the error returned by Store.Edit
+// if the edit request is invalid.
+type InvalidEditError struct {
+	Err error // Reason the edit request is invalid.
+}
+
+func (e InvalidEditError) Error() string { return e.Err.Error() }
+
+// Validate returns non-nil error if the edit request
+// to edit the profile of user is invalid.
+func (er EditRequest) Validate(user users.UserSpec) error {
+	if er.Name != nil {
+		name := strings.TrimSpace(*er.Name)
+		if utf8.RuneCountInString(name) > maxNameLength {
+			return fmt.Errorf("name is longer than %d characters", maxNameLength)
+		}
+		if strings.IndexFunc(name, unicode.IsControl) != -1 {
+			return errors.New("name contains control characters")
+		}
+	}
+	if er.Email != nil {
+		if email := strings.TrimSpace(*er.Email); email != "" {
+			if err := validateEmail(email); err != nil {
+				return err
+			}
+		}
+	}
+	if er.AvatarURL != nil {
+		avatarURL := strings.TrimSpace(*er.AvatarURL)
+		if avatarURL == "" {
+			return errors.New("avatar URL must not be empty")
+		}
+		if strings.HasPrefix(avatarURL, "/usercontent/") {
+			// A path of content uploaded by the user is okay.
+			if err := validateUserContentPath(avatarURL, user); err != nil {
+				return fmt.Errorf("avatar URL %v", err)
+			}
+		} else if err := validateWebURL(avatarURL); err != nil {
+			return fmt.Errorf("avatar URL %v", err)
+		}
+	}
+	if er.HTMLURL != nil {
+		if htmlURL := strings.TrimSpace(*er.HTMLURL); htmlURL != "" {
+			if err := validateWebURL(htmlURL); err != nil {
+				return fmt.Errorf("website %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateEmail validates that s is a bare email address.
+func validateEmail(s string) error {
+	if len(s) > maxEmailLength {
+		return fmt.Errorf("email is longer than %d characters", maxEmailLength)
+	}
+	if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+		return fmt.Errorf("email %q is not a valid email address", s)
+	}
+	return nil
+}
+
+// validateUserContentPath validates that s is the path
+// of a file uploaded by user, like "/usercontent/1@example.org/{name}".
+func validateUserContentPath(s string, user users.UserSpec) error {
+	prefix := fmt.Sprintf("/usercontent/%d@%s/", user.ID, user.Domain)
+	name := strings.TrimPrefix(s, prefix)
+	if len(s) > maxURLLength || !strings.HasPrefix(s, prefix) ||
+		name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("%q is not a path of content uploaded by you", s)
+	}
+	return nil
+}
+
+// validateWebURL validates that s is an absolute http or https URL.
+func validateWebURL(s string) error {
+	if len(s) > maxURLLength {
+		return fmt.Errorf("is longer than %d characters", maxURLLength)
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return fmt.Errorf("%q is not an absolute http or https URL", s)
+	}
+	return nil
+}
+
+// edits returns the fields of er paired with their names.
+func (er EditRequest) edits() []struct {
+	field string
+	value *string
+} {
+	return []struct {
+		field string
+		value *string
+	}{
+		{"Name", er.Name},
+		{"Email", er.Email},
+		{"AvatarURL", er.AvatarURL},
+		{"HTMLURL", er.HTMLURL},
+	}
+}
+
+// profileField returns a pointer to the profile field of u named field.
+// field must be one of "Name", "Email", "AvatarURL", "HTMLURL".
+func profileField(u *users.User, field string) *string {
+	switch field {
+	case "Name":
+		return &u.Name
+	case "Email":
+		return &u.Email
+	case "AvatarURL":
+		return &u.AvatarURL
+	case "HTMLURL":
+		return &u.HTMLURL
+	default:
+		panic(fmt.Errorf("profileField: unknown field %q", field))
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
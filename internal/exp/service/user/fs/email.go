@@ -0,0 +1,233 @@
+package fs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/users"
+)
+
+// Email is an additional email address of a user.
+// Verified email addresses are used to attribute
+// git commits to the user.
+type Email struct {
+	Address  string
+	Verified bool
+}
+
+// emailTokenLifetime is how long an email verification token is valid.
+const emailTokenLifetime = 24 * time.Hour
+
+// emailKey identifies an email address of a user.
+type emailKey struct {
+	User    users.UserSpec
+	Address string // Lower case.
+}
+
+func (s *Store) loadEmails() error {
+	f, err := s.fs.OpenFile(context.Background(), "emails", os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var e email
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		key := emailKey{User: e.UserSpec.UserSpec(), Address: strings.ToLower(e.Address)}
+		if e.Removed {
+			delete(s.emails, key)
+			continue
+		}
+		s.emails[key] = e
+	}
+	s.rebuildVerified()
+	return nil
+}
+
+// rebuildVerified rebuilds the verified email map.
+// s.mu must be held, unless s is still being loaded.
+func (s *Store) rebuildVerified() {
+	s.verified = make(map[string]users.UserSpec)
+	for key, e := range s.emails {
+		if e.Verified {
+			s.verified[key.Address] = key.User
+		}
+	}
+}
+
+// appendEmail appends e to the emails file.
+func (s *Store) appendEmail(ctx context.Context, e email) error {
+	f, err := s.fs.OpenFile(ctx, "emails", os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+// ListEmails lists additional email addresses of the specified user,
+// sorted by address.
+func (s *Store) ListEmails(_ context.Context, user users.UserSpec) ([]Email, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, os.ErrNotExist
+	}
+	var emails []Email
+	for key, e := range s.emails {
+		if key.User != user {
+			continue
+		}
+		emails = append(emails, Email{Address: e.Address, Verified: e.Verified})
+	}
+	sort.Slice(emails, func(i, j int) bool { return emails[i].Address < emails[j].Address })
+	return emails, nil
+}
+
+// AddEmail adds an unverified email address to the specified user,
+// and returns a token that can be given to VerifyEmail to verify it.
+// If the address was already added but isn't verified yet, a new token
+// is issued and the previous one stops being valid.
+// It returns os.ErrNotExist if the user doesn't exist,
+// and os.ErrExist if the address is already verified by any user.
+func (s *Store) AddEmail(ctx context.Context, user users.UserSpec, address string) (token string, err error) {
+	address = strings.TrimSpace(address)
+	if err := validateEmail(address); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return "", os.ErrNotExist
+	}
+	if _, ok := s.verified[strings.ToLower(address)]; ok {
+		return "", os.ErrExist
+	}
+	var b [16]byte
+	_, err = rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(b[:])
+	e := email{
+		UserSpec:  fromUserSpec(user),
+		Address:   address,
+		TokenHash: hashToken(token),
+		Created:   time.Now().UTC(),
+	}
+
+	// Commit to storage first, returning error on failure.
+	err = s.appendEmail(ctx, e)
+	if err != nil {
+		return "", err
+	}
+
+	// Commit to memory second.
+	s.emails[emailKey{User: user, Address: strings.ToLower(address)}] = e
+
+	return token, nil
+}
+
+// VerifyEmail verifies the email address of the specified user
+// that was issued token by AddEmail, and returns it.
+// It returns os.ErrNotExist if there's no such unverified address
+// or the token has expired, and os.ErrExist if the address
+// has been verified by another user in the meantime.
+func (s *Store) VerifyEmail(ctx context.Context, user users.UserSpec, token string) (Email, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokenHash := hashToken(token)
+	for key, e := range s.emails {
+		if key.User != user || e.Verified || e.TokenHash != tokenHash {
+			continue
+		}
+		if time.Since(e.Created) > emailTokenLifetime {
+			return Email{}, os.ErrNotExist
+		}
+		if _, ok := s.verified[key.Address]; ok {
+			return Email{}, os.ErrExist
+		}
+		e.Verified, e.TokenHash = true, ""
+
+		// Commit to storage first, returning error on failure.
+		err := s.appendEmail(ctx, e)
+		if err != nil {
+			return Email{}, err
+		}
+
+		// Commit to memory second.
+		s.emails[key] = e
+		s.rebuildVerified()
+
+		return Email{Address: e.Address, Verified: true}, nil
+	}
+	return Email{}, os.ErrNotExist
+}
+
+// RemoveEmail removes an email address from the specified user.
+// It returns os.ErrNotExist if the user doesn't have that address.
+func (s *Store) RemoveEmail(ctx context.Context, user users.UserSpec, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := emailKey{User: user, Address: strings.ToLower(strings.TrimSpace(address))}
+	e, ok := s.emails[key]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	// Commit to storage first, returning error on failure.
+	err := s.appendEmail(ctx, email{UserSpec: e.UserSpec, Address: e.Address, Removed: true})
+	if err != nil {
+		return err
+	}
+
+	// Commit to memory second.
+	delete(s.emails, key)
+	s.rebuildVerified()
+
+	return nil
+}
+
+// GetByVerifiedEmail fetches the user that has verified
+// the email address, compared case-insensitively.
+// It returns os.ErrNotExist if there's no such user.
+func (s *Store) GetByVerifiedEmail(_ context.Context, address string) (users.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.verified[strings.ToLower(address)]
+	if !ok {
+		return users.User{}, os.ErrNotExist
+	}
+	u, ok := s.users[user]
+	if !ok {
+		return users.User{}, os.ErrNotExist
+	}
+	return u, nil
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of token.
+// Only hashes of verification tokens are stored.
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
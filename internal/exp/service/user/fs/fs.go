@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/shurcooL/users"
@@ -18,20 +19,37 @@ import (
 // a virtual filesystem root for storage.
 func NewStore(root webdav.FileSystem) (*Store, error) {
 	s := &Store{
-		fs:    root,
-		users: make(map[users.UserSpec]users.User),
+		fs:     root,
+		users:  make(map[users.UserSpec]users.User),
+		edited: make(map[users.UserSpec][]string),
+		emails: make(map[emailKey]email),
+		keys:   make(map[signingKeyKey]signingKey),
 	}
 	err := s.load()
 	if err != nil {
 		return nil, err
 	}
+	err = s.loadEmails()
+	if err != nil {
+		return nil, err
+	}
+	err = s.loadSigningKeys()
+	if err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 type Store struct {
-	mu    sync.Mutex
-	fs    webdav.FileSystem
-	users map[users.UserSpec]users.User
+	mu     sync.Mutex
+	fs     webdav.FileSystem
+	users  map[users.UserSpec]users.User
+	edited map[users.UserSpec][]string // Profile fields edited by user.
+
+	emails   map[emailKey]email
+	verified map[string]users.UserSpec // Key is lower verified email address.
+
+	keys map[signingKeyKey]signingKey
 }
 
 func (s *Store) load() error {
@@ -51,6 +69,7 @@ func (s *Store) load() error {
 		}
 		user := u.User()
 		s.users[user.UserSpec] = user
+		s.edited[user.UserSpec] = u.Edited
 	}
 	return nil
 }
@@ -112,6 +131,10 @@ func (s *Store) InsertByCanonicalMe(ctx context.Context, user users.User) (users
 	for _, u := range s.users {
 		if u.CanonicalMe == user.CanonicalMe {
 			user.UserSpec.ID = u.UserSpec.ID
+			// Keep profile fields that were edited by the user.
+			for _, field := range s.edited[u.UserSpec] {
+				*profileField(&user, field) = *profileField(&u, field)
+			}
 			if reflect.DeepEqual(user, u) {
 				// User already exists and doesn't need to be updated.
 				return user, nil
@@ -131,12 +154,14 @@ func (s *Store) InsertByCanonicalMe(ctx context.Context, user users.User) (users
 	//       entries with the same user spec at some point.
 
 	// Commit to storage first, returning error on failure.
+	u := fromUser(user)
+	u.Edited = s.edited[user.UserSpec]
 	f, err := s.fs.OpenFile(ctx, "users", os.O_WRONLY|os.O_APPEND, 0600)
 	if err != nil {
 		return users.User{}, err
 	}
 	defer f.Close()
-	err = json.NewEncoder(f).Encode(fromUser(user))
+	err = json.NewEncoder(f).Encode(u)
 	if err != nil {
 		return users.User{}, err
 	}
@@ -147,6 +172,59 @@ func (s *Store) InsertByCanonicalMe(ctx context.Context, user users.User) (users
 	return user, nil
 }
 
+// Edit edits the profile of the specified user
+// as described by er, and returns the updated user.
+// It returns an error of type InvalidEditError if er is invalid,
+// and os.ErrNotExist if the user doesn't exist.
+// The caller is responsible for authorization checks.
+func (s *Store) Edit(ctx context.Context, user users.UserSpec, er EditRequest) (users.User, error) {
+	if err := er.Validate(user); err != nil {
+		return users.User{}, InvalidEditError{Err: err}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[user]
+	if !ok {
+		return users.User{}, os.ErrNotExist
+	}
+
+	// Apply edits.
+	edited := s.edited[user]
+	for _, e := range er.edits() {
+		if e.value == nil {
+			continue
+		}
+		*profileField(&u, e.field) = strings.TrimSpace(*e.value)
+		if !contains(edited, e.field) {
+			edited = append(edited, e.field)
+		}
+	}
+
+	// Updating is done by appending to the end of users file,
+	// same as in InsertByCanonicalMe.
+
+	// Commit to storage first, returning error on failure.
+	record := fromUser(u)
+	record.Edited = edited
+	f, err := s.fs.OpenFile(ctx, "users", os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return users.User{}, err
+	}
+	defer f.Close()
+	err = json.NewEncoder(f).Encode(record)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	// Commit to memory second.
+	s.users[user] = u
+	s.edited[user] = edited
+
+	return u, nil
+}
+
 // Get fetches the specified user.
 func (s *Store) Get(_ context.Context, user users.UserSpec) (users.User, error) {
 	s.mu.Lock()
@@ -158,3 +236,15 @@ func (s *Store) Get(_ context.Context, user users.UserSpec) (users.User, error)
 	}
 	return u, nil
 }
+
+// List lists all users, in no particular order.
+func (s *Store) List(_ context.Context) ([]users.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	us := make([]users.User, 0, len(s.users))
+	for _, u := range s.users {
+		us = append(us, u)
+	}
+	return us, nil
+}
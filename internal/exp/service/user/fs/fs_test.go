@@ -0,0 +1,344 @@
+package fs_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/shurcooL/home/internal/exp/service/user/fs"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/webdav"
+)
+
+func TestEdit(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "userfs_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tempFS := webdav.Dir(tempDir)
+	s, err := fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign in a user for the first time.
+	signedIn := users.User{
+		UserSpec:    users.UserSpec{Domain: "example.org"},
+		CanonicalMe: "https://example.org/",
+		Login:       "example.org",
+		Name:        "Original Name",
+		AvatarURL:   "https://example.org/avatar.png",
+		HTMLURL:     "https://example.org/",
+	}
+	user, err := s.InsertByCanonicalMe(context.Background(), signedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Invalid edits are rejected.
+	for _, er := range []fs.EditRequest{
+		{Email: str("not an email")},
+		{Email: str("Gopher <gopher@example.org>")},
+		{AvatarURL: str("")},
+		{AvatarURL: str("javascript:alert(1)")},
+		{AvatarURL: str("/usercontent/../secret")},
+		{AvatarURL: str("/usercontent/2@example.org/avatar.png")},
+		{AvatarURL: str("/usercontent/1@example.org/../2@example.org/avatar.png")},
+		{AvatarURL: str("/usercontent/1@example.org/")},
+		{HTMLURL: str("example.org")},
+		{Name: str("Line\nBreak")},
+	} {
+		_, err := s.Edit(context.Background(), user.UserSpec, er)
+		if _, ok := err.(fs.InvalidEditError); !ok {
+			t.Errorf("Edit(%+v): got error %v, want fs.InvalidEditError", er, err)
+		}
+	}
+
+	// Edit the user's profile.
+	edited, err := s.Edit(context.Background(), user.UserSpec, fs.EditRequest{
+		Name:      str(" New Name "),
+		Email:     str("gopher@example.org"),
+		AvatarURL: str("/usercontent/1@example.org/avatar.png"),
+	})
+	if err != nil {
+		t.Fatal("Edit:", err)
+	}
+	want := user
+	want.Name = "New Name"
+	want.Email = "gopher@example.org"
+	want.AvatarURL = "/usercontent/1@example.org/avatar.png"
+	if !reflect.DeepEqual(edited, want) {
+		t.Errorf("after Edit:\ngot:  %+v\nwant: %+v", edited, want)
+	}
+	if got, err := s.Get(context.Background(), user.UserSpec); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get after Edit:\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// Signing in again keeps edited fields, but updates others.
+	signedIn.HTMLURL = "https://example.org/about"
+	user, err = s.InsertByCanonicalMe(context.Background(), signedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.HTMLURL = "https://example.org/about"
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("after sign in:\ngot:  %+v\nwant: %+v", user, want)
+	}
+
+	// Edits persist across store reloads.
+	s, err = fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(context.Background(), user.UserSpec); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get after reload:\ngot:  %+v\nwant: %+v", got, want)
+	}
+	user, err = s.InsertByCanonicalMe(context.Background(), signedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("after sign in after reload:\ngot:  %+v\nwant: %+v", user, want)
+	}
+
+	// Editing a user that doesn't exist.
+	_, err = s.Edit(context.Background(), users.UserSpec{ID: 123, Domain: "example.org"}, fs.EditRequest{Name: str("Name")})
+	if !os.IsNotExist(err) {
+		t.Errorf("Edit of nonexistent user: got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestEmails(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "userfs_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tempFS := webdav.Dir(tempDir)
+	s, err := fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var us []users.User
+	for _, domain := range []string{"example.org", "example.com"} {
+		u, err := s.InsertByCanonicalMe(context.Background(), users.User{
+			UserSpec:    users.UserSpec{Domain: domain},
+			CanonicalMe: "https://" + domain + "/",
+			Login:       domain,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		us = append(us, u)
+	}
+	alice, bob := us[0], us[1]
+
+	// Invalid addresses are rejected.
+	if _, err := s.AddEmail(context.Background(), alice.UserSpec, "Gopher <gopher@example.org>"); err == nil {
+		t.Error("AddEmail with invalid address: got nil error, want non-nil")
+	}
+
+	// Unverified addresses aren't used to look up users.
+	token, err := s.AddEmail(context.Background(), alice.UserSpec, "Gopher@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetByVerifiedEmail(context.Background(), "gopher@example.org"); !os.IsNotExist(err) {
+		t.Errorf("GetByVerifiedEmail before verification: got error %v, want os.ErrNotExist", err)
+	}
+
+	// Another user can add the same address, but a token
+	// for one user doesn't verify it for another.
+	bobToken, err := s.AddEmail(context.Background(), bob.UserSpec, "gopher@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.VerifyEmail(context.Background(), bob.UserSpec, token); !os.IsNotExist(err) {
+		t.Errorf("VerifyEmail with another user's token: got error %v, want os.ErrNotExist", err)
+	}
+
+	// Verify the address.
+	e, err := s.VerifyEmail(context.Background(), alice.UserSpec, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (fs.Email{Address: "Gopher@example.org", Verified: true}); e != want {
+		t.Errorf("VerifyEmail: got %+v, want %+v", e, want)
+	}
+	if _, err := s.VerifyEmail(context.Background(), alice.UserSpec, token); !os.IsNotExist(err) {
+		t.Errorf("VerifyEmail with used token: got error %v, want os.ErrNotExist", err)
+	}
+	if got, err := s.GetByVerifiedEmail(context.Background(), "GOPHER@example.org"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, alice) {
+		t.Errorf("GetByVerifiedEmail: got %+v, want %+v", got, alice)
+	}
+
+	// Once verified, the address can't be verified or added by another user.
+	if _, err := s.VerifyEmail(context.Background(), bob.UserSpec, bobToken); !os.IsExist(err) {
+		t.Errorf("VerifyEmail of address verified by another user: got error %v, want os.ErrExist", err)
+	}
+	if _, err := s.AddEmail(context.Background(), bob.UserSpec, "gopher@example.org"); !os.IsExist(err) {
+		t.Errorf("AddEmail of address verified by another user: got error %v, want os.ErrExist", err)
+	}
+	if _, err := s.AddEmail(context.Background(), alice.UserSpec, "other@example.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Emails persist across store reloads.
+	s, err = fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emails, err := s.ListEmails(context.Background(), alice.UserSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []fs.Email{{Address: "Gopher@example.org", Verified: true}, {Address: "other@example.org"}}; !reflect.DeepEqual(emails, want) {
+		t.Errorf("ListEmails after reload:\ngot:  %+v\nwant: %+v", emails, want)
+	}
+	if _, err := s.GetByVerifiedEmail(context.Background(), "gopher@example.org"); err != nil {
+		t.Errorf("GetByVerifiedEmail after reload: %v", err)
+	}
+
+	// Removing the address stops it from being used to look up users,
+	// and lets another user verify it.
+	err = s.RemoveEmail(context.Background(), alice.UserSpec, "gopher@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetByVerifiedEmail(context.Background(), "gopher@example.org"); !os.IsNotExist(err) {
+		t.Errorf("GetByVerifiedEmail after RemoveEmail: got error %v, want os.ErrNotExist", err)
+	}
+	if err := s.RemoveEmail(context.Background(), alice.UserSpec, "gopher@example.org"); !os.IsNotExist(err) {
+		t.Errorf("RemoveEmail of removed address: got error %v, want os.ErrNotExist", err)
+	}
+	if _, err := s.VerifyEmail(context.Background(), bob.UserSpec, bobToken); err != nil {
+		t.Errorf("VerifyEmail of address removed by another user: %v", err)
+	}
+	s, err = fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetByVerifiedEmail(context.Background(), "gopher@example.org"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, bob) {
+		t.Errorf("GetByVerifiedEmail after reload: got %+v, want %+v", got, bob)
+	}
+}
+
+func TestSigningKeys(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "userfs_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	tempFS := webdav.Dir(tempDir)
+	s, err := fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var us []users.User
+	for _, domain := range []string{"example.org", "example.com"} {
+		u, err := s.InsertByCanonicalMe(context.Background(), users.User{
+			UserSpec:    users.UserSpec{Domain: domain},
+			CanonicalMe: "https://" + domain + "/",
+			Login:       domain,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		us = append(us, u)
+	}
+	alice, bob := us[0], us[1]
+	token, err := s.AddEmail(context.Background(), alice.UserSpec, "Gopher@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.VerifyEmail(context.Background(), alice.UserSpec, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshKey := fs.SigningKey{Type: "ssh", Key: "ssh-ed25519 AAAA gopher", Fingerprint: "SHA256:ssh"}
+	gpgKey := fs.SigningKey{Type: "gpg", Key: "-----BEGIN PGP PUBLIC KEY BLOCK-----", Fingerprint: "ABCD"}
+
+	// Invalid keys are rejected.
+	for _, k := range []fs.SigningKey{
+		{Type: "x509", Key: "key", Fingerprint: "x509"},
+		{Type: "ssh", Key: "ssh-ed25519 AAAA gopher"},
+		{Type: "ssh", Fingerprint: "SHA256:empty"},
+	} {
+		if err := s.AddSigningKey(context.Background(), alice.UserSpec, k); err == nil {
+			t.Errorf("AddSigningKey(%+v): got nil error, want non-nil", k)
+		}
+	}
+
+	// Add keys, and check a key can't be added by another user.
+	for _, k := range []fs.SigningKey{sshKey, gpgKey} {
+		err := s.AddSigningKey(context.Background(), alice.UserSpec, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddSigningKey(context.Background(), bob.UserSpec, sshKey); !os.IsExist(err) {
+		t.Errorf("AddSigningKey of key added by another user: got error %v, want os.ErrExist", err)
+	}
+
+	// Keys persist across store reloads.
+	s, err = fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.ListSigningKeys(context.Background(), alice.UserSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []fs.SigningKey{gpgKey, sshKey}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListSigningKeys after reload:\ngot:  %+v\nwant: %+v", keys, want)
+	}
+	if got, want := s.ListSigningKeysByVerifiedEmail(context.Background()), map[string][]fs.SigningKey{
+		"gopher@example.org": {gpgKey, sshKey},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListSigningKeysByVerifiedEmail:\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// Removed keys are no longer listed.
+	err = s.RemoveSigningKey(context.Background(), alice.UserSpec, sshKey.Fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RemoveSigningKey(context.Background(), alice.UserSpec, sshKey.Fingerprint); !os.IsNotExist(err) {
+		t.Errorf("RemoveSigningKey of removed key: got error %v, want os.ErrNotExist", err)
+	}
+	s, err = fs.NewStore(tempFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.ListSigningKeysByVerifiedEmail(context.Background()), map[string][]fs.SigningKey{
+		"gopher@example.org": {gpgKey},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListSigningKeysByVerifiedEmail after RemoveSigningKey:\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func str(s string) *string { return &s }
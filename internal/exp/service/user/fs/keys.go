@@ -0,0 +1,191 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shurcooL/users"
+)
+
+// SigningKey is a public key that a user signs git commits and tags with.
+// Signatures made with it are verified for commits and tags whose
+// committer or tagger email is verified by the user.
+type SigningKey struct {
+	Type        string // Key type. Either "gpg" or "ssh".
+	Key         string // ASCII-armored GPG public key, or SSH public key in authorized_keys format.
+	Fingerprint string // Key fingerprint.
+}
+
+// maxSigningKeyLength is the maximum length of a signing key, in bytes.
+const maxSigningKeyLength = 64 << 10
+
+// signingKeyKey identifies a signing key of a user.
+type signingKeyKey struct {
+	User        users.UserSpec
+	Fingerprint string
+}
+
+func (s *Store) loadSigningKeys() error {
+	f, err := s.fs.OpenFile(context.Background(), "keys", os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var k signingKey
+		err := dec.Decode(&k)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		key := signingKeyKey{User: k.UserSpec.UserSpec(), Fingerprint: k.Fingerprint}
+		if k.Removed {
+			delete(s.keys, key)
+			continue
+		}
+		s.keys[key] = k
+	}
+	return nil
+}
+
+// appendSigningKey appends k to the keys file.
+func (s *Store) appendSigningKey(ctx context.Context, k signingKey) error {
+	f, err := s.fs.OpenFile(ctx, "keys", os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(k)
+}
+
+// ListSigningKeys lists signing keys of the specified user,
+// sorted by type and fingerprint.
+func (s *Store) ListSigningKeys(_ context.Context, user users.UserSpec) ([]SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return nil, os.ErrNotExist
+	}
+	var keys []SigningKey
+	for key, k := range s.keys {
+		if key.User != user {
+			continue
+		}
+		keys = append(keys, SigningKey{Type: k.Type, Key: k.Key, Fingerprint: k.Fingerprint})
+	}
+	sortSigningKeys(keys)
+	return keys, nil
+}
+
+// AddSigningKey adds a signing key to the specified user.
+// The caller is responsible for parsing the key and computing
+// its fingerprint.
+// It returns os.ErrNotExist if the user doesn't exist,
+// and os.ErrExist if a key with the same fingerprint
+// was already added by any user.
+func (s *Store) AddSigningKey(ctx context.Context, user users.UserSpec, key SigningKey) error {
+	switch {
+	case key.Type != "gpg" && key.Type != "ssh":
+		return fmt.Errorf("signing key type %q is not supported", key.Type)
+	case key.Fingerprint == "":
+		return fmt.Errorf("signing key has no fingerprint")
+	case key.Key == "" || len(key.Key) > maxSigningKeyLength:
+		return fmt.Errorf("signing key must be between 1 and %d bytes long", maxSigningKeyLength)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user]; !ok {
+		return os.ErrNotExist
+	}
+	for k := range s.keys {
+		if k.Fingerprint == key.Fingerprint {
+			return os.ErrExist
+		}
+	}
+	k := signingKey{
+		UserSpec:    fromUserSpec(user),
+		Type:        key.Type,
+		Key:         key.Key,
+		Fingerprint: key.Fingerprint,
+		Added:       time.Now().UTC(),
+	}
+
+	// Commit to storage first, returning error on failure.
+	err := s.appendSigningKey(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	// Commit to memory second.
+	s.keys[signingKeyKey{User: user, Fingerprint: key.Fingerprint}] = k
+
+	return nil
+}
+
+// RemoveSigningKey removes the signing key with the specified
+// fingerprint from the specified user.
+// It returns os.ErrNotExist if the user doesn't have that key.
+func (s *Store) RemoveSigningKey(ctx context.Context, user users.UserSpec, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := signingKeyKey{User: user, Fingerprint: fingerprint}
+	k, ok := s.keys[key]
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	// Commit to storage first, returning error on failure.
+	err := s.appendSigningKey(ctx, signingKey{UserSpec: k.UserSpec, Fingerprint: k.Fingerprint, Removed: true})
+	if err != nil {
+		return err
+	}
+
+	// Commit to memory second.
+	delete(s.keys, key)
+
+	return nil
+}
+
+// ListSigningKeysByVerifiedEmail lists signing keys of all users,
+// keyed by each email address verified by their owner in lower case.
+// Users without signing keys are omitted.
+func (s *Store) ListSigningKeysByVerifiedEmail(_ context.Context) map[string][]SigningKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userKeys := make(map[users.UserSpec][]SigningKey)
+	for key, k := range s.keys {
+		userKeys[key.User] = append(userKeys[key.User], SigningKey{Type: k.Type, Key: k.Key, Fingerprint: k.Fingerprint})
+	}
+	for _, ks := range userKeys {
+		sortSigningKeys(ks)
+	}
+	keys := make(map[string][]SigningKey)
+	for address, user := range s.verified {
+		if len(userKeys[user]) == 0 {
+			continue
+		}
+		keys[address] = userKeys[user]
+	}
+	return keys
+}
+
+func sortSigningKeys(keys []SigningKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Type != keys[j].Type {
+			return keys[i].Type < keys[j].Type
+		}
+		return keys[i].Fingerprint < keys[j].Fingerprint
+	})
+}
@@ -1,14 +1,24 @@
 package fs
 
-import "github.com/shurcooL/users"
+import (
+	"time"
+
+	"github.com/shurcooL/users"
+)
 
 // Tree layout:
 //
 // 	root
-// 	└── users (newline separated JSON stream of user objects)
+// 	├── users (newline separated JSON stream of user objects)
+// 	├── emails (newline separated JSON stream of email objects)
+// 	└── keys (newline separated JSON stream of signing key objects)
 //
 // There may be multiple entries with the same
 // user spec. Later entries take precedence.
+// The same applies to emails with the same
+// user spec and (case-insensitive) address,
+// and to signing keys with the same user spec
+// and fingerprint.
 
 // user is an on-disk representation of users.User.
 type user struct {
@@ -24,6 +34,11 @@ type user struct {
 	HTMLURL   string `json:",omitempty"`
 
 	SiteAdmin bool `json:",omitempty"`
+
+	// Edited lists profile fields that were edited by the user
+	// (one of "Name", "Email", "AvatarURL", "HTMLURL"). They're
+	// kept when the user is updated by InsertByCanonicalMe.
+	Edited []string `json:",omitempty"`
 }
 
 func fromUser(u users.User) user {
@@ -68,6 +83,29 @@ func (u user) User() users.User {
 	}
 }
 
+// email is an on-disk representation of an additional email address of a user.
+type email struct {
+	UserSpec userSpec
+	Address  string
+
+	Verified  bool      `json:",omitempty"`
+	TokenHash string    `json:",omitempty"` // Hex-encoded SHA-256 hash of verification token, if not verified.
+	Created   time.Time // Time the verification token was issued.
+
+	Removed bool `json:",omitempty"` // Address was removed.
+}
+
+// signingKey is an on-disk representation of a signing key of a user.
+type signingKey struct {
+	UserSpec    userSpec
+	Type        string `json:",omitempty"`
+	Key         string `json:",omitempty"`
+	Fingerprint string
+	Added       time.Time `json:",omitempty"`
+
+	Removed bool `json:",omitempty"` // Key was removed.
+}
+
 // userSpec is an on-disk representation of users.UserSpec.
 type userSpec struct {
 	ID     uint64
@@ -20,12 +20,24 @@ func HasImportPathSeparator(path string) bool {
 	return strings.IndexByte(path, importPathSeparator) != -1
 }
 
-func PkgIndex(pkgPath string) string     { return pkgPath }
-func PkgLicense(pkgPath string) string   { return pkgPath + "$file/LICENSE" }
-func PkgHistory(pkgPath string) string   { return pkgPath + "$history" }
-func PkgCommit(pkgPath string) string    { return pkgPath + "$commit" }
-func RepoIndex(repoPath string) string   { return repoPath + "/..." }
-func RepoHistory(repoPath string) string { return repoPath + "/...$history" }
-func RepoCommit(repoPath string) string  { return repoPath + "/...$commit" }
-func RepoIssues(repoPath string) string  { return repoPath + "/...$issues" }
-func RepoChanges(repoPath string) string { return repoPath + "/...$changes" }
+func PkgIndex(pkgPath string) string         { return pkgPath }
+func PkgVersion(pkgPath, v string) string    { return pkgPath + "@" + v }
+func PkgLicense(pkgPath, file string) string { return pkgPath + "$file/" + file }
+func PkgHistory(pkgPath string) string       { return pkgPath + "$history" }
+func PkgCommit(pkgPath string) string        { return pkgPath + "$commit" }
+func PkgInsights(pkgPath string) string      { return pkgPath + "$insights" }
+func PkgImports(pkgPath string) string       { return pkgPath + "$imports" }
+func PkgImportedBy(pkgPath string) string    { return pkgPath + "$importedby" }
+func RepoIndex(repoPath string) string       { return repoPath + "/..." }
+func RepoHistory(repoPath string) string     { return repoPath + "/...$history" }
+func RepoCommit(repoPath string) string      { return repoPath + "/...$commit" }
+func RepoIssues(repoPath string) string      { return repoPath + "/...$issues" }
+func RepoChanges(repoPath string) string     { return repoPath + "/...$changes" }
+func RepoActivity(repoPath string) string    { return repoPath + "/...$activity" }
+func RepoInsights(repoPath string) string    { return repoPath + "/...$insights" }
+func RepoBranches(repoPath string) string    { return repoPath + "/...$branches" }
+func RepoTags(repoPath string) string        { return repoPath + "/...$tags" }
+func RepoCompare(repoPath string) string     { return repoPath + "/...$compare" }
+func RepoBlame(repoPath string) string       { return repoPath + "/...$blame" }
+func RepoArchive(repoPath string) string     { return repoPath + "/...$archive" }
+func RepoSettings(repoPath string) string    { return repoPath + "/...$settings" }
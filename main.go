@@ -37,22 +37,35 @@ import (
 	"github.com/shurcooL/httpgzip"
 	"github.com/shurcooL/issues"
 	"github.com/shurcooL/users"
+	"golang.org/x/mod/sumdb"
 	"golang.org/x/net/webdav"
 )
 
 var (
-	httpFlag          = flag.String("http", ":8080", "Listen for HTTP connections on this address.")
-	metricsHTTPFlag   = flag.String("metrics-http", "", "Listen for metrics HTTP connections on this address, if any.")
-	secureCookieFlag  = flag.Bool("secure-cookie", false, "Value of cookie attribute Secure.")
-	storeDirFlag      = flag.String("store-dir", filepath.Join(os.TempDir(), "home-store"), "Directory of home store (required).")
-	stateFileFlag     = flag.String("state-file", "", "Optional path to file to save/load state (file is deleted after loading).")
-	analyticsFileFlag = flag.String("analytics-file", "", "Optional path to file containing analytics HTML to insert at the beginning of <head>.")
-	noRobotsFlag      = flag.Bool("no-robots", false, "Disallow all robots on all pages.")
-	siteNameFlag      = flag.String("site-name", "home (local devel)", "Name of site, displayed on sign in page.")
-	indieauthMeFlag   = indieauth.MeFlag("indieauth-me", "", "Canonical IndieAuth 'me' user profile URL for this home instance, or the empty string to disable the IndieAuth authorization endpoint. See https://indieauth.spec.indieweb.org/#user-profile-url.")
-	githubRelMeFlag   = flag.String("github-rel-me", "dmitshur", "GitHub username to advertise in a rel='me' link.")
-	fetchFuncURLFlag  = flag.String("fetch-func-url", "", "Optional URL to FetchService function.")
-	fetchKeyFileFlag  = flag.String("fetch-key-file", "", "Optional path to key file for FetchService function.")
+	httpFlag           = flag.String("http", ":8080", "Listen for HTTP connections on this address.")
+	metricsHTTPFlag    = flag.String("metrics-http", "", "Listen for metrics HTTP connections on this address, if any.")
+	secureCookieFlag   = flag.Bool("secure-cookie", false, "Value of cookie attribute Secure.")
+	storeDirFlag       = flag.String("store-dir", filepath.Join(os.TempDir(), "home-store"), "Directory of home store (required).")
+	stateFileFlag      = flag.String("state-file", "", "Optional path to file to save/load state (file is deleted after loading).")
+	analyticsFileFlag  = flag.String("analytics-file", "", "Optional path to file containing analytics HTML to insert at the beginning of <head>.")
+	noRobotsFlag       = flag.Bool("no-robots", false, "Disallow all robots on all pages.")
+	siteNameFlag       = flag.String("site-name", "home (local devel)", "Name of site, displayed on sign in page.")
+	indieauthMeFlag    = indieauth.MeFlag("indieauth-me", "", "Canonical IndieAuth 'me' user profile URL for this home instance, or the empty string to disable the IndieAuth authorization endpoint. See https://indieauth.spec.indieweb.org/#user-profile-url.")
+	githubRelMeFlag    = flag.String("github-rel-me", "dmitshur", "GitHub username to advertise in a rel='me' link.")
+	fetchFuncURLFlag   = flag.String("fetch-func-url", "", "Optional URL to FetchService function.")
+	fetchKeyFileFlag   = flag.String("fetch-key-file", "", "Optional path to key file for FetchService function.")
+	moduleUpstreamFlag = flag.String("module-upstream", "", "Optional URL of upstream module proxy (e.g., https://proxy.golang.org) to cache modules not in the store from.")
+	smtpAddrFlag       = flag.String("smtp-addr", "", "Optional SMTP server address (host:port) to send email verification messages via. If empty, verification links are logged.")
+	emailFromFlag      = flag.String("email-from", "", "Email address to send email verification messages from.")
+	siteURLFlag        = flag.String("site-url", "http://localhost:8080", "Canonical base URL of the site (e.g., https://dmitri.shuralyov.com), used to build links in email verification messages.")
+	sumdbNameFlag      = flag.String("sumdb-name", "", "Optional name of checksum database for modules in the store (e.g., dmitri.shuralyov.com/api/sumdb), or the empty string to disable it.")
+	mirrorFetchFlag    = flag.Duration("mirror-fetch", time.Hour, "Interval at which to fetch mirror repositories from upstream, or 0 to fetch them on demand only.")
+	vulnScanFlag       = flag.Duration("vuln-scan", 24*time.Hour, "Interval at which to scan modules in the store for dependencies with known vulnerabilities, or 0 to disable scanning. The OSV vulnerability database is read from the vulndb directory of the store.")
+	externalFetchFlag  = flag.Duration("external-fetch", 24*time.Hour, "Interval at which to rediscover packages in external repositories registered in the store, or 0 to discover them when they're added only.")
+	userContentGCFlag  = flag.Duration("usercontent-gc", 0, "Interval at which to delete user content that has been orphaned for longer than a grace period, or 0 to delete it from the /admin/usercontent page only.")
+	vanityFileFlag     = flag.String("vanity-file", "", "Optional path to JSON file configuring vanity import path prefixes whose code is hosted elsewhere.")
+	vulnIssuesFlag     = flag.Bool("vuln-issues", false, "File issues for dependencies with known vulnerabilities found by scanning.")
+	requireSignedFlag  = flag.Bool("require-signed", false, "Require commits pushed to master to be signed with a signing key of their committer.")
 )
 
 func init() {
@@ -223,9 +236,9 @@ func run(ctx context.Context, cancel context.CancelFunc, storeDir, stateFile, an
 		initIndieAuth(users, me)
 	}
 
-	usersAPIHandler := httphandler.Users{Users: users}
+	usersAPIHandler := httphandler.Users{Users: users, EditProfile: users.editProfileAPI}
 	http.Handle("/api/userspec", cookieAuth{httputil.ErrorHandler(users, usersAPIHandler.GetAuthenticatedSpec)})
-	http.Handle("/api/user", cookieAuth{httputil.ErrorHandler(users, usersAPIHandler.GetAuthenticated)})
+	http.Handle("/api/user", cookieAuth{httputil.ErrorHandler(users, usersAPIHandler.Authenticated)})
 	http.Handle("/api/user/", cookieAuth{httputil.ErrorHandler(users, usersAPIHandler.Get)})
 
 	reactionsAPIHandler := httphandler.Reactions{Reactions: reactions}
@@ -235,13 +248,27 @@ func run(ctx context.Context, cancel context.CancelFunc, storeDir, stateFile, an
 	eventsAPIHandler := httphandler.Events{Events: events}
 	http.Handle("/api/events/list", headerAuth{httputil.ErrorHandler(users, eventsAPIHandler.List)})
 
-	userContentHandler := userContentHandler{
+	userContentHandler := &userContentHandler{
 		store: webdav.Dir(filepath.Join(storeDir, "usercontent")),
 		users: users,
+		quota: userContentQuota,
 	}
 	http.Handle("/api/usercontent", cookieAuth{httputil.ErrorHandler(users, userContentHandler.Upload)})
 	http.Handle("/usercontent/", http.StripPrefix("/usercontent", cookieAuth{httputil.ErrorHandler(users, userContentHandler.Serve)}))
 
+	profileSettingsHandler := profileSettingsHandler{users: users, notification: notifServiceV2}
+	http.Handle("/settings/profile", cookieAuth{httputil.ErrorHandler(users, profileSettingsHandler.ServeHTTP)})
+	emailSettingsHandler := emailSettingsHandler{
+		users:            users,
+		notification:     notifServiceV2,
+		siteURL:          strings.TrimSuffix(*siteURLFlag, "/"),
+		sendVerification: newVerificationSender(*smtpAddrFlag, *emailFromFlag),
+	}
+	http.Handle("/settings/emails", cookieAuth{httputil.ErrorHandler(users, emailSettingsHandler.ServeHTTP)})
+	http.Handle("/settings/emails/verify", cookieAuth{httputil.ErrorHandler(users, emailSettingsHandler.Verify)})
+	signingKeySettingsHandler := signingKeySettingsHandler{users: users, notification: notifServiceV2}
+	http.Handle("/settings/keys", cookieAuth{httputil.ErrorHandler(users, signingKeySettingsHandler.ServeHTTP)})
+
 	indexHandler := initIndex(events, notifServiceV2, users)
 
 	initAbout(notifServiceV2, users)
@@ -292,23 +319,135 @@ func run(ctx context.Context, cancel context.CancelFunc, storeDir, stateFile, an
 
 	// Code repositories (part 2 of 2).
 	moduleHandler := codepkg.ModuleHandler{Code: code}
+	if *moduleUpstreamFlag != "" {
+		moduleHandler.Cache = &codepkg.ModuleCache{
+			Upstream: strings.TrimSuffix(*moduleUpstreamFlag, "/"),
+			Dir:      filepath.Join(storeDir, "modulecache"),
+		}
+	}
 	http.Handle("/api/module/", http.StripPrefix("/api/module/", httputil.ErrorHandler(nil, moduleHandler.ServeModule)))
+	if *sumdbNameFlag != "" {
+		sumDB, err := codepkg.NewSumDB(filepath.Join(storeDir, "sumdb"), *sumdbNameFlag, codepkg.ModuleHandler{Code: code})
+		if err != nil {
+			return fmt.Errorf("codepkg.NewSumDB: %v", err)
+		}
+		log.Println("checksum database verifier key:", sumDB.VerifierKey)
+		sumDBHandler := http.StripPrefix("/api/sumdb", sumdb.NewServer(sumDB))
+		for _, path := range sumdb.ServerPaths {
+			http.Handle("/api/sumdb"+path, sumDBHandler)
+		}
+		http.HandleFunc("/api/sumdb/key", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, sumDB.VerifierKey+"\n")
+		})
+	}
 	gitUsers, err := initGitUsers(users)
 	if err != nil {
 		return fmt.Errorf("initGitUsers: %v", err)
 	}
+	signatures := codepkg.NewSignatureVerifier(filepath.Join(storeDir, "signingkeys"), gitUsers)
+	var requireSigned *codepkg.SignatureVerifier
+	if *requireSignedFlag {
+		requireSigned = signatures
+	}
 	gitHooksDir := filepath.Join(storeDir, "bin", runtime.GOOS+"_"+runtime.GOARCH, "githook")
-	gitHandler, err := codepkg.NewGitHandler(code, reposDir, gitHooksDir, events, users, gitUsers, func(req *http.Request) *http.Request {
+	gitHandler, err := codepkg.NewGitHandler(code, reposDir, gitHooksDir, events, users, gitUsers, requireSigned, func(req *http.Request) *http.Request {
 		session, _ := lookUpSessionViaBasicAuth(req, users)
 		return withSession(req, session)
 	})
 	if err != nil {
 		return fmt.Errorf("code.NewGitHandler: %v", err)
 	}
-	codeHandler := codeHandler{code, reposDir, issuesApp, changesApp, issuesService, changeService, notifServiceV2, users, gitUsers}
-	servePackagesMaybe := initPackages(code, notifServiceV2, users)
+	var vulns *codepkg.VulnScanner
+	if *vulnScanFlag > 0 {
+		vulns = &codepkg.VulnScanner{Code: code, DBDir: filepath.Join(storeDir, "vulndb")}
+		if *vulnIssuesFlag {
+			vulns.FileIssue = newVulnIssueFiler(issuesService, dmitshur)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vulns.Run(ctx, *vulnScanFlag)
+		}()
+	}
+	codeHandler := codeHandler{
+		code:         code,
+		reposDir:     reposDir,
+		archivesDir:  filepath.Join(storeDir, "archives"),
+		docs:         &codepkg.DocCache{Code: code, Dir: filepath.Join(storeDir, "doccache")},
+		vulns:        vulns,
+		issuesApp:    issuesApp,
+		changesApp:   changesApp,
+		issues:       issuesService,
+		change:       changeService,
+		events:       events,
+		notification: notifServiceV2,
+		users:        users,
+		gitUsers:     gitUsers,
+		signatures:   signatures,
+	}
+	external, err := codepkg.NewExternalRegistry(filepath.Join(storeDir, "external"), githubPackages, githubExcludedPackages, users)
+	if err != nil {
+		return fmt.Errorf("code.NewExternalRegistry: %v", err)
+	}
+	servePackagesMaybe := initPackages(code, external, notifServiceV2, users)
+	if *mirrorFetchFlag > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code.RunMirrorFetcher(ctx, *mirrorFetchFlag)
+		}()
+	}
+	if *externalFetchFlag > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			external.Run(ctx, *externalFetchFlag)
+		}()
+	}
+
+	initAction(code, external, users)
+
+	vanityHandler := &vanityHandler{
+		notification: notifServiceV2,
+		users:        users,
+	}
+	if *vanityFileFlag != "" {
+		vanityHandler.imports, err = loadVanityImports(*vanityFileFlag)
+		if err != nil {
+			return fmt.Errorf("loadVanityImports: %v", err)
+		}
+	}
 
-	initAction(code, users)
+	userProfileHandler := userProfileHandler{
+		code:         code,
+		issues:       issuesService,
+		change:       changeService,
+		events:       events,
+		gitUsers:     gitUsers,
+		notification: notifServiceV2,
+		users:        users,
+	}
+	http.Handle("/users/", cookieAuth{httputil.ErrorHandler(users, userProfileHandler.ServeHTTP)})
+
+	userContentGC := &userContentGC{
+		content:      userContentHandler.store,
+		issues:       webdav.Dir(filepath.Join(storeDir, "issues")),
+		changes:      changeService,
+		code:         code,
+		profiles:     users,
+		gracePeriod:  userContentGracePeriod,
+		notification: notifServiceV2,
+		users:        users,
+	}
+	http.Handle("/admin/usercontent", cookieAuth{httputil.ErrorHandler(users, userContentGC.ServeAdmin)})
+	if *userContentGCFlag > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userContentGC.Run(ctx, *userContentGCFlag)
+		}()
+	}
 
 	initTalks(
 		skipDot(http.Dir(filepath.Join(os.Getenv("HOME"), "Dropbox", "Public", "dmitri", "talks"))),
@@ -346,6 +485,10 @@ func run(ctx context.Context, cancel context.CancelFunc, storeDir, stateFile, an
 		if ok := codeHandler.ServeCodeMaybe(w, req); ok {
 			return
 		}
+		// Serve vanity import paths of code hosted elsewhere, if the request matches.
+		if ok := vanityHandler.ServeVanityMaybe(w, req); ok {
+			return
+		}
 		// Serve remaining import path pattern queries, if the request matches.
 		if ok := servePackagesMaybe(w, req); ok {
 			return
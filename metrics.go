@@ -4,6 +4,8 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -12,6 +14,11 @@ import (
 type prometheusMetrics struct {
 	goGetRequestsTotal *prometheus.CounterVec
 	githubRateLimit    *prometheus.GaugeVec
+
+	// goGetRequests mirrors goGetRequestsTotal
+	// so that it can be displayed on insights pages.
+	goGetRequestsMu sync.Mutex
+	goGetRequests   map[string]uint64 // Import path -> count.
 }
 
 var metrics = &prometheusMetrics{
@@ -23,10 +30,28 @@ var metrics = &prometheusMetrics{
 		Name: "home_github_rate_limit",
 		Help: "Remaining requests the GitHub client can make this hour.",
 	}, []string{"client"}),
+	goGetRequests: make(map[string]uint64),
 }
 
 func (m *prometheusMetrics) IncGoGetRequestsTotal(importPath string) {
 	m.goGetRequestsTotal.With(prometheus.Labels{"path": importPath}).Inc()
+	m.goGetRequestsMu.Lock()
+	m.goGetRequests[importPath]++
+	m.goGetRequestsMu.Unlock()
+}
+
+// GoGetRequestsWithin returns the total number of ?go-get=1 requests
+// since process start for import path root and all import paths within it.
+func (m *prometheusMetrics) GoGetRequestsWithin(root string) uint64 {
+	m.goGetRequestsMu.Lock()
+	defer m.goGetRequestsMu.Unlock()
+	var total uint64
+	for importPath, n := range m.goGetRequests {
+		if importPath == root || strings.HasPrefix(importPath, root+"/") {
+			total += n
+		}
+	}
+	return total
 }
 
 func (m *prometheusMetrics) SetGitHubRateLimit(clientName string, remaining int) {
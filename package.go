@@ -15,9 +15,11 @@ import (
 	"github.com/shurcooL/home/exp/vec/attr"
 	"github.com/shurcooL/home/exp/vec/elem"
 	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
 	"github.com/shurcooL/home/internal/exp/service/change"
 	issues "github.com/shurcooL/home/internal/exp/service/issue"
 	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
 	"github.com/shurcooL/htmlg"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/html"
@@ -25,9 +27,13 @@ import (
 
 // packageHandler is a handler for a Go package index page.
 type packageHandler struct {
-	Repo repoInfo
-	Pkg  pkgInfo
+	Repo    repoInfo
+	Pkg     pkgInfo
+	Dir     *code.Directory
+	Version string // Module version to display documentation of, or empty string for latest.
 
+	docs         *code.DocCache
+	vulns        *code.VulnScanner // May be nil.
 	issues       issueCounter
 	change       changeCounter
 	notification notification.Service
@@ -44,11 +50,31 @@ var packageHTML = template.Must(template.New("").Parse(`<html>
 	</head>
 	<body>`))
 
+var versionsHTML = template.Must(template.New("").Parse(`<details class="versions"><summary>Version: {{with .Version}}{{.}}{{else}}latest{{end}}</summary><ul>
+	<li><a href="{{.LatestURL}}">latest</a></li>
+	{{- range .Versions}}
+	<li><a href="{{.URL}}">{{.Version}}</a></li>
+	{{- end}}
+</ul></details>`))
+
 func (h *packageHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
 	if err := httputil.AllowMethods(req, http.MethodGet, http.MethodHead); err != nil {
 		return err
 	}
 
+	if h.Version != "" {
+		// Use documentation computed from the commit that the module version resolves to.
+		p, err := h.docs.GetPackage(req.Context(), h.Dir, h.Version)
+		if err != nil {
+			return err
+		}
+		h.Pkg.Name, h.Pkg.DocHTML, h.Pkg.Doc = p.Name, p.DocHTML, p.Doc
+	}
+	versions, err := h.docs.ListVersions(req.Context(), h.Dir)
+	if err != nil {
+		return err
+	}
+
 	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
 	if err != nil {
 		log.Println(err)
@@ -128,22 +154,58 @@ func (h *packageHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) err
 	if err != nil {
 		return err
 	}
+	if len(versions) > 0 {
+		err = h.renderVersions(w, versions)
+		if err != nil {
+			return err
+		}
+	}
+	if findings := packageFindings(h.vulns.Findings(h.Repo.Spec), h.Dir); len(findings) > 0 && h.Version == "" {
+		err = htmlg.RenderComponents(w, vulnBadge{Findings: findings})
+		if err != nil {
+			return err
+		}
+	}
 	if h.Pkg.DocHTML != "" {
 		err = vec.RenderHTML(w, elem.H3("Overview"), vec.UnsafeHTML(h.Pkg.DocHTML))
 		if err != nil {
 			return err
 		}
 	}
+	goGet := "go get -u " + h.Pkg.Spec
+	if h.Version != "" {
+		goGet = "go get " + h.Pkg.Spec + "@" + h.Version
+	}
 	err = vec.RenderHTML(w,
 		elem.H3("Installation"),
-		elem.P(elem.Pre("go get -u "+h.Pkg.Spec)),
+		elem.P(elem.Pre(goGet)),
+	)
+	if err != nil {
+		return err
+	}
+	if h.Pkg.Doc != nil && !h.Pkg.IsCommand() {
+		err = renderPackageDoc(w, h.Pkg.Spec, h.Pkg.Doc)
+		if err != nil {
+			return err
+		}
+	}
+	err = vec.RenderHTML(w,
 		elem.H3(elem.A("Documentation", attr.Href("https://pkg.go.dev/"+h.Pkg.Spec))),
 		elem.H3(elem.A("Code", attr.Href("https://gotools.org/"+h.Pkg.Spec))),
-		elem.H3(elem.A("License", attr.Href(h.Pkg.LicenseURL))),
+		elem.H3(elem.A("Imports", attr.Href(route.PkgImports(h.Pkg.Spec[len("dmitri.shuralyov.com"):])))),
+		elem.H3(elem.A("Imported By", attr.Href(route.PkgImportedBy(h.Pkg.Spec[len("dmitri.shuralyov.com"):])))),
 	)
 	if err != nil {
 		return err
 	}
+	if h.Pkg.LicenseName != "" {
+		err = vec.RenderHTML(w, elem.H3(elem.A("License", attr.Href(h.Pkg.LicenseURL)), " ("+h.Pkg.LicenseName+")"))
+	} else {
+		err = vec.RenderHTML(w, elem.H3(elem.A("License", attr.Href(h.Pkg.LicenseURL))))
+	}
+	if err != nil {
+		return err
+	}
 
 	_, err = io.WriteString(w, `</div>`)
 	if err != nil {
@@ -153,3 +215,26 @@ func (h *packageHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) err
 	_, err = io.WriteString(w, `</body></html>`)
 	return err
 }
+
+// renderVersions renders a selector of module versions to w.
+// Versions are ordered as returned by code.DocCache.ListVersions.
+func (h *packageHandler) renderVersions(w io.Writer, versions []string) error {
+	pkgPath := h.Pkg.Spec[len("dmitri.shuralyov.com"):]
+	type version struct {
+		Version string
+		URL     string
+	}
+	var vs []version
+	for _, v := range versions {
+		vs = append(vs, version{Version: v, URL: route.PkgVersion(pkgPath, v)})
+	}
+	return versionsHTML.Execute(w, struct {
+		Version   string
+		LatestURL string
+		Versions  []version
+	}{
+		Version:   h.Version,
+		LatestURL: route.PkgIndex(pkgPath),
+		Versions:  vs,
+	})
+}
@@ -30,7 +30,7 @@ var packagesHTML = template.Must(template.New("").Parse(`<html>
 	</head>
 	<body>`))
 
-func initPackages(code *code.Service, notification notification.Service, usersService users.Service) func(w http.ResponseWriter, req *http.Request) bool {
+func initPackages(code *code.Service, external *code.ExternalRegistry, notification notification.Service, usersService users.Service) func(w http.ResponseWriter, req *http.Request) bool {
 	packagesHandler := cookieAuth{httputil.ErrorHandler(usersService, func(w http.ResponseWriter, req *http.Request) error {
 		if req.Method != "GET" {
 			return httperror.Method{Allowed: []string{"GET"}}
@@ -102,7 +102,7 @@ func initPackages(code *code.Service, notification notification.Service, usersSe
 		if err != nil {
 			return err
 		}
-		err = renderPackages(w, expandPattern(dsDirs, githubPackages, importPathPattern)) // We know that "dmitri.shuralyov.com/..." comes before "github.com/...", that's why dsDirs, githubPackages are guaranteed to be in alphabetical order.
+		err = renderPackages(w, expandPattern(dsDirs, external.List(), importPathPattern)) // We know that "dmitri.shuralyov.com/..." comes before "github.com/...", that's why dsDirs, external packages are guaranteed to be in alphabetical order.
 		if err != nil {
 			return err
 		}
@@ -142,6 +142,7 @@ func renderPackages(w io.Writer, packages []*code.Directory) error {
 			<tr>
 				<th>Path</th>
 				<th>Synopsis</th>
+				<th>License</th>
 			</tr>
 		</thead>
 		<tbody>`)
@@ -152,6 +153,7 @@ func renderPackages(w io.Writer, packages []*code.Directory) error {
 		err := html.Render(w, htmlg.TR(
 			htmlg.TD(htmlg.A(p.ImportPath, packageHomeURL(p.ImportPath))),
 			htmlg.TD(htmlg.Text(p.Package.Synopsis)),
+			htmlg.TD(htmlg.Text(licenseName(p))),
 		))
 		if err != nil {
 			return err
@@ -173,20 +175,11 @@ func packageHomeURL(importPath string) string {
 	}
 }
 
-// githubPackages is a hardcoded list Go packages on github.com,
+// githubPackages is a list of Go packages on github.com,
 // specifically, a subset of packages made by dmitshur, excluding less noteworthy ones.
-// It's sorted by import path.
+// It's used to seed the registry of external packages when it's first created,
+// and is sorted by import path.
 var githubPackages = []*code.Directory{
-	//{
-	//	ImportPath: "github.com/goxjs/example/motionblur",
-	//	Command:    true,
-	//	Synopsis:   "Render a square with and without motion blur.",
-	//},
-	//{
-	//	ImportPath: "github.com/goxjs/example/triangle",
-	//	Command:    true,
-	//	Synopsis:   "Render a basic triangle.",
-	//},
 	{
 		ImportPath: "github.com/goxjs/gl",
 		RepoRoot:   "github.com/goxjs/gl",
@@ -203,11 +196,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package glutil implements OpenGL utility functions.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/goxjs/gl/test",
-	//	Command:    false,
-	//	Synopsis:   "Package test contains tests for goxjs/gl.",
-	//},
 	{
 		ImportPath: "github.com/goxjs/glfw",
 		RepoRoot:   "github.com/goxjs/glfw",
@@ -216,11 +204,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package glfw experimentally provides a glfw-like API with desktop (via glfw) and browser (via HTML5 canvas) backends.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/goxjs/glfw/test/events",
-	//	Command:    true,
-	//	Synopsis:   "events hooks every available callback and outputs their arguments.",
-	//},
 	{
 		ImportPath: "github.com/goxjs/websocket",
 		RepoRoot:   "github.com/goxjs/websocket",
@@ -229,16 +212,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package websocket is a Go cross-platform implementation of a client for the WebSocket protocol.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store",
-	//	Command:    false,
-	//	Synopsis:   "Package gps defines domain types for Go Package Store.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/assets",
-	//	Command:    false,
-	//	Synopsis:   "Package assets contains assets for Go Package Store.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/Go-Package-Store/cmd/Go-Package-Store",
 		RepoRoot:   "github.com/shurcooL/Go-Package-Store",
@@ -247,56 +220,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Go Package Store displays updates for the Go packages in your GOPATH.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/component",
-	//	Command:    false,
-	//	Synopsis:   "Package component contains Vecty HTML components used by Go Package Store.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/frontend",
-	//	Command:    true,
-	//	Synopsis:   "Command frontend runs on frontend of Go Package Store.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/frontend/action",
-	//	Command:    false,
-	//	Synopsis:   "Package action defines actions that can be applied to the data model in store.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/frontend/model",
-	//	Command:    false,
-	//	Synopsis:   "Package model is a frontend data model for updates.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/frontend/store",
-	//	Command:    false,
-	//	Synopsis:   "Package store is a store for updates.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/presenter",
-	//	Command:    false,
-	//	Synopsis:   "Package presenter defines domain types for Go Package Store presenters.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/presenter/github",
-	//	Command:    false,
-	//	Synopsis:   "Package github provides a GitHub API-powered presenter.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/presenter/gitiles",
-	//	Command:    false,
-	//	Synopsis:   "Package gitiles provides a Gitiles API-powered presenter.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/updater",
-	//	Command:    false,
-	//	Synopsis:   "Package updater contains gps.Updater implementations.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/Go-Package-Store/workspace",
-	//	Command:    false,
-	//	Synopsis:   "Package workspace contains a pipeline for processing a Go workspace.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/Hover",
 		RepoRoot:   "github.com/shurcooL/Hover",
@@ -305,11 +228,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Hover is a work-in-progress port of Hover, a game originally created by Eric Undersander in 2000.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/Hover/track",
-	//	Command:    false,
-	//	Synopsis:   "Package track defines Hover track data structure and provides loading functionality.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/binstale",
 		RepoRoot:   "github.com/shurcooL/binstale",
@@ -318,26 +236,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "binstale tells you whether the binaries in your GOPATH/bin are stale or up to date.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/cmd/dumpargs",
-	//	Command:    true,
-	//	Synopsis:   "dumpargs dumps the command-line arguments.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/cmd/dumpglfw3joysticks",
-	//	Command:    true,
-	//	Synopsis:   "dumpglfw3joysticks dumps state of attached joysticks.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/cmd/dumphttpreq",
-	//	Command:    true,
-	//	Synopsis:   "dumphttpreq dumps incoming HTTP requests with full detail.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/cmd/godocrouter",
-	//	Command:    true,
-	//	Synopsis:   "godocrouter is a reverse proxy that augments a private godoc server instance with global godoc.org instance.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/cmd/goimporters",
 		RepoRoot:   "github.com/shurcooL/cmd",
@@ -378,11 +276,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "jsonfmt pretty-prints JSON from stdin.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/cmd/runestats",
-	//	Command:    true,
-	//	Synopsis:   "runestats prints counts of total and unique runes from stdin.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/component",
 		RepoRoot:   "github.com/shurcooL/component",
@@ -399,16 +292,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "eX0-go is a work in progress Go implementation of eX0.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/eX0/eX0-go/gpc",
-	//	Command:    false,
-	//	Synopsis:   "Package gpc parses GPC format files.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/eX0/eX0-go/packet",
-	//	Command:    false,
-	//	Synopsis:   "Package packet is for TCP and UDP packets used in eX0 networking protocol.",
-	//},
 	{
 		//New:        true,
 		ImportPath: "github.com/shurcooL/events",
@@ -466,11 +349,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package select_menu provides a select menu component.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/frontend/table-of-contents/handler",
-	//	Command:    false,
-	//	Synopsis:   "Package handler registers \"/table-of-contents.{js,css}\" routes on http.DefaultServeMux on init.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/frontend/tabsupport",
 		RepoRoot:   "github.com/shurcooL/frontend",
@@ -512,11 +390,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package githubv4 is a client library for accessing GitHub GraphQL API v4 (https://developer.github.com/v4/).",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/githubv4/example/githubv4dev",
-	//	Command:    true,
-	//	Synopsis:   "githubv4dev is a test program currently being used for developing githubv4 package.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/go-goon",
 		RepoRoot:   "github.com/shurcooL/go-goon",
@@ -777,11 +650,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "gostatus is a command line tool that shows the status of Go repositories.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/gostatus/status",
-	//	Command:    false,
-	//	Synopsis:   "Package status provides a func to check if two repo URLs are equal in the context of Go packages.",
-	//},
 	{
 		//New:        true,
 		ImportPath: "github.com/shurcooL/graphql",
@@ -791,11 +659,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package graphql provides a GraphQL client implementation.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/graphql/example/graphqldev",
-	//	Command:    true,
-	//	Synopsis:   "graphqldev is a test program currently being used for developing graphql package.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/graphql/ident",
 		RepoRoot:   "github.com/shurcooL/graphql",
@@ -812,21 +675,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "gtdo is the source for gotools.org.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/gtdo/assets",
-	//	Command:    false,
-	//	Synopsis:   "Package assets contains assets for gtdo.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/gtdo/gtdo",
-	//	Command:    false,
-	//	Synopsis:   "Package gtdo contains common gtdo-specific consts for backend and frontend.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/gtdo/page",
-	//	Command:    false,
-	//	Synopsis:   "Package page contains code to render pages that can be used from backend and frontend.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/highlight_diff",
 		RepoRoot:   "github.com/shurcooL/highlight_diff",
@@ -851,31 +699,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "home is Dmitri Shuralyov's personal website.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/assets",
-	//	Command:    false,
-	//	Synopsis:   "Package assets contains assets for home.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/component",
-	//	Command:    false,
-	//	Synopsis:   "Package component contains individual components that can render themselves as HTML.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/exp/vec",
-	//	Command:    false,
-	//	Synopsis:   "Package vec provides a vecty-like API for backend HTML rendering.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/exp/vec/attr",
-	//	Command:    false,
-	//	Synopsis:   "Package attr defines functions to set attributes of an HTML node.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/exp/vec/elem",
-	//	Command:    false,
-	//	Synopsis:   "Package elem defines functions to create HTML elements.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/home/http",
 		RepoRoot:   "github.com/shurcooL/home",
@@ -892,11 +715,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package httphandler contains API handlers used by home.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/home/httputil",
-	//	Command:    false,
-	//	Synopsis:   "Package httputil is a custom HTTP framework created specifically for home.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/home/presentdata",
 		RepoRoot:   "github.com/shurcooL/home",
@@ -1027,26 +845,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package issuesapp is a web frontend for an issues service.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/issuesapp/assets",
-	//	Command:    false,
-	//	Synopsis:   "Package assets contains assets for issuesapp.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/issuesapp/common",
-	//	Command:    false,
-	//	Synopsis:   "Package common contains common code for backend and frontend.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/issuesapp/component",
-	//	Command:    false,
-	//	Synopsis:   "Package component contains individual components that can render themselves as HTML.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/issuesapp/frontend",
-	//	Command:    true,
-	//	Synopsis:   "frontend script for issuesapp.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/issuesapp/httpclient",
 		RepoRoot:   "github.com/shurcooL/issuesapp",
@@ -1063,11 +861,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package httphandler contains an API handler for issues.Service.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/issuesapp/httproute",
-	//	Command:    false,
-	//	Synopsis:   "Package httproute contains route paths for httpclient, httphandler.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/ivybrowser",
 		RepoRoot:   "github.com/shurcooL/ivybrowser",
@@ -1124,21 +917,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package notificationsapp is a web frontend for a notifications service.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/notificationsapp/assets",
-	//	Command:    false,
-	//	Synopsis:   "Package assets contains assets for notificationsapp.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/notificationsapp/component",
-	//	Command:    false,
-	//	Synopsis:   "Package component contains individual components that can render themselves as HTML.",
-	//},
-	//{
-	//	ImportPath: "github.com/shurcooL/notificationsapp/frontend",
-	//	Command:    true,
-	//	Synopsis:   "frontend script for notificationsapp.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/notificationsapp/httpclient",
 		RepoRoot:   "github.com/shurcooL/notificationsapp",
@@ -1155,11 +933,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package httphandler contains an API handler for notifications.Service.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/notificationsapp/httproute",
-	//	Command:    false,
-	//	Synopsis:   "Package httproute contains route paths for httpclient, httphandler.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/octicon",
 		RepoRoot:   "github.com/shurcooL/octicon",
@@ -1200,11 +973,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package fs implements reactions.Service using a virtual filesystem.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/reactions/mousemoveclick",
-	//	Command:    true,
-	//	Synopsis:   "mousemoveclick is a script to demonstrate a peculiar browser behavior on iOS.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/resume",
 		RepoRoot:   "github.com/shurcooL/resume",
@@ -1213,11 +981,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "Package resume contains Dmitri Shuralyov's résumé.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/resume/component",
-	//	Command:    false,
-	//	Synopsis:   "Package component contains individual components that can render themselves as HTML.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/sanitized_anchor_name",
 		RepoRoot:   "github.com/shurcooL/sanitized_anchor_name",
@@ -1322,11 +1085,6 @@ var githubPackages = []*code.Directory{
 			Synopsis: "vfsgendev is a convenience tool for using vfsgen in a common development configuration.",
 		},
 	},
-	//{
-	//	ImportPath: "github.com/shurcooL/vfsgen/test",
-	//	Command:    false,
-	//	Synopsis:   "Package test contains tests for virtual filesystem implementation generated by vfsgen.",
-	//},
 	{
 		ImportPath: "github.com/shurcooL/webdavfs/vfsutil",
 		RepoRoot:   "github.com/shurcooL/webdavfs",
@@ -1345,6 +1103,58 @@ var githubPackages = []*code.Directory{
 	},
 }
 
+// githubExcludedPackages is a list of less noteworthy packages
+// in repositories of githubPackages that aren't listed. It's sorted by import path.
+var githubExcludedPackages = []string{
+	"github.com/goxjs/gl/test",
+	"github.com/goxjs/glfw/test/events",
+	"github.com/shurcooL/Go-Package-Store",
+	"github.com/shurcooL/Go-Package-Store/assets",
+	"github.com/shurcooL/Go-Package-Store/component",
+	"github.com/shurcooL/Go-Package-Store/frontend",
+	"github.com/shurcooL/Go-Package-Store/frontend/action",
+	"github.com/shurcooL/Go-Package-Store/frontend/model",
+	"github.com/shurcooL/Go-Package-Store/frontend/store",
+	"github.com/shurcooL/Go-Package-Store/presenter",
+	"github.com/shurcooL/Go-Package-Store/presenter/github",
+	"github.com/shurcooL/Go-Package-Store/presenter/gitiles",
+	"github.com/shurcooL/Go-Package-Store/updater",
+	"github.com/shurcooL/Go-Package-Store/workspace",
+	"github.com/shurcooL/Hover/track",
+	"github.com/shurcooL/cmd/dumpargs",
+	"github.com/shurcooL/cmd/dumpglfw3joysticks",
+	"github.com/shurcooL/cmd/dumphttpreq",
+	"github.com/shurcooL/cmd/godocrouter",
+	"github.com/shurcooL/cmd/runestats",
+	"github.com/shurcooL/eX0/eX0-go/gpc",
+	"github.com/shurcooL/eX0/eX0-go/packet",
+	"github.com/shurcooL/frontend/table-of-contents/handler",
+	"github.com/shurcooL/githubv4/example/githubv4dev",
+	"github.com/shurcooL/gostatus/status",
+	"github.com/shurcooL/graphql/example/graphqldev",
+	"github.com/shurcooL/gtdo/assets",
+	"github.com/shurcooL/gtdo/gtdo",
+	"github.com/shurcooL/gtdo/page",
+	"github.com/shurcooL/home/assets",
+	"github.com/shurcooL/home/component",
+	"github.com/shurcooL/home/exp/vec",
+	"github.com/shurcooL/home/exp/vec/attr",
+	"github.com/shurcooL/home/exp/vec/elem",
+	"github.com/shurcooL/home/httputil",
+	"github.com/shurcooL/issuesapp/assets",
+	"github.com/shurcooL/issuesapp/common",
+	"github.com/shurcooL/issuesapp/component",
+	"github.com/shurcooL/issuesapp/frontend",
+	"github.com/shurcooL/issuesapp/httproute",
+	"github.com/shurcooL/notificationsapp/assets",
+	"github.com/shurcooL/notificationsapp/component",
+	"github.com/shurcooL/notificationsapp/frontend",
+	"github.com/shurcooL/notificationsapp/httproute",
+	"github.com/shurcooL/reactions/mousemoveclick",
+	"github.com/shurcooL/resume/component",
+	"github.com/shurcooL/vfsgen/test",
+}
+
 // expandPattern returns a list of Go packages matched by specified
 // import path pattern, which may have the following forms:
 //
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dmitri.shuralyov.com/html/belt"
+	"github.com/shurcooL/go/timeutil"
+	"github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	activitypkg "github.com/shurcooL/home/internal/exp/service/activity"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	"github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/octicon"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var userProfileHTML = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+	<head>
+{{.AnalyticsHTML}}		<title>{{.User.Login}}</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/index/style.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+.h-card {
+	display: flex;
+	align-items: center;
+	margin-bottom: 30px;
+}
+.h-card img.u-photo {
+	width: 96px;
+	height: 96px;
+	border-radius: 4px;
+	margin-right: 20px;
+}
+.h-card .p-name {
+	font-size: 24px;
+	font-weight: bold;
+}
+.h-card .details {
+	color: #666;
+	font-size: 14px;
+	margin-top: 4px;
+}
+ul.items {
+	list-style-type: none;
+	padding-left: 0;
+}
+ul.items li {
+	margin-bottom: 6px;
+}
+table.calendar {
+	border-spacing: 3px;
+}
+table.calendar td {
+	width: 10px;
+	height: 10px;
+	padding: 0;
+	border-radius: 2px;
+}
+		</style>
+	</head>
+	<body>
+		<div style="max-width: 800px; margin: 0 auto 100px auto;">`))
+
+// userProfileHandler serves public user profile pages at "/users/{Domain}/{ID}".
+type userProfileHandler struct {
+	code         *code.Service
+	issues       issues.Service
+	change       change.Service
+	events       activitypkg.Lister
+	gitUsers     code.GitUsers // Attributes commits counted in the contribution calendar.
+	notification notification.Service
+	users        users.Service
+}
+
+func (h userProfileHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+	us, ok := parseUserProfilePath(req.URL.Path)
+	if !ok {
+		return os.ErrNotExist
+	}
+	user, err := h.users.Get(req.Context(), us)
+	if err != nil {
+		return err
+	}
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		return err
+	}
+
+	// Gather the user's activity and contributions.
+	// Events are kept for a limited time, so contributions
+	// are counted from the commit history of repositories.
+	userEvents, eventsError := h.events.ListEvents(req.Context(), activitypkg.ListOptions{
+		Actor: user.UserSpec,
+		Limit: 1000,
+	})
+	today := time.Now()
+	commitCounts, err := h.code.CountCommits(req.Context(), contributionCalendarStart(today), time.Local, func(email string) bool {
+		u, ok := h.gitUsers.GitUser(email)
+		return ok && u.UserSpec == user.UserSpec
+	})
+	if err != nil {
+		return err
+	}
+	repos, err := h.repos(req.Context())
+	if err != nil {
+		return err
+	}
+	openedIssues, err := h.openedIssues(req.Context(), user.UserSpec, repos)
+	if err != nil {
+		return err
+	}
+	openedChanges, err := h.openedChanges(req.Context(), user.UserSpec, repos)
+	if err != nil {
+		return err
+	}
+	ownedRepos, err := h.ownedRepos(req.Context(), user.UserSpec)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = userProfileHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		User          users.User
+	}{analyticsHTML, user})
+	if err != nil {
+		return err
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+	err = htmlg.RenderComponents(w, component.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	})
+	if err != nil {
+		return err
+	}
+
+	var error string
+	if eventsError != nil {
+		error = "There was a problem getting latest activity."
+		if authenticatedUser.SiteAdmin {
+			error += "\n\n" + eventsError.Error()
+		}
+	}
+	err = htmlg.RenderComponents(w,
+		hCard{User: user},
+		heading{Text: "Contributions"},
+		contributionCalendar{Counts: commitCounts, Today: today},
+		heading{Text: "Repositories"},
+		ownedRepos,
+		heading{Text: "Issues"},
+		openedIssues,
+		heading{Text: "Changes"},
+		openedChanges,
+		heading{Text: "Activity"},
+		activity{Events: userEvents, Error: error, ShowWIP: authenticatedUser.UserSpec == dmitshur},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>`)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</body></html>`)
+	return err
+}
+
+// parseUserProfilePath parses a user profile page path
+// like "/users/example.com/1" into the user spec it's for.
+func parseUserProfilePath(path string) (users.UserSpec, bool) {
+	elems := strings.Split(strings.TrimPrefix(path, "/users/"), "/")
+	if len(elems) != 2 || elems[0] == "" {
+		return users.UserSpec{}, false
+	}
+	id, err := strconv.ParseUint(elems[1], 10, 64)
+	if err != nil || id == 0 {
+		return users.UserSpec{}, false
+	}
+	return users.UserSpec{ID: id, Domain: elems[0]}, true
+}
+
+// repos returns the repositories in the code service.
+func (h userProfileHandler) repos(ctx context.Context) ([]*code.Directory, error) {
+	dirs, err := h.code.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var repos []*code.Directory
+	for _, d := range dirs {
+		if !d.IsRepoRoot() {
+			continue
+		}
+		repos = append(repos, d)
+	}
+	return repos, nil
+}
+
+// openedIssues returns issues opened by user in repos, newest first.
+func (h userProfileHandler) openedIssues(ctx context.Context, user users.UserSpec, repos []*code.Directory) (itemList, error) {
+	type repoIssue struct {
+		issues.Issue
+		Repo string
+	}
+	var is []repoIssue
+	for _, repo := range repos {
+		ris, err := h.issues.List(ctx, issues.RepoSpec{URI: repo.RepoRoot}, issues.IssueListOptions{State: issues.AllStates})
+		if err != nil {
+			return itemList{}, err
+		}
+		for _, i := range ris {
+			if i.User.UserSpec != user {
+				continue
+			}
+			is = append(is, repoIssue{Issue: i, Repo: repo.RepoRoot})
+		}
+	}
+	sort.SliceStable(is, func(i, j int) bool { return is[i].CreatedAt.After(is[j].CreatedAt) })
+	l := itemList{Empty: "No issues opened."}
+	for _, i := range is {
+		l.Items = append(l.Items, belt.Issue{
+			State:   i.State,
+			Title:   i.Repo + ": " + i.Title,
+			HTMLURL: route.RepoIssues(i.Repo[len("dmitri.shuralyov.com"):]) + "/" + strconv.FormatUint(i.ID, 10),
+		})
+	}
+	return l, nil
+}
+
+// openedChanges returns changes opened by user in repos, newest first.
+func (h userProfileHandler) openedChanges(ctx context.Context, user users.UserSpec, repos []*code.Directory) (itemList, error) {
+	type repoChange struct {
+		change.Change
+		Repo string
+	}
+	var cs []repoChange
+	for _, repo := range repos {
+		rcs, err := h.change.List(ctx, repo.RepoRoot, change.ListOptions{Filter: change.FilterAll})
+		if err != nil {
+			return itemList{}, err
+		}
+		for _, c := range rcs {
+			if c.Author.UserSpec != user {
+				continue
+			}
+			cs = append(cs, repoChange{Change: c, Repo: repo.RepoRoot})
+		}
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].CreatedAt.After(cs[j].CreatedAt) })
+	l := itemList{Empty: "No changes opened."}
+	for _, c := range cs {
+		l.Items = append(l.Items, belt.Change{
+			State:   c.State,
+			Title:   c.Repo + ": " + c.Title,
+			HTMLURL: route.RepoChanges(c.Repo[len("dmitri.shuralyov.com"):]) + "/" + strconv.FormatUint(c.ID, 10),
+		})
+	}
+	return l, nil
+}
+
+// ownedRepos returns repositories that are owned by user.
+func (h userProfileHandler) ownedRepos(ctx context.Context, user users.UserSpec) (itemList, error) {
+	repoRoots, err := h.code.ListOwnedRepos(ctx, user)
+	if err != nil {
+		return itemList{}, err
+	}
+	if user == dmitshur {
+		// Repositories that don't record an owner
+		// were created by the site owner.
+		unowned, err := h.code.ListOwnedRepos(ctx, users.UserSpec{})
+		if err != nil {
+			return itemList{}, err
+		}
+		repoRoots = append(repoRoots, unowned...)
+		sort.Strings(repoRoots)
+	}
+	l := itemList{Empty: "No repositories."}
+	for _, repoRoot := range repoRoots {
+		l.Items = append(l.Items, iconLink{
+			Text:      repoRoot,
+			URL:       route.RepoIndex(repoRoot[len("dmitri.shuralyov.com"):]),
+			Black:     true,
+			Icon:      octicon.Repo,
+			IconColor: &RGB{R: 35, G: 35, B: 35}, // Black (not pure).
+		})
+	}
+	return l, nil
+}
+
+// hCard displays a user's profile as an h-card.
+type hCard struct {
+	User users.User
+}
+
+func (c hCard) Render() []*html.Node {
+	name := c.User.Name
+	if name == "" {
+		name = c.User.Login
+	}
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Class.String(), Val: "h-card"}},
+	}
+	div.AppendChild(&html.Node{
+		Type: html.ElementNode, Data: atom.Img.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Class.String(), Val: "u-photo"},
+			{Key: atom.Src.String(), Val: c.User.AvatarURL},
+			{Key: atom.Alt.String(), Val: ""},
+		},
+	})
+	nameNode := htmlg.SpanClass("p-name", htmlg.Text(name))
+	if c.User.HTMLURL != "" {
+		nameNode = &html.Node{
+			Type: html.ElementNode, Data: atom.A.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Class.String(), Val: "p-name u-url"},
+				{Key: atom.Href.String(), Val: c.User.HTMLURL},
+				{Key: atom.Rel.String(), Val: "me"},
+			},
+			FirstChild: htmlg.Text(name),
+		}
+	}
+	details := htmlg.DivClass("details",
+		htmlg.SpanClass("p-nickname", htmlg.Text(c.User.Login)),
+	)
+	if c.User.Email != "" {
+		details.AppendChild(htmlg.Text(" · "))
+		details.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.A.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Class.String(), Val: "u-email"},
+				{Key: atom.Href.String(), Val: "mailto:" + c.User.Email},
+			},
+			FirstChild: htmlg.Text(c.User.Email),
+		})
+	}
+	div.AppendChild(htmlg.Div(nameNode, details))
+	return []*html.Node{div}
+}
+
+// heading is a section heading.
+type heading struct {
+	Text string
+}
+
+func (h heading) Render() []*html.Node {
+	return []*html.Node{htmlg.H3(htmlg.Text(h.Text))}
+}
+
+// itemList is a list of items, or text if it's empty.
+type itemList struct {
+	Items []htmlg.Component
+	Empty string // Text to display if there are no items.
+}
+
+func (l itemList) Render() []*html.Node {
+	if len(l.Items) == 0 {
+		return []*html.Node{htmlg.P(htmlg.Text(l.Empty))}
+	}
+	ul := htmlg.ULClass("items")
+	for _, item := range l.Items {
+		ul.AppendChild(htmlg.LI(item.Render()...))
+	}
+	return []*html.Node{ul}
+}
+
+// contributionCalendar displays the number of contributions per day
+// over the last year, as a grid with a column per week.
+type contributionCalendar struct {
+	Counts map[string]int // Key is date in "2006-01-02" format.
+	Today  time.Time
+}
+
+// contributionCalendarWeeks is the number of weeks
+// displayed by a contribution calendar.
+const contributionCalendarWeeks = 53
+
+// contributionCalendarStart returns the first day displayed
+// by a contribution calendar whose last day is today.
+func contributionCalendarStart(today time.Time) time.Time {
+	return timeutil.StartOfWeek(today).AddDate(0, 0, -7*(contributionCalendarWeeks-1))
+}
+
+func (c contributionCalendar) Render() []*html.Node {
+	const weeks = contributionCalendarWeeks
+	start := contributionCalendarStart(c.Today)
+	table := &html.Node{
+		Type: html.ElementNode, Data: atom.Table.String(),
+		Attr: []html.Attribute{{Key: atom.Class.String(), Val: "calendar"}},
+	}
+	var total int
+	for weekday := 0; weekday < 7; weekday++ {
+		tr := &html.Node{Type: html.ElementNode, Data: atom.Tr.String()}
+		for week := 0; week < weeks; week++ {
+			day := start.AddDate(0, 0, 7*week+weekday)
+			if day.After(c.Today) {
+				break
+			}
+			n := c.Counts[day.Format("2006-01-02")]
+			total += n
+			tr.AppendChild(&html.Node{
+				Type: html.ElementNode, Data: atom.Td.String(),
+				Attr: []html.Attribute{
+					{Key: atom.Style.String(), Val: "background-color: " + contributionColor(n) + ";"},
+					{Key: atom.Title.String(), Val: fmt.Sprintf("%d contributions on %s", n, day.Format("Jan 2, 2006"))},
+				},
+			})
+		}
+		table.AppendChild(tr)
+	}
+	summary := htmlg.P(htmlg.Text(fmt.Sprintf("%d contributions in the last year.", total)))
+	return []*html.Node{table, summary}
+}
+
+// contributionColor returns the color of a day
+// with n contributions in a contribution calendar.
+func contributionColor(n int) string {
+	switch {
+	case n == 0:
+		return "#ebedf0"
+	case n < 3:
+		return "#c6e48b"
+	case n < 6:
+		return "#7bc96f"
+	case n < 10:
+		return "#239a3b"
+	default:
+		return "#196127"
+	}
+}
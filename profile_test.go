@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shurcooL/users"
+)
+
+func TestParseUserProfilePath(t *testing.T) {
+	for _, tt := range []struct {
+		path   string
+		want   users.UserSpec
+		wantOK bool
+	}{
+		{"/users/github.com/1924134", users.UserSpec{ID: 1924134, Domain: "github.com"}, true},
+		{"/users/example.com/1", users.UserSpec{ID: 1, Domain: "example.com"}, true},
+		{"/users/example.com/0", users.UserSpec{}, false},
+		{"/users/example.com/abc", users.UserSpec{}, false},
+		{"/users/example.com", users.UserSpec{}, false},
+		{"/users//1", users.UserSpec{}, false},
+		{"/users/example.com/1/extra", users.UserSpec{}, false},
+	} {
+		got, ok := parseUserProfilePath(tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseUserProfilePath(%q): got (%+v, %v), want (%+v, %v)", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	statepkg "dmitri.shuralyov.com/state"
+	homecomponent "github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	issuescomponent "github.com/shurcooL/issuesapp/component"
+	"github.com/shurcooL/octicon"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// refsHandler is a handler for displaying and deleting
+// branches or tags of a git repository.
+type refsHandler struct {
+	Repo repoInfo
+	Tags bool // Whether to display tags rather than branches.
+
+	code         *code.Service
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+	signatures   *code.SignatureVerifier // May be nil.
+}
+
+var refsHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>Repository {{.Name}} - {{.Title}}</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/commits/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+func (h *refsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet, http.MethodPost); err != nil {
+		return err
+	}
+	if req.Method == http.MethodPost {
+		return h.delete(req)
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	openIssues, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	openChanges, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+
+	var refs []code.Ref
+	title := "Branches"
+	if h.Tags {
+		refs, err = h.code.ListTags(req.Context(), h.Repo.Spec)
+		title = "Tags"
+	} else {
+		refs, err = h.code.ListBranches(req.Context(), h.Repo.Spec)
+	}
+	if err != nil {
+		return err
+	}
+	var signatures map[string]code.Signature
+	if h.Tags {
+		signatures = make(map[string]code.Signature)
+		for _, ref := range refs {
+			signature, err := h.signatures.VerifyTag(req.Context(), h.Repo.Dir, ref.Name)
+			if err != nil {
+				log.Println("refsHandler: VerifyTag:", err)
+				continue
+			}
+			signatures[ref.Name] = signature
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = refsHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		Name          string
+		Title         string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		Name:          path.Base(h.Repo.Spec),
+		Title:         title,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := homecomponent.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, homecomponent.RepositoryTabNav(homecomponent.HistoryTab, h.Repo.Path, h.Repo.Packages, openIssues, openChanges))
+	if err != nil {
+		return err
+	}
+
+	err = htmlg.RenderComponents(w,
+		refBar{RepoPath: h.Repo.Path},
+		refList{
+			Refs:       refs,
+			Tags:       h.Tags,
+			Signatures: signatures,
+			RepoPath:   h.Repo.Path,
+			CanDelete:  authenticatedUser.SiteAdmin,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// delete handles a POST request to delete a branch or tag.
+func (h *refsHandler) delete(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	name, err := getSingleValue(req.PostForm, "name")
+	if err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	if h.Tags {
+		err = h.code.DeleteTag(req.Context(), h.Repo.Spec, name)
+	} else {
+		err = h.code.DeleteBranch(req.Context(), h.Repo.Spec, name)
+	}
+	if err != nil {
+		return err
+	}
+	return httperror.Redirect{URL: req.URL.Path}
+}
+
+// refBar displays the ref whose history is being shown, if any,
+// along with links to branch and tag listings.
+type refBar struct {
+	Ref      string // Ref whose history is being shown, or empty string if none.
+	RepoPath string
+}
+
+func (r refBar) Render() []*html.Node {
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "font-size: 14px; margin-bottom: 20px;"}},
+	}
+	if r.Ref != "" {
+		icon := htmlg.Span(octicon.GitBranch())
+		icon.Attr = append(icon.Attr, html.Attribute{Key: atom.Style.String(), Val: "margin-right: 4px;"})
+		div.AppendChild(icon)
+		div.AppendChild(htmlg.Strong(r.Ref))
+		div.AppendChild(htmlg.Text(" · "))
+	}
+	div.AppendChild(htmlg.A("Branches", route.RepoBranches(r.RepoPath)))
+	div.AppendChild(htmlg.Text(" · "))
+	div.AppendChild(htmlg.A("Tags", route.RepoTags(r.RepoPath)))
+	return []*html.Node{div}
+}
+
+// refList displays a list of branches or tags.
+type refList struct {
+	Refs       []code.Ref
+	Tags       bool                      // Whether Refs are tags rather than branches.
+	Signatures map[string]code.Signature // Signature verification states of tags, keyed by name.
+	RepoPath   string
+	CanDelete  bool // Whether to display delete buttons.
+}
+
+func (l refList) Render() []*html.Node {
+	if len(l.Refs) == 0 {
+		text := "There are no branches."
+		if l.Tags {
+			text = "There are no tags."
+		}
+		return homecomponent.BlankSlate{
+			Content: htmlg.Nodes{htmlg.Text(text)},
+		}.Render()
+	}
+
+	var nodes []*html.Node
+	for _, ref := range l.Refs {
+		nodes = append(nodes, l.renderRef(ref)...)
+	}
+	return []*html.Node{htmlg.DivClass("list-entry-border", nodes...)}
+}
+
+func (l refList) renderRef(ref code.Ref) []*html.Node {
+	div := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "display: flex; align-items: center;"}},
+	}
+
+	nameAndByline := &html.Node{
+		Type: html.ElementNode, Data: atom.Div.String(),
+		Attr: []html.Attribute{{Key: atom.Style.String(), Val: "flex-grow: 1;"}},
+	}
+	{
+		historyURL := route.RepoHistory(l.RepoPath) + "?" + url.Values{"ref": {ref.Name}}.Encode()
+		name := htmlg.Div(
+			&html.Node{
+				Type: html.ElementNode, Data: atom.A.String(),
+				Attr: []html.Attribute{
+					{Key: atom.Class.String(), Val: "black"},
+					{Key: atom.Href.String(), Val: historyURL},
+				},
+				FirstChild: htmlg.Strong(ref.Name),
+			},
+		)
+		nameAndByline.AppendChild(name)
+
+		byline := htmlg.DivClass("gray tiny")
+		byline.Attr = append(byline.Attr, html.Attribute{Key: atom.Style.String(), Val: "margin-top: 2px;"})
+		byline.AppendChild(htmlg.A(ref.Subject, route.RepoCommit(l.RepoPath)+"/"+ref.Commit))
+		byline.AppendChild(htmlg.Text(" by " + ref.AuthorName + " "))
+		htmlg.AppendChildren(byline, issuescomponent.Time{Time: ref.AuthorTime}.Render()...)
+		nameAndByline.AppendChild(byline)
+	}
+	div.AppendChild(nameAndByline)
+
+	htmlg.AppendChildren(div, signatureBadge{Signature: l.Signatures[ref.Name]}.Render()...)
+
+	if ref.Ahead != 0 || ref.Behind != 0 {
+		aheadBehind := htmlg.SpanClass("gray tiny", htmlg.Text(fmt.Sprintf("%d behind | %d ahead", ref.Behind, ref.Ahead)))
+		aheadBehind.Attr = append(aheadBehind.Attr, html.Attribute{Key: atom.Title.String(), Val: "Number of commits behind and ahead of master."})
+		div.AppendChild(aheadBehind)
+	}
+
+	if l.Tags {
+		links := archiveLinks{RepoPath: l.RepoPath, Rev: ref.Name}.Render()
+		for _, n := range links {
+			n.Attr = append(n.Attr, html.Attribute{Key: atom.Style.String(), Val: "margin-left: 12px;"})
+		}
+		htmlg.AppendChildren(div, links...)
+	}
+
+	if !(!l.Tags && ref.Name == "master") {
+		compare := htmlg.A("Compare", route.RepoCompare(l.RepoPath)+"/master..."+ref.Name)
+		compare.Attr = append(compare.Attr, html.Attribute{Key: atom.Style.String(), Val: "font-size: 12px; margin-left: 12px;"})
+		div.AppendChild(compare)
+	}
+
+	if l.CanDelete && !(!l.Tags && ref.Name == "master") {
+		form := &html.Node{
+			Type: html.ElementNode, Data: atom.Form.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Method.String(), Val: "post"},
+				{Key: atom.Style.String(), Val: "margin: 0 0 0 12px;"},
+			},
+		}
+		form.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.Input.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Type.String(), Val: "hidden"},
+				{Key: atom.Name.String(), Val: "name"},
+				{Key: atom.Value.String(), Val: ref.Name},
+			},
+		})
+		form.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.Input.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Type.String(), Val: "submit"},
+				{Key: atom.Value.String(), Val: "Delete"},
+				{Key: atom.Onclick.String(), Val: fmt.Sprintf("return confirm(%q);", "Delete "+ref.Name+"?")},
+			},
+		})
+		div.AppendChild(form)
+	}
+
+	return []*html.Node{htmlg.DivClass("list-entry-body multilist-entry", div)}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	statepkg "dmitri.shuralyov.com/state"
+	"github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+)
+
+// repositorySettingsHandler is a handler for viewing and editing
+// settings of a repository. It's available to site admins only.
+type repositorySettingsHandler struct {
+	Repo repoInfo
+
+	code         *code.Service
+	issues       issueCounter
+	change       changeCounter
+	notification notification.Service
+	users        users.Service
+}
+
+var repositorySettingsHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>Repository {{.Name}} - Settings</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+body, input {
+	font-family: Go;
+}
+label {
+	display: block;
+	margin-top: 15px;
+	font-weight: bold;
+}
+label.inline {
+	display: inline;
+	font-weight: normal;
+}
+input[type="text"] {
+	width: 100%;
+	box-sizing: border-box;
+}
+.error {
+	color: darkred;
+}
+		</style>
+	</head>
+	<body>`))
+
+var repositorySettingsBodyHTML = template.Must(template.New("").Parse(`{{with .Error}}<p class="error">{{.}}</p>{{end}}
+<h3>Settings</h3>
+<form method="post">
+	<input type="hidden" name="action" value="edit">
+	<label for="description">Description</label>
+	<input type="text" id="description" name="description" value="{{.Settings.Description}}">
+	<p><input type="checkbox" id="archived" name="archived" value="true"{{if .Settings.Archived}} checked{{end}}>
+	<label class="inline" for="archived">Archived (read-only, pushes are rejected)</label></p>
+	<p><input type="submit" value="Update settings"></p>
+</form>
+<h3>Rename</h3>
+<p>Requests for the old import path will be redirected to the new one. Repositories with issues or changes can't be renamed.</p>
+<form method="post">
+	<input type="hidden" name="action" value="rename">
+	<input type="text" name="spec" value="{{.Spec}}">
+	<p><input type="submit" value="Rename"></p>
+</form>
+<h3>Delete</h3>
+<p>This permanently deletes the repository. Type <strong>{{.Spec}}</strong> to confirm.</p>
+<form method="post">
+	<input type="hidden" name="action" value="delete">
+	<input type="text" name="spec" value="">
+	<p><input type="submit" value="Delete"></p>
+</form>`))
+
+func (h *repositorySettingsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if err := httputil.AllowMethods(req, http.MethodGet, http.MethodPost); err != nil {
+		return err
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		return err
+	}
+	if !authenticatedUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	var errorText string
+	if req.Method == http.MethodPost {
+		switch err := h.update(req); err.(type) {
+		case nil:
+			return httperror.Redirect{URL: req.URL.Path}
+		case httperror.Redirect, httperror.BadRequest:
+			return err
+		default:
+			errorText = err.Error()
+		}
+	}
+
+	nc, err := h.notification.CountNotifications(req.Context())
+	if err != nil {
+		return err
+	}
+	openIssues, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.StateFilter(statepkg.IssueOpen)})
+	if err != nil {
+		return err
+	}
+	openChanges, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterOpen})
+	if err != nil {
+		return err
+	}
+	settings, err := h.code.GetRepoSettings(req.Context(), h.Repo.Spec)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = repositorySettingsHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		Name          string
+	}{
+		AnalyticsHTML: analyticsHTML,
+		Name:          path.Base(h.Repo.Spec),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := component.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(h.Repo.Spec+"/...")))
+	if err != nil {
+		return err
+	}
+
+	// Render the tabnav.
+	err = htmlg.RenderComponents(w, component.RepositoryTabNav(component.NoTab, h.Repo.Path, h.Repo.Packages, openIssues, openChanges))
+	if err != nil {
+		return err
+	}
+
+	err = repositorySettingsBodyHTML.Execute(w, struct {
+		Error    string
+		Spec     string
+		Settings code.RepoSettings
+	}{
+		Error:    errorText,
+		Spec:     h.Repo.Spec,
+		Settings: settings,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
+
+// update handles a POST request to update repository settings.
+// It returns httperror.Redirect if the repository moved as a result.
+//
+// Issues and changes are stored by import path and aren't moved
+// along with a renamed repository, so repositories that have any
+// can't be renamed.
+func (h *repositorySettingsHandler) update(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	action, err := getSingleValue(req.PostForm, "action")
+	if err != nil {
+		return httperror.BadRequest{Err: err}
+	}
+	switch action {
+	case "edit":
+		description, err := getSingleValue(req.PostForm, "description")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		return h.code.EditRepoSettings(req.Context(), h.Repo.Spec, code.RepoSettings{
+			Description: description,
+			Archived:    req.PostForm.Get("archived") == "true",
+		})
+	case "rename":
+		newSpec, err := getSingleValue(req.PostForm, "spec")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		if !strings.HasPrefix(newSpec, "dmitri.shuralyov.com/") {
+			return fmt.Errorf("repository must be within dmitri.shuralyov.com")
+		}
+		issueCount, err := h.issues.Count(req.Context(), issues.RepoSpec{URI: h.Repo.Spec}, issues.IssueListOptions{State: issues.AllStates})
+		if err != nil {
+			return err
+		}
+		changeCount, err := h.change.Count(req.Context(), h.Repo.Spec, change.ListOptions{Filter: change.FilterAll})
+		if err != nil {
+			return err
+		}
+		if issueCount > 0 || changeCount > 0 {
+			return fmt.Errorf("repository with issues or changes can't be renamed")
+		}
+		err = h.code.RenameRepo(req.Context(), h.Repo.Spec, newSpec)
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists", newSpec)
+		} else if err != nil {
+			return err
+		}
+		log.Printf("renamed repository %q to %q\n", h.Repo.Spec, newSpec)
+		return httperror.Redirect{URL: route.RepoSettings(newSpec[len("dmitri.shuralyov.com"):])}
+	case "delete":
+		confirm, err := getSingleValue(req.PostForm, "spec")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		if confirm != h.Repo.Spec {
+			return fmt.Errorf("confirmation %q doesn't match repository %s", confirm, h.Repo.Spec)
+		}
+		err = h.code.DeleteRepo(req.Context(), h.Repo.Spec)
+		if err != nil {
+			return err
+		}
+		log.Printf("deleted repository %q\n", h.Repo.Spec)
+		return httperror.Redirect{URL: "/packages"}
+	default:
+		return httperror.BadRequest{Err: fmt.Errorf("unknown action %q", action)}
+	}
+}
@@ -16,9 +16,11 @@ import (
 	"github.com/shurcooL/home/internal/exp/service/change"
 	issues "github.com/shurcooL/home/internal/exp/service/issue"
 	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
 	"github.com/shurcooL/htmlg"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // repositoryHandler is a handler for a Go repository index page.
@@ -30,6 +32,7 @@ type repositoryHandler struct {
 	Repo repoInfo
 
 	code         *code.Service
+	vulns        *code.VulnScanner // May be nil.
 	issues       issueCounter
 	change       changeCounter
 	notification notification.Service
@@ -117,11 +120,82 @@ func (h *repositoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 		return err
 	}
 
+	settings, err := h.code.GetRepoSettings(req.Context(), h.Repo.Spec)
+	if err != nil {
+		return err
+	}
+	if settings.Description != "" {
+		err = html.Render(w, htmlg.P(htmlg.Text(settings.Description)))
+		if err != nil {
+			return err
+		}
+	}
+	if authenticatedUser.SiteAdmin {
+		err = html.Render(w, htmlg.Div(htmlg.A("Settings", route.RepoSettings(h.Repo.Path))))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Mark mirrors and archived repositories as read-only.
+	upstream, err := h.code.MirrorUpstream(req.Context(), h.Repo.Spec)
+	if err != nil {
+		return err
+	}
+	if settings.Archived {
+		err = htmlg.RenderComponents(w, component.Flash{
+			Content: htmlg.NodeComponent(*htmlg.Text("This repository is archived. It's read-only.")),
+		})
+		if err != nil {
+			return err
+		}
+	} else if upstream != "" {
+		err = htmlg.RenderComponents(w, component.Flash{
+			Content: mirrorNotice{
+				Upstream:  code.RedactURL(upstream),
+				RepoSpec:  h.Repo.Spec,
+				ReturnURL: req.RequestURI,
+				CanFetch:  authenticatedUser.SiteAdmin,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if findings := h.vulns.Findings(h.Repo.Spec); len(findings) > 0 {
+		err = htmlg.RenderComponents(w, vulnBadge{Findings: findings})
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.Repo.Packages > 0 {
+		// Offer source archives of master, unless the repository is empty.
+		err = html.Render(w, htmlg.Div(archiveLinks{RepoPath: h.Repo.Path, Rev: "master"}.Render()...))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Display the license of the repository, if it has a license file at its root.
+	root, err := h.code.GetDirectory(req.Context(), h.Repo.Spec)
+	if err != nil {
+		return err
+	}
+	if root.HasLicenseFile() {
+		span := htmlg.SpanClass("gray tiny", htmlg.Text("License: "), htmlg.A(licenseName(root), route.PkgLicense(h.Repo.Path, root.LicenseFile)))
+		err = html.Render(w, htmlg.Div(span))
+		if err != nil {
+			return err
+		}
+	}
+
 	dirs, err := h.code.ListDirectories(req.Context())
 	if err != nil {
 		return err
 	}
-	err = renderPackages(w, expandPattern(dirs, nil, h.Repo.Spec+"/...")) // repositoryHandler is used only for self-hosted packages, so it's okay to leave out githubPackages when expanding pattern.
+	err = renderPackages(w, expandPattern(dirs, nil, h.Repo.Spec+"/...")) // repositoryHandler is used only for self-hosted packages, so it's okay to leave out external packages when expanding pattern.
 	if err != nil {
 		return err
 	}
@@ -134,3 +208,50 @@ func (h *repositoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	_, err = io.WriteString(w, `</body></html>`)
 	return err
 }
+
+// mirrorNotice is a notice that a repository is a read-only mirror
+// of an upstream repository. If CanFetch is true, it offers to fetch
+// from upstream now.
+type mirrorNotice struct {
+	Upstream  string // Upstream URL, with user information removed.
+	RepoSpec  string
+	ReturnURL string
+	CanFetch  bool
+}
+
+func (m mirrorNotice) Render() []*html.Node {
+	ns := []*html.Node{
+		htmlg.Text("Read-only mirror of "),
+		htmlg.Strong(m.Upstream),
+		htmlg.Text("."),
+	}
+	if !m.CanFetch {
+		return ns
+	}
+	form := &html.Node{
+		Type: html.ElementNode, Data: atom.Form.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Method.String(), Val: "post"},
+			{Key: atom.Action.String(), Val: "/action/fetch-mirror"},
+			{Key: atom.Style.String(), Val: "display: inline; margin-left: 12px;"},
+		},
+	}
+	for _, kv := range [...][2]string{{"spec", m.RepoSpec}, {"return", m.ReturnURL}} {
+		form.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: atom.Input.String(),
+			Attr: []html.Attribute{
+				{Key: atom.Type.String(), Val: "hidden"},
+				{Key: atom.Name.String(), Val: kv[0]},
+				{Key: atom.Value.String(), Val: kv[1]},
+			},
+		})
+	}
+	form.AppendChild(&html.Node{
+		Type: html.ElementNode, Data: atom.Input.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Type.String(), Val: "submit"},
+			{Key: atom.Value.String(), Val: "Fetch now"},
+		},
+	})
+	return append(ns, form)
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/exp/service/user/fs"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	"github.com/shurcooL/users"
+)
+
+var profileSettingsHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>Settings</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+body, input {
+	font-family: Go;
+}
+label {
+	display: block;
+	margin-top: 15px;
+	font-weight: bold;
+}
+input[type="text"], input[type="email"], input[type="url"], textarea {
+	width: 100%;
+	box-sizing: border-box;
+}
+.error {
+	color: darkred;
+}
+.tabnav {
+	margin-bottom: 15px;
+	border-bottom: 1px solid #ddd;
+}
+.tabnav-tabs {
+	margin-bottom: -1px;
+}
+.tabnav-tab {
+	display: inline-block;
+	padding: 8px 12px;
+	color: #666;
+	text-decoration: none;
+	border: 1px solid transparent;
+	border-bottom: 0;
+}
+.tabnav-tab.selected {
+	color: #333;
+	background-color: #fff;
+	border-color: #ddd;
+	border-radius: 3px 3px 0 0;
+}
+		</style>
+	</head>
+	<body>
+		<div style="max-width: 800px; margin: 0 auto 100px auto;">`))
+
+var profileSettingsBodyHTML = template.Must(template.New("").Parse(`<h1>Profile Settings</h1>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+<img src="{{.User.AvatarURL}}" width="96" height="96" style="border-radius: 4px;">
+<form method="post">
+	<label for="name">Name</label>
+	<input type="text" id="name" name="name" value="{{.User.Name}}">
+	<label for="email">Public email</label>
+	<input type="email" id="email" name="email" value="{{.User.Email}}">
+	<label for="avatar">Avatar URL</label>
+	<input type="text" id="avatar" name="avatar" value="{{.User.AvatarURL}}">
+	<label for="website">Website</label>
+	<input type="url" id="website" name="website" value="{{.User.HTMLURL}}">
+	<p><input type="submit" value="Update profile"></p>
+</form>`))
+
+// profileSettingsHandler serves the profile settings page,
+// where the authenticated user can edit their profile.
+type profileSettingsHandler struct {
+	users        Users
+	notification notification.Service
+}
+
+func (h profileSettingsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		return httperror.Method{Allowed: []string{http.MethodGet, http.MethodPost}}
+	}
+	authenticatedUser, err := getSettingsUser(req.Context(), h.users, req.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		form      = authenticatedUser // Profile values to show in the form.
+		editError error
+	)
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		var er fs.EditRequest
+		for _, f := range []struct {
+			key   string
+			value **string
+		}{
+			{"name", &er.Name},
+			{"email", &er.Email},
+			{"avatar", &er.AvatarURL},
+			{"website", &er.HTMLURL},
+		} {
+			v, err := getSingleValue(req.PostForm, f.key)
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			*f.value = &v
+		}
+		_, err := h.users.EditProfile(req.Context(), er)
+		switch e := (fs.InvalidEditError{}); {
+		case errors.As(err, &e):
+			editError = e
+		case err != nil:
+			return err
+		default:
+			return httperror.Redirect{URL: req.URL.Path}
+		}
+		// Show the form again with the submitted values and the error.
+		form.Name, form.Email, form.AvatarURL, form.HTMLURL = *er.Name, *er.Email, *er.AvatarURL, *er.HTMLURL
+	}
+
+	return serveSettingsPage(w, req, h.notification, authenticatedUser, profileTab, editError != nil, func(w io.Writer) error {
+		return profileSettingsBodyHTML.Execute(w, struct {
+			User  users.User
+			Error error
+		}{form, editError})
+	})
+}
+
+// getSettingsUser returns the authenticated user. If there isn't one,
+// it returns an httperror.Redirect to the login page that returns
+// to returnURL afterwards.
+func getSettingsUser(ctx context.Context, us Users, returnURL string) (users.User, error) {
+	authenticatedUser, err := us.GetAuthenticated(ctx)
+	if err != nil {
+		return users.User{}, err
+	} else if authenticatedUser.ID == 0 {
+		loginURL := (&url.URL{
+			Path:     "/login",
+			RawQuery: url.Values{returnParameterName: {returnURL}}.Encode(),
+		}).String()
+		return users.User{}, httperror.Redirect{URL: loginURL}
+	}
+	return authenticatedUser, nil
+}
+
+// serveSettingsPage serves a settings page for authenticatedUser
+// with the selected tab. The page-specific body is rendered by
+// renderBody, following the shared head, header and settings tabnav.
+// If badRequest is true, the page is served with a 400 status code,
+// such as when showing a form again with an error.
+func serveSettingsPage(w http.ResponseWriter, req *http.Request, notification notification.Service, authenticatedUser users.User, selected settingsTab, badRequest bool, renderBody func(io.Writer) error) error {
+	nc, err := notification.CountNotifications(req.Context())
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if badRequest {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	err = profileSettingsHTML.Execute(w, struct{ AnalyticsHTML template.HTML }{analyticsHTML})
+	if err != nil {
+		return err
+	}
+	err = htmlg.RenderComponents(w,
+		component.Header{
+			CurrentUser:       authenticatedUser,
+			NotificationCount: nc,
+			ReturnURL:         req.RequestURI,
+		},
+		settingsTabnav(selected),
+	)
+	if err != nil {
+		return err
+	}
+	err = renderBody(w)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, `</div>`)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</body></html>`)
+	return err
+}
+
+type settingsTab uint8
+
+const (
+	profileTab settingsTab = iota
+	emailsTab
+	signingKeysTab
+)
+
+func settingsTabnav(selected settingsTab) htmlg.Component {
+	return component.TabNav{
+		Tabs: []component.Tab{
+			{
+				Content:  htmlg.NodeComponent(*htmlg.Text("Profile")),
+				URL:      "/settings/profile",
+				Selected: selected == profileTab,
+			},
+			{
+				Content:  htmlg.NodeComponent(*htmlg.Text("Commit emails")),
+				URL:      "/settings/emails",
+				Selected: selected == emailsTab,
+			},
+			{
+				Content:  htmlg.NodeComponent(*htmlg.Text("Signing keys")),
+				URL:      "/settings/keys",
+				Selected: selected == signingKeysTab,
+			},
+		},
+	}
+}
+
+var emailSettingsBodyHTML = template.Must(template.New("").Parse(`<h1>Commit Emails</h1>
+<p>Git commits authored with a verified email address are attributed to you.</p>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+{{with .Emails}}<table>
+	{{range .}}<tr>
+		<td>{{.Address}}</td>
+		<td>{{if .Verified}}Verified{{else}}<em>Unverified, check your inbox</em>{{end}}</td>
+		<td><form method="post">
+			<input type="hidden" name="action" value="remove">
+			<input type="hidden" name="email" value="{{.Address}}">
+			<input type="submit" value="Remove">
+		</form></td>
+	</tr>{{end}}
+</table>{{else}}<p>No commit emails.</p>{{end}}
+<form method="post">
+	<input type="hidden" name="action" value="add">
+	<label for="email">Add email</label>
+	<input type="email" id="email" name="email" value="{{.Address}}">
+	<p><input type="submit" value="Add and send verification email"></p>
+</form>`))
+
+// emailSettingsHandler serves the commit email settings page,
+// where the authenticated user can add, verify and remove
+// email addresses that git commits are attributed by.
+type emailSettingsHandler struct {
+	users        Users
+	notification notification.Service
+
+	// siteURL is the canonical base URL of the site, without a trailing slash.
+	// Verification links are built from it rather than the request's Host header,
+	// which is controlled by the client.
+	siteURL string
+
+	// sendVerification sends a message with verifyURL to address.
+	sendVerification func(ctx context.Context, address, verifyURL string) error
+}
+
+func (h emailSettingsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		return httperror.Method{Allowed: []string{http.MethodGet, http.MethodPost}}
+	}
+	authenticatedUser, err := getSettingsUser(req.Context(), h.users, req.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		address  string // Address to show in the add email form.
+		addError error
+	)
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		action, err := getSingleValue(req.PostForm, "action")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		address, err = getSingleValue(req.PostForm, "email")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		switch action {
+		case "add":
+			addError = h.addEmail(req, address)
+			if addError == nil {
+				return httperror.Redirect{URL: req.URL.Path}
+			}
+		case "remove":
+			err := h.users.RemoveEmail(req.Context(), address)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return httperror.Redirect{URL: req.URL.Path}
+		default:
+			return httperror.BadRequest{Err: fmt.Errorf("unsupported action %q", action)}
+		}
+	}
+
+	emails, err := h.users.ListEmails(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return serveSettingsPage(w, req, h.notification, authenticatedUser, emailsTab, addError != nil, func(w io.Writer) error {
+		return emailSettingsBodyHTML.Execute(w, struct {
+			Emails  []fs.Email
+			Address string
+			Error   error
+		}{emails, address, addError})
+	})
+}
+
+// addEmail adds address to the authenticated user
+// and sends a verification message to it.
+// It returns a non-nil error that is okay to show
+// to the user if address can't be added.
+func (h emailSettingsHandler) addEmail(req *http.Request, address string) error {
+	token, err := h.users.AddEmail(req.Context(), address)
+	if os.IsExist(err) {
+		return fmt.Errorf("email %q is already verified", strings.TrimSpace(address))
+	} else if err != nil {
+		return err
+	}
+	verifyURL := h.siteURL + "/settings/emails/verify?" + url.Values{"token": {token}}.Encode()
+	err = h.sendVerification(req.Context(), strings.TrimSpace(address), verifyURL)
+	if err != nil {
+		log.Println("emailSettingsHandler: sendVerification:", err)
+		return fmt.Errorf("failed to send verification email")
+	}
+	return nil
+}
+
+// Verify serves the link sent in email verification messages.
+func (h emailSettingsHandler) Verify(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodGet {
+		return httperror.Method{Allowed: []string{http.MethodGet}}
+	}
+	_, err := getSettingsUser(req.Context(), h.users, req.RequestURI)
+	if err != nil {
+		return err
+	}
+	_, err = h.users.VerifyEmail(req.Context(), req.URL.Query().Get("token"))
+	if os.IsNotExist(err) {
+		return httperror.BadRequest{Err: fmt.Errorf("verification link is not valid or has expired")}
+	} else if os.IsExist(err) {
+		return httperror.BadRequest{Err: fmt.Errorf("email is already verified by another user")}
+	} else if err != nil {
+		return err
+	}
+	return httperror.Redirect{URL: "/settings/emails"}
+}
+
+var signingKeySettingsBodyHTML = template.Must(template.New("").Parse(`<h1>Signing Keys</h1>
+<p>Git commits and tags signed with one of these keys are shown as verified
+if their committer or tagger email is one of your <a href="/settings/emails">verified commit emails</a>.</p>
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+{{with .Keys}}<table>
+	{{range .}}<tr>
+		<td>{{if eq .Type "gpg"}}GPG{{else}}SSH{{end}}</td>
+		<td><code>{{.Fingerprint}}</code></td>
+		<td><form method="post">
+			<input type="hidden" name="action" value="remove">
+			<input type="hidden" name="fingerprint" value="{{.Fingerprint}}">
+			<input type="submit" value="Remove">
+		</form></td>
+	</tr>{{end}}
+</table>{{else}}<p>No signing keys.</p>{{end}}
+<form method="post">
+	<input type="hidden" name="action" value="add">
+	<label for="key">Add key</label>
+	<textarea id="key" name="key" rows="8" placeholder="An ASCII-armored GPG public key, or an SSH public key like ssh-ed25519 AAAA...">{{.Key}}</textarea>
+	<p><input type="submit" value="Add key"></p>
+</form>`))
+
+// signingKeySettingsHandler serves the signing key settings page,
+// where the authenticated user can add and remove GPG and SSH keys
+// that their git commits and tags are signed with.
+type signingKeySettingsHandler struct {
+	users        Users
+	notification notification.Service
+}
+
+func (h signingKeySettingsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		return httperror.Method{Allowed: []string{http.MethodGet, http.MethodPost}}
+	}
+	authenticatedUser, err := getSettingsUser(req.Context(), h.users, req.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		key      string // Key to show in the add key form.
+		addError error
+	)
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		action, err := getSingleValue(req.PostForm, "action")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		switch action {
+		case "add":
+			key, err = getSingleValue(req.PostForm, "key")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			addError = h.addKey(req.Context(), key)
+			if addError == nil {
+				return httperror.Redirect{URL: req.URL.Path}
+			}
+		case "remove":
+			fingerprint, err := getSingleValue(req.PostForm, "fingerprint")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			err = h.users.RemoveSigningKey(req.Context(), fingerprint)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return httperror.Redirect{URL: req.URL.Path}
+		default:
+			return httperror.BadRequest{Err: fmt.Errorf("unsupported action %q", action)}
+		}
+	}
+
+	keys, err := h.users.ListSigningKeys(req.Context())
+	if err != nil {
+		return err
+	}
+
+	return serveSettingsPage(w, req, h.notification, authenticatedUser, signingKeysTab, addError != nil, func(w io.Writer) error {
+		return signingKeySettingsBodyHTML.Execute(w, struct {
+			Keys  []fs.SigningKey
+			Key   string
+			Error error
+		}{keys, key, addError})
+	})
+}
+
+// addKey parses key and adds it to the authenticated user.
+// It returns a non-nil error that is okay to show
+// to the user if key can't be added.
+func (h signingKeySettingsHandler) addKey(ctx context.Context, key string) error {
+	k, err := code.ParseSigningKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = h.users.AddSigningKey(ctx, fs.SigningKey(k))
+	if os.IsExist(err) {
+		return fmt.Errorf("key %s is already added", k.Fingerprint)
+	}
+	return err
+}
+
+// newVerificationSender returns a function that sends email verification
+// messages via the SMTP server at addr, from the address from.
+// If addr is empty, verification links are logged instead of being sent.
+// The HOME_SMTP_PASSWORD environment variable, if set, is used to authenticate.
+func newVerificationSender(addr, from string) func(ctx context.Context, address, verifyURL string) error {
+	if addr == "" {
+		return func(_ context.Context, address, verifyURL string) error {
+			log.Printf("verification link for %s (no -smtp-addr to send it with): %s\n", address, verifyURL)
+			return nil
+		}
+	}
+	var auth smtp.Auth
+	if password := os.Getenv("HOME_SMTP_PASSWORD"); password != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i != -1 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", from, password, host)
+	}
+	return func(_ context.Context, address, verifyURL string) error {
+		msg := "From: " + from + "\r\n" +
+			"To: " + address + "\r\n" +
+			"Subject: Verify your email\r\n" +
+			"\r\n" +
+			"Open the following link to verify that git commits authored with this email can be attributed to you:\r\n" +
+			"\r\n" +
+			verifyURL + "\r\n"
+		return smtp.SendMail(addr, auth, from, []string{address}, []byte(msg))
+	}
+}
@@ -1,11 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"io"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
 	pathpkg "path"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/shurcooL/httperror"
@@ -14,19 +27,70 @@ import (
 	"golang.org/x/net/webdav"
 )
 
+// userContentTypes is the allow-list of user content media types,
+// mapped to the file extension used to store them.
+// The media type of uploaded content is verified by sniffing.
+var userContentTypes = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// userContentTypeByExtension returns the Content-Type
+// to serve user content with the given file extension.
+func userContentTypeByExtension(ext string) (string, bool) {
+	for mediaType, e := range userContentTypes {
+		if e != ext {
+			continue
+		}
+		if mediaType == "text/plain" {
+			return "text/plain; charset=utf-8", true
+		}
+		return mediaType, true
+	}
+	return "", false
+}
+
+const (
+	// userContentMaxSize is the maximum size of a single upload, in bytes.
+	userContentMaxSize = 10 * 1024 * 1024
+
+	// userContentQuota is the default maximum total size
+	// of content a single user can upload, in bytes.
+	userContentQuota = 100 * 1024 * 1024
+
+	// thumbnailMaxWidth is the maximum width of generated thumbnails, in pixels.
+	// Images narrower than that don't get a thumbnail.
+	thumbnailMaxWidth = 800
+
+	// imageMaxPixels is the maximum number of pixels an uploaded image may have.
+	// It protects against decompression bombs.
+	imageMaxPixels = 50 * 1000 * 1000
+)
+
 type userContentHandler struct {
 	store webdav.FileSystem
 	users users.Service
+
+	// quota is the maximum total size of content
+	// a single user can upload, in bytes.
+	// Site admins are not subject to it.
+	quota int64
+
+	mu sync.Mutex // Serializes uploads, so that quota checks are accurate.
 }
 
-func (uc userContentHandler) Upload(w http.ResponseWriter, req *http.Request) error {
+func (uc *userContentHandler) Upload(w http.ResponseWriter, req *http.Request) error {
 	if req.Method != "POST" {
 		return httperror.Method{Allowed: []string{"POST"}}
 	}
 
 	type uploadResponse struct {
-		URL   string `json:",omitempty"`
-		Error string `json:",omitempty"`
+		URL          string `json:",omitempty"`
+		ThumbnailURL string `json:",omitempty"` // Only set for images that got a thumbnail.
+		Error        string `json:",omitempty"`
 	}
 
 	user, err := uc.users.GetAuthenticated(req.Context())
@@ -37,49 +101,123 @@ func (uc userContentHandler) Upload(w http.ResponseWriter, req *http.Request) er
 		return httperror.JSONResponse{V: uploadResponse{Error: os.ErrPermission.Error()}}
 	}
 
-	if contentType := req.Header.Get("Content-Type"); contentType != "image/png" {
+	contentType := req.Header.Get("Content-Type")
+	declaredType, _, err := mime.ParseMediaType(contentType)
+	if _, ok := userContentTypes[declaredType]; err != nil || !ok {
 		return httperror.JSONResponse{V: uploadResponse{Error: fmt.Sprintf("Content-Type %q is not supported", contentType)}}
 	}
 
+	body := http.MaxBytesReader(w, req.Body, userContentMaxSize) // The http.Server will close the request body, the handler does not need to.
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+	}
+	mediaType, err := sniffUserContent(b)
+	if err != nil {
+		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+	} else if mediaType != declaredType {
+		return httperror.JSONResponse{V: uploadResponse{Error: fmt.Sprintf("content is %q, not %q as declared", mediaType, declaredType)}}
+	}
+
+	// Strip metadata from images and generate thumbnails.
+	var thumb []byte
+	switch mediaType {
+	case "image/png", "image/jpeg", "image/gif":
+		b, thumb, err = processImage(b, mediaType)
+		if err != nil {
+			return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+		}
+	}
+
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
 	dir := fmt.Sprintf("/%d@%s", user.ID, user.Domain)
 	err = vfsutil.MkdirAll(req.Context(), uc.store, dir, 0755)
 	if err != nil {
 		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
 	}
 
+	if !user.SiteAdmin {
+		used, err := uc.usage(req.Context(), dir)
+		if err != nil {
+			return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+		}
+		if used+int64(len(b))+int64(len(thumb)) > uc.quota {
+			return httperror.JSONResponse{V: uploadResponse{Error: fmt.Sprintf("upload would exceed quota of %d MB", uc.quota/1024/1024)}}
+		}
+	}
+
 	uuid, err := uuid.NewRandom()
 	if err != nil {
 		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
 	}
-	name := uuid.String() + ".png"
-	path := pathpkg.Join(dir, name)
-	f, err := uc.store.OpenFile(req.Context(), path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	ext := userContentTypes[mediaType]
+	path := pathpkg.Join(dir, uuid.String()+ext)
+	err = uc.writeFile(req.Context(), path, b)
 	if err != nil {
 		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
 	}
+	resp := uploadResponse{URL: pathpkg.Join("/usercontent", path)}
+	if thumb != nil {
+		thumbPath := pathpkg.Join(dir, uuid.String()+".thumb"+ext)
+		err = uc.writeFile(req.Context(), thumbPath, thumb)
+		if err != nil {
+			uc.store.RemoveAll(req.Context(), path)
+			return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+		}
+		resp.ThumbnailURL = pathpkg.Join("/usercontent", thumbPath)
+	}
+	return httperror.JSONResponse{V: resp}
+}
 
-	const maxSizeBytes = 10 * 1024 * 1024
-	body := http.MaxBytesReader(w, req.Body, maxSizeBytes) // The http.Server will close the request body, the handler does not need to.
-	_, err = io.Copy(f, body)
+// writeFile writes b to a new file at path in uc.store.
+// On failure, it removes the partially written file.
+func (uc *userContentHandler) writeFile(ctx context.Context, path string, b []byte) error {
+	f, err := uc.store.OpenFile(ctx, path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
 	if err != nil {
 		f.Close()
-		uc.store.RemoveAll(req.Context(), path)
-		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+		uc.store.RemoveAll(ctx, path)
+		return err
 	}
 	err = f.Close()
 	if err != nil {
-		uc.store.RemoveAll(req.Context(), path)
-		return httperror.JSONResponse{V: uploadResponse{Error: err.Error()}}
+		uc.store.RemoveAll(ctx, path)
+		return err
 	}
+	return nil
+}
 
-	return httperror.JSONResponse{V: uploadResponse{URL: pathpkg.Join("/usercontent", path)}}
+// usage returns the total size of user content in dir, in bytes.
+func (uc *userContentHandler) usage(ctx context.Context, dir string) (int64, error) {
+	fis, err := vfsutil.ReadDir(ctx, uc.store, dir)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, fi := range fis {
+		if fi.IsDir() {
+			continue
+		}
+		total += fi.Size()
+	}
+	return total, nil
 }
 
-func (uc userContentHandler) Serve(w http.ResponseWriter, req *http.Request) error {
+func (uc *userContentHandler) Serve(w http.ResponseWriter, req *http.Request) error {
 	if req.Method != "GET" {
 		return httperror.Method{Allowed: []string{"GET"}}
 	}
 
+	contentType, ok := userContentTypeByExtension(pathpkg.Ext(req.URL.Path))
+	if !ok {
+		return os.ErrNotExist
+	}
+
 	f, err := vfsutil.Open(req.Context(), uc.store, req.URL.Path)
 	if err != nil {
 		return err
@@ -93,7 +231,184 @@ func (uc userContentHandler) Serve(w http.ResponseWriter, req *http.Request) err
 		return os.ErrNotExist
 	}
 
-	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	http.ServeContent(w, req, "", fi.ModTime(), f)
 	return nil
 }
+
+// sniffUserContent determines the media type of content b,
+// and reports an error if it's not in the userContentTypes allow-list.
+func sniffUserContent(b []byte) (mediaType string, _ error) {
+	contentType := http.DetectContentType(b)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := userContentTypes[mediaType]; !ok {
+		return "", fmt.Errorf("content of type %q is not supported", contentType)
+	}
+	if mediaType == "text/plain" {
+		// Only accept UTF-8 text. DetectContentType looks at a prefix only,
+		// so check the entire content.
+		if cs := params["charset"]; cs != "utf-8" || !utf8.Valid(b) {
+			return "", errors.New("text content must be valid UTF-8")
+		}
+	}
+	return mediaType, nil
+}
+
+// processImage strips metadata such as EXIF from image b,
+// and generates a thumbnail if the image is wider than thumbnailMaxWidth.
+// thumb is nil if no thumbnail was generated.
+func processImage(b []byte, mediaType string) (_, thumb []byte, _ error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("image.DecodeConfig: %v", err)
+	}
+	if config.Width*config.Height > imageMaxPixels {
+		return nil, nil, fmt.Errorf("image dimensions %dx%d are too large", config.Width, config.Height)
+	}
+
+	switch mediaType {
+	case "image/jpeg":
+		b, err = stripJPEGMetadata(b)
+	case "image/png":
+		b, err = stripPNGMetadata(b)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.Width <= thumbnailMaxWidth {
+		return b, nil, nil
+	}
+	m, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, fmt.Errorf("image.Decode: %v", err)
+	}
+	var buf bytes.Buffer
+	switch t := thumbnail(m, thumbnailMaxWidth); mediaType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, t, &jpeg.Options{Quality: 85})
+	case "image/png":
+		err = png.Encode(&buf, t)
+	case "image/gif":
+		// Only the first frame of an animated GIF is used.
+		err = gif.Encode(&buf, t, nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, buf.Bytes(), nil
+}
+
+// thumbnail returns a copy of m downscaled to maxWidth pixels wide,
+// preserving its aspect ratio. Each destination pixel is the average
+// of the source pixels it covers.
+func thumbnail(m image.Image, maxWidth int) image.Image {
+	sb := m.Bounds()
+	w := maxWidth
+	h := sb.Dy() * w / sb.Dx()
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy0, sy1 := sb.Min.Y+y*sb.Dy()/h, sb.Min.Y+(y+1)*sb.Dy()/h
+		if sy1 == sy0 {
+			sy1++
+		}
+		for x := 0; x < w; x++ {
+			sx0, sx1 := sb.Min.X+x*sb.Dx()/w, sb.Min.X+(x+1)*sb.Dx()/w
+			if sx1 == sx0 {
+				sx1++
+			}
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := m.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// stripJPEGMetadata removes APP1 (EXIF, XMP) and APP13 (IPTC) segments
+// from JPEG image b. Image data is left untouched.
+func stripJPEGMetadata(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil, errors.New("not a JPEG image")
+	}
+	out := []byte{0xff, 0xd8}
+	for i := 2; ; {
+		if i+2 > len(b) || b[i] != 0xff {
+			return nil, errors.New("malformed JPEG image")
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte.
+			i++
+			continue
+		case marker == 0xd9:
+			// End of image.
+			return append(out, b[i:]...), nil
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			// Standalone markers without a length.
+			out = append(out, b[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(b) {
+			return nil, errors.New("malformed JPEG image")
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) {
+			return nil, errors.New("malformed JPEG image")
+		}
+		if marker == 0xda {
+			// Start of scan. The remainder is entropy-coded image data.
+			return append(out, b[i:]...), nil
+		}
+		if marker != 0xe1 && marker != 0xed {
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+}
+
+// stripPNGMetadata removes eXIf and textual (tEXt, zTXt, iTXt) chunks
+// from PNG image b. Image data is left untouched.
+func stripPNGMetadata(b []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !strings.HasPrefix(string(b), signature) {
+		return nil, errors.New("not a PNG image")
+	}
+	out := []byte(signature)
+	for i := len(signature); i < len(b); {
+		if i+8 > len(b) {
+			return nil, errors.New("malformed PNG image")
+		}
+		length := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 8 + length + 4 // Length, type, data, CRC.
+		if end > len(b) {
+			return nil, errors.New("malformed PNG image")
+		}
+		switch typ := string(b[i+4 : i+8]); typ {
+		case "eXIf", "tEXt", "zTXt", "iTXt":
+		default:
+			out = append(out, b[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
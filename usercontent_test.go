@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/webdav"
+)
+
+func TestUserContent(t *testing.T) {
+	uc := &userContentHandler{
+		store: webdav.NewMemFS(),
+		users: mockUploader{},
+		quota: 1024 * 1024,
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/usercontent", httputil.ErrorHandler(nil, uc.Upload))
+	mux.Handle("/usercontent/", http.StripPrefix("/usercontent", httputil.ErrorHandler(nil, uc.Serve)))
+
+	type uploadResponse struct {
+		URL          string
+		ThumbnailURL string
+		Error        string
+	}
+	upload := func(contentType string, body []byte) uploadResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/usercontent", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var resp uploadResponse
+		err := json.NewDecoder(rr.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, tt := range []struct {
+		name      string
+		mediaType string
+		body      []byte
+		wantType  string
+		wantError bool
+		wantThumb bool
+	}{
+		{
+			name:      "small png",
+			mediaType: "image/png",
+			body:      encodePNG(t, 10, 10),
+			wantType:  "image/png",
+		},
+		{
+			name:      "large png gets thumbnail",
+			mediaType: "image/png",
+			body:      encodePNG(t, 2*thumbnailMaxWidth, 10),
+			wantType:  "image/png",
+			wantThumb: true,
+		},
+		{
+			name:      "jpeg",
+			mediaType: "image/jpeg",
+			body:      encodeJPEG(t, 10, 10),
+			wantType:  "image/jpeg",
+		},
+		{
+			name:      "log file",
+			mediaType: "text/plain",
+			body:      []byte("2020/01/01 00:00:00 hello\n"),
+			wantType:  "text/plain; charset=utf-8",
+		},
+		{
+			name:      "declared type does not match content",
+			mediaType: "image/png",
+			body:      encodeJPEG(t, 10, 10),
+			wantError: true,
+		},
+		{
+			name:      "html is not allowed",
+			mediaType: "text/plain",
+			body:      []byte("<html><script>alert(1)</script></html>"),
+			wantError: true,
+		},
+		{
+			name:      "unsupported declared type",
+			mediaType: "application/octet-stream",
+			body:      []byte("\x00\x01\x02"),
+			wantError: true,
+		},
+		{
+			name:      "over quota",
+			mediaType: "text/plain",
+			body:      bytes.Repeat([]byte("a"), 2*1024*1024),
+			wantError: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := upload(tt.mediaType, tt.body)
+			if tt.wantError {
+				if resp.Error == "" {
+					t.Fatalf("got no error, want one")
+				}
+				return
+			}
+			if resp.Error != "" {
+				t.Fatalf("got error %q, want none", resp.Error)
+			}
+			if !strings.HasPrefix(resp.URL, "/usercontent/1@example.com/") {
+				t.Errorf("got URL %q, want it to be within /usercontent/1@example.com/", resp.URL)
+			}
+			if got, want := resp.ThumbnailURL != "", tt.wantThumb; got != want {
+				t.Errorf("got thumbnail URL %q, want thumbnail: %v", resp.ThumbnailURL, want)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, resp.URL, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+			if got, want := rr.Code, http.StatusOK; got != want {
+				t.Errorf("got status code %d %s, want %d %s", got, http.StatusText(got), want, http.StatusText(want))
+			}
+			if got, want := rr.Header().Get("Content-Type"), tt.wantType; got != want {
+				t.Errorf("got Content-Type header %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	b := encodeJPEG(t, 4, 4)
+	exif := []byte("\xff\xe1\x00\x0eExif\x00\x00GPS!!!")
+	withEXIF := append(append(append([]byte(nil), b[:2]...), exif...), b[2:]...)
+
+	got, err := stripJPEGMetadata(withEXIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("Exif")) {
+		t.Error("EXIF segment was not removed")
+	}
+	if !bytes.Equal(got, b) {
+		t.Error("stripping EXIF did not restore the original image")
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	b := encodePNG(t, 4, 4)
+	const ihdrEnd = 8 + 8 + 13 + 4 // Signature, IHDR chunk.
+	text := []byte("\x00\x00\x00\x07tEXtAuthor\x00\x00\x00\x00\x00")
+	withText := append(append(append([]byte(nil), b[:ihdrEnd]...), text...), b[ihdrEnd:]...)
+
+	got, err := stripPNGMetadata(withText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Error("stripping tEXt did not restore the original image")
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// mockUploader is a users.Service where the authenticated user
+// is a regular (non-admin) user 1@example.com.
+type mockUploader struct{ users.Service }
+
+func (mockUploader) GetAuthenticated(context.Context) (users.User, error) {
+	return users.User{UserSpec: users.UserSpec{ID: 1, Domain: "example.com"}}, nil
+}
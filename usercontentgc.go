@@ -0,0 +1,497 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	pathpkg "path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/shurcooL/home/component"
+	codepkg "github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	"github.com/shurcooL/users"
+	"github.com/shurcooL/webdavfs/vfsutil"
+	"golang.org/x/net/webdav"
+)
+
+// userContentGracePeriod is how long an orphaned upload is kept before
+// it's deleted. It gives users time to post the comment they're writing,
+// and to undo edits that removed the last reference to it.
+const userContentGracePeriod = 7 * 24 * time.Hour
+
+// userContentGCStatePath is the path of the file in the user content store
+// that records when each orphaned file was first seen as an orphan.
+// Its extension isn't in userContentTypes, so it's never served.
+const userContentGCStatePath = "/gc.json"
+
+// userContentRefRE matches references to user content in comment bodies.
+// The first submatch is the user content key, see userContentKey.
+var userContentRefRE = regexp.MustCompile(`/usercontent(/[^/\s]+@[^/\s]+/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})(?:\.thumb)?\.[a-z]+`)
+
+// userContentKey returns the key of user content at path,
+// which is the path without the file extension and thumbnail suffix.
+// An upload and its thumbnail share the same key.
+func userContentKey(path string) string {
+	path = strings.TrimSuffix(path, pathpkg.Ext(path))
+	return strings.TrimSuffix(path, ".thumb")
+}
+
+// userContentGC finds user content that isn't referenced by any issue
+// or change comment or user avatar, and deletes it once it's been orphaned
+// for longer than gracePeriod. It also serves an admin page for managing
+// user content.
+type userContentGC struct {
+	content     webdav.FileSystem // User content store.
+	issues      webdav.FileSystem // Issue store, scanned for references.
+	changes     change.Service    // Scanned for references in changes of code repositories.
+	code        *codepkg.Service
+	profiles    userLister // Scanned for references in user avatars.
+	gracePeriod time.Duration
+
+	collectMu sync.Mutex // Guards the state file at userContentGCStatePath.
+
+	notification notification.Service
+	users        users.Service
+}
+
+// userLister lists all users.
+type userLister interface {
+	List(context.Context) ([]users.User, error)
+}
+
+// userContentFile is a file in the user content store.
+type userContentFile struct {
+	Path    string // Path within the user content store, like "/1@example.com/{uuid}.png".
+	Size    int64
+	ModTime time.Time
+	Orphan  bool // Orphan reports whether the file isn't referenced by any comment or avatar.
+
+	// OrphanedSince is when the file was first seen as an orphan by Collect.
+	// It's the zero time if the file isn't an orphan, or hasn't been collected yet.
+	OrphanedSince time.Time
+}
+
+// Run collects orphaned user content every interval, until ctx is canceled.
+func (gc *userContentGC) Run(ctx context.Context, interval time.Duration) {
+	for {
+		deleted, err := gc.Collect(ctx, time.Now())
+		if err != nil {
+			log.Println("userContentGC.Collect:", err)
+		}
+		for _, f := range deleted {
+			log.Printf("userContentGC: deleted orphaned %s (%d bytes, uploaded %v, orphaned since %v)\n", f.Path, f.Size, f.ModTime, f.OrphanedSince)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Collect deletes user content that has been orphaned for longer than
+// the grace period, and returns the files it deleted. The grace period is
+// measured from when Collect first saw a file as an orphan, which is
+// recorded in the state file at userContentGCStatePath.
+func (gc *userContentGC) Collect(ctx context.Context, now time.Time) (deleted []userContentFile, _ error) {
+	gc.collectMu.Lock()
+	defer gc.collectMu.Unlock()
+	files, err := gc.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orphanedSince := make(map[string]time.Time) // Path -> when it was first seen as an orphan.
+	var firstErr error
+	for _, f := range files {
+		if !f.Orphan {
+			continue
+		}
+		if f.OrphanedSince.IsZero() {
+			f.OrphanedSince = now
+		}
+		if now.Sub(f.OrphanedSince) < gc.gracePeriod {
+			orphanedSince[f.Path] = f.OrphanedSince
+			continue
+		}
+		err := gc.content.RemoveAll(ctx, f.Path)
+		if err != nil {
+			orphanedSince[f.Path] = f.OrphanedSince
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		deleted = append(deleted, f)
+	}
+	err = gc.writeState(ctx, orphanedSince)
+	if err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("writing state: %v", err)
+	}
+	return deleted, firstErr
+}
+
+// readState reads the state file at userContentGCStatePath.
+// A missing state file is treated as empty.
+func (gc *userContentGC) readState(ctx context.Context) (orphanedSince map[string]time.Time, _ error) {
+	f, err := vfsutil.Open(ctx, gc.content, userContentGCStatePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&orphanedSince)
+	return orphanedSince, err
+}
+
+// writeState writes the state file at userContentGCStatePath.
+func (gc *userContentGC) writeState(ctx context.Context, orphanedSince map[string]time.Time) error {
+	b, err := json.MarshalIndent(orphanedSince, "", "\t")
+	if err != nil {
+		return err
+	}
+	return vfsutil.WriteFile(ctx, gc.content, userContentGCStatePath, b, 0644)
+}
+
+// Scan lists all files in the user content store,
+// and reports which ones are orphaned.
+func (gc *userContentGC) Scan(ctx context.Context) ([]userContentFile, error) {
+	refs, err := gc.references(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orphanedSince, err := gc.readState(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %v", err)
+	}
+	userDirs, err := vfsutil.ReadDir(ctx, gc.content, "/")
+	if err != nil {
+		return nil, err
+	}
+	var files []userContentFile
+	for _, userDir := range userDirs {
+		if !userDir.IsDir() {
+			continue
+		}
+		dir := "/" + userDir.Name()
+		fis, err := vfsutil.ReadDir(ctx, gc.content, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			if fi.IsDir() {
+				continue
+			}
+			path := pathpkg.Join(dir, fi.Name())
+			f := userContentFile{
+				Path:    path,
+				Size:    fi.Size(),
+				ModTime: fi.ModTime(),
+				Orphan:  !refs[userContentKey(path)],
+			}
+			if f.Orphan {
+				f.OrphanedSince = orphanedSince[path]
+			}
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// references returns the set of keys of user content
+// referenced by issue and change comments, and user avatars.
+func (gc *userContentGC) references(ctx context.Context) (map[string]bool, error) {
+	refs := make(map[string]bool)
+	addRefs := func(body string) {
+		for _, m := range userContentRefRE.FindAllStringSubmatch(body, -1) {
+			refs[m[1]] = true
+		}
+	}
+
+	// Issues and their comments are stored as files, scan them all.
+	err := walkFiles(ctx, gc.issues, "/", func(path string) error {
+		f, err := vfsutil.Open(ctx, gc.issues, path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		addRefs(string(b))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning issues: %v", err)
+	}
+
+	// Uploaded avatars are referenced by user profiles.
+	us, err := gc.profiles.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %v", err)
+	}
+	for _, u := range us {
+		addRefs(u.AvatarURL)
+	}
+
+	// Changes are scanned via the change service, for each code repository.
+	dirs, err := gc.code.ListDirectories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if d.ImportPath != d.RepoRoot {
+			continue
+		}
+		cs, err := gc.changes.List(ctx, d.RepoRoot, change.ListOptions{Filter: change.FilterAll})
+		if err != nil {
+			return nil, fmt.Errorf("listing changes of %s: %v", d.RepoRoot, err)
+		}
+		for _, c := range cs {
+			timeline, err := gc.changes.ListTimeline(ctx, d.RepoRoot, c.ID, nil)
+			if err != nil {
+				return nil, fmt.Errorf("listing timeline of %s/%d: %v", d.RepoRoot, c.ID, err)
+			}
+			for _, item := range timeline {
+				switch item := item.(type) {
+				case change.Comment:
+					addRefs(item.Body)
+				case change.Review:
+					addRefs(item.Body)
+					for _, c := range item.Comments {
+						addRefs(c.Body)
+					}
+				}
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+// walkFiles calls walkFn for each file in the tree rooted at root.
+func walkFiles(ctx context.Context, fs webdav.FileSystem, root string, walkFn func(path string) error) error {
+	fis, err := vfsutil.ReadDir(ctx, fs, root)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		path := pathpkg.Join(root, fi.Name())
+		if fi.IsDir() {
+			err = walkFiles(ctx, fs, path, walkFn)
+		} else {
+			err = walkFn(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes the user content at path, along with its thumbnail or original.
+func (gc *userContentGC) Delete(ctx context.Context, path string) error {
+	if !strings.HasPrefix(path, "/") || path != pathpkg.Clean(path) || strings.Count(path, "/") != 2 {
+		return fmt.Errorf("invalid user content path %q", path)
+	}
+	if _, err := vfsutil.Stat(ctx, gc.content, path); err != nil {
+		return err
+	}
+	key := userContentKey(path)
+	fis, err := vfsutil.ReadDir(ctx, gc.content, pathpkg.Dir(path))
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		p := pathpkg.Join(pathpkg.Dir(path), fi.Name())
+		if fi.IsDir() || userContentKey(p) != key {
+			continue
+		}
+		err := gc.content.RemoveAll(ctx, p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var userContentAdminHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>User Content</title>
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<style type="text/css">
+table {
+	border-collapse: collapse;
+	width: 100%;
+}
+td, th {
+	text-align: left;
+	padding: 4px 8px;
+	border-bottom: 1px solid #eee;
+}
+.orphan {
+	color: #999;
+}
+		</style>
+	</head>
+	<body>
+		<div style="max-width: 800px; margin: 0 auto 100px auto;">`))
+
+var userContentAdminBodyHTML = template.Must(template.New("").Funcs(template.FuncMap{
+	"bytes": func(n int64) string { return humanize.IBytes(uint64(n)) },
+	"time":  humanize.Time,
+}).Parse(`<h1>User Content</h1>
+<form method="post">
+	<input type="hidden" name="action" value="collect">
+	<input type="submit" value="Delete files orphaned for longer than {{.GracePeriod}}">
+</form>
+{{range .Users}}
+<h3>{{.Dir}} &mdash; {{bytes .Total}} in {{len .Files}} files{{with .Orphaned}}, {{bytes .}} orphaned{{end}}</h3>
+<table>
+	{{range .Files}}
+	<tr{{if .Orphan}} class="orphan" title="Not referenced by any comment{{if not .OrphanedSince.IsZero}} since {{time .OrphanedSince}}{{end}}."{{end}}>
+		<td><a href="/usercontent{{.Path}}">{{.Path}}</a></td>
+		<td>{{bytes .Size}}</td>
+		<td>{{time .ModTime}}</td>
+		<td>
+			<form method="post" onsubmit="return confirm('Delete {{.Path}}?');">
+				<input type="hidden" name="action" value="delete">
+				<input type="hidden" name="path" value="{{.Path}}">
+				<input type="submit" value="Delete">
+			</form>
+		</td>
+	</tr>
+	{{end}}
+</table>
+{{else}}
+<p>There is no user content.</p>
+{{end}}`))
+
+// ServeAdmin serves the user content admin page. It shows storage use per user,
+// and allows deleting individual content and collecting orphaned content.
+func (gc *userContentGC) ServeAdmin(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		return httperror.Method{Allowed: []string{http.MethodGet, http.MethodPost}}
+	}
+	authenticatedUser, err := gc.users.GetAuthenticated(req.Context())
+	if err != nil {
+		return err
+	} else if !authenticatedUser.SiteAdmin {
+		return os.ErrPermission
+	}
+
+	if req.Method == http.MethodPost {
+		if err := req.ParseForm(); err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		action, err := getSingleValue(req.PostForm, "action")
+		if err != nil {
+			return httperror.BadRequest{Err: err}
+		}
+		switch action {
+		case "delete":
+			path, err := getSingleValue(req.PostForm, "path")
+			if err != nil {
+				return httperror.BadRequest{Err: err}
+			}
+			err = gc.Delete(req.Context(), path)
+			if err != nil {
+				return err
+			}
+			log.Printf("userContentGC: %v deleted %s\n", authenticatedUser.UserSpec, path)
+		case "collect":
+			deleted, err := gc.Collect(req.Context(), time.Now())
+			for _, f := range deleted {
+				log.Printf("userContentGC: deleted orphaned %s (%d bytes, uploaded %v, orphaned since %v)\n", f.Path, f.Size, f.ModTime, f.OrphanedSince)
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return httperror.BadRequest{Err: fmt.Errorf("unsupported action %q", action)}
+		}
+		return httperror.Redirect{URL: req.URL.Path}
+	}
+
+	files, err := gc.Scan(req.Context())
+	if err != nil {
+		return err
+	}
+	type userUsage struct {
+		Dir      string
+		Total    int64
+		Orphaned int64
+		Files    []userContentFile
+	}
+	var usage []*userUsage
+	byDir := make(map[string]*userUsage)
+	for _, f := range files {
+		dir := pathpkg.Dir(f.Path)
+		u, ok := byDir[dir]
+		if !ok {
+			u = &userUsage{Dir: dir}
+			byDir[dir] = u
+			usage = append(usage, u)
+		}
+		u.Total += f.Size
+		if f.Orphan {
+			u.Orphaned += f.Size
+		}
+		u.Files = append(u.Files, f)
+	}
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Total > usage[j].Total })
+	for _, u := range usage {
+		sort.Slice(u.Files, func(i, j int) bool { return u.Files[i].ModTime.After(u.Files[j].ModTime) })
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = userContentAdminHTML.Execute(w, struct{ AnalyticsHTML template.HTML }{analyticsHTML})
+	if err != nil {
+		return err
+	}
+	nc, err := gc.notification.CountNotifications(req.Context())
+	if err != nil {
+		return err
+	}
+	err = htmlg.RenderComponents(w, component.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	})
+	if err != nil {
+		return err
+	}
+	err = userContentAdminBodyHTML.Execute(w, struct {
+		GracePeriod time.Duration
+		Users       []*userUsage
+	}{gc.gracePeriod, usage})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, `</div>`)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `</body></html>`)
+	return err
+}
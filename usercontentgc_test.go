@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shurcooL/events"
+	codepkg "github.com/shurcooL/home/internal/code"
+	"github.com/shurcooL/home/internal/exp/service/change"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/users"
+	"github.com/shurcooL/webdavfs/vfsutil"
+	"golang.org/x/net/webdav"
+)
+
+func TestUserContentGC(t *testing.T) {
+	const (
+		issueImage  = "/1@example.com/11111111-1111-1111-1111-111111111111.png"
+		issueThumb  = "/1@example.com/11111111-1111-1111-1111-111111111111.thumb.png"
+		changeLog   = "/2@example.com/22222222-2222-2222-2222-222222222222.txt"
+		orphanImage = "/2@example.com/33333333-3333-3333-3333-333333333333.jpg"
+		avatarImage = "/2@example.com/44444444-4444-4444-4444-444444444444.png"
+	)
+	ctx := context.Background()
+	content := webdav.NewMemFS()
+	for _, path := range []string{issueImage, issueThumb, changeLog, orphanImage, avatarImage} {
+		err := vfsutil.MkdirAll(ctx, content, filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = vfsutil.WriteFile(ctx, content, path, []byte("content"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	issueStore := webdav.NewMemFS()
+	err := vfsutil.MkdirAll(ctx, issueStore, "/dmitri.shuralyov.com/blog/issues/1", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vfsutil.WriteFile(ctx, issueStore, "/dmitri.shuralyov.com/blog/issues/1/0",
+		[]byte(`{"Body":"Screenshot:\n\n[![Image](/usercontent`+issueThumb+`)](/usercontent`+issueImage+`)\n"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification := struct{ notification.Service }{} // Mock.
+	events := struct{ events.Service }{}             // Mock.
+	code, err := codepkg.NewService(filepath.Join("internal", "code", "testdata", "repositories"), notification, events, mockUsers{})
+	if err != nil {
+		t.Fatal("code.NewService:", err)
+	}
+	gc := &userContentGC{
+		content: content,
+		issues:  issueStore,
+		changes: mockChanges{
+			"dmitri.shuralyov.com/kebabcase": {change.Comment{Body: "Log is at https://dmitri.shuralyov.com/usercontent" + changeLog + "."}},
+		},
+		code:        code,
+		profiles:    mockUserList{{AvatarURL: "/usercontent" + avatarImage}, {AvatarURL: "https://example.com/avatar.png"}},
+		gracePeriod: time.Hour,
+	}
+
+	files, err := gc.Scan(ctx)
+	if err != nil {
+		t.Fatal("Scan:", err)
+	}
+	var orphans []string
+	for _, f := range files {
+		if f.Orphan {
+			orphans = append(orphans, f.Path)
+		}
+	}
+	if got, want := orphans, []string{orphanImage}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got orphans %q, want %q", got, want)
+	}
+
+	// Orphans within the grace period must not be deleted.
+	deleted, err := gc.Collect(ctx, time.Now())
+	if err != nil {
+		t.Fatal("Collect:", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("got %d deleted files within grace period, want none", len(deleted))
+	}
+
+	// Orphans older than the grace period must be deleted.
+	deleted, err = gc.Collect(ctx, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatal("Collect:", err)
+	}
+	if len(deleted) != 1 || deleted[0].Path != orphanImage {
+		t.Errorf("got deleted files %+v, want only %q", deleted, orphanImage)
+	}
+	if _, err := vfsutil.Stat(ctx, content, orphanImage); err == nil {
+		t.Errorf("orphan %q still exists after Collect", orphanImage)
+	}
+
+	// The grace period starts when a file is first seen as an orphan,
+	// not when it was uploaded.
+	gc.profiles = mockUserList{{AvatarURL: "https://example.com/avatar.png"}}
+	deleted, err = gc.Collect(ctx, time.Now().Add(3*time.Hour))
+	if err != nil {
+		t.Fatal("Collect:", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("got deleted files %+v right after they were orphaned, want none", deleted)
+	}
+	deleted, err = gc.Collect(ctx, time.Now().Add(5*time.Hour))
+	if err != nil {
+		t.Fatal("Collect:", err)
+	}
+	if len(deleted) != 1 || deleted[0].Path != avatarImage {
+		t.Errorf("got deleted files %+v, want only %q", deleted, avatarImage)
+	}
+
+	// Deleting an image must delete its thumbnail too.
+	err = gc.Delete(ctx, issueImage)
+	if err != nil {
+		t.Fatal("Delete:", err)
+	}
+	files, err = gc.Scan(ctx)
+	if err != nil {
+		t.Fatal("Scan:", err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	if got, want := paths, []string{changeLog}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got remaining files %q, want %q", got, want)
+	}
+}
+
+// mockUserList implements userLister.
+type mockUserList []users.User
+
+func (m mockUserList) List(context.Context) ([]users.User, error) { return m, nil }
+
+// mockChanges is a change.Service where each repository
+// has a single change with the given timeline.
+type mockChanges map[string][]interface{}
+
+func (mockChanges) List(context.Context, string, change.ListOptions) ([]change.Change, error) {
+	return []change.Change{{ID: 1}}, nil
+}
+func (mockChanges) Count(context.Context, string, change.ListOptions) (uint64, error) {
+	panic("not implemented")
+}
+func (mockChanges) Get(context.Context, string, uint64) (change.Change, error) {
+	panic("not implemented")
+}
+func (m mockChanges) ListTimeline(_ context.Context, repo string, _ uint64, _ *change.ListTimelineOptions) ([]interface{}, error) {
+	return m[repo], nil
+}
+func (mockChanges) ListCommits(context.Context, string, uint64) ([]change.Commit, error) {
+	panic("not implemented")
+}
+func (mockChanges) GetDiff(context.Context, string, uint64, *change.GetDiffOptions) ([]byte, error) {
+	panic("not implemented")
+}
+func (mockChanges) EditComment(context.Context, string, uint64, change.CommentRequest) (change.Comment, error) {
+	panic("not implemented")
+}
+func (mockChanges) ThreadType(context.Context, string) (string, error) {
+	panic("not implemented")
+}
@@ -13,7 +13,10 @@ import (
 	githubv3 "github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
 	"github.com/shurcooL/githubv4"
+	"github.com/shurcooL/home/httphandler"
+	"github.com/shurcooL/home/internal/code"
 	"github.com/shurcooL/home/internal/exp/service/user/fs"
+	"github.com/shurcooL/httperror"
 	"github.com/shurcooL/users"
 	"golang.org/x/net/webdav"
 	"golang.org/x/oauth2"
@@ -82,10 +85,10 @@ type userCreator interface {
 	InsertByCanonicalMe(ctx context.Context, user users.User) (users.User, error)
 }
 
-func newUsersService(root webdav.FileSystem) (users.Service, userCreator, error) {
+func newUsersService(root webdav.FileSystem) (Users, userCreator, error) {
 	s, err := fs.NewStore(root)
 	if err != nil {
-		return nil, nil, err
+		return Users{}, nil, err
 	}
 	return Users{store: s}, s, nil
 }
@@ -99,6 +102,11 @@ func (u Users) Get(ctx context.Context, user users.UserSpec) (users.User, error)
 	return u.store.Get(ctx, user)
 }
 
+// List lists all users, in no particular order.
+func (u Users) List(ctx context.Context) ([]users.User, error) {
+	return u.store.List(ctx)
+}
+
 func (Users) GetAuthenticatedSpec(ctx context.Context) (users.UserSpec, error) {
 	s, ok := ctx.Value(sessionContextKey).(*session)
 	if !ok {
@@ -121,10 +129,108 @@ func (u Users) GetAuthenticated(ctx context.Context) (users.User, error) {
 	return u.Get(ctx, userSpec)
 }
 
+// Edit is not implemented, since users.EditRequest has no editable fields.
+// Use EditProfile to edit profile fields.
 func (Users) Edit(ctx context.Context, er users.EditRequest) (users.User, error) {
 	return users.User{}, errors.New("Edit is not implemented")
 }
 
+// EditProfile edits the profile of the authenticated user.
+// It returns an error of type fs.InvalidEditError if er is invalid.
+func (u Users) EditProfile(ctx context.Context, er fs.EditRequest) (users.User, error) {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return users.User{}, err
+	}
+	return u.store.Edit(ctx, userSpec, er)
+}
+
+// editProfileAPI is EditProfile for use by the users API handler.
+func (u Users) editProfileAPI(ctx context.Context, er httphandler.EditProfileRequest) (users.User, error) {
+	user, err := u.EditProfile(ctx, fs.EditRequest(er))
+	if e := (fs.InvalidEditError{}); errors.As(err, &e) {
+		return users.User{}, httperror.BadRequest{Err: err}
+	}
+	return user, err
+}
+
+// ListEmails lists additional email addresses of the authenticated user.
+func (u Users) ListEmails(ctx context.Context) ([]fs.Email, error) {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.store.ListEmails(ctx, userSpec)
+}
+
+// AddEmail adds an unverified email address to the authenticated user,
+// and returns a token that verifies it.
+func (u Users) AddEmail(ctx context.Context, address string) (token string, err error) {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return u.store.AddEmail(ctx, userSpec, address)
+}
+
+// VerifyEmail verifies an email address of the authenticated user.
+func (u Users) VerifyEmail(ctx context.Context, token string) (fs.Email, error) {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return fs.Email{}, err
+	}
+	return u.store.VerifyEmail(ctx, userSpec, token)
+}
+
+// RemoveEmail removes an email address from the authenticated user.
+func (u Users) RemoveEmail(ctx context.Context, address string) error {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return err
+	}
+	return u.store.RemoveEmail(ctx, userSpec, address)
+}
+
+// ListSigningKeys lists signing keys of the authenticated user.
+func (u Users) ListSigningKeys(ctx context.Context) ([]fs.SigningKey, error) {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.store.ListSigningKeys(ctx, userSpec)
+}
+
+// AddSigningKey adds a signing key to the authenticated user.
+func (u Users) AddSigningKey(ctx context.Context, key fs.SigningKey) error {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return err
+	}
+	return u.store.AddSigningKey(ctx, userSpec, key)
+}
+
+// RemoveSigningKey removes a signing key from the authenticated user.
+func (u Users) RemoveSigningKey(ctx context.Context, fingerprint string) error {
+	userSpec, err := u.authenticatedSpec(ctx)
+	if err != nil {
+		return err
+	}
+	return u.store.RemoveSigningKey(ctx, userSpec, fingerprint)
+}
+
+// authenticatedSpec returns the authenticated user,
+// or os.ErrPermission if there isn't one.
+func (u Users) authenticatedSpec(ctx context.Context) (users.UserSpec, error) {
+	userSpec, err := u.GetAuthenticatedSpec(ctx)
+	if err != nil {
+		return users.UserSpec{}, err
+	}
+	if userSpec.ID == 0 {
+		return users.UserSpec{}, os.ErrPermission
+	}
+	return userSpec, nil
+}
+
 // sessionContextKey is a context key. It can be used to access the session
 // that the context is tied to. The associated value will be of type *session.
 var sessionContextKey = &contextKey{"session"}
@@ -133,17 +239,73 @@ func withSession(req *http.Request, s *session) *http.Request {
 	return req.WithContext(context.WithValue(req.Context(), sessionContextKey, s))
 }
 
-func initGitUsers(usersService users.Service) (gitUsers map[string]users.User, err error) {
-	// TODO: Add support for additional git users.
-	gitUsers = make(map[string]users.User) // Key is lower git author email.
-	dmitshur, err := usersService.Get(context.Background(), dmitshur)
+// gitUsers maps git commit author emails to users.
+// It implements code.GitUsers and code.SigningKeys.
+//
+// Users are looked up by email addresses they've verified
+// in the user store, so changes to verified emails and user
+// profiles take effect right away.
+type gitUsers struct {
+	store *fs.Store
+
+	// static maps additional emails (key is lower git author email)
+	// to users, for emails that aren't verified in the user store.
+	static map[string]users.UserSpec
+}
+
+func initGitUsers(u Users) (gitUsers, error) {
+	g := gitUsers{store: u.store, static: make(map[string]users.UserSpec)}
+	dmitshurUser, err := u.Get(context.Background(), dmitshur)
 	if os.IsNotExist(err) {
 		log.Printf("initGitUsers: dmitshur user does not exist: %v", err)
-		return gitUsers, nil
+		return g, nil
 	} else if err != nil {
-		return nil, err
+		return gitUsers{}, err
+	}
+	g.static[strings.ToLower(dmitshurUser.Email)] = dmitshur
+	g.static[strings.ToLower("shurcooL@gmail.com")] = dmitshur // Previous email.
+	return g, nil
+}
+
+// GitUser implements code.GitUsers.
+func (g gitUsers) GitUser(email string) (users.User, bool) {
+	user, err := g.store.GetByVerifiedEmail(context.Background(), email)
+	if err == nil {
+		return user, true
+	}
+	us, ok := g.static[strings.ToLower(email)]
+	if !ok {
+		return users.User{}, false
+	}
+	user, err = g.store.Get(context.Background(), us)
+	return user, err == nil
+}
+
+// SigningKeys implements code.SigningKeys.
+// Like in GitUser, static emails are used for
+// emails that aren't verified in the user store.
+func (g gitUsers) SigningKeys() map[string][]code.SigningKey {
+	keys := make(map[string][]code.SigningKey)
+	for email, ks := range g.store.ListSigningKeysByVerifiedEmail(context.Background()) {
+		keys[email] = signingKeys(ks)
+	}
+	for email, us := range g.static {
+		if _, err := g.store.GetByVerifiedEmail(context.Background(), email); err == nil {
+			continue
+		}
+		ks, err := g.store.ListSigningKeys(context.Background(), us)
+		if err != nil || len(ks) == 0 {
+			continue
+		}
+		keys[email] = signingKeys(ks)
+	}
+	return keys
+}
+
+func signingKeys(ks []fs.SigningKey) []code.SigningKey {
+	keys := make([]code.SigningKey, len(ks))
+	for i, k := range ks {
+		keys[i] = code.SigningKey(k)
 	}
-	gitUsers[strings.ToLower(dmitshur.Email)] = dmitshur
-	gitUsers[strings.ToLower("shurcooL@gmail.com")] = dmitshur // Previous email.
-	return gitUsers, nil
+	return keys
 }
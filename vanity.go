@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/shurcooL/home/component"
+	"github.com/shurcooL/home/httputil"
+	"github.com/shurcooL/home/internal/exp/service/notification"
+	"github.com/shurcooL/home/internal/route"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/httperror"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+)
+
+// vanityImport configures a vanity import path prefix
+// whose code is hosted elsewhere.
+type vanityImport struct {
+	Prefix  string // Import path prefix corresponding to the repository root. E.g., "dmitri.shuralyov.com/foo".
+	VCS     string // Version control system. E.g., "git".
+	RepoURL string // Repository URL. E.g., "https://example.org/user/foo".
+
+	// SourceDir and SourceFile are optional URL templates
+	// for the go-source meta tag, using its {dir}, {/dir},
+	// {file} and {line} substitutions.
+	// E.g., "https://example.org/user/foo/tree/master{/dir}"
+	// and "https://example.org/user/foo/blob/master{/dir}/{file}#L{line}".
+	SourceDir  string
+	SourceFile string
+}
+
+// loadVanityImports loads vanity imports from the JSON file at path.
+func loadVanityImports(path string) ([]vanityImport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var imports []vanityImport
+	err = json.Unmarshal(b, &imports)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range imports {
+		if !strings.HasPrefix(v.Prefix, "dmitri.shuralyov.com/") || strings.HasSuffix(v.Prefix, "/") {
+			return nil, fmt.Errorf("vanity import prefix %q is not a path beneath dmitri.shuralyov.com", v.Prefix)
+		}
+		switch v.VCS {
+		case "git", "hg", "svn", "bzr", "fossil", "mod":
+		default:
+			return nil, fmt.Errorf("vanity import %q has unsupported VCS %q", v.Prefix, v.VCS)
+		}
+		if v.RepoURL == "" {
+			return nil, fmt.Errorf("vanity import %q has no repository URL", v.Prefix)
+		}
+		if (v.SourceDir == "") != (v.SourceFile == "") {
+			return nil, fmt.Errorf("vanity import %q must have both or neither of source directory and file URL templates", v.Prefix)
+		}
+	}
+	return imports, nil
+}
+
+// lookUpVanityImport returns the vanity import with the longest prefix
+// that matches importPath, if any.
+func lookUpVanityImport(imports []vanityImport, importPath string) (vanityImport, bool) {
+	var (
+		found vanityImport
+		ok    bool
+	)
+	for _, v := range imports {
+		if importPath != v.Prefix && !strings.HasPrefix(importPath, v.Prefix+"/") {
+			continue
+		}
+		if !ok || len(v.Prefix) > len(found.Prefix) {
+			found, ok = v, true
+		}
+	}
+	return found, ok
+}
+
+// MetaTags returns the go-import and go-source meta tags for v.
+func (v vanityImport) MetaTags() string {
+	tags := fmt.Sprintf(`<meta name="go-import" content="%s">`, html.EscapeString(v.Prefix+" "+v.VCS+" "+v.RepoURL))
+	if v.SourceDir != "" {
+		tags += fmt.Sprintf("\n"+`<meta name="go-source" content="%s">`, html.EscapeString(v.Prefix+" "+v.RepoURL+" "+v.SourceDir+" "+v.SourceFile))
+	}
+	return tags
+}
+
+var vanityHTML = template.Must(template.New("").Parse(`<html>
+	<head>
+{{.AnalyticsHTML}}		<title>{{.ImportPath}}</title>
+		{{.MetaTags}}
+		<link href="/icon.svg" rel="icon" type="image/svg+xml">
+		<meta name="viewport" content="width=device-width">
+		<link href="/assets/fonts/fonts.css" rel="stylesheet" type="text/css">
+		<link href="/assets/package/style.css" rel="stylesheet" type="text/css">
+	</head>
+	<body>`))
+
+// vanityHandler serves go-import and go-source meta tags for
+// vanity import paths whose code is hosted elsewhere, and a landing
+// page that links to the documentation for humans visiting them.
+type vanityHandler struct {
+	imports      []vanityImport
+	notification notification.Service
+	users        users.Service
+}
+
+func (h *vanityHandler) ServeVanityMaybe(w http.ResponseWriter, req *http.Request) (ok bool) {
+	if route.HasImportPathSeparator(req.URL.Path) || strings.Contains(req.URL.Path, "...") {
+		return false
+	}
+	importPath := "dmitri.shuralyov.com" + req.URL.Path
+	v, ok := lookUpVanityImport(h.imports, importPath)
+	if !ok {
+		return false
+	}
+
+	// Handle ?go-get=1 requests, serve a go-import meta tag page.
+	if req.URL.Query().Get("go-get") == "1" {
+		if err := httputil.AllowMethods(req, http.MethodGet, http.MethodHead); err != nil {
+			httperror.HandleMethod(w, err.(httperror.Method))
+			return true
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if req.Method == http.MethodHead {
+			return true
+		}
+		metrics.IncGoGetRequestsTotal(importPath)
+		io.WriteString(w, v.MetaTags())
+		return true
+	}
+
+	landing := cookieAuth{httputil.ErrorHandler(h.users, func(w http.ResponseWriter, req *http.Request) error {
+		return h.serveLandingPage(w, req, importPath, v)
+	})}
+	landing.ServeHTTP(w, req)
+	return true
+}
+
+// serveLandingPage serves a page for humans visiting
+// the vanity import path importPath.
+func (h *vanityHandler) serveLandingPage(w http.ResponseWriter, req *http.Request, importPath string, v vanityImport) error {
+	if err := httputil.AllowMethods(req, http.MethodGet); err != nil {
+		return err
+	}
+
+	authenticatedUser, err := h.users.GetAuthenticated(req.Context())
+	if err != nil {
+		log.Println(err)
+		authenticatedUser = users.User{} // THINK: Should it be a fatal error or not? What about on frontend vs backend?
+	}
+	var nc uint64
+	if authenticatedUser.ID != 0 {
+		nc, err = h.notification.CountNotifications(req.Context())
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err = vanityHTML.Execute(w, struct {
+		AnalyticsHTML template.HTML
+		ImportPath    string
+		MetaTags      template.HTML
+	}{
+		AnalyticsHTML: analyticsHTML,
+		ImportPath:    importPath,
+		MetaTags:      template.HTML(v.MetaTags()),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, `<div style="max-width: 800px; margin: 0 auto 100px auto;">`)
+	if err != nil {
+		return err
+	}
+
+	// Render the header.
+	header := component.Header{
+		CurrentUser:       authenticatedUser,
+		NotificationCount: nc,
+		ReturnURL:         req.RequestURI,
+	}
+	err = htmlg.RenderComponents(w, header)
+	if err != nil {
+		return err
+	}
+
+	err = html.Render(w, htmlg.H2(htmlg.Text(importPath)))
+	if err != nil {
+		return err
+	}
+	for _, n := range []*html.Node{
+		htmlg.P(htmlg.Text("The source code of this package is hosted at "), htmlg.A(v.RepoURL, v.RepoURL), htmlg.Text(".")),
+		htmlg.H3(htmlg.A("Documentation", "https://pkg.go.dev/"+importPath)),
+		htmlg.H3(htmlg.A("Code", v.RepoURL)),
+	} {
+		err = html.Render(w, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w, `</div>
+	</body>
+</html>`)
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLookUpVanityImport(t *testing.T) {
+	imports := []vanityImport{
+		{Prefix: "dmitri.shuralyov.com/foo", VCS: "git", RepoURL: "https://example.org/foo"},
+		{Prefix: "dmitri.shuralyov.com/foo/v2", VCS: "git", RepoURL: "https://example.org/foo-v2"},
+	}
+	for _, tt := range []struct {
+		importPath string
+		wantOK     bool
+		wantPrefix string
+	}{
+		{"dmitri.shuralyov.com/foo", true, "dmitri.shuralyov.com/foo"},
+		{"dmitri.shuralyov.com/foo/bar", true, "dmitri.shuralyov.com/foo"},
+		{"dmitri.shuralyov.com/foo/v2/bar", true, "dmitri.shuralyov.com/foo/v2"},
+		{"dmitri.shuralyov.com/foobar", false, ""},
+		{"dmitri.shuralyov.com/other", false, ""},
+	} {
+		v, ok := lookUpVanityImport(imports, tt.importPath)
+		if ok != tt.wantOK || v.Prefix != tt.wantPrefix {
+			t.Errorf("lookUpVanityImport(%q): got %q, %v, want %q, %v", tt.importPath, v.Prefix, ok, tt.wantPrefix, tt.wantOK)
+		}
+	}
+}
+
+func TestVanityImportMetaTags(t *testing.T) {
+	v := vanityImport{
+		Prefix:     "dmitri.shuralyov.com/foo",
+		VCS:        "git",
+		RepoURL:    "https://example.org/foo",
+		SourceDir:  "https://example.org/foo/tree/master{/dir}",
+		SourceFile: "https://example.org/foo/blob/master{/dir}/{file}#L{line}",
+	}
+	got := v.MetaTags()
+	want := `<meta name="go-import" content="dmitri.shuralyov.com/foo git https://example.org/foo">
+<meta name="go-source" content="dmitri.shuralyov.com/foo https://example.org/foo https://example.org/foo/tree/master{/dir} https://example.org/foo/blob/master{/dir}/{file}#L{line}">`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	v.SourceDir, v.SourceFile = "", ""
+	got = v.MetaTags()
+	want = `<meta name="go-import" content="dmitri.shuralyov.com/foo git https://example.org/foo">`
+	if got != want {
+		t.Errorf("without go-source: got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLoadVanityImports(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		json    string
+		wantErr bool
+	}{
+		{"valid", `[{"Prefix": "dmitri.shuralyov.com/foo", "VCS": "git", "RepoURL": "https://example.org/foo"}]`, false},
+		{"other domain", `[{"Prefix": "example.org/foo", "VCS": "git", "RepoURL": "https://example.org/foo"}]`, true},
+		{"bad VCS", `[{"Prefix": "dmitri.shuralyov.com/foo", "VCS": "cvs", "RepoURL": "https://example.org/foo"}]`, true},
+		{"no repo URL", `[{"Prefix": "dmitri.shuralyov.com/foo", "VCS": "git"}]`, true},
+		{"half source", `[{"Prefix": "dmitri.shuralyov.com/foo", "VCS": "git", "RepoURL": "https://example.org/foo", "SourceDir": "https://example.org/foo{/dir}"}]`, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "vanity.json")
+			err := ioutil.WriteFile(path, []byte(tt.json), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = loadVanityImports(path)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Test that ?go-get=1 requests for vanity import paths are counted.
+func TestVanityGoGetRequestsCounted(t *testing.T) {
+	h := &vanityHandler{
+		imports: []vanityImport{{Prefix: "dmitri.shuralyov.com/counted", VCS: "git", RepoURL: "https://example.org/counted"}},
+	}
+	before := metrics.GoGetRequestsWithin("dmitri.shuralyov.com/counted")
+	req := httptest.NewRequest(http.MethodGet, "/counted/sub?go-get=1", nil)
+	rr := httptest.NewRecorder()
+	if ok := h.ServeVanityMaybe(rr, req); !ok {
+		t.Fatal("ServeVanityMaybe: got ok false, want true")
+	}
+	if got, want := metrics.GoGetRequestsWithin("dmitri.shuralyov.com/counted"), before+1; got != want {
+		t.Errorf("got %d go-get requests, want %d", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shurcooL/home/internal/code"
+	issues "github.com/shurcooL/home/internal/exp/service/issue"
+	"github.com/shurcooL/htmlg"
+	"github.com/shurcooL/users"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// vulnBadge displays known vulnerabilities in dependencies.
+type vulnBadge struct {
+	Findings []code.Finding // At least one.
+}
+
+func (b vulnBadge) Render() []*html.Node {
+	text := fmt.Sprintf("%d known vulnerabilities in dependencies", len(b.Findings))
+	if len(b.Findings) == 1 {
+		text = "1 known vulnerability in dependencies"
+	}
+	badge := htmlg.Span(htmlg.Text(text))
+	badge.Attr = append(badge.Attr, html.Attribute{Key: atom.Style.String(), Val: "display: inline-block; padding: 2px 6px; border-radius: 3px; color: #fff; background-color: #bd2c00; font-size: 12px; font-weight: bold;"})
+	var items []*html.Node
+	for _, f := range b.Findings {
+		li := htmlg.LI(
+			htmlg.A(f.ID, "https://pkg.go.dev/vuln/"+f.ID),
+			htmlg.Text(fmt.Sprintf(": %s (%s %s", f.Summary, f.Module, f.Version)),
+		)
+		if f.Fixed != "" {
+			li.AppendChild(htmlg.Text(", fixed in " + f.Fixed))
+		}
+		if f.Unconfirmed {
+			li.AppendChild(htmlg.Text("; package use not confirmed"))
+		}
+		li.AppendChild(htmlg.Text(")"))
+		items = append(items, li)
+	}
+	div := htmlg.Div(badge, htmlg.UL(items...))
+	div.Attr = append(div.Attr, html.Attribute{Key: atom.Style.String(), Val: "margin-top: 10px; margin-bottom: 10px;"})
+	return []*html.Node{div}
+}
+
+// packageFindings returns findings that affect the package
+// in directory d, out of findings in its repository.
+func packageFindings(findings []code.Finding, d *code.Directory) []code.Finding {
+	var fs []code.Finding
+	for _, f := range findings {
+		if len(f.Packages) == 0 && f.Requirer == d.Module() {
+			fs = append(fs, f)
+			continue
+		}
+		for _, p := range f.Packages {
+			if p == d.ImportPath {
+				fs = append(fs, f)
+				break
+			}
+		}
+	}
+	return fs
+}
+
+// newVulnIssueFiler returns a function that files findings as issues
+// in the repository's issue tracker on behalf of author, unless an issue
+// for the same vulnerability and module already exists.
+func newVulnIssueFiler(service issues.Service, author users.UserSpec) func(context.Context, string, code.Finding) error {
+	return func(ctx context.Context, repoRoot string, f code.Finding) error {
+		ctx = context.WithValue(ctx, sessionContextKey, &session{UserSpec: author})
+		repo := issues.RepoSpec{URI: repoRoot}
+		title := fmt.Sprintf("%s: vulnerability in dependency %s", f.ID, f.Module)
+		is, err := service.List(ctx, repo, issues.IssueListOptions{State: issues.AllStates})
+		if err != nil {
+			return err
+		}
+		for _, i := range is {
+			if i.Title == title {
+				// Already filed.
+				return nil
+			}
+		}
+		var body strings.Builder
+		fmt.Fprintf(&body, "%s\n\n", f.Summary)
+		fmt.Fprintf(&body, "Module %s requires %s %s, which is affected by https://pkg.go.dev/vuln/%s.\n", f.Requirer, f.Module, f.Version, f.ID)
+		if f.Fixed != "" {
+			fmt.Fprintf(&body, "It's fixed in %s.\n", f.Fixed)
+		}
+		if f.Unconfirmed {
+			fmt.Fprintf(&body, "\nNo package of %s was found to use the vulnerable packages directly, but they may be used through another dependency.\n", f.Requirer)
+		}
+		if len(f.Packages) > 0 {
+			fmt.Fprintf(&body, "\nAffected packages:\n\n")
+			for _, p := range f.Packages {
+				fmt.Fprintf(&body, "- %s\n", p)
+			}
+		}
+		_, err = service.Create(ctx, repo, issues.Issue{
+			Title:   title,
+			Comment: issues.Comment{Body: body.String()},
+		})
+		return err
+	}
+}